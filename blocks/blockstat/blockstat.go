@@ -0,0 +1,623 @@
+// Package blockstat keeps running counts of the blocks in a blockstore, so
+// that reporting them doesn't need to walk the whole blockstore.
+//
+// Counts are updated as blocks are put and deleted, persisted in the repo
+// datastore and reconciled with the content of the blockstore by scanning it
+// in the background.
+package blockstat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipsn/go-ipfs/filestore"
+
+	cid "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-cid"
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	bstore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-blockstore"
+	logging "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("blockstat")
+
+var countsKey = ds.NewKey("/local/blockstat")
+
+var (
+	// FlushInterval is how often changed counts are persisted.
+	FlushInterval = time.Minute
+	// ReconcileInterval is how often Run reconciles the counts with the
+	// blockstore.
+	ReconcileInterval = 24 * time.Hour
+	// RetryInterval is how long Run waits before reconciling again after a
+	// failed or interrupted reconciliation.
+	RetryInterval = 10 * time.Minute
+	// PinnedRecountDelay is how long Run waits after pins change before
+	// recounting the pinned blocks, so that changes made in a row are
+	// recounted once.
+	PinnedRecountDelay = 10 * time.Second
+)
+
+// ErrInterrupted is returned by Reconcile when blocks were deleted while it
+// was scanning the blockstore. The counts are left as they were.
+var ErrInterrupted = errors.New("blocks were deleted while counting them")
+
+// Totals counts blocks and their size.
+type Totals struct {
+	Blocks uint64
+	Bytes  uint64
+}
+
+func (t *Totals) add(size uint64) {
+	t.Blocks++
+	t.Bytes += size
+}
+
+func (t *Totals) sub(size uint64) {
+	// Counts of blocks put before the counts were last reconciled may be
+	// off, don't let them wrap around.
+	if t.Blocks > 0 {
+		t.Blocks--
+	}
+	if t.Bytes > size {
+		t.Bytes -= size
+	} else {
+		t.Bytes = 0
+	}
+}
+
+func (t *Totals) plus(o Totals) {
+	t.Blocks += o.Blocks
+	t.Bytes += o.Bytes
+}
+
+// Stat breaks the blocks of a blockstore down by type.
+type Stat struct {
+	Totals
+	// ByCodec counts blocks by the codec of their CID.
+	ByCodec map[string]Totals
+	// Regular counts the blocks stored in the blockstore, Filestore the
+	// ones referencing files or URLs.
+	Regular   Totals
+	Filestore Totals
+	// Pinned and Unpinned are as of the last time the pinned blocks were
+	// counted, blocks pinned since then are counted as unpinned.
+	Pinned   Totals
+	Unpinned Totals
+	// Reconciled is when the counts were last reconciled with the
+	// blockstore, the zero time if they never were.
+	Reconciled time.Time
+	// Approximate is set when the counts may not match the blockstore,
+	// until they are reconciled or the pinned blocks are recounted.
+	Approximate bool `json:",omitempty"`
+}
+
+// Options configure a Counter.
+type Options struct {
+	// Pinned returns the set of pinned blocks, it's used to count pinned
+	// blocks when reconciling.
+	Pinned func(ctx context.Context) (*cid.Set, error)
+}
+
+type class struct {
+	Codec     string
+	Filestore bool
+}
+
+func classOf(c cid.Cid, fstore bool) class {
+	codec, ok := cid.CodecToStr[c.Type()]
+	if !ok {
+		codec = fmt.Sprintf("0x%x", c.Type())
+	}
+	return class{Codec: codec, Filestore: fstore}
+}
+
+type entry struct {
+	class class
+	size  uint64
+}
+
+// source is a part of the blockstore scanned by Reconcile.
+type source struct {
+	allKeys   func(ctx context.Context) (<-chan cid.Cid, error)
+	getSize   func(c cid.Cid) (int, error)
+	filestore bool
+}
+
+// Counter counts the blocks put into and deleted from the blockstores it
+// wraps.
+type Counter struct {
+	d    ds.Datastore
+	opts Options
+
+	mu         sync.Mutex
+	counts     map[class]Totals
+	pinned     Totals
+	reconciled time.Time
+	accurate   bool
+	dirty      bool
+	closed     bool
+	sources    []source
+
+	// pinsChanged is set when pins changed since the pinned blocks were
+	// counted, and signaled on pinsSignal for Run to recount them. pinsGen
+	// counts the changes, so that a count only clears the changes it saw.
+	pinsChanged bool
+	pinsGen     uint64
+	pinsSignal  chan struct{}
+
+	// ctx is canceled on Close to stop background reconciliations, and
+	// reconciling is set while one runs.
+	ctx         context.Context
+	cancel      context.CancelFunc
+	reconciling bool
+
+	// Blocks put while scanning, and whether any were deleted.
+	scanning    bool
+	touched     map[string]entry
+	interrupted bool
+
+	scanMu sync.Mutex
+}
+
+// record is how counts are persisted.
+type record struct {
+	Counts     []recordCounts
+	Pinned     Totals
+	Reconciled time.Time
+	// PinsChanged is set when pins changed since the pinned blocks were
+	// counted.
+	PinsChanged bool `json:",omitempty"`
+	// Clean is set when the counts were persisted on Close, and were
+	// therefore up to date.
+	Clean bool
+}
+
+type recordCounts struct {
+	class
+	Totals
+}
+
+// New returns a Counter persisting its counts in d. Counts persisted by a
+// previous Counter are loaded; they are accurate if it was closed and the
+// blockstore was reconciled at least once.
+func New(d ds.Datastore, opts Options) (*Counter, error) {
+	c := &Counter{
+		d:          d,
+		opts:       opts,
+		counts:     make(map[class]Totals),
+		pinsSignal: make(chan struct{}, 1),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	data, err := d.Get(countsKey)
+	switch err {
+	case nil:
+		var r record
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, fmt.Errorf("reading block counts: %s", err)
+		}
+		for _, rc := range r.Counts {
+			c.counts[rc.class] = rc.Totals
+		}
+		c.pinned = r.Pinned
+		c.reconciled = r.Reconciled
+		c.accurate = r.Clean && !r.Reconciled.IsZero()
+		c.pinsChanged = r.PinsChanged
+	case ds.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	// Until closed, the persisted counts may miss the latest changes.
+	if err := c.flush(false); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Accurate returns whether the counts match the content of the blockstore.
+// They don't when the blockstore was never reconciled, or when the counts
+// weren't persisted on close the last time.
+func (c *Counter) Accurate() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.accurate
+}
+
+// Stat returns the current counts.
+func (c *Counter) Stat() Stat {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := Stat{
+		ByCodec:     make(map[string]Totals),
+		Pinned:      c.pinned,
+		Reconciled:  c.reconciled,
+		Approximate: !c.accurate || c.pinsChanged,
+	}
+	for cl, t := range c.counts {
+		s.Totals.plus(t)
+		byCodec := s.ByCodec[cl.Codec]
+		byCodec.plus(t)
+		s.ByCodec[cl.Codec] = byCodec
+		if cl.Filestore {
+			s.Filestore.plus(t)
+		} else {
+			s.Regular.plus(t)
+		}
+	}
+	if s.Pinned.Blocks > s.Blocks {
+		s.Pinned.Blocks = s.Blocks
+	}
+	if s.Pinned.Bytes > s.Bytes {
+		s.Pinned.Bytes = s.Bytes
+	}
+	s.Unpinned = Totals{Blocks: s.Blocks - s.Pinned.Blocks, Bytes: s.Bytes - s.Pinned.Bytes}
+	return s
+}
+
+func (c *Counter) add(k cid.Cid, fstore bool, size uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cl := classOf(k, fstore)
+	t := c.counts[cl]
+	t.add(size)
+	c.counts[cl] = t
+	c.dirty = true
+	if c.scanning {
+		c.touched[k.KeyString()] = entry{cl, size}
+	}
+}
+
+func (c *Counter) remove(k cid.Cid, fstore bool, size uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cl := classOf(k, fstore)
+	t := c.counts[cl]
+	t.sub(size)
+	if t.Blocks == 0 {
+		delete(c.counts, cl)
+	} else {
+		c.counts[cl] = t
+	}
+	c.dirty = true
+	if c.scanning {
+		// The scan may have counted the block already.
+		c.interrupted = true
+	}
+}
+
+// flush persists the counts, marking them clean if closing.
+func (c *Counter) flush(closing bool) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	r := record{
+		Pinned:      c.pinned,
+		Reconciled:  c.reconciled,
+		PinsChanged: c.pinsChanged,
+		Clean:       closing,
+	}
+	for cl, t := range c.counts {
+		r.Counts = append(r.Counts, recordCounts{cl, t})
+	}
+	c.dirty = false
+	c.closed = closing
+	c.mu.Unlock()
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return c.d.Put(countsKey, data)
+}
+
+// Reconcile scans the blockstore and replaces the counts with what it found.
+// Blocks may be put while it runs, but if any are deleted, it returns
+// ErrInterrupted and leaves the counts as they were.
+func (c *Counter) Reconcile(ctx context.Context) error {
+	c.scanMu.Lock()
+	defer c.scanMu.Unlock()
+
+	pinned, gen, err := c.listPinned(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.scanning = true
+	c.touched = make(map[string]entry)
+	c.interrupted = false
+	sources := c.sources
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.scanning = false
+		c.touched = nil
+		c.mu.Unlock()
+	}()
+
+	start := time.Now()
+	counts := make(map[class]Totals)
+	var pinnedTotals Totals
+	count := func(k cid.Cid, cl class, size uint64) {
+		t := counts[cl]
+		t.add(size)
+		counts[cl] = t
+		if pinned.Has(k) {
+			pinnedTotals.add(size)
+		}
+	}
+
+	for _, s := range sources {
+		keys, err := s.allKeys(ctx)
+		if err != nil {
+			return err
+		}
+		for k := range keys {
+			// Blocks put since the scan started are counted below.
+			c.mu.Lock()
+			_, touched := c.touched[k.KeyString()]
+			c.mu.Unlock()
+			if touched {
+				continue
+			}
+
+			size, err := s.getSize(k)
+			if err == bstore.ErrNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			count(k, classOf(k, s.filestore), uint64(size))
+		}
+		// AllKeysChan closes its channel when the context is done.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	if c.interrupted {
+		c.mu.Unlock()
+		return ErrInterrupted
+	}
+	for k, e := range c.touched {
+		t := counts[e.class]
+		t.add(e.size)
+		counts[e.class] = t
+		if kc, err := cid.Cast([]byte(k)); err == nil && pinned.Has(kc) {
+			pinnedTotals.add(e.size)
+		}
+	}
+	c.counts = counts
+	c.setPinned(pinnedTotals, gen)
+	c.reconciled = time.Now()
+	c.accurate = true
+	c.mu.Unlock()
+
+	log.Infof("reconciled block counts in %s", time.Since(start))
+	return c.flush(false)
+}
+
+// listPinned returns the set of pinned blocks, and the count of pin changes
+// it includes.
+func (c *Counter) listPinned(ctx context.Context) (*cid.Set, uint64, error) {
+	c.mu.Lock()
+	gen := c.pinsGen
+	c.mu.Unlock()
+
+	if c.opts.Pinned == nil {
+		return cid.NewSet(), gen, nil
+	}
+	pinned, err := c.opts.Pinned(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("listing pinned blocks: %s", err)
+	}
+	return pinned, gen, nil
+}
+
+// setPinned sets the pinned totals counted from the pins as of gen. It must
+// be called with mu held.
+func (c *Counter) setPinned(t Totals, gen uint64) {
+	c.pinned = t
+	if c.pinsGen == gen {
+		c.pinsChanged = false
+	}
+	c.dirty = true
+}
+
+// PinsChanged marks the pinned blocks as changed, to be recounted by Run.
+// It's called when pins are changed and after garbage collection.
+func (c *Counter) PinsChanged() {
+	c.mu.Lock()
+	c.pinsChanged = true
+	c.pinsGen++
+	c.dirty = true
+	c.mu.Unlock()
+
+	select {
+	case c.pinsSignal <- struct{}{}:
+	default:
+	}
+}
+
+// RecountPinned counts the pinned blocks again, without scanning the rest of
+// the blockstore.
+func (c *Counter) RecountPinned(ctx context.Context) error {
+	c.scanMu.Lock()
+	defer c.scanMu.Unlock()
+
+	pinned, gen, err := c.listPinned(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	sources := c.sources
+	c.mu.Unlock()
+
+	var pinnedTotals Totals
+	err = pinned.ForEach(func(k cid.Cid) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, s := range sources {
+			size, err := s.getSize(k)
+			if err == bstore.ErrNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			pinnedTotals.add(uint64(size))
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.setPinned(pinnedTotals, gen)
+	c.mu.Unlock()
+	return nil
+}
+
+// ReconcileInBackground starts reconciling the counts with the blockstore,
+// unless a background reconciliation is already running. It's stopped by
+// Close.
+func (c *Counter) ReconcileInBackground() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reconciling || c.closed {
+		return
+	}
+	c.reconciling = true
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			c.reconciling = false
+			c.mu.Unlock()
+		}()
+		if err := c.Reconcile(c.ctx); err != nil && c.ctx.Err() == nil {
+			log.Warningf("reconciling block counts: %s", err)
+		}
+	}()
+}
+
+// Run persists changed counts every FlushInterval, and reconciles them with
+// the blockstore every ReconcileInterval, right away if they aren't accurate.
+// The pinned blocks are recounted PinnedRecountDelay after pins change. It
+// returns when ctx is done.
+func (c *Counter) Run(ctx context.Context) {
+	flush := time.NewTicker(FlushInterval)
+	defer flush.Stop()
+
+	c.mu.Lock()
+	next := ReconcileInterval - time.Since(c.reconciled)
+	if !c.accurate || next < 0 {
+		next = 0
+	}
+	c.mu.Unlock()
+	reconcile := time.NewTimer(next)
+	defer reconcile.Stop()
+
+	recount := time.NewTimer(PinnedRecountDelay)
+	defer recount.Stop()
+	c.mu.Lock()
+	if !c.pinsChanged {
+		recount.Stop()
+	}
+	c.mu.Unlock()
+
+	for {
+		select {
+		case <-flush.C:
+			c.mu.Lock()
+			dirty := c.dirty
+			c.mu.Unlock()
+			if dirty {
+				if err := c.flush(false); err != nil {
+					log.Errorf("persisting block counts: %s", err)
+				}
+			}
+		case <-reconcile.C:
+			next := ReconcileInterval
+			if err := c.Reconcile(ctx); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Warningf("reconciling block counts: %s", err)
+				next = RetryInterval
+			}
+			reconcile.Reset(next)
+		case <-c.pinsSignal:
+			if !recount.Stop() {
+				select {
+				case <-recount.C:
+				default:
+				}
+			}
+			recount.Reset(PinnedRecountDelay)
+		case <-recount.C:
+			c.mu.Lock()
+			changed := c.pinsChanged
+			c.mu.Unlock()
+			if !changed {
+				// A reconciliation counted them meanwhile.
+				break
+			}
+			if err := c.RecountPinned(ctx); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Warningf("recounting pinned blocks: %s", err)
+				recount.Reset(RetryInterval)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close stops background reconciliations and persists the counts. Changes
+// made after Close aren't persisted.
+func (c *Counter) Close() error {
+	c.cancel()
+	return c.flush(true)
+}
+
+// Wrap returns a blockstore counting the blocks put into and deleted from
+// bs as regular blocks.
+func (c *Counter) Wrap(bs bstore.Blockstore) bstore.Blockstore {
+	c.mu.Lock()
+	c.sources = append(c.sources, source{
+		allKeys: bs.AllKeysChan,
+		getSize: bs.GetSize,
+	})
+	c.mu.Unlock()
+	return &blockstore{Blockstore: bs, c: c, getSize: bs.GetSize}
+}
+
+// WrapFilestore returns a blockstore counting the blocks put into and
+// deleted from the file manager of fs. Its main blockstore should be wrapped
+// by Wrap.
+func (c *Counter) WrapFilestore(fs *filestore.Filestore) bstore.Blockstore {
+	fm := fs.FileManager()
+	c.mu.Lock()
+	c.sources = append(c.sources, source{
+		allKeys:   fm.AllKeysChan,
+		getSize:   fm.GetSize,
+		filestore: true,
+	})
+	c.mu.Unlock()
+	return &blockstore{Blockstore: fs, c: c, getSize: fm.GetSize, filestore: true}
+}
@@ -0,0 +1,333 @@
+package blockstat
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipsn/go-ipfs/filestore"
+
+	blocks "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-block-format"
+	cid "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-cid"
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/namespace"
+	bstore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-blockstore"
+	posinfo "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-posinfo"
+	dag "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-merkledag"
+)
+
+func expectTotals(t *testing.T, name string, got Totals, blocks, bytes uint64) {
+	t.Helper()
+	if got.Blocks != blocks || got.Bytes != bytes {
+		t.Errorf("expected %d %s blocks of %d bytes, got %+v", blocks, name, bytes, got)
+	}
+}
+
+type hookBlockstore struct {
+	bstore.Blockstore
+	onAllKeys func()
+}
+
+func (bs *hookBlockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	bs.onAllKeys()
+	return bs.Blockstore.AllKeysChan(ctx)
+}
+
+func TestCounting(t *testing.T) {
+	d := ds.NewMapDatastore()
+	c, err := New(d, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := c.Wrap(bstore.NewBlockstore(d))
+
+	raw := dag.NewRawNode([]byte("raw block"))
+	node := dag.NodeWithData([]byte("protobuf block"))
+	for i := 0; i < 2; i++ {
+		if err := bs.Put(raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bs.PutMany([]blocks.Block{node, node, raw}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := c.Stat()
+	total := uint64(len(raw.RawData()) + len(node.RawData()))
+	expectTotals(t, "total", s.Totals, 2, total)
+	expectTotals(t, "regular", s.Regular, 2, total)
+	expectTotals(t, "unpinned", s.Unpinned, 2, total)
+	expectTotals(t, "protobuf", s.ByCodec["protobuf"], 1, uint64(len(node.RawData())))
+
+	if err := bs.DeleteBlock(raw.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.DeleteBlock(raw.Cid()); err != bstore.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	s = c.Stat()
+	expectTotals(t, "total", s.Totals, 1, uint64(len(node.RawData())))
+	if _, ok := s.ByCodec["raw"]; ok {
+		t.Errorf("expected no raw blocks, got %+v", s.ByCodec)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	d := ds.NewMapDatastore()
+	c, err := New(d, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Accurate() {
+		t.Fatal("expected counts that were never reconciled not to be accurate")
+	}
+	bs := c.Wrap(bstore.NewBlockstore(d))
+	if err := c.Reconcile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.Put(blocks.NewBlock([]byte("a"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = New(d, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Accurate() {
+		t.Fatal("expected counts persisted on close to be accurate")
+	}
+	expectTotals(t, "total", c.Stat().Totals, 1, 1)
+
+	// Not closing the counter, as if crashing.
+	c, err = New(d, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Accurate() {
+		t.Fatal("expected counts not persisted on close not to be accurate")
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	d := ds.NewMapDatastore()
+	base := bstore.NewBlockstore(d)
+	// Blocks put before counting.
+	a, b := blocks.NewBlock([]byte("a")), blocks.NewBlock([]byte("bb"))
+	if err := base.PutMany([]blocks.Block{a, b}); err != nil {
+		t.Fatal(err)
+	}
+
+	pinned := cid.NewSet()
+	pinned.Add(b.Cid())
+	c, err := New(d, Options{
+		Pinned: func(context.Context) (*cid.Set, error) { return pinned, nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook := &hookBlockstore{Blockstore: base, onAllKeys: func() {}}
+	bs := c.Wrap(hook)
+	expectTotals(t, "total", c.Stat().Totals, 0, 0)
+
+	if err := c.Reconcile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s := c.Stat()
+	expectTotals(t, "total", s.Totals, 2, 3)
+	expectTotals(t, "pinned", s.Pinned, 1, 2)
+	expectTotals(t, "unpinned", s.Unpinned, 1, 1)
+	if s.Reconciled.IsZero() || !c.Accurate() {
+		t.Error("expected the counts to be reconciled")
+	}
+
+	// Blocks put while scanning are counted once.
+	cb := blocks.NewBlock([]byte("ccc"))
+	hook.onAllKeys = func() {
+		if err := bs.Put(cb); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Reconcile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expectTotals(t, "total", c.Stat().Totals, 3, 6)
+
+	// Deleting blocks while scanning interrupts the reconciliation.
+	hook.onAllKeys = func() {
+		if err := bs.DeleteBlock(a.Cid()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Reconcile(context.Background()); err != ErrInterrupted {
+		t.Fatalf("expected ErrInterrupted, got %v", err)
+	}
+	expectTotals(t, "total", c.Stat().Totals, 2, 5)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for start := time.Now(); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestPinsChanged(t *testing.T) {
+	defer func(d time.Duration) { PinnedRecountDelay = d }(PinnedRecountDelay)
+	PinnedRecountDelay = 10 * time.Millisecond
+
+	d := ds.NewMapDatastore()
+	var mu sync.Mutex
+	pinned := cid.NewSet()
+	opts := Options{
+		Pinned: func(context.Context) (*cid.Set, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			set := cid.NewSet()
+			for _, k := range pinned.Keys() {
+				set.Add(k)
+			}
+			return set, nil
+		},
+	}
+	c, err := New(d, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := c.Wrap(bstore.NewBlockstore(d))
+	a := blocks.NewBlock([]byte("a"))
+	if err := bs.Put(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reconcile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if c.Stat().Approximate {
+		t.Fatal("expected reconciled counts not to be approximate")
+	}
+
+	mu.Lock()
+	pinned.Add(a.Cid())
+	mu.Unlock()
+	c.PinsChanged()
+	if !c.Stat().Approximate {
+		t.Fatal("expected counts to be approximate after pins changed")
+	}
+
+	// Changed pins are remembered across restarts, and recounted by Run.
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c, err = New(d, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Wrap(bstore.NewBlockstore(d))
+	if !c.Stat().Approximate {
+		t.Fatal("expected changed pins to be persisted")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+	waitFor(t, "the pinned blocks to be recounted", func() bool {
+		s := c.Stat()
+		return !s.Approximate && s.Pinned.Blocks == 1
+	})
+
+	mu.Lock()
+	pinned.Remove(a.Cid())
+	mu.Unlock()
+	c.PinsChanged()
+	waitFor(t, "the pinned blocks to be recounted", func() bool {
+		s := c.Stat()
+		return !s.Approximate && s.Pinned.Blocks == 0
+	})
+	expectTotals(t, "unpinned", c.Stat().Unpinned, 1, 1)
+}
+
+func TestReconcileInBackground(t *testing.T) {
+	d := ds.NewMapDatastore()
+	base := bstore.NewBlockstore(d)
+	if err := base.Put(blocks.NewBlock([]byte("a"))); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(d, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Wrap(base)
+	if !c.Stat().Approximate {
+		t.Fatal("expected counts that were never reconciled to be approximate")
+	}
+	c.ReconcileInBackground()
+	c.ReconcileInBackground()
+	waitFor(t, "the counts to be reconciled", c.Accurate)
+	s := c.Stat()
+	if s.Approximate {
+		t.Error("expected reconciled counts not to be approximate")
+	}
+	expectTotals(t, "total", s.Totals, 1, 1)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFilestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blockstat-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data := []byte("file content")
+	path := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := ds.NewMapDatastore()
+	c, err := New(d, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm := filestore.NewFileManager(namespace.Wrap(d, ds.NewKey("/filestore")), dir)
+	fm.AllowFiles = true
+	fs := filestore.NewFilestore(c.Wrap(bstore.NewBlockstore(d)), fm)
+	bs := c.WrapFilestore(fs)
+
+	ref := &posinfo.FilestoreNode{
+		Node:    dag.NewRawNode(data),
+		PosInfo: &posinfo.PosInfo{FullPath: path},
+	}
+	regular := blocks.NewBlock([]byte("regular"))
+	if err := bs.PutMany([]blocks.Block{ref, regular}); err != nil {
+		t.Fatal(err)
+	}
+	s := c.Stat()
+	expectTotals(t, "filestore", s.Filestore, 1, uint64(len(data)))
+	expectTotals(t, "regular", s.Regular, 1, uint64(len(regular.RawData())))
+
+	if err := c.Reconcile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s = c.Stat()
+	expectTotals(t, "filestore", s.Filestore, 1, uint64(len(data)))
+	expectTotals(t, "regular", s.Regular, 1, uint64(len(regular.RawData())))
+
+	if err := bs.DeleteBlock(ref.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.DeleteBlock(regular.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	expectTotals(t, "total", c.Stat().Totals, 0, 0)
+}
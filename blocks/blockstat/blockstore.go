@@ -0,0 +1,135 @@
+package blockstat
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	blocks "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-block-format"
+	cid "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-cid"
+	bstore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-blockstore"
+	posinfo "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-posinfo"
+)
+
+// Puts and deletes of the same block are serialized so that a block is
+// counted once, by striping locks over CIDs.
+const lockStripes = 64
+
+type blockstore struct {
+	bstore.Blockstore
+	c *Counter
+
+	// getSize returns the size of the counted blocks.
+	getSize func(cid.Cid) (int, error)
+	// filestore is set when only the blocks of a file manager are counted,
+	// the others being counted by the wrapped main blockstore.
+	filestore bool
+
+	locks [lockStripes]sync.Mutex
+}
+
+func (bs *blockstore) stripe(c cid.Cid) int {
+	h := fnv.New32a()
+	h.Write(c.Bytes())
+	return int(h.Sum32() % lockStripes)
+}
+
+// lock locks the stripes of the CIDs, in order.
+func (bs *blockstore) lock(cids ...cid.Cid) func() {
+	var stripes []int
+	seen := make(map[int]bool)
+	for _, c := range cids {
+		s := bs.stripe(c)
+		if !seen[s] {
+			seen[s] = true
+			stripes = append(stripes, s)
+		}
+	}
+	sort.Ints(stripes)
+	for _, s := range stripes {
+		bs.locks[s].Lock()
+	}
+	return func() {
+		for _, s := range stripes {
+			bs.locks[s].Unlock()
+		}
+	}
+}
+
+func (bs *blockstore) counted(b blocks.Block) bool {
+	if !bs.filestore {
+		return true
+	}
+	_, ok := b.(*posinfo.FilestoreNode)
+	return ok
+}
+
+func (bs *blockstore) Put(b blocks.Block) error {
+	if !bs.counted(b) {
+		return bs.Blockstore.Put(b)
+	}
+	defer bs.lock(b.Cid())()
+
+	has, err := bs.Blockstore.Has(b.Cid())
+	if err != nil {
+		return err
+	}
+	if has {
+		return nil
+	}
+	if err := bs.Blockstore.Put(b); err != nil {
+		return err
+	}
+	bs.c.add(b.Cid(), bs.filestore, uint64(len(b.RawData())))
+	return nil
+}
+
+func (bs *blockstore) PutMany(blks []blocks.Block) error {
+	var cids []cid.Cid
+	for _, b := range blks {
+		if bs.counted(b) {
+			cids = append(cids, b.Cid())
+		}
+	}
+	defer bs.lock(cids...)()
+
+	var added []blocks.Block
+	seen := make(map[string]bool)
+	for _, b := range blks {
+		if !bs.counted(b) || seen[b.Cid().KeyString()] {
+			continue
+		}
+		seen[b.Cid().KeyString()] = true
+		has, err := bs.Blockstore.Has(b.Cid())
+		if err != nil {
+			return err
+		}
+		if !has {
+			added = append(added, b)
+		}
+	}
+
+	if err := bs.Blockstore.PutMany(blks); err != nil {
+		return err
+	}
+	for _, b := range added {
+		bs.c.add(b.Cid(), bs.filestore, uint64(len(b.RawData())))
+	}
+	return nil
+}
+
+func (bs *blockstore) DeleteBlock(c cid.Cid) error {
+	defer bs.lock(c)()
+
+	size, err := bs.getSize(c)
+	if err == bstore.ErrNotFound {
+		return bs.Blockstore.DeleteBlock(c)
+	} else if err != nil {
+		return err
+	}
+	if err := bs.Blockstore.DeleteBlock(c); err != nil {
+		return err
+	}
+	bs.c.remove(c, bs.filestore, uint64(size))
+	return nil
+}
@@ -0,0 +1,366 @@
+// Package scrubber verifies the blocks of a repo in the background, moving
+// the corrupt ones into quarantine and fetching them again when possible.
+package scrubber
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	cid "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-cid"
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	query "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/query"
+	bstore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-blockstore"
+	dshelp "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-ds-help"
+	logging "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-log"
+	metrics "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-metrics-interface"
+)
+
+var log = logging.Logger("scrubber")
+
+// QuarantinePrefix is the datastore namespace corrupt blocks are moved to.
+var QuarantinePrefix = ds.NewKey("/quarantine")
+
+var stateKey = ds.NewKey("/local/scrubber")
+
+// DefaultRate is the number of bytes read per second when no rate is set.
+const DefaultRate = 8 << 20
+
+// FetchTimeout is how long fetching a corrupt block again may take.
+var FetchTimeout = time.Minute
+
+// Options configure a Scrubber.
+type Options struct {
+	// Period is how often all blocks are verified.
+	Period time.Duration
+	// Rate is the maximum number of bytes read per second, DefaultRate if
+	// zero.
+	Rate uint64
+	// Fetch fetches a block from the network and stores it in the
+	// blockstore. Corrupt blocks aren't fetched again if nil.
+	Fetch func(ctx context.Context, c cid.Cid) error
+}
+
+// Quarantined is a corrupt block moved into quarantine.
+type Quarantined struct {
+	Cid  cid.Cid
+	Size int
+	// Restored is whether the blockstore holds a valid copy of the block
+	// again.
+	Restored bool
+}
+
+// Status reports the progress of the scrubber.
+type Status struct {
+	Period time.Duration
+	Rate   uint64
+	// Fetching is whether corrupt blocks are fetched from the network.
+	Fetching bool
+
+	// LastPass is when the last pass over all blocks completed, the zero
+	// time if none did.
+	LastPass time.Time
+	// PassStarted is when the current pass started, the zero time if none
+	// is running.
+	PassStarted time.Time
+	// PassBlocks and PassBytes count the blocks verified by the current
+	// pass.
+	PassBlocks uint64
+	PassBytes  uint64
+
+	// Totals since the scrubber started.
+	Blocks    uint64
+	Bytes     uint64
+	Corrupt   uint64
+	Refetched uint64
+	Errors    uint64
+
+	Quarantined []Quarantined
+}
+
+type state struct {
+	LastPass time.Time
+}
+
+type scrubberMetrics struct {
+	blocks      metrics.Counter
+	bytes       metrics.Counter
+	corrupt     metrics.Counter
+	refetched   metrics.Counter
+	errors      metrics.Counter
+	quarantined metrics.Gauge
+}
+
+// Scrubber verifies the blocks of a repo.
+type Scrubber struct {
+	d      ds.Datastore
+	raw    bstore.Blockstore
+	bs     bstore.Blockstore
+	opts   Options
+	metric scrubberMetrics
+
+	passMu sync.Mutex
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New returns a scrubber of the blocks stored in the repo datastore d.
+// Corrupt blocks are deleted through bs, which should be the blockstore
+// built on top of d, so that the layers above it notice.
+func New(ctx context.Context, d ds.Batching, bs bstore.Blockstore, opts Options) (*Scrubber, error) {
+	if opts.Rate == 0 {
+		opts.Rate = DefaultRate
+	}
+	raw := bstore.NewBlockstore(d)
+	raw.HashOnRead(true)
+
+	ctx = metrics.CtxSubScope(ctx, "scrubber")
+	s := &Scrubber{
+		d:    d,
+		raw:  raw,
+		bs:   bs,
+		opts: opts,
+		metric: scrubberMetrics{
+			blocks:      metrics.NewCtx(ctx, "blocks_total", "Number of blocks verified").Counter(),
+			bytes:       metrics.NewCtx(ctx, "bytes_total", "Number of bytes verified").Counter(),
+			corrupt:     metrics.NewCtx(ctx, "corrupt_blocks_total", "Number of corrupt blocks found").Counter(),
+			refetched:   metrics.NewCtx(ctx, "refetched_blocks_total", "Number of corrupt blocks fetched again").Counter(),
+			errors:      metrics.NewCtx(ctx, "errors_total", "Number of blocks that couldn't be verified").Counter(),
+			quarantined: metrics.NewCtx(ctx, "quarantined_blocks", "Number of blocks in quarantine").Gauge(),
+		},
+		status: Status{
+			Period:   opts.Period,
+			Rate:     opts.Rate,
+			Fetching: opts.Fetch != nil,
+		},
+	}
+
+	data, err := d.Get(stateKey)
+	switch err {
+	case nil:
+		var st state
+		if err := json.Unmarshal(data, &st); err != nil {
+			return nil, err
+		}
+		s.status.LastPass = st.LastPass
+	case ds.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	if _, err := s.quarantined(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func quarantineKey(c cid.Cid) ds.Key {
+	return QuarantinePrefix.Child(dshelp.CidToDsKey(c))
+}
+
+// quarantined lists the blocks in quarantine, setting the quarantined_blocks
+// gauge to their number as they may have been removed since.
+func (s *Scrubber) quarantined() ([]Quarantined, error) {
+	res, err := s.d.Query(query.Query{Prefix: QuarantinePrefix.String(), KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Quarantined
+	for _, e := range entries {
+		c, err := dshelp.DsKeyToCid(ds.NewKey(ds.RawKey(e.Key).BaseNamespace()))
+		if err != nil {
+			log.Warningf("invalid key in quarantine: %s", e.Key)
+			continue
+		}
+		size, err := s.d.GetSize(ds.RawKey(e.Key))
+		if err != nil {
+			return nil, err
+		}
+		restored, err := s.bs.Has(c)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Quarantined{Cid: c, Size: size, Restored: restored})
+	}
+	s.metric.quarantined.Set(float64(len(out)))
+	return out, nil
+}
+
+// Status returns the progress of the scrubber and the blocks in quarantine.
+func (s *Scrubber) Status() (Status, error) {
+	quarantined, err := s.quarantined()
+	if err != nil {
+		return Status{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.status
+	st.Quarantined = quarantined
+	return st, nil
+}
+
+// Run verifies all blocks every Options.Period, until ctx is done.
+func (s *Scrubber) Run(ctx context.Context) {
+	s.mu.Lock()
+	wait := s.opts.Period - time.Since(s.status.LastPass)
+	s.mu.Unlock()
+
+	for {
+		if wait < 0 {
+			wait = 0
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+
+		if err := s.Scrub(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Errorf("scrubbing blocks: %s", err)
+		}
+		wait = s.opts.Period
+	}
+}
+
+// Scrub verifies all blocks once, at the configured rate.
+func (s *Scrubber) Scrub(ctx context.Context) error {
+	s.passMu.Lock()
+	defer s.passMu.Unlock()
+
+	start := time.Now()
+	s.mu.Lock()
+	s.status.PassStarted = start
+	s.status.PassBlocks = 0
+	s.status.PassBytes = 0
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.status.PassStarted = time.Time{}
+		s.mu.Unlock()
+		if _, err := s.quarantined(); err != nil {
+			log.Warningf("listing quarantined blocks: %s", err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	keys, err := s.raw.AllKeysChan(ctx)
+	if err != nil {
+		return err
+	}
+
+	var read uint64
+	for c := range keys {
+		size, err := s.verify(ctx, c)
+		if err != nil {
+			log.Warningf("verifying block %s: %s", c, err)
+			s.metric.errors.Inc()
+			s.mu.Lock()
+			s.status.Errors++
+			s.mu.Unlock()
+		}
+
+		read += uint64(size)
+		due := time.Duration(float64(read) / float64(s.opts.Rate) * float64(time.Second))
+		if d := due - time.Since(start); d > 0 {
+			select {
+			case <-time.After(d):
+			case <-ctx.Done():
+			}
+		}
+	}
+	// AllKeysChan closes its channel when the context is done.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(state{LastPass: time.Now()})
+	if err != nil {
+		return err
+	}
+	if err := s.d.Put(stateKey, data); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.status.LastPass = time.Now()
+	s.mu.Unlock()
+	log.Infof("verified all blocks in %s", time.Since(start))
+	return nil
+}
+
+// verify verifies a block, returning how many bytes were read.
+func (s *Scrubber) verify(ctx context.Context, c cid.Cid) (int, error) {
+	b, err := s.raw.Get(c)
+	switch err {
+	case nil:
+		s.count(len(b.RawData()))
+		return len(b.RawData()), nil
+	case bstore.ErrNotFound:
+		// Deleted since listed.
+		return 0, nil
+	case bstore.ErrHashMismatch:
+	default:
+		return 0, err
+	}
+
+	data, err := s.d.Get(bstore.BlockPrefix.Child(dshelp.CidToDsKey(c)))
+	if err != nil {
+		return 0, err
+	}
+	s.count(len(data))
+	log.Errorf("block %s is corrupt, moving it into quarantine", c)
+	s.metric.corrupt.Inc()
+	s.mu.Lock()
+	s.status.Corrupt++
+	s.mu.Unlock()
+
+	had, err := s.d.Has(quarantineKey(c))
+	if err != nil {
+		return len(data), err
+	}
+	if err := s.d.Put(quarantineKey(c), data); err != nil {
+		return len(data), err
+	}
+	if err := s.bs.DeleteBlock(c); err != nil && err != bstore.ErrNotFound {
+		return len(data), err
+	}
+	if !had {
+		s.metric.quarantined.Inc()
+	}
+
+	if s.opts.Fetch == nil {
+		return len(data), nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, FetchTimeout)
+	defer cancel()
+	if err := s.opts.Fetch(ctx, c); err != nil {
+		log.Warningf("fetching corrupt block %s again: %s", c, err)
+		return len(data), nil
+	}
+	s.metric.refetched.Inc()
+	s.mu.Lock()
+	s.status.Refetched++
+	s.mu.Unlock()
+	return len(data), nil
+}
+
+func (s *Scrubber) count(size int) {
+	s.metric.blocks.Inc()
+	s.metric.bytes.Add(float64(size))
+	s.mu.Lock()
+	s.status.PassBlocks++
+	s.status.PassBytes += uint64(size)
+	s.status.Blocks++
+	s.status.Bytes += uint64(size)
+	s.mu.Unlock()
+}
@@ -0,0 +1,160 @@
+package scrubber
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-block-format"
+	cid "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-cid"
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	bstore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-blockstore"
+	dshelp "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-ds-help"
+)
+
+func corrupt(t *testing.T, d ds.Datastore, b blocks.Block) {
+	err := d.Put(bstore.BlockPrefix.Child(dshelp.CidToDsKey(b.Cid())), []byte("corrupt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+type gauge struct{ v float64 }
+
+func (g *gauge) Set(v float64) { g.v = v }
+func (g *gauge) Inc()          { g.v++ }
+func (g *gauge) Dec()          { g.v-- }
+func (g *gauge) Add(v float64) { g.v += v }
+func (g *gauge) Sub(v float64) { g.v -= v }
+
+func TestScrub(t *testing.T) {
+	ctx := context.Background()
+	d := ds.NewMapDatastore()
+	bs := bstore.NewBlockstore(d)
+	good, bad := blocks.NewBlock([]byte("good")), blocks.NewBlock([]byte("bad"))
+	if err := bs.PutMany([]blocks.Block{good, bad}); err != nil {
+		t.Fatal(err)
+	}
+	corrupt(t, d, bad)
+
+	s, err := New(ctx, d, bs, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quarantined := &gauge{}
+	s.metric.quarantined = quarantined
+	if err := s.Scrub(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Scrubbing again doesn't count the block twice.
+	corrupt(t, d, bad)
+	if err := s.Scrub(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if quarantined.v != 1 {
+		t.Errorf("expected 1 quarantined block, the gauge is at %v", quarantined.v)
+	}
+
+	if has, _ := bs.Has(bad.Cid()); has {
+		t.Error("expected the corrupt block to be removed from the blockstore")
+	}
+	if has, _ := bs.Has(good.Cid()); !has {
+		t.Error("expected the valid block to be kept")
+	}
+	data, err := d.Get(quarantineKey(bad.Cid()))
+	if err != nil || !bytes.Equal(data, []byte("corrupt")) {
+		t.Fatalf("expected the corrupt block in quarantine, got %q, %v", data, err)
+	}
+
+	st, err := s.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Blocks != 4 || st.Corrupt != 2 || st.Refetched != 0 || st.LastPass.IsZero() {
+		t.Errorf("unexpected status %+v", st)
+	}
+	if len(st.Quarantined) != 1 || !st.Quarantined[0].Cid.Equals(bad.Cid()) || st.Quarantined[0].Restored {
+		t.Errorf("unexpected quarantined blocks %+v", st.Quarantined)
+	}
+
+	// Blocks removed from quarantine aren't counted anymore.
+	if err := d.Delete(quarantineKey(bad.Cid())); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Status(); err != nil {
+		t.Fatal(err)
+	}
+	if quarantined.v != 0 {
+		t.Errorf("expected no quarantined blocks, the gauge is at %v", quarantined.v)
+	}
+
+	// The last pass is remembered.
+	s, err = New(ctx, d, bs, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := s.Status(); st.LastPass.IsZero() {
+		t.Error("expected the last pass to be persisted")
+	}
+}
+
+func TestRefetch(t *testing.T) {
+	ctx := context.Background()
+	d := ds.NewMapDatastore()
+	bs := bstore.NewBlockstore(d)
+	b := blocks.NewBlock([]byte("block"))
+	if err := bs.Put(b); err != nil {
+		t.Fatal(err)
+	}
+	corrupt(t, d, b)
+
+	s, err := New(ctx, d, bs, Options{
+		Fetch: func(ctx context.Context, c cid.Cid) error {
+			return bs.Put(b)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Scrub(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := s.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Corrupt != 1 || st.Refetched != 1 {
+		t.Errorf("unexpected status %+v", st)
+	}
+	if len(st.Quarantined) != 1 || !st.Quarantined[0].Restored {
+		t.Errorf("expected the block to be restored, got %+v", st.Quarantined)
+	}
+	if got, err := bs.Get(b.Cid()); err != nil || !bytes.Equal(got.RawData(), b.RawData()) {
+		t.Errorf("expected the block to be fetched again, got %v", err)
+	}
+}
+
+func TestRate(t *testing.T) {
+	ctx := context.Background()
+	d := ds.NewMapDatastore()
+	bs := bstore.NewBlockstore(d)
+	for i := 0; i < 4; i++ {
+		if err := bs.Put(blocks.NewBlock(bytes.Repeat([]byte{byte(i)}, 100))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := New(ctx, d, bs, Options{Rate: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := s.Scrub(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond {
+		t.Errorf("expected reading 400 bytes at 1000 bytes/s to take 400ms, took %s", elapsed)
+	}
+}
@@ -41,6 +41,7 @@ const (
 	ipfsMountKwd              = "mount-ipfs"
 	ipnsMountKwd              = "mount-ipns"
 	migrateKwd                = "migrate"
+	migrateDryRunKwd          = "migrate-dry-run"
 	mountKwd                  = "mount"
 	offlineKwd                = "offline" // global option
 	routingOptionKwd          = "routing"
@@ -128,6 +129,21 @@ environment variable:
 
   export IPFS_PATH=/path/to/ipfsrepo
 
+Migrations
+
+When the repo was created by an older version of ipfs, it has to be migrated
+before the daemon can start. Migrations built into ipfs run in-process; the
+config, version and datastore_spec files are backed up to the
+'migration-backups' directory of the repo first, and the migrations that ran
+are reverted if one fails. Repos too old for the built-in migrations are
+migrated with the fs-repo-migrations tool, which is downloaded if needed.
+
+  ipfs daemon --migrate
+
+To see which migrations would run without changing anything:
+
+  ipfs daemon --migrate-dry-run
+
 Routing
 
 IPFS by default will use a DHT for content routing. There is a highly
@@ -164,6 +180,7 @@ Headers.
 		cmdkit.BoolOption(enableGCKwd, "Enable automatic periodic repo garbage collection"),
 		cmdkit.BoolOption(adjustFDLimitKwd, "Check and raise file descriptor limits if needed").WithDefault(true),
 		cmdkit.BoolOption(migrateKwd, "If true, assume yes at the migrate prompt. If false, assume no."),
+		cmdkit.BoolOption(migrateDryRunKwd, "Only report the repo migrations that would run, then exit."),
 		cmdkit.BoolOption(enablePubSubKwd, "Instantiate the ipfs daemon with the experimental pubsub feature enabled."),
 		cmdkit.BoolOption(enableIPNSPubSubKwd, "Enable IPNS record distribution through pubsub; enables pubsub."),
 		cmdkit.BoolOption(enableMultiplexKwd, "Add the experimental 'go-multiplex' stream muxer to libp2p on construction.").WithDefault(true),
@@ -176,6 +193,29 @@ Headers.
 	Run:         daemonFunc,
 }
 
+// migrateRepo migrates the repo at repoPath to the current version, using
+// the built-in migrations when they cover all the versions in between and
+// fs-repo-migrations otherwise.
+func migrateRepo(repoPath string, dryRun bool) error {
+	ver, err := migrate.RepoPath(repoPath).Version()
+	if err != nil {
+		return err
+	}
+
+	if _, err := migrate.Plan(ver, fsrepo.RepoVersion); err != nil {
+		if dryRun {
+			return fmt.Errorf("cannot report the migrations run by fs-repo-migrations: %s", err)
+		}
+		return migrate.RunMigration(fsrepo.RepoVersion)
+	}
+
+	_, err = fsrepo.Migrate(repoPath, fsrepo.RepoVersion, migrate.MigrateOptions{
+		DryRun: dryRun,
+		Out:    os.Stdout,
+	})
+	return err
+}
+
 // defaultMux tells mux to serve path using the default muxer. This is
 // mostly useful to hook up things that register in the default muxer,
 // and don't provide a convenient http.Handler entry point, such as
@@ -248,6 +288,11 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	default:
 		return err
 	case fsrepo.ErrNeedMigration:
+		if dryRun, _ := req.Options[migrateDryRunKwd].(bool); dryRun {
+			fmt.Println("Found outdated fs-repo, these migrations would run:")
+			return migrateRepo(cctx.ConfigRoot, true)
+		}
+
 		domigrate, found := req.Options[migrateKwd].(bool)
 		fmt.Println("Found outdated fs-repo, migrations need to be run.")
 
@@ -257,11 +302,11 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 
 		if !domigrate {
 			fmt.Println("Not running migrations of fs-repo now.")
-			fmt.Println("Please get fs-repo-migrations from https://dist.ipfs.io")
+			fmt.Println("Please run 'ipfs daemon --migrate' or get fs-repo-migrations from https://dist.ipfs.io")
 			return fmt.Errorf("fs-repo requires migration")
 		}
 
-		err = migrate.RunMigration(fsrepo.RepoVersion)
+		err = migrateRepo(cctx.ConfigRoot, false)
 		if err != nil {
 			fmt.Println("The migrations of fs-repo failed:")
 			fmt.Printf("  %s\n", err)
@@ -275,7 +320,11 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 			return err
 		}
 	case nil:
-		break
+		if dryRun, _ := req.Options[migrateDryRunKwd].(bool); dryRun {
+			repo.Close()
+			fmt.Println("fs-repo is up to date, no migrations would run.")
+			return nil
+		}
 	}
 
 	cfg, err := cctx.GetConfig()
@@ -594,7 +643,7 @@ func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, e
 		corehttp.CommandsROOption(cmdctx),
 	}
 
-	if cfg.Experimental.P2pHttpProxy {
+	if cfg.Gateway.P2PProxy || cfg.Experimental.P2pHttpProxy {
 		opts = append(opts, corehttp.ProxyOption())
 	}
 
@@ -408,10 +408,17 @@ func getAPIClient(ctx context.Context, repoPath, apiAddrStr string) (http.Client
 	if len(addr.Protocols()) == 0 {
 		return nil, fmt.Errorf(apiErrorFmt, repoPath, "multiaddr doesn't provide any protocols")
 	}
-	return apiClientForAddr(ctx, addr)
+
+	// When the daemon hosts tenants, the requests of the node itself are
+	// authenticated with the root token.
+	var opts []http.ClientOpt
+	if cfg, err := fsrepo.ConfigAt(repoPath); err == nil && cfg.API.RootToken != "" {
+		opts = append(opts, http.ClientWithHeader("Authorization", "Bearer "+cfg.API.RootToken))
+	}
+	return apiClientForAddr(ctx, addr, opts...)
 }
 
-func apiClientForAddr(ctx context.Context, addr ma.Multiaddr) (http.Client, error) {
+func apiClientForAddr(ctx context.Context, addr ma.Multiaddr, opts ...http.ClientOpt) (http.Client, error) {
 	addr, err := resolveAddr(ctx, addr)
 	if err != nil {
 		return nil, err
@@ -422,7 +429,8 @@ func apiClientForAddr(ctx context.Context, addr ma.Multiaddr) (http.Client, erro
 		return nil, err
 	}
 
-	return http.NewClient(host, http.ClientWithAPIPrefix(corehttp.APIPath)), nil
+	opts = append(opts, http.ClientWithAPIPrefix(corehttp.APIPath))
+	return http.NewClient(host, opts...), nil
 }
 
 func resolveAddr(ctx context.Context, addr ma.Multiaddr) (ma.Multiaddr, error) {
@@ -5,19 +5,26 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"github.com/ipsn/go-ipfs/provider"
 	"os"
 	"syscall"
 	"time"
 
+	blockstat "github.com/ipsn/go-ipfs/blocks/blockstat"
+	scrubber "github.com/ipsn/go-ipfs/blocks/scrubber"
 	filestore "github.com/ipsn/go-ipfs/filestore"
 	namesys "github.com/ipsn/go-ipfs/namesys"
 	pin "github.com/ipsn/go-ipfs/pin"
+	gc "github.com/ipsn/go-ipfs/pin/gc"
 	repo "github.com/ipsn/go-ipfs/repo"
 	cidv0v1 "github.com/ipsn/go-ipfs/thirdparty/cidv0v1"
 	"github.com/ipsn/go-ipfs/thirdparty/verifbs"
 
+	humanize "github.com/dustin/go-humanize"
+
 	bserv "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-blockservice"
+	cid "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-cid"
 	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
 	retry "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/retrystore"
 	dsync "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/sync"
@@ -202,8 +209,18 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 		return err
 	}
 
-	// TEMP: setting global sharding switch here
-	uio.UseHAMTSharding = conf.Experimental.ShardingEnabled
+	shardingSize := uio.DefaultHAMTShardingSize
+	if conf.UnixFS.ShardingThreshold != "" {
+		threshold, err := humanize.ParseBytes(conf.UnixFS.ShardingThreshold)
+		if err != nil {
+			return fmt.Errorf("invalid UnixFS.ShardingThreshold: %s", err)
+		}
+		shardingSize = int(threshold)
+	}
+	n.DirectoryOptions = []uio.DirectoryOption{
+		uio.ForceSharding(conf.Experimental.ShardingEnabled),
+		uio.ShardingSize(shardingSize),
+	}
 
 	opts.HasBloomFilterSize = conf.Datastore.BloomFilterSize
 	if !cfg.Permanent {
@@ -221,6 +238,14 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 
 	bs = cidv0v1.NewBlockstore(bs)
 
+	n.BlockStat, err = blockstat.New(n.Repo.Datastore(), blockstat.Options{
+		Pinned: n.pinnedBlocks,
+	})
+	if err != nil {
+		return err
+	}
+	bs = n.BlockStat.Wrap(bs)
+
 	n.BaseBlocks = bs
 	n.GCLocker = bstore.NewGCLocker()
 	n.Blockstore = bstore.NewGCBlockstore(bs, n.GCLocker)
@@ -228,7 +253,7 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 	if conf.Experimental.FilestoreEnabled || conf.Experimental.UrlstoreEnabled {
 		// hash security
 		n.Filestore = filestore.NewFilestore(bs, n.Repo.FileManager())
-		n.Blockstore = bstore.NewGCBlockstore(n.Filestore, n.GCLocker)
+		n.Blockstore = bstore.NewGCBlockstore(n.BlockStat.WrapFilestore(n.Filestore), n.GCLocker)
 		n.Blockstore = &verifbs.VerifBSGC{GCBlockstore: n.Blockstore}
 	}
 
@@ -259,7 +284,11 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 	} else {
 		n.Exchange = offline.Exchange(n.Blockstore)
 		n.Routing = offroute.NewOfflineRouter(n.Repo.Datastore(), n.RecordValidator)
-		n.Namesys = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), 0)
+		nsopts, err := n.getNamesysOptions()
+		if err != nil {
+			return err
+		}
+		n.Namesys = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), 0, nsopts...)
 	}
 
 	n.Blocks = bserv.New(n.Blockstore, n.Exchange)
@@ -274,6 +303,7 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 		// this is kinda sketchy and could cause data loss
 		n.Pinning = pin.NewPinner(n.Repo.Datastore(), n.DAG, internalDag)
 	}
+	n.Pinning = &countingPinner{Pinner: n.Pinning, stat: n.BlockStat}
 	n.Resolver = resolver.NewBasicResolver(n.DAG)
 
 	// Provider
@@ -289,5 +319,88 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 		}
 	}
 
-	return n.loadFilesRoot()
+	if err := n.setupScrubber(ctx, rcfg, cfg.Online); err != nil {
+		return err
+	}
+
+	if err := n.loadFilesRoot(); err != nil {
+		return err
+	}
+
+	// The tenants are loaded even when offline, as the garbage collector
+	// needs their pins.
+	if err := n.setupTenants(rcfg.Tenants); err != nil {
+		return err
+	}
+
+	if cfg.Permanent {
+		go n.BlockStat.Run(goprocessctx.OnClosingContext(n.proc))
+		if rcfg.Datastore.ScrubPeriod != "" {
+			go n.Scrubber.Run(goprocessctx.OnClosingContext(n.proc))
+		}
+	}
+
+	return nil
+}
+
+// pinnedBlocks returns the set of blocks kept by the pins of the node and of
+// its tenants, the way the garbage collector computes it.
+func (n *IpfsNode) pinnedBlocks(ctx context.Context) (*cid.Set, error) {
+	output := make(chan gc.Result)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for res := range output {
+			log.Debugf("listing pinned blocks: %s", res.Error)
+		}
+	}()
+	defer func() {
+		close(output)
+		<-done
+	}()
+
+	ng := dag.NewDAGService(bserv.New(n.Blockstore, offline.Exchange(n.Blockstore)))
+	return gc.ColoredSet(ctx, n.GCPinner(), ng, nil, output)
+}
+
+// countingPinner has the pinned blocks recounted when its pins are flushed.
+type countingPinner struct {
+	pin.Pinner
+	stat *blockstat.Counter
+}
+
+func (p *countingPinner) Flush() error {
+	if err := p.Pinner.Flush(); err != nil {
+		return err
+	}
+	p.stat.PinsChanged()
+	return nil
+}
+
+func (n *IpfsNode) setupScrubber(ctx context.Context, rcfg *cfg.Config, online bool) error {
+	opts := scrubber.Options{}
+	if rcfg.Datastore.ScrubPeriod != "" {
+		period, err := time.ParseDuration(rcfg.Datastore.ScrubPeriod)
+		if err != nil {
+			return fmt.Errorf("invalid Datastore.ScrubPeriod: %s", err)
+		}
+		opts.Period = period
+	}
+	if rcfg.Datastore.ScrubRate != "" {
+		rate, err := humanize.ParseBytes(rcfg.Datastore.ScrubRate)
+		if err != nil {
+			return fmt.Errorf("invalid Datastore.ScrubRate: %s", err)
+		}
+		opts.Rate = rate
+	}
+	if online {
+		opts.Fetch = func(ctx context.Context, c cid.Cid) error {
+			_, err := n.Blocks.GetBlock(ctx, c)
+			return err
+		}
+	}
+
+	var err error
+	n.Scrubber, err = scrubber.New(ctx, n.Repo.Datastore(), n.BaseBlocks, opts)
+	return err
 }
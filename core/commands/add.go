@@ -46,6 +46,9 @@ const (
 	hashOptionName        = "hash"
 	inlineOptionName      = "inline"
 	inlineLimitOptionName = "inline-limit"
+	resumeOptionName      = "resume"
+	partialOptionName     = "partial"
+	appendToOptionName    = "append-to"
 )
 
 const adderOutChanSize = 8
@@ -103,6 +106,30 @@ You can now check what blocks have been created by:
   QmY6yj1GsermExDXoosVE3aSPxdMNYr6aKuw3nA8LoWPRS 2059
   QmerURi9k4XzKCaaPbsK6BL5pMEjF7PGphjDvkkjDtsVf3 868
   QmQB28iwSriSUSMqG2nXDTLtdPHgWb4rebBrU7Q1j4vxPv 338
+
+The resume option, '--resume=<id>', records the progress of the add in
+the repo under the given upload ID. If the add is interrupted, running
+it again with the same ID continues where it stopped: files which were
+already added are skipped, as well as the data stored for the file that
+was being added.
+
+  > ipfs add --resume=backup -r /data
+  ^C
+  > ipfs add --resume=backup -r /data
+
+Through the HTTP API, a single large file can also be sent in several
+requests: every request but the last one sets '--partial' and sends the
+next part of the file, together with its position in the file with
+'--offset'. Each partial request reports the amount of data stored so
+far, which is where the next part must start. Parts must be sent one at a
+time: a request for an upload ID which is already in progress fails.
+
+The append-to option, '--append-to=<path>', appends the data to an existing
+file and returns the root of the extended file. The data is added using the
+trickle-dag format, and only the last nodes of the existing file are
+rewritten, which makes it efficient for files which keep growing:
+
+  > ipfs add --append-to=QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH more.log
 `,
 	},
 
@@ -130,6 +157,10 @@ You can now check what blocks have been created by:
 		cmdkit.StringOption(hashOptionName, "Hash function to use. Implies CIDv1 if not sha2-256. (experimental)").WithDefault("sha2-256"),
 		cmdkit.BoolOption(inlineOptionName, "Inline small blocks into CIDs. (experimental)"),
 		cmdkit.IntOption(inlineLimitOptionName, "Maximum block size to inline. (experimental)").WithDefault(32),
+		cmdkit.StringOption(resumeOptionName, "Record progress under this upload ID, continuing a previous add with the same ID. (experimental)"),
+		cmdkit.Int64Option(offsetOptionName, "Offset in the file being resumed at which the given data starts. (experimental)"),
+		cmdkit.BoolOption(partialOptionName, "Only add the next part of a single file, to be continued with the same upload ID. (experimental)"),
+		cmdkit.StringOption(appendToOptionName, "Append the data to the file at the given path, returning the new root. (experimental)"),
 	},
 	PreRun: func(req *cmds.Request, env cmds.Environment) error {
 		quiet, _ := req.Options[quietOptionName].(bool)
@@ -172,6 +203,10 @@ You can now check what blocks have been created by:
 		inline, _ := req.Options[inlineOptionName].(bool)
 		inlineLimit, _ := req.Options[inlineLimitOptionName].(int)
 		pathName, _ := req.Options[stdinPathName].(string)
+		resume, _ := req.Options[resumeOptionName].(string)
+		offset, _ := req.Options[offsetOptionName].(int64)
+		partial, _ := req.Options[partialOptionName].(bool)
+		appendTo, _ := req.Options[appendToOptionName].(string)
 
 		hashFunCode, ok := mh.Names[strings.ToLower(hashFunStr)]
 		if !ok {
@@ -205,6 +240,10 @@ You can now check what blocks have been created by:
 			options.Unixfs.Progress(progress),
 			options.Unixfs.Silent(silent),
 			options.Unixfs.Events(events),
+
+			options.Unixfs.Resume(resume),
+			options.Unixfs.ResumeOffset(offset),
+			options.Unixfs.Partial(partial),
 		}
 
 		if cidVerSet {
@@ -219,12 +258,28 @@ You can now check what blocks have been created by:
 			opts = append(opts, options.Unixfs.Layout(options.TrickleLayout))
 		}
 
+		if appendTo != "" {
+			p, err := coreiface.ParsePath(appendTo)
+			if err != nil {
+				return err
+			}
+			rp, err := api.ResolvePath(req.Context, p)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, options.Unixfs.AppendTo(rp.Cid()))
+		}
+
 		errCh := make(chan error)
 		go func() {
 			var err error
 			defer func() { errCh <- err }()
 			defer close(events)
 			_, err = api.Unixfs().Add(req.Context, req.Files, opts...)
+			if err == coreiface.ErrPartialAdd {
+				// The progress of the upload was reported by the events.
+				err = nil
+			}
 		}()
 
 		for event := range events {
@@ -29,6 +29,8 @@ func TestROCommands(t *testing.T) {
 		"/get",
 		"/ls",
 		"/name",
+		"/name/get",
+		"/name/inspect",
 		"/name/resolve",
 		"/object",
 		"/object/data",
@@ -66,6 +68,96 @@ func TestROCommands(t *testing.T) {
 		}
 	}
 }
+
+func TestTenantCommands(t *testing.T) {
+	list := []string{
+		"/add",
+		"/block",
+		"/block/get",
+		"/block/put",
+		"/block/stat",
+		"/cat",
+		"/cid",
+		"/cid/base32",
+		"/cid/bases",
+		"/cid/codecs",
+		"/cid/format",
+		"/cid/hashes",
+		"/commands",
+		"/dag",
+		"/dag/get",
+		"/dag/put",
+		"/dag/resolve",
+		"/dns",
+		"/file",
+		"/file/ls",
+		"/files",
+		"/files/chcid",
+		"/files/cp",
+		"/files/flush",
+		"/files/ls",
+		"/files/mkdir",
+		"/files/mv",
+		"/files/read",
+		"/files/rm",
+		"/files/stat",
+		"/files/write",
+		"/get",
+		"/key",
+		"/key/gen",
+		"/key/list",
+		"/key/rename",
+		"/key/rm",
+		"/ls",
+		"/name",
+		"/name/get",
+		"/name/inspect",
+		"/name/publish",
+		"/name/put",
+		"/name/resolve",
+		"/object",
+		"/object/data",
+		"/object/diff",
+		"/object/get",
+		"/object/links",
+		"/object/new",
+		"/object/patch",
+		"/object/patch/add-link",
+		"/object/patch/append-data",
+		"/object/patch/rm-link",
+		"/object/patch/set-data",
+		"/object/put",
+		"/object/stat",
+		"/pin",
+		"/pin/add",
+		"/pin/ls",
+		"/pin/rm",
+		"/pin/update",
+		"/pin/verify",
+		"/refs",
+		"/resolve",
+		"/tar",
+		"/tar/add",
+		"/tar/cat",
+		"/version",
+	}
+
+	cmdSet := make(map[string]struct{})
+	collectPaths("", RootTenant, cmdSet)
+
+	for _, path := range list {
+		if _, ok := cmdSet[path]; !ok {
+			t.Errorf("%q not in result", path)
+		} else {
+			delete(cmdSet, path)
+		}
+	}
+
+	for path := range cmdSet {
+		t.Errorf("%q in result but shouldn't be", path)
+	}
+}
+
 func TestCommands(t *testing.T) {
 	list := []string{
 		"/add",
@@ -141,10 +233,18 @@ func TestCommands(t *testing.T) {
 		"/ls",
 		"/mount",
 		"/name",
+		"/name/follow",
+		"/name/follow/add",
+		"/name/follow/ls",
+		"/name/follow/rm",
+		"/name/get",
+		"/name/inspect",
 		"/name/publish",
+		"/name/put",
 		"/name/pubsub",
 		"/name/pubsub/state",
 		"/name/pubsub/subs",
+		"/name/pubsub/subscribe",
 		"/name/pubsub/cancel",
 		"/name/resolve",
 		"/object",
@@ -161,12 +261,18 @@ func TestCommands(t *testing.T) {
 		"/object/put",
 		"/object/stat",
 		"/p2p",
+		"/p2p/acl",
+		"/p2p/acl/allow",
+		"/p2p/acl/deny",
+		"/p2p/acl/open",
+		"/p2p/acl/rm",
 		"/p2p/close",
 		"/p2p/forward",
 		"/p2p/listen",
 		"/p2p/ls",
 		"/p2p/stream",
 		"/p2p/stream/close",
+		"/p2p/stream/dial",
 		"/p2p/stream/ls",
 		"/pin",
 		"/pin/add",
@@ -183,8 +289,14 @@ func TestCommands(t *testing.T) {
 		"/refs",
 		"/refs/local",
 		"/repo",
+		"/repo/backup",
+		"/repo/convert",
 		"/repo/fsck",
 		"/repo/gc",
+		"/repo/migrate",
+		"/repo/restore",
+		"/repo/scrub",
+		"/repo/scrub/status",
 		"/repo/stat",
 		"/repo/verify",
 		"/repo/version",
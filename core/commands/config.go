@@ -145,7 +145,7 @@ var configShowCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Output config file contents.",
 		ShortDescription: `
-NOTE: For security reasons, this command will omit your private key. If you would like to make a full backup of your config (private key included), you must copy the config file from your repo.
+NOTE: For security reasons, this command will omit your private key, the API tokens and the datastore credentials. If you would like to make a full backup of your config (private key included), you must copy the config file from your repo.
 `,
 	},
 	Type: map[string]interface{}{},
@@ -175,6 +175,7 @@ NOTE: For security reasons, this command will omit your private key. If you woul
 		if err != nil {
 			return err
 		}
+		scrubSecrets(cfg)
 
 		return cmds.EmitOnce(res, &cfg)
 	},
@@ -192,6 +193,71 @@ NOTE: For security reasons, this command will omit your private key. If you woul
 	},
 }
 
+// datastoreSecrets are the fields of the datastore specs holding credentials.
+var datastoreSecrets = []string{"secretKey", "sessionToken"}
+
+// scrubSecrets removes the API tokens, which give access to the API as the node
+// or as its tenants, and the credentials of the datastores.
+func scrubSecrets(m map[string]interface{}) {
+	if api, ok := m["API"].(map[string]interface{}); ok {
+		delete(api, "RootToken")
+	}
+	if tenants, ok := m["Tenants"].(map[string]interface{}); ok {
+		for _, t := range tenants {
+			if t, ok := t.(map[string]interface{}); ok {
+				delete(t, "APIToken")
+			}
+		}
+	}
+	if d, ok := m["Datastore"].(map[string]interface{}); ok {
+		scrubDatastoreSecrets(d["Spec"])
+	}
+}
+
+func scrubDatastoreSecrets(spec interface{}) {
+	switch spec := spec.(type) {
+	case map[string]interface{}:
+		for _, k := range datastoreSecrets {
+			delete(spec, k)
+		}
+		for _, v := range spec {
+			scrubDatastoreSecrets(v)
+		}
+	case []interface{}:
+		for _, v := range spec {
+			scrubDatastoreSecrets(v)
+		}
+	}
+}
+
+// restoreDatastoreSecrets copies the credentials missing from a datastore
+// spec from the same place of the old spec.
+func restoreDatastoreSecrets(spec, old interface{}) {
+	switch spec := spec.(type) {
+	case map[string]interface{}:
+		old, ok := old.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for _, k := range datastoreSecrets {
+			if _, ok := spec[k]; !ok && old[k] != nil {
+				spec[k] = old[k]
+			}
+		}
+		for k, v := range spec {
+			restoreDatastoreSecrets(v, old[k])
+		}
+	case []interface{}:
+		old, ok := old.([]interface{})
+		if !ok {
+			return
+		}
+		for i := 0; i < len(spec) && i < len(old); i++ {
+			restoreDatastoreSecrets(spec[i], old[i])
+		}
+	}
+}
+
 func scrubValue(m map[string]interface{}, key []string) error {
 	find := func(m map[string]interface{}, k string) (string, interface{}, bool) {
 		lckey := strings.ToLower(k)
@@ -375,7 +441,8 @@ func buildProfileHelp() string {
 	return out
 }
 
-// scrubPrivKey scrubs private key for security reasons.
+// scrubPrivKey scrubs private key, API tokens and datastore credentials for
+// security reasons.
 func scrubPrivKey(cfg *config.Config) (map[string]interface{}, error) {
 	cfgMap, err := config.ToMap(cfg)
 	if err != nil {
@@ -386,6 +453,7 @@ func scrubPrivKey(cfg *config.Config) (map[string]interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
+	scrubSecrets(cfgMap)
 
 	return cfgMap, nil
 }
@@ -484,5 +552,22 @@ func replaceConfig(r repo.Repo, file io.Reader) error {
 
 	cfg.Identity.PrivKey = pkstr
 
+	// Keep the API tokens and datastore credentials omitted by
+	// 'ipfs config show'.
+	oldCfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+	if cfg.API.RootToken == "" {
+		cfg.API.RootToken = oldCfg.API.RootToken
+	}
+	for name, t := range cfg.Tenants {
+		if t.APIToken == "" {
+			t.APIToken = oldCfg.Tenants[name].APIToken
+			cfg.Tenants[name] = t
+		}
+	}
+	restoreDatastoreSecrets(cfg.Datastore.Spec, oldCfg.Datastore.Spec)
+
 	return r.SetConfig(&cfg)
 }
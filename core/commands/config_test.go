@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDatastoreSecrets(t *testing.T) {
+	const spec = `{
+		"type": "mount",
+		"mounts": [
+			{"type": "s3ds", "bucket": "ipfs", "accessKey": "AKID", "secretKey": "secret", "mountpoint": "/blocks"},
+			{"type": "levelds", "path": "datastore", "mountpoint": "/"}
+		]
+	}`
+	var orig, scrubbed map[string]interface{}
+	if err := json.Unmarshal([]byte(spec), &orig); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(spec), &scrubbed); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := map[string]interface{}{"Datastore": map[string]interface{}{"Spec": scrubbed}}
+	scrubSecrets(cfg)
+	s3 := scrubbed["mounts"].([]interface{})[0].(map[string]interface{})
+	if _, ok := s3["secretKey"]; ok {
+		t.Fatal("expected the secret key to be scrubbed")
+	}
+	if s3["accessKey"] != "AKID" {
+		t.Fatal("expected the access key to be kept")
+	}
+
+	restoreDatastoreSecrets(scrubbed, orig)
+	if !reflect.DeepEqual(scrubbed, orig) {
+		t.Fatalf("expected the secret key to be restored, got %v", scrubbed)
+	}
+}
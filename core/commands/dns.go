@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 
+	cmdenv "github.com/ipsn/go-ipfs/core/commands/cmdenv"
 	ncmd "github.com/ipsn/go-ipfs/core/commands/name"
 	namesys "github.com/ipsn/go-ipfs/namesys"
 	nsopts "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/interface-go-ipfs-core/options/namesys"
@@ -51,6 +52,9 @@ The resolver can recursively resolve:
 	dnslink=/ipns/ipfs.io
 	> ipfs dns -r recursive.ipfs.io
 	/ipfs/QmRzTuh2Lpuz7Gr39stNr6mTFdqAghsZec1JoUnfySUzcy
+
+The lookups of the names under the domain suffixes listed in DNS.Resolvers
+in the config are sent to the DNS-over-HTTPS or DNS servers set there.
 `,
 	},
 
@@ -63,7 +67,15 @@ The resolver can recursively resolve:
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		recursive, _ := req.Options[dnsRecursiveOptionName].(bool)
 		name := req.Arguments[0]
-		resolver := namesys.NewDNSResolver()
+
+		cfg, err := cmdenv.GetConfig(env)
+		if err != nil {
+			return err
+		}
+		resolver, err := namesys.NewDNSResolverWithResolvers(cfg.DNS.Resolvers)
+		if err != nil {
+			return err
+		}
 
 		var ropts []nsopts.ResolveOpt
 		if !recursive {
@@ -518,6 +518,7 @@ Examples:
 const (
 	filesOffsetOptionName = "offset"
 	filesCountOptionName  = "count"
+	filesAppendOptionName = "append"
 )
 
 var filesReadCmd = &cmds.Command{
@@ -674,6 +675,10 @@ written.
 If the '--create' option is specified, the file will be created if it does not
 exist. Nonexistant intermediate directories will not be created.
 
+If the '--append' option is specified, the data is written at the end of the
+file. Appending only rewrites the last nodes of the file, which makes it
+suitable for files growing continuously, like logs.
+
 Newly created files will have the same CID version and hash function of the
 parent directory unless the --cid-version and --hash options are used.
 
@@ -689,6 +694,7 @@ EXAMPLE:
 
     echo "hello world" | ipfs files write --create /myfs/a/b/file
     echo "hello world" | ipfs files write --truncate /myfs/a/b/file
+    echo "hello again" | ipfs files write --append /myfs/a/b/file
 
 WARNING:
 
@@ -703,6 +709,7 @@ stat' on the file or any of its ancestors.
 	},
 	Options: []cmdkit.Option{
 		cmdkit.Int64Option(filesOffsetOptionName, "o", "Byte offset to begin writing at."),
+		cmdkit.BoolOption(filesAppendOptionName, "a", "Write at the end of the file."),
 		cmdkit.BoolOption(filesCreateOptionName, "e", "Create the file if it does not exist."),
 		cmdkit.BoolOption(filesParentsOptionName, "p", "Make parent directories as needed."),
 		cmdkit.BoolOption(filesTruncateOptionName, "t", "Truncate the file to size zero before writing."),
@@ -733,10 +740,14 @@ stat' on the file or any of its ancestors.
 			return err
 		}
 
-		offset, _ := req.Options[filesOffsetOptionName].(int64)
+		offset, offsetFound := req.Options[filesOffsetOptionName].(int64)
 		if offset < 0 {
 			return fmt.Errorf("cannot have negative write offset")
 		}
+		appendData, _ := req.Options[filesAppendOptionName].(bool)
+		if appendData && (offsetFound || trunc) {
+			return fmt.Errorf("cannot append when writing at an offset or truncating")
+		}
 
 		if mkParents {
 			err := ensureContainingDirectoryExists(nd.FilesRoot, path, prefix)
@@ -753,7 +764,7 @@ stat' on the file or any of its ancestors.
 			fi.RawLeaves = rawLeaves
 		}
 
-		wfd, err := fi.Open(mfs.Flags{Write: true, Sync: flush})
+		wfd, err := fi.Open(mfs.Flags{Write: true, Sync: flush, Append: appendData})
 		if err != nil {
 			return err
 		}
@@ -780,7 +791,11 @@ stat' on the file or any of its ancestors.
 			return fmt.Errorf("cannot have negative byte count")
 		}
 
-		_, err = wfd.Seek(int64(offset), io.SeekStart)
+		if appendData {
+			_, err = wfd.Seek(0, io.SeekEnd)
+		} else {
+			_, err = wfd.Seek(int64(offset), io.SeekStart)
+		}
 		if err != nil {
 			flog.Error("seekfail: ", err)
 			return err
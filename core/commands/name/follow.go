@@ -0,0 +1,204 @@
+package name
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	cmdenv "github.com/ipsn/go-ipfs/core/commands/cmdenv"
+	ipnsrp "github.com/ipsn/go-ipfs/namesys/republisher"
+
+	cmdkit "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-cmds"
+	pb "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipns/pb"
+	peer "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peer"
+)
+
+// FollowedName describes a name on the keepalive list and its latest known
+// record.
+type FollowedName struct {
+	Name     string
+	Value    string `json:",omitempty"`
+	Sequence uint64 `json:",omitempty"`
+	Validity string `json:",omitempty"`
+	Error    string `json:",omitempty"`
+}
+
+// FollowedNames is the output of 'ipfs name follow ls'.
+type FollowedNames struct {
+	Names []FollowedName
+}
+
+var FollowCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Keep the IPNS records of third-party names alive.",
+		ShortDescription: `
+Manages the keepalive list of the IPNS republisher. On every republish, the
+latest valid record of each followed name is fetched, stored in the repo and
+put back to the routing system, so it doesn't expire from the network while
+its publisher is offline. No private key is needed.
+
+The republish interval is set by Ipns.RepublishPeriod in the config.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add": followAddCmd,
+		"rm":  followRmCmd,
+		"ls":  followLsCmd,
+	},
+}
+
+var followAddCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Add names to the keepalive list.",
+		ShortDescription: `
+Adds names to the keepalive list. When the daemon is running, their records
+are fetched and republished right away.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg(nameArgName, true, true, "IPNS names to follow."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		var ids []peer.ID
+		for _, name := range req.Arguments {
+			pid, err := parseIpnsName(name)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, pid)
+		}
+
+		for _, pid := range ids {
+			if err := ipnsrp.Follow(nd.Repo.Datastore(), pid); err != nil {
+				return err
+			}
+
+			out := FollowedName{Name: peer.IDB58Encode(pid)}
+			if nd.IpnsRepub != nil {
+				e, err := nd.IpnsRepub.RepublishFollowed(req.Context, pid)
+				if err != nil {
+					out.Error = err.Error()
+				} else {
+					fillFollowedName(&out, e)
+				}
+			}
+			if err := res.Emit(&out); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *FollowedName) error {
+			var err error
+			switch {
+			case out.Error != "":
+				_, err = fmt.Fprintf(w, "Following %s (not republished yet: %s)\n", out.Name, out.Error)
+			case out.Value != "":
+				_, err = fmt.Fprintf(w, "Following %s: %s\n", out.Name, out.Value)
+			default:
+				_, err = fmt.Fprintf(w, "Following %s\n", out.Name)
+			}
+			return err
+		}),
+	},
+	Type: FollowedName{},
+}
+
+var followRmCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Remove names from the keepalive list.",
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg(nameArgName, true, true, "IPNS names to stop following."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range req.Arguments {
+			pid, err := parseIpnsName(name)
+			if err != nil {
+				return err
+			}
+			if err := ipnsrp.Unfollow(nd.Repo.Datastore(), pid); err != nil {
+				return fmt.Errorf("%s: %s", name, err)
+			}
+			if err := res.Emit(&FollowedName{Name: peer.IDB58Encode(pid)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *FollowedName) error {
+			_, err := fmt.Fprintf(w, "Unfollowed %s\n", out.Name)
+			return err
+		}),
+	},
+	Type: FollowedName{},
+}
+
+var followLsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List the names on the keepalive list.",
+		ShortDescription: `
+Lists the followed names along with the value, sequence number and validity of
+the latest record stored for them.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		followed, err := ipnsrp.ListFollowed(req.Context, nd.Repo.Datastore())
+		if err != nil {
+			return err
+		}
+
+		out := &FollowedNames{Names: make([]FollowedName, 0, len(followed))}
+		for pid, e := range followed {
+			n := FollowedName{Name: peer.IDB58Encode(pid)}
+			fillFollowedName(&n, e)
+			out.Names = append(out.Names, n)
+		}
+		sort.Slice(out.Names, func(i, j int) bool {
+			return out.Names[i].Name < out.Names[j].Name
+		})
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *FollowedNames) error {
+			tw := tabwriter.NewWriter(w, 1, 2, 1, ' ', 0)
+			for _, n := range out.Names {
+				if n.Value == "" {
+					fmt.Fprintf(tw, "%s\t-\t\t\n", n.Name)
+					continue
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", n.Name, n.Value, n.Sequence, n.Validity)
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: FollowedNames{},
+}
+
+func fillFollowedName(n *FollowedName, e *pb.IpnsEntry) {
+	if e == nil {
+		return
+	}
+	n.Value = string(e.GetValue())
+	n.Sequence = e.GetSequence()
+	n.Validity = string(e.GetValidity())
+}
@@ -30,6 +30,7 @@ const (
 	dhtRecordCountOptionName = "dht-record-count"
 	dhtTimeoutOptionName     = "dht-timeout"
 	streamOptionName         = "stream"
+	staleOKOptionName        = "stale-ok"
 )
 
 var IpnsCmd = &cmds.Command{
@@ -67,6 +68,11 @@ Resolve the value of a dnslink:
   > ipfs name resolve ipfs.io
   /ipfs/QmaBvfZooxWkrv7D3r8LS9moNjzD2o525XMZze69hhoxf5
 
+Resolved entries are cached for the TTL of their records. When
+Ipns.ResolveCacheMaxStaleness is set in the config, --stale-ok returns an
+entry that has expired less than that long ago right away, and refreshes it in
+the background. --nocache bypasses the cache entirely.
+
 `,
 	},
 
@@ -76,6 +82,7 @@ Resolve the value of a dnslink:
 	Options: []cmdkit.Option{
 		cmdkit.BoolOption(recursiveOptionName, "r", "Resolve until the result is not an IPNS name.").WithDefault(true),
 		cmdkit.BoolOption(nocacheOptionName, "n", "Do not use cached entries."),
+		cmdkit.BoolOption(staleOKOptionName, "Return stale cached entries right away and refresh them in the background."),
 		cmdkit.UintOption(dhtRecordCountOptionName, "dhtrc", "Number of records to request for DHT resolution."),
 		cmdkit.StringOption(dhtTimeoutOptionName, "dhtt", "Max time to collect values during DHT resolution eg \"30s\". Pass 0 for no timeout."),
 		cmdkit.BoolOption(streamOptionName, "s", "Stream entries as they are found."),
@@ -104,8 +111,11 @@ Resolve the value of a dnslink:
 		dhtt, dhttok := req.Options[dhtTimeoutOptionName].(string)
 		stream, _ := req.Options[streamOptionName].(bool)
 
+		staleOK, _ := req.Options[staleOKOptionName].(bool)
+
 		opts := []options.NameResolveOption{
 			options.Name.Cache(!nocache),
+			options.Name.ResolveOption(nsopts.StaleOK(staleOK)),
 		}
 
 		if !recursive {
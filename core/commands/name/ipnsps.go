@@ -8,6 +8,7 @@ import (
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-cmds"
 	"github.com/ipsn/go-ipfs/core/commands/cmdenv"
+	"github.com/ipsn/go-ipfs/namesys"
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peer"
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-record"
 )
@@ -31,13 +32,19 @@ var IpnsPubsubCmd = &cmds.Command{
 		ShortDescription: `
 Manage and inspect the state of the IPNS pubsub resolver.
 
+Names are subscribed to the first time they are resolved. Subscriptions made
+with 'ipfs name pubsub subscribe' are also restored when the daemon restarts.
+The latest known records of subscribed names are published again every
+Ipns.PubsubRebroadcastInterval, so peers joining late get them right away.
+
 Note: this command is experimental and subject to change as the system is refined
 `,
 	},
 	Subcommands: map[string]*cmds.Command{
-		"state":  ipnspsStateCmd,
-		"subs":   ipnspsSubsCmd,
-		"cancel": ipnspsCancelCmd,
+		"state":     ipnspsStateCmd,
+		"subs":      ipnspsSubsCmd,
+		"subscribe": ipnspsSubscribeCmd,
+		"cancel":    ipnspsCancelCmd,
 	},
 }
 
@@ -105,6 +112,56 @@ var ipnspsSubsCmd = &cmds.Command{
 	},
 }
 
+var ipnspsSubscribeCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Subscribe to name updates",
+		ShortDescription: `
+Subscribes to the pubsub topics of the given names, without resolving them.
+The subscriptions are persisted and restored when the daemon restarts, until
+they are canceled with 'ipfs name pubsub cancel'.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if n.PSRouter == nil {
+			return cmdkit.Errorf(cmdkit.ErrClient, "IPNS pubsub subsystem is not enabled")
+		}
+
+		var pids []peer.ID
+		for _, name := range req.Arguments {
+			pid, err := peer.IDB58Decode(strings.TrimPrefix(name, "/ipns/"))
+			if err != nil {
+				return cmdkit.Errorf(cmdkit.ErrClient, "%s", err)
+			}
+			pids = append(pids, pid)
+		}
+
+		var paths []string
+		for _, pid := range pids {
+			if err := n.PSRouter.Subscribe("/ipns/" + string(pid)); err != nil {
+				return err
+			}
+			if err := namesys.AddPubsubSubscription(n.Repo.Datastore(), pid); err != nil {
+				return err
+			}
+			paths = append(paths, "/ipns/"+peer.IDB58Encode(pid))
+		}
+
+		return cmds.EmitOnce(res, &stringList{paths})
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("name", true, true, "Names to subscribe to."),
+	},
+	Type: stringList{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: stringListEncoder(),
+	},
+}
+
 var ipnspsCancelCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Cancel a name subscription",
@@ -130,7 +187,11 @@ var ipnspsCancelCmd = &cmds.Command{
 		if err != nil {
 			return err
 		}
-		return cmds.EmitOnce(res, &ipnsPubsubCancel{ok})
+		persisted, err := namesys.RemovePubsubSubscription(n.Repo.Datastore(), pid)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &ipnsPubsubCancel{ok || persisted})
 	},
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("name", true, false, "Name to cancel the subscription for."),
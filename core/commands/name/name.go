@@ -51,6 +51,10 @@ Resolve the value of another name:
   > ipfs name resolve QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ
   /ipfs/QmSiTko9JZyabH56y2fussEt1A5oDqsFXB3CkvAqraFryz
 
+Inspect the record published for a name:
+
+  > ipfs name inspect QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ
+
 Resolve the value of a dnslink:
 
   > ipfs name resolve ipfs.io
@@ -63,5 +67,9 @@ Resolve the value of a dnslink:
 		"publish": PublishCmd,
 		"resolve": IpnsCmd,
 		"pubsub":  IpnsPubsubCmd,
+		"inspect": InspectCmd,
+		"get":     GetCmd,
+		"put":     PutCmd,
+		"follow":  FollowCmd,
 	},
 }
@@ -1,9 +1,11 @@
 package name
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	cmdenv "github.com/ipsn/go-ipfs/core/commands/cmdenv"
@@ -26,6 +28,8 @@ const (
 	ttlOptionName          = "ttl"
 	keyOptionName          = "key"
 	quieterOptionName      = "quieter"
+	sequenceOptionName     = "sequence"
+	dataOptionName         = "data"
 )
 
 var PublishCmd = &cmds.Command{
@@ -65,6 +69,17 @@ Alternatively, publish an <ipfs-path> using a valid PeerID (as listed by
  > ipfs name publish --key=QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
   Published to QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
 
+The sequence number of the record is incremented whenever the published value
+changes. Use --sequence to set it explicitly, e.g. to supersede a record
+published from another machine. It may not be lower than the sequence number
+of the last record published by this node.
+
+Extra data can be attached to the record with --data, as a JSON object. It is
+signed along with the value, the validity, the ttl and the sequence number of
+the record:
+
+  > ipfs name publish --ttl=10m --data='{"comment":"release 1.2"}' /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+
 `,
 	},
 
@@ -81,6 +96,8 @@ Alternatively, publish an <ipfs-path> using a valid PeerID (as listed by
 		cmdkit.StringOption(ttlOptionName, "Time duration this record should be cached for. Uses the same syntax as the lifetime option. (caution: experimental)"),
 		cmdkit.StringOption(keyOptionName, "k", "Name of the key to be used or a valid PeerID, as listed by 'ipfs key list -l'.").WithDefault("self"),
 		cmdkit.BoolOption(quieterOptionName, "Q", "Write only final hash."),
+		cmdkit.Uint64Option(sequenceOptionName, "Sequence number of the record. Defaults to the last one, incremented if the value changes."),
+		cmdkit.StringOption(dataOptionName, "Extra data to sign along with the record, as a JSON object."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
@@ -112,6 +129,19 @@ Alternatively, publish an <ipfs-path> using a valid PeerID (as listed by
 			opts = append(opts, options.Name.TTL(d))
 		}
 
+		if seq, found := req.Options[sequenceOptionName].(uint64); found {
+			opts = append(opts, options.Name.Sequence(seq))
+		}
+
+		if data, found := req.Options[dataOptionName].(string); found {
+			extra, err := parseRecordData(data)
+			if err != nil {
+				return fmt.Errorf("error parsing data option: %s", err)
+			}
+
+			opts = append(opts, options.Name.Data(extra))
+		}
+
 		p, err := iface.ParsePath(req.Arguments[0])
 		if err != nil {
 			return err
@@ -151,3 +181,42 @@ Alternatively, publish an <ipfs-path> using a valid PeerID (as listed by
 	},
 	Type: IpnsEntry{},
 }
+
+// parseRecordData parses the JSON object given to --data. Numbers are decoded
+// as integers when possible so they are encoded as such in the record.
+func parseRecordData(data string) (map[string]interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+
+	var extra map[string]interface{}
+	if err := dec.Decode(&extra); err != nil {
+		return nil, err
+	}
+	if extra == nil {
+		return nil, errors.New("expected a JSON object")
+	}
+	for k, v := range extra {
+		extra[k] = convertJSONNumbers(v)
+	}
+	return extra, nil
+}
+
+func convertJSONNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = convertJSONNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = convertJSONNumbers(e)
+		}
+	}
+	return v
+}
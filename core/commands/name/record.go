@@ -0,0 +1,344 @@
+package name
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	core "github.com/ipsn/go-ipfs/core"
+	cmdenv "github.com/ipsn/go-ipfs/core/commands/cmdenv"
+
+	proto "github.com/gogo/protobuf/proto"
+	cmdkit "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-cmdkit"
+	cmds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-cmds"
+	ipns "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipns"
+	pb "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipns/pb"
+	ic "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peer"
+)
+
+// IpnsInspectEntry describes a decoded IPNS record.
+type IpnsInspectEntry struct {
+	Name         string `json:",omitempty"`
+	Value        string
+	ValidityType string
+	Validity     string
+	Sequence     uint64
+	TTL          *time.Duration `json:",omitempty"`
+	PublicKey    string
+	Validation   string
+	Data         map[string]interface{} `json:",omitempty"`
+}
+
+const (
+	recordArgName = "record"
+	nameArgName   = "name"
+)
+
+var InspectCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Decode and verify an IPNS record.",
+		ShortDescription: `
+Prints the fields of an IPNS record and checks its signature. The record is
+either fetched from the routing system for the given name, or read from a file
+or from standard input.
+`,
+		LongDescription: `
+Prints the fields of an IPNS record and checks its signature. The record is
+either fetched from the routing system for the given name, or read from a file
+or from standard input.
+
+The record is only read from standard input when no name is given. The
+signature of a record read from a file or from standard input can only be
+checked if the name it was published under is given, or if the record embeds
+its public key.
+
+Examples:
+
+Inspect the record currently published for a name:
+
+  > ipfs name inspect QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n
+
+Inspect a record saved by 'ipfs name get':
+
+  > ipfs name inspect QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n record.bin
+  > ipfs name inspect < record.bin
+`,
+	},
+
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg(nameArgName, false, false, "IPNS name to fetch the record of, or to verify the given record against."),
+		cmdkit.FileArg(recordArgName, false, false, "File holding the IPNS record to inspect.").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		var pid peer.ID
+		if len(req.Arguments) > 0 {
+			pid, err = parseIpnsName(req.Arguments[0])
+			if err != nil {
+				return err
+			}
+		}
+
+		var data []byte
+		if req.Files != nil {
+			file, err := cmdenv.GetFileArg(req.Files.Entries())
+			if err != nil {
+				return err
+			}
+			data, err = ioutil.ReadAll(file)
+			if err != nil {
+				return err
+			}
+		} else {
+			if pid == "" {
+				return fmt.Errorf("a name or a record is required")
+			}
+			data, err = nd.Routing.GetValue(req.Context, ipns.RecordKey(pid))
+			if err != nil {
+				return err
+			}
+		}
+
+		entry := new(pb.IpnsEntry)
+		if err := proto.Unmarshal(data, entry); err != nil {
+			return ipns.ErrBadRecord
+		}
+
+		out, err := inspectRecord(pid, entry)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *IpnsInspectEntry) error {
+			if out.Name != "" {
+				fmt.Fprintf(w, "Name:          %s\n", out.Name)
+			}
+			fmt.Fprintf(w, "Value:         %s\n", out.Value)
+			fmt.Fprintf(w, "Validity Type: %s\n", out.ValidityType)
+			fmt.Fprintf(w, "Validity:      %s\n", out.Validity)
+			fmt.Fprintf(w, "Sequence:      %d\n", out.Sequence)
+			if out.TTL != nil {
+				fmt.Fprintf(w, "TTL:           %s\n", *out.TTL)
+			}
+			fmt.Fprintf(w, "Public Key:    %s\n", out.PublicKey)
+			fmt.Fprintf(w, "Validation:    %s\n", out.Validation)
+			if len(out.Data) > 0 {
+				fmt.Fprintln(w, "Data:")
+				keys := make([]string, 0, len(out.Data))
+				for k := range out.Data {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					fmt.Fprintf(w, "  %s: %v\n", k, out.Data[k])
+				}
+			}
+			return nil
+		}),
+	},
+	Type: IpnsInspectEntry{},
+}
+
+var GetCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Fetch the signed IPNS record of a name.",
+		ShortDescription: `
+Fetches the IPNS record published for the given name from the routing system
+and writes it, as is, to standard output. The record can be decoded with
+'ipfs name inspect' and published again with 'ipfs name put'.
+
+When the node is offline, the record is looked up in the local datastore. This
+allows signing records on an offline machine:
+
+  offline> ipfs name publish --allow-offline --key=cold /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+  offline> ipfs name get QmSrPmbaUKA3ZodhzPWZnpFgcPMFWF4QsxXbkWfEptTBJd > record.bin
+
+  online> ipfs name put QmSrPmbaUKA3ZodhzPWZnpFgcPMFWF4QsxXbkWfEptTBJd record.bin
+`,
+	},
+
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg(nameArgName, true, false, "IPNS name to fetch the record of."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		pid, err := parseIpnsName(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		data, err := nd.Routing.GetValue(req.Context, ipns.RecordKey(pid))
+		if err != nil {
+			return err
+		}
+
+		return res.Emit(bytes.NewReader(data))
+	},
+}
+
+var PutCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Publish a pre-signed IPNS record.",
+		ShortDescription: `
+Publishes an IPNS record, as written by 'ipfs name get', to the routing system
+under the given name. The record is verified against the name before being
+published, so it must have been signed with the key of the name and must not
+have expired.
+`,
+	},
+
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg(nameArgName, true, false, "IPNS name to publish the record under."),
+		cmdkit.FileArg(recordArgName, true, false, "File holding the IPNS record to publish.").EnableStdin(),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(allowOfflineOptionName, "When offline, save the IPNS record to the the local datastore without broadcasting to the network instead of simply failing."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		allowOffline, _ := req.Options[allowOfflineOptionName].(bool)
+		if !nd.IsOnline && !allowOffline {
+			return errAllowOffline
+		}
+
+		pid, err := parseIpnsName(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		file, err := cmdenv.GetFileArg(req.Files.Entries())
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			return err
+		}
+
+		if err := putRecord(req, nd, pid, data); err != nil {
+			return err
+		}
+
+		entry := new(pb.IpnsEntry)
+		if err := proto.Unmarshal(data, entry); err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &IpnsEntry{
+			Name:  peer.IDB58Encode(pid),
+			Value: string(entry.GetValue()),
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, ie *IpnsEntry) error {
+			_, err := fmt.Fprintf(w, "Published to %s: %s\n", ie.Name, ie.Value)
+			return err
+		}),
+	},
+	Type: IpnsEntry{},
+}
+
+// putRecord validates the record against the name and stores it in the
+// routing system.
+func putRecord(req *cmds.Request, nd *core.IpfsNode, pid peer.ID, data []byte) error {
+	key := ipns.RecordKey(pid)
+	validator := ipns.Validator{KeyBook: nd.Peerstore}
+	if err := validator.Validate(key, data); err != nil {
+		return err
+	}
+	return nd.Routing.PutValue(req.Context, key, data)
+}
+
+// parseIpnsName returns the peer ID of an IPNS name, given with or without
+// the /ipns/ prefix.
+func parseIpnsName(name string) (peer.ID, error) {
+	pid, err := peer.IDB58Decode(strings.TrimPrefix(name, "/ipns/"))
+	if err != nil {
+		return "", fmt.Errorf("invalid IPNS name %q: %s", name, err)
+	}
+	return pid, nil
+}
+
+// inspectRecord decodes the fields of the record and verifies it against the
+// given name or, if the name isn't known, against the public key embedded in
+// the record.
+func inspectRecord(pid peer.ID, entry *pb.IpnsEntry) (*IpnsInspectEntry, error) {
+	out := &IpnsInspectEntry{
+		Value:        string(entry.GetValue()),
+		ValidityType: entry.GetValidityType().String(),
+		Validity:     string(entry.GetValidity()),
+		Sequence:     entry.GetSequence(),
+	}
+	if entry.Ttl != nil {
+		ttl := time.Duration(entry.GetTtl())
+		out.TTL = &ttl
+	}
+
+	data, err := ipns.GetExtraData(entry)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		out.Data = data
+	}
+
+	if entry.PubKey != nil {
+		out.PublicKey = "embedded in the record"
+	} else {
+		out.PublicKey = "extracted from the name"
+	}
+
+	if pid == "" {
+		if entry.PubKey == nil {
+			out.PublicKey = "unknown"
+			out.Validation = "not verified, the name of the record is required"
+			return out, nil
+		}
+		pk, err := ic.UnmarshalPublicKey(entry.PubKey)
+		if err != nil {
+			out.Validation = fmt.Sprintf("unmarshaling pubkey in record: %s", err)
+			return out, nil
+		}
+		pid, err = peer.IDFromPublicKey(pk)
+		if err != nil {
+			out.Validation = err.Error()
+			return out, nil
+		}
+	}
+	out.Name = peer.IDB58Encode(pid)
+
+	pk, err := ipns.ExtractPublicKey(pid, entry)
+	if err != nil {
+		out.Validation = err.Error()
+		return out, nil
+	}
+	if pk == nil {
+		out.PublicKey = "unknown"
+		out.Validation = ipns.ErrPublicKeyNotFound.Error()
+		return out, nil
+	}
+	if err := ipns.Validate(pk, entry); err != nil {
+		out.Validation = err.Error()
+		return out, nil
+	}
+	out.Validation = "valid"
+	return out, nil
+}
@@ -0,0 +1,68 @@
+package name
+
+import (
+	"testing"
+	"time"
+
+	ipns "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipns"
+	ci "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peer"
+)
+
+func TestInspectRecord(t *testing.T) {
+	sk, pk, err := ci.GenerateKeyPair(ci.RSA, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := []byte("/ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy")
+	ttl := time.Minute
+	entry, err := ipns.CreateWithData(sk, value, 3, time.Now().Add(time.Hour), &ttl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the name nor an embedded key, the record can't be verified.
+	out, err := inspectRecord("", entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Validation == "valid" || out.Name != "" {
+		t.Fatalf("unexpected validation of an anonymous record: %+v", out)
+	}
+
+	if err := ipns.EmbedPublicKey(pk, entry); err != nil {
+		t.Fatal(err)
+	}
+	out, err = inspectRecord("", entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Validation != "valid" || out.Name != peer.IDB58Encode(pid) {
+		t.Fatalf("expected record to be verified with its embedded key: %+v", out)
+	}
+	if out.Sequence != 3 || out.TTL == nil || *out.TTL != time.Minute || out.Value != string(value) {
+		t.Fatalf("unexpected record fields: %+v", out)
+	}
+
+	// A record checked against another name fails validation.
+	_, otherPk, err := ci.GenerateKeyPair(ci.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := peer.IDFromPublicKey(otherPk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = inspectRecord(other, entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Validation == "valid" {
+		t.Fatal("expected record to fail validation against another name")
+	}
+}
@@ -7,16 +7,20 @@ import (
 	"io"
 	"strconv"
 	"strings"
+	"sync"
 	"text/tabwriter"
 	"time"
 
 	core "github.com/ipsn/go-ipfs/core"
 	cmdenv "github.com/ipsn/go-ipfs/core/commands/cmdenv"
 	p2p "github.com/ipsn/go-ipfs/p2p"
+	repo "github.com/ipsn/go-ipfs/repo"
 
 	ipfsaddr "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-addr"
 	cmdkit "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-cmdkit"
 	cmds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-cmds"
+	config "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-config"
+	peer "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peer"
 	pstore "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peerstore"
 	protocol "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-protocol"
 	ma "github.com/ipsn/go-ipfs/gxlibs/github.com/multiformats/go-multiaddr"
@@ -31,6 +35,20 @@ type P2PListenerInfoOutput struct {
 	Protocol      string
 	ListenAddress string
 	TargetAddress string
+
+	// Access control of p2p listeners, unset for local ones.
+	AllowedPeers []string `json:",omitempty"`
+	DeniedPeers  []string `json:",omitempty"`
+	Restricted   bool     `json:",omitempty"`
+	Rejected     *uint64  `json:",omitempty"`
+}
+
+// P2PACLOutput is output type of acl commands
+type P2PACLOutput struct {
+	Protocol     string
+	AllowedPeers []string
+	DeniedPeers  []string
+	Restricted   bool
 }
 
 // P2PStreamInfoOutput is output type of streams command
@@ -54,6 +72,10 @@ type P2PStreamsOutput struct {
 const (
 	allowCustomProtocolOptionName = "allow-custom-protocol"
 	reportPeerIDOptionName        = "report-peer-id"
+	allowPeerOptionName           = "allow-peer"
+	denyPeerOptionName            = "deny-peer"
+	persistOptionName             = "persist"
+	httpOptionName                = "http"
 )
 
 var resolveTimeout = 10 * time.Second
@@ -75,6 +97,7 @@ are refined`,
 		"listen":  p2pListenCmd,
 		"close":   p2pCloseCmd,
 		"ls":      p2pLsCmd,
+		"acl":     p2pACLCmd,
 	},
 }
 
@@ -87,9 +110,14 @@ Forward connections made to <listen-address> to <target-address>.
 <protocol> specifies the libp2p protocol name to use for libp2p
 connections and/or handlers. It must be prefixed with '` + P2PProtoPrefix + `'.
 
+<listen-address> is either a TCP/UDP address or a unix socket path, such as
+/unix/run/myproto.sock.
+
 Example:
   ipfs p2p forward ` + P2PProtoPrefix + `myproto /ip4/127.0.0.1/tcp/4567 /ipfs/QmPeer
     - Forward connections to 127.0.0.1:4567 to '` + P2PProtoPrefix + `myproto' service on /ipfs/QmPeer
+  ipfs p2p forward ` + P2PProtoPrefix + `myproto /unix/tmp/myproto.sock /ipfs/QmPeer
+    - Forward connections to the /tmp/myproto.sock unix socket to '` + P2PProtoPrefix + `myproto' service on /ipfs/QmPeer
 
 `,
 	},
@@ -100,6 +128,7 @@ Example:
 	},
 	Options: []cmdkit.Option{
 		cmdkit.BoolOption(allowCustomProtocolOptionName, "Don't require /x/ prefix"),
+		cmdkit.BoolOption(persistOptionName, "Save the listener to the config, to re-create it when the daemon restarts"),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := p2pGetNode(env)
@@ -129,7 +158,18 @@ Example:
 			return errors.New("protocol name must be within '" + P2PProtoPrefix + "' namespace")
 		}
 
-		return forwardLocal(n.Context(), n.P2P, n.Peerstore, proto, listen, targets)
+		if err := forwardLocal(n.Context(), n.P2P, n.Peerstore, proto, listen, targets); err != nil {
+			return err
+		}
+
+		if persist, _ := req.Options[persistOptionName].(bool); persist {
+			return persistP2PListener(n.Repo, config.P2PListener{
+				Protocol:      protoOpt,
+				ListenAddress: listen.String(),
+				TargetAddress: targets[0].String(),
+			})
+		}
+		return nil
 	},
 }
 
@@ -172,9 +212,28 @@ Create libp2p service and forward connections made to <target-address>.
 
 <protocol> specifies the libp2p handler name. It must be prefixed with '` + P2PProtoPrefix + `'.
 
+<target-address> is either a TCP/UDP address or a unix socket path, such as
+/unix/run/myproto.sock.
+
+With --http, the target must be an HTTP service. HTTP is then terminated on
+this node: the requests are reverse-proxied to the target with the peer ID of
+the requesting peer in the X-Libp2p-Peer-Id header. Other nodes reach the
+service through the /p2p/ proxy of their gateway (see Gateway.P2PProxy), at
+/p2p/<peer-id>/x/<name>/http/<path> for a '` + P2PProtoPrefix + `<name>/http' protocol.
+
+By default, any peer may connect to the service. --allow-peer restricts it to
+the given peers and --deny-peer rejects the given peers. Both take a comma
+separated list of peer IDs and can be changed later with 'ipfs p2p acl'.
+
 Example:
   ipfs p2p listen ` + P2PProtoPrefix + `myproto /ip4/127.0.0.1/tcp/1234
     - Forward connections to 'myproto' libp2p service to 127.0.0.1:1234
+  ipfs p2p listen ` + P2PProtoPrefix + `myproto /unix/run/myproto.sock
+    - Forward connections to 'myproto' libp2p service to the /run/myproto.sock unix socket
+  ipfs p2p listen --allow-peer=QmPeer1,QmPeer2 ` + P2PProtoPrefix + `myproto /ip4/127.0.0.1/tcp/1234
+    - Only let QmPeer1 and QmPeer2 connect to 'myproto' libp2p service
+  ipfs p2p listen --http ` + P2PProtoPrefix + `myapp/http /ip4/127.0.0.1/tcp/8080
+    - Serve the HTTP service at 127.0.0.1:8080 as 'myapp/http' libp2p service
 
 `,
 	},
@@ -185,6 +244,10 @@ Example:
 	Options: []cmdkit.Option{
 		cmdkit.BoolOption(allowCustomProtocolOptionName, "Don't require /x/ prefix"),
 		cmdkit.BoolOption(reportPeerIDOptionName, "r", "Send remote base58 peerid to target when a new connection is established"),
+		cmdkit.StringOption(allowPeerOptionName, "Comma separated list of the only peers allowed to connect"),
+		cmdkit.StringOption(denyPeerOptionName, "Comma separated list of peers not allowed to connect"),
+		cmdkit.BoolOption(persistOptionName, "Save the listener to the config, to re-create it when the daemon restarts"),
+		cmdkit.BoolOption(httpOptionName, "Reverse-proxy HTTP requests to the target instead of forwarding raw streams"),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := p2pGetNode(env)
@@ -214,14 +277,98 @@ Example:
 			return errors.New("protocol name must be within '" + P2PProtoPrefix + "' namespace")
 		}
 
-		_, err = n.P2P.ForwardRemote(n.Context(), proto, target, reportPeerID)
-		return err
+		allowOpt, _ := req.Options[allowPeerOptionName].(string)
+		allowed, err := p2p.ParsePeerIDs(strings.Split(allowOpt, ","))
+		if err != nil {
+			return err
+		}
+		denyOpt, _ := req.Options[denyPeerOptionName].(string)
+		denied, err := p2p.ParsePeerIDs(strings.Split(denyOpt, ","))
+		if err != nil {
+			return err
+		}
+
+		serveHTTP, _ := req.Options[httpOptionName].(bool)
+		if serveHTTP && reportPeerID {
+			return errors.New("can't combine --http with --report-peer-id, the peer ID is sent in the X-Libp2p-Peer-Id header")
+		}
+
+		acl := p2p.NewPeerACL(allowed, denied)
+		if serveHTTP {
+			_, err = n.P2P.ForwardHTTP(n.Context(), proto, target, acl)
+		} else {
+			_, err = n.P2P.ForwardRemote(n.Context(), proto, target, reportPeerID, acl)
+		}
+		if err != nil {
+			return err
+		}
+
+		if persist, _ := req.Options[persistOptionName].(bool); persist {
+			return persistP2PListener(n.Repo, config.P2PListener{
+				Protocol:      protoOpt,
+				TargetAddress: target.String(),
+				HTTP:          serveHTTP,
+				ReportPeerID:  reportPeerID,
+				AllowPeers:    peerStrings(allowed),
+				DenyPeers:     peerStrings(denied),
+				Restricted:    acl.Restricted(),
+			})
+		}
+		return nil
 	},
 }
 
+// persistP2PListener saves a listener to the P2P.Listeners config section,
+// replacing the entry of the same listener if any.
+func persistP2PListener(r repo.Repo, l config.P2PListener) error {
+	return updateP2PListeners(r, func(listeners []config.P2PListener) []config.P2PListener {
+		out := listeners[:0]
+		for _, old := range listeners {
+			if old.Protocol == l.Protocol && old.ListenAddress == l.ListenAddress {
+				continue
+			}
+			out = append(out, old)
+		}
+		return append(out, l)
+	})
+}
+
+// p2pListenersLock serializes the updates of the P2P.Listeners config
+// section, so that concurrent commands don't overwrite each other's changes.
+var p2pListenersLock sync.Mutex
+
+// updateP2PListeners rewrites the P2P.Listeners config section.
+func updateP2PListeners(r repo.Repo, update func([]config.P2PListener) []config.P2PListener) error {
+	p2pListenersLock.Lock()
+	defer p2pListenersLock.Unlock()
+
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+	cfg, err = cfg.Clone()
+	if err != nil {
+		return err
+	}
+	cfg.P2P.Listeners = update(cfg.P2P.Listeners)
+	return r.SetConfig(cfg)
+}
+
+func peerStrings(ids []peer.ID) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.Pretty()
+	}
+	return out
+}
+
 // checkPort checks whether target multiaddr contains tcp or udp protocol
-// and whether the port is equal to 0
+// and whether the port is equal to 0. Unix socket targets have no port.
 func checkPort(target ma.Multiaddr) error {
+	if _, err := target.ValueForProtocol(ma.P_UNIX); err == nil {
+		return nil
+	}
+
 	// get tcp or udp port from multiaddr
 	getPort := func() (string, error) {
 		sport, _ := target.ValueForProtocol(ma.P_TCP)
@@ -274,7 +421,7 @@ var p2pLsCmd = &cmds.Command{
 		Tagline: "List active p2p listeners.",
 	},
 	Options: []cmdkit.Option{
-		cmdkit.BoolOption(p2pHeadersOptionName, "v", "Print table headers (Protocol, Listen, Target)."),
+		cmdkit.BoolOption(p2pHeadersOptionName, "v", "Print table headers (Protocol, Listen, Target) and the access control of p2p listeners."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := p2pGetNode(env)
@@ -296,11 +443,20 @@ var p2pLsCmd = &cmds.Command{
 
 		n.P2P.ListenersP2P.Lock()
 		for _, listener := range n.P2P.ListenersP2P.Listeners {
-			output.Listeners = append(output.Listeners, P2PListenerInfoOutput{
+			info := P2PListenerInfoOutput{
 				Protocol:      string(listener.Protocol()),
 				ListenAddress: listener.ListenAddress().String(),
 				TargetAddress: listener.TargetAddress().String(),
-			})
+			}
+			if l, ok := listener.(interface{ ACL() *p2p.PeerACL }); ok {
+				acl := l.ACL()
+				rejected := acl.Rejected()
+				info.AllowedPeers = peerStrings(acl.Allowed())
+				info.DeniedPeers = peerStrings(acl.Denied())
+				info.Restricted = acl.Restricted()
+				info.Rejected = &rejected
+			}
+			output.Listeners = append(output.Listeners, info)
 		}
 		n.P2P.ListenersP2P.Unlock()
 
@@ -312,11 +468,27 @@ var p2pLsCmd = &cmds.Command{
 			headers, _ := req.Options[p2pHeadersOptionName].(bool)
 			tw := tabwriter.NewWriter(w, 1, 2, 1, ' ', 0)
 			for _, listener := range out.Listeners {
-				if headers {
-					fmt.Fprintln(tw, "Protocol\tListen Address\tTarget Address")
+				if !headers {
+					fmt.Fprintf(tw, "%s\t%s\t%s\n", listener.Protocol, listener.ListenAddress, listener.TargetAddress)
+					continue
 				}
 
-				fmt.Fprintf(tw, "%s\t%s\t%s\n", listener.Protocol, listener.ListenAddress, listener.TargetAddress)
+				fmt.Fprintln(tw, "Protocol\tListen Address\tTarget Address\tAllowed\tDenied\tRejected")
+				allowed, denied, rejected := "-", "-", "-"
+				if listener.Rejected != nil {
+					allowed, denied = "all", "none"
+					if listener.Restricted {
+						allowed = "none"
+						if len(listener.AllowedPeers) > 0 {
+							allowed = strings.Join(listener.AllowedPeers, ",")
+						}
+					}
+					if len(listener.DeniedPeers) > 0 {
+						denied = strings.Join(listener.DeniedPeers, ",")
+					}
+					rejected = strconv.FormatUint(*listener.Rejected, 10)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", listener.Protocol, listener.ListenAddress, listener.TargetAddress, allowed, denied, rejected)
 			}
 			tw.Flush()
 
@@ -325,6 +497,123 @@ var p2pLsCmd = &cmds.Command{
 	},
 }
 
+// p2pACLCmd is the 'ipfs p2p acl' command
+var p2pACLCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Manage the peers allowed to connect to p2p listeners.",
+		ShortDescription: `
+Changes the access control lists of the services created with 'ipfs p2p listen'.
+Denied peers are always rejected. Once peers have been allowed, only the peers
+on the allow list may connect, even after the last of them is removed, until
+'ipfs p2p acl open' lets any peer in again. Rejected attempts are logged and
+counted in 'ipfs p2p ls -v'.
+`,
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"allow": p2pACLModifyCmd("Allow peers to connect to a p2p listener.", (*p2p.PeerACL).Allow),
+		"deny":  p2pACLModifyCmd("Deny peers from connecting to a p2p listener.", (*p2p.PeerACL).Deny),
+		"rm":    p2pACLModifyCmd("Remove peers from the allow and deny lists of a p2p listener.", (*p2p.PeerACL).Remove),
+		"open":  p2pACLOpenCmd,
+	},
+}
+
+var p2pACLOpenCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Clear the allow list of a p2p listener, letting any peer that isn't denied connect.",
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("protocol", true, false, "Protocol name of the listener."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(persistOptionName, "Also update the listener saved to the config"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		return runP2PACLCmd(req, res, env, func(acl *p2p.PeerACL) {
+			acl.Open()
+		})
+	},
+	Type:     P2PACLOutput{},
+	Encoders: p2pACLEncoders,
+}
+
+func p2pACLModifyCmd(tagline string, modify func(*p2p.PeerACL, ...peer.ID)) *cmds.Command {
+	return &cmds.Command{
+		Helptext: cmdkit.HelpText{
+			Tagline: tagline,
+		},
+		Arguments: []cmdkit.Argument{
+			cmdkit.StringArg("protocol", true, false, "Protocol name of the listener."),
+			cmdkit.StringArg("peer", true, true, "Peer IDs."),
+		},
+		Options: []cmdkit.Option{
+			cmdkit.BoolOption(persistOptionName, "Also update the listener saved to the config"),
+		},
+		Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+			ids, err := p2p.ParsePeerIDs(req.Arguments[1:])
+			if err != nil {
+				return err
+			}
+			return runP2PACLCmd(req, res, env, func(acl *p2p.PeerACL) {
+				modify(acl, ids...)
+			})
+		},
+		Type:     P2PACLOutput{},
+		Encoders: p2pACLEncoders,
+	}
+}
+
+// runP2PACLCmd changes the ACL of the listener of the protocol given as first
+// argument, saving it to the config with --persist, and emits the new ACL.
+func runP2PACLCmd(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment, modify func(*p2p.PeerACL)) error {
+	n, err := p2pGetNode(env)
+	if err != nil {
+		return err
+	}
+
+	proto := protocol.ID(req.Arguments[0])
+	acl, ok := n.P2P.ListenerACL(proto)
+	if !ok {
+		return fmt.Errorf("no p2p listener for protocol %s", proto)
+	}
+	modify(acl)
+
+	if persist, _ := req.Options[persistOptionName].(bool); persist {
+		err := updateP2PListeners(n.Repo, func(listeners []config.P2PListener) []config.P2PListener {
+			for i, l := range listeners {
+				if l.Protocol == string(proto) && l.ListenAddress == "" {
+					listeners[i].AllowPeers = peerStrings(acl.Allowed())
+					listeners[i].DenyPeers = peerStrings(acl.Denied())
+					listeners[i].Restricted = acl.Restricted()
+				}
+			}
+			return listeners
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return cmds.EmitOnce(res, &P2PACLOutput{
+		Protocol:     string(proto),
+		AllowedPeers: peerStrings(acl.Allowed()),
+		DeniedPeers:  peerStrings(acl.Denied()),
+		Restricted:   acl.Restricted(),
+	})
+}
+
+var p2pACLEncoders = cmds.EncoderMap{
+	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *P2PACLOutput) error {
+		allowed := "all"
+		if out.Restricted {
+			allowed = strings.Join(out.AllowedPeers, " ")
+		}
+		fmt.Fprintf(w, "Allowed: %s\n", allowed)
+		fmt.Fprintf(w, "Denied: %s\n", strings.Join(out.DeniedPeers, " "))
+		return nil
+	}),
+}
+
 const (
 	p2pAllOptionName           = "all"
 	p2pProtocolOptionName      = "protocol"
@@ -341,6 +630,7 @@ var p2pCloseCmd = &cmds.Command{
 		cmdkit.StringOption(p2pProtocolOptionName, "p", "Match protocol name"),
 		cmdkit.StringOption(p2pListenAddressOptionName, "l", "Match listen address"),
 		cmdkit.StringOption(p2pTargetAddressOptionName, "t", "Match target address"),
+		cmdkit.BoolOption(persistOptionName, "Also remove the matching listeners saved to the config"),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := p2pGetNode(env)
@@ -373,25 +663,53 @@ var p2pCloseCmd = &cmds.Command{
 			return errors.New("can't combine --all with other matching options")
 		}
 
-		match := func(listener p2p.Listener) bool {
+		matchAddrs := func(lproto protocol.ID, laddr, taddr ma.Multiaddr) bool {
 			if closeAll {
 				return true
 			}
-			if p && proto != listener.Protocol() {
+			if p && proto != lproto {
 				return false
 			}
-			if l && !listen.Equal(listener.ListenAddress()) {
+			if l && !listen.Equal(laddr) {
 				return false
 			}
-			if t && !target.Equal(listener.TargetAddress()) {
+			if t && !target.Equal(taddr) {
 				return false
 			}
 			return true
 		}
+		match := func(listener p2p.Listener) bool {
+			return matchAddrs(listener.Protocol(), listener.ListenAddress(), listener.TargetAddress())
+		}
 
 		done := n.P2P.ListenersLocal.Close(match)
 		done += n.P2P.ListenersP2P.Close(match)
 
+		if persist, _ := req.Options[persistOptionName].(bool); persist {
+			self, err := ma.NewMultiaddr("/ipfs/" + n.Identity.Pretty())
+			if err != nil {
+				return err
+			}
+			err = updateP2PListeners(n.Repo, func(listeners []config.P2PListener) []config.P2PListener {
+				out := listeners[:0]
+				for _, pl := range listeners {
+					laddr := self
+					if pl.ListenAddress != "" {
+						laddr, _ = ma.NewMultiaddr(pl.ListenAddress)
+					}
+					taddr, _ := ma.NewMultiaddr(pl.TargetAddress)
+					if laddr != nil && taddr != nil && matchAddrs(protocol.ID(pl.Protocol), laddr, taddr) {
+						continue
+					}
+					out = append(out, pl)
+				}
+				return out
+			})
+			if err != nil {
+				return err
+			}
+		}
+
 		return cmds.EmitOnce(res, done)
 	},
 	Type: int(0),
@@ -417,6 +735,80 @@ var p2pStreamCmd = &cmds.Command{
 	Subcommands: map[string]*cmds.Command{
 		"ls":    p2pStreamLsCmd,
 		"close": p2pStreamCloseCmd,
+		"dial":  p2pStreamDialCmd,
+	},
+}
+
+var p2pStreamDialCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Open a p2p stream and pipe it to stdin and stdout.",
+		ShortDescription: `
+Opens a libp2p stream to the <protocol> service of <peer>, writes the data read
+from stdin to it, then writes what the remote side sends back to stdout. The
+stream is closed for writing once stdin is exhausted.
+
+Example:
+  echo "ping" | ipfs p2p stream dial /ipfs/QmPeer ` + P2PProtoPrefix + `myproto
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("peer", true, false, "Peer to dial."),
+		cmdkit.StringArg("protocol", true, false, "Protocol name."),
+		cmdkit.FileArg("data", false, false, "Data to send.").EnableStdin(),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(allowCustomProtocolOptionName, "Don't require /x/ prefix"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := p2pGetNode(env)
+		if err != nil {
+			return err
+		}
+
+		targets, err := parseIpfsAddr(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		proto := protocol.ID(req.Arguments[1])
+
+		allowCustom, _ := req.Options[allowCustomProtocolOptionName].(bool)
+
+		if !allowCustom && !strings.HasPrefix(string(proto), P2PProtoPrefix) {
+			return errors.New("protocol name must be within '" + P2PProtoPrefix + "' namespace")
+		}
+
+		var data io.Reader
+		if req.Files != nil {
+			data, err = cmdenv.GetFileArg(req.Files.Entries())
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, addr := range targets {
+			n.Peerstore.AddAddr(addr.ID(), addr.Multiaddr(), pstore.TempAddrTTL)
+		}
+		stream, err := n.P2P.DialStream(req.Context, targets[0].ID(), proto)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			if data != nil {
+				if _, err := io.Copy(stream, data); err != nil {
+					stream.Reset()
+					return
+				}
+			}
+			stream.Close()
+		}()
+
+		go func() {
+			<-req.Context.Done()
+			stream.Reset()
+		}()
+
+		return res.Emit(stream)
 	},
 }
 
@@ -1,23 +1,33 @@
 package commands
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"text/tabwriter"
+	"time"
 
 	humanize "github.com/dustin/go-humanize"
+	blockstat "github.com/ipsn/go-ipfs/blocks/blockstat"
+	scrubber "github.com/ipsn/go-ipfs/blocks/scrubber"
 	cmdenv "github.com/ipsn/go-ipfs/core/commands/cmdenv"
 	corerepo "github.com/ipsn/go-ipfs/core/corerepo"
+	repo "github.com/ipsn/go-ipfs/repo"
 	fsrepo "github.com/ipsn/go-ipfs/repo/fsrepo"
+	mfsr "github.com/ipsn/go-ipfs/repo/fsrepo/migrations"
 
 	cid "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-cid"
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
 	bstore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-blockstore"
 	cmdkit "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-cmdkit"
 	cmds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-cmds"
@@ -42,6 +52,11 @@ var RepoCmd = &cmds.Command{
 		"fsck":    repoFsckCmd,
 		"version": repoVersionCmd,
 		"verify":  repoVerifyCmd,
+		"convert": repoConvertCmd,
+		"migrate": repoMigrateCmd,
+		"backup":  repoBackupCmd,
+		"restore": repoRestoreCmd,
+		"scrub":   repoScrubCmd,
 	},
 }
 
@@ -145,6 +160,18 @@ StorageMax      string Maximum datastore size (from configuration)
 NumObjects      int Number of objects in the local repo.
 RepoPath        string The path to the repo being currently used.
 Version         string The repo version.
+
+For each tiered datastore, it also outputs the size of its hot and cold
+tiers, the number of blocks read from each tier and the number of blocks
+moved between them.
+
+Blocks are then counted by codec, as regular or filestore blocks and as
+pinned or unpinned blocks. Blocks are counted as they are added and removed,
+and the counts are reconciled with the blockstore by the daemon once a day.
+Counts that can't be trusted, on a repo that was never counted or after an
+unclean shutdown, are reconciled in the background and reported as
+approximate meanwhile. Pinned blocks are recounted shortly after pins change
+and after garbage collection, until then new pins are counted as unpinned.
 `,
 	},
 	Options: []cmdkit.Option{
@@ -185,13 +212,17 @@ Version         string The repo version.
 			human, _ := req.Options[repoHumanOptionName].(bool)
 			sizeOnly, _ := req.Options[repoSizeOnlyOptionName].(bool)
 
-			printSize := func(name string, size uint64) {
-				sizeStr := fmt.Sprintf("%d", size)
+			formatSize := func(size uint64) string {
 				if human {
-					sizeStr = humanize.Bytes(size)
+					return humanize.Bytes(size)
 				}
-
-				fmt.Fprintf(wtr, "%s:\t%s\n", name, sizeStr)
+				return fmt.Sprintf("%d", size)
+			}
+			printSize := func(name string, size uint64) {
+				fmt.Fprintf(wtr, "%s:\t%s\n", name, formatSize(size))
+			}
+			printBlocks := func(kind string, t blockstat.Totals) {
+				fmt.Fprintf(wtr, "Blocks (%s):\t%d, %s\n", kind, t.Blocks, formatSize(t.Bytes))
 			}
 
 			if !sizeOnly {
@@ -206,6 +237,37 @@ Version         string The repo version.
 				fmt.Fprintf(wtr, "Version:\t%s\n", stat.Version)
 			}
 
+			for _, t := range stat.Tiers {
+				printSize(fmt.Sprintf("HotSize (%s)", t.Mountpoint), t.HotSize)
+				printSize(fmt.Sprintf("ColdSize (%s)", t.Mountpoint), t.ColdSize)
+				fmt.Fprintf(wtr, "HotReads (%s):\t%d\n", t.Mountpoint, t.HotReads)
+				fmt.Fprintf(wtr, "ColdReads (%s):\t%d\n", t.Mountpoint, t.ColdReads)
+				fmt.Fprintf(wtr, "Demoted (%s):\t%d\n", t.Mountpoint, t.Demoted)
+				fmt.Fprintf(wtr, "Promoted (%s):\t%d\n", t.Mountpoint, t.Promoted)
+			}
+
+			if b := stat.Blocks; b != nil {
+				var codecs []string
+				for codec := range b.ByCodec {
+					codecs = append(codecs, codec)
+				}
+				sort.Strings(codecs)
+				for _, codec := range codecs {
+					printBlocks(codec, b.ByCodec[codec])
+				}
+				printBlocks("regular", b.Regular)
+				printBlocks("filestore", b.Filestore)
+				printBlocks("pinned", b.Pinned)
+				printBlocks("unpinned", b.Unpinned)
+
+				reconciled := "never"
+				if !b.Reconciled.IsZero() {
+					reconciled = b.Reconciled.Format(time.RFC3339)
+				}
+				fmt.Fprintf(wtr, "BlocksReconciled:\t%s\n", reconciled)
+				fmt.Fprintf(wtr, "BlocksApproximate:\t%t\n", b.Approximate)
+			}
+
 			return nil
 		}),
 	},
@@ -263,6 +325,329 @@ daemons are running.
 	},
 }
 
+const repoConvertToOptionName = "to"
+
+var repoConvertCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Convert the repo datastore to a different configuration.",
+		ShortDescription: `
+'ipfs repo convert' copies all the data in the datastore into a new datastore
+configured by --to, verifies the copy and then replaces the old datastore
+with it. If the daemon is running, the datastore is converted while in use.
+`,
+		LongDescription: `
+'ipfs repo convert' copies all the data in the datastore into a new datastore
+configured by --to, verifies the copy and then replaces the old datastore
+with it, updating Datastore.Spec in the config.
+
+--to takes either the name of a datastore profile, such as 'badgerds' or
+'default-datastore', or a datastore spec in JSON:
+
+  ipfs repo convert --to=badgerds
+
+The new datastore is built inside the repo, so make sure there is enough
+free disk space for a second copy of the data. If the conversion is
+interrupted, running the same command again resumes from the last
+checkpoint. If replacing the old datastore fails, it is put back; if it is
+interrupted, it is finished or undone the next time the repo is opened.
+
+If the daemon is running, it keeps serving from the old datastore while the
+data is copied, writing to both datastores, and switches to the new one
+without restarting. The old datastore is only removed, and the new one moved
+into place, when the daemon is restarted. An interrupted conversion of a
+running daemon starts over.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption(repoConvertToOptionName, "Datastore profile or JSON datastore spec to convert to."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		configRoot, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+
+		to, _ := req.Options[repoConvertToOptionName].(string)
+		if to == "" {
+			return cmdkit.Errorf(cmdkit.ErrClient, "missing --%s", repoConvertToOptionName)
+		}
+		spec, err := datastoreSpec(to)
+		if err != nil {
+			return cmdkit.Errorf(cmdkit.ErrClient, "%s", err)
+		}
+
+		var emitErr error
+		err = fsrepo.ConvertDatastore(req.Context, configRoot, spec, func(p fsrepo.ConvertProgress) {
+			if emitErr == nil {
+				emitErr = res.Emit(&p)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return emitErr
+	},
+	Type: fsrepo.ConvertProgress{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, p *fsrepo.ConvertProgress) error {
+			switch p.Phase {
+			case fsrepo.ConvertPhaseCopy:
+				msg := fmt.Sprintf("copied %d keys", p.Keys)
+				if p.Resumed > 0 {
+					msg += fmt.Sprintf(" (%d from a previous run)", p.Resumed)
+				}
+				fmt.Fprintf(w, "%-50s\r", msg)
+			case fsrepo.ConvertPhaseVerify:
+				fmt.Fprintf(w, "%-50s\r", fmt.Sprintf("verified %d keys", p.Keys))
+			case fsrepo.ConvertPhaseSwap:
+				fmt.Fprintln(w, "\nreplacing the datastore")
+			}
+			return nil
+		}),
+	},
+}
+
+// datastoreSpec returns the datastore spec set by the named config profile,
+// or parses to as a JSON spec.
+func datastoreSpec(to string) (map[string]interface{}, error) {
+	if profile, ok := config.Profiles[to]; ok {
+		var cfg config.Config
+		if err := profile.Transform(&cfg); err != nil {
+			return nil, err
+		}
+		if cfg.Datastore.Spec == nil {
+			return nil, fmt.Errorf("profile %q does not configure a datastore", to)
+		}
+		return cfg.Datastore.Spec, nil
+	}
+
+	var spec map[string]interface{}
+	if err := json.Unmarshal([]byte(to), &spec); err != nil {
+		return nil, fmt.Errorf("%q is neither a profile nor a valid datastore spec: %s", to, err)
+	}
+	return spec, nil
+}
+
+const (
+	repoMigrateToOptionName     = "to"
+	repoMigrateDryRunOptionName = "dry-run"
+)
+
+var repoMigrateCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Run the built-in repo migrations.",
+		ShortDescription: `
+'ipfs repo migrate' migrates the repo to the version used by this ipfs, or
+to the version given by --to, which may be older than the current one. It
+only runs the migrations built into ipfs. This command can only run when no
+ipfs daemons are running.
+
+The config, version and datastore_spec files are backed up to the
+'migration-backups' directory of the repo before migrating. If a migration
+fails, the ones that already ran are reverted.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.IntOption(repoMigrateToOptionName, "Repo version to migrate to.").WithDefault(fsrepo.RepoVersion),
+		cmdkit.BoolOption(repoMigrateDryRunOptionName, "Only report the migrations that would run."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		configRoot, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+
+		to, _ := req.Options[repoMigrateToOptionName].(int)
+		dryRun, _ := req.Options[repoMigrateDryRunOptionName].(bool)
+
+		var out bytes.Buffer
+		steps, err := fsrepo.Migrate(configRoot, to, mfsr.MigrateOptions{
+			DryRun: dryRun,
+			Out:    &out,
+		})
+		if err != nil {
+			return err
+		}
+		if len(steps) == 0 {
+			fmt.Fprintf(&out, "fs-repo is already at version %d.\n", to)
+		}
+		return cmds.EmitOnce(res, &MessageOutput{out.String()})
+	},
+	Type: MessageOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *MessageOutput) error {
+			_, err := fmt.Fprint(w, out.Message)
+			return err
+		}),
+	},
+}
+
+const (
+	repoBackupBlocksOptionName      = "blocks"
+	repoBackupIncrementalOptionName = "incremental"
+)
+
+var repoBackupCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Back up the repo to a file.",
+		ShortDescription: `
+'ipfs repo backup' writes a snapshot of the repo to a tar archive at <dest>,
+which must not exist yet. The snapshot holds the config, the keystores of the
+node and of its tenants and the datastore entries such as pins, the MFS root
+and IPNS records. With --blocks it also includes all blocks. It can be taken
+while the daemon runs, in which case <dest> is written by the daemon.
+
+With --incremental, only the blocks that were not in the repo when the given
+previous backup was taken are included. Restore the full backup and then the
+incremental ones in order with 'ipfs repo restore'.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("dest", true, false, "Path of the backup file to write."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(repoBackupBlocksOptionName, "Include all blocks in the backup."),
+		cmdkit.StringOption(repoBackupIncrementalOptionName, "Path of a previous backup with blocks to take an incremental backup from."),
+	},
+	PreRun: func(req *cmds.Request, env cmds.Environment) error {
+		// The daemon may run in another directory.
+		dest, err := filepath.Abs(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		req.Arguments[0] = dest
+
+		if base, ok := req.Options[repoBackupIncrementalOptionName].(string); ok && base != "" {
+			base, err = filepath.Abs(base)
+			if err != nil {
+				return err
+			}
+			req.Options[repoBackupIncrementalOptionName] = base
+		}
+		return nil
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		dest := req.Arguments[0]
+		if _, err := os.Stat(dest); err == nil {
+			return fmt.Errorf("%s already exists", dest)
+		}
+
+		opts := corerepo.BackupOptions{}
+		opts.Blocks, _ = req.Options[repoBackupBlocksOptionName].(bool)
+		if base, _ := req.Options[repoBackupIncrementalOptionName].(string); base != "" {
+			f, err := os.Open(base)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			opts.Base = bufio.NewReader(f)
+		}
+
+		// Write to a temporary file so that an interrupted backup doesn't
+		// leave a truncated one behind.
+		tmp := dest + ".tmp"
+		f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp)
+
+		w := bufio.NewWriter(f)
+		stat, err := corerepo.Backup(req.Context, n, w, opts)
+		if err == nil {
+			err = w.Flush()
+		}
+		if err == nil {
+			err = f.Sync()
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, dest); err != nil {
+			return err
+		}
+
+		return cmds.EmitOnce(res, stat)
+	},
+	Type: corerepo.BackupStat{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, stat *corerepo.BackupStat) error {
+			return printBackupStat(w, "backed up", stat)
+		}),
+	},
+}
+
+var repoRestoreCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Restore the repo from backups.",
+		ShortDescription: `
+'ipfs repo restore' restores backups taken with 'ipfs repo backup' into the
+repo, which must already be initialized. Pass a full backup followed by the
+incremental backups taken after it, in order. The datastore configuration of
+the repo is kept; the rest of the config, the keys and the datastore entries
+in the backups replace the existing ones. This command can only run when no
+ipfs daemons are running.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("backup", true, true, "Path of a backup file to restore."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		configRoot, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+
+		var backups []io.Reader
+		for _, fn := range req.Arguments {
+			f, err := os.Open(fn)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			backups = append(backups, bufio.NewReader(f))
+		}
+
+		r, err := fsrepo.Open(configRoot)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		stats, err := corerepo.Restore(req.Context, r, backups...)
+		for _, stat := range stats {
+			if err := res.Emit(stat); err != nil {
+				return err
+			}
+		}
+		return err
+	},
+	Type: corerepo.BackupStat{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, stat *corerepo.BackupStat) error {
+			return printBackupStat(w, "restored", stat)
+		}),
+	},
+}
+
+func printBackupStat(w io.Writer, verb string, stat *corerepo.BackupStat) error {
+	kind := "full"
+	if stat.Manifest.Base != "" {
+		kind = "incremental"
+	}
+	_, err := fmt.Fprintf(w, "%s %s backup %s: %d keys, %d datastore entries, %d blocks\n",
+		verb, kind, stat.Manifest.ID, stat.Keys, stat.Entries, stat.Blocks)
+	return err
+}
+
 type VerifyProgress struct {
 	Msg      string
 	Progress int
@@ -374,6 +759,158 @@ var repoVerifyCmd = &cmds.Command{
 	},
 }
 
+const repoScrubDryRunOptionName = "dry-run"
+
+// RepoScrubResult is either a problem found in a replica of a mirrored
+// datastore, or the summary of the scrub of a mirrored datastore.
+type RepoScrubResult struct {
+	Problem *repo.ScrubProblem `json:",omitempty"`
+	Stat    *repo.ScrubStat    `json:",omitempty"`
+}
+
+var repoScrubCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Verify and repair the replicas of mirrored datastores.",
+		ShortDescription: `
+'ipfs repo scrub' compares the entries of all replicas of the mirrored
+datastores of the repo. Blocks are verified against their CID, other entries
+are decided by majority. Replicas missing an entry or holding a divergent or
+corrupt one are repaired, unless --dry-run is passed.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(repoScrubDryRunOptionName, "Report problems without repairing them."),
+	},
+	Subcommands: map[string]*cmds.Command{
+		"status": repoScrubStatusCmd,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		dryRun, _ := req.Options[repoScrubDryRunOptionName].(bool)
+
+		var emitErr error
+		stats, err := n.Repo.ScrubDatastores(req.Context, !dryRun, func(p repo.ScrubProblem) {
+			if emitErr == nil {
+				emitErr = res.Emit(&RepoScrubResult{Problem: &p})
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if emitErr != nil {
+			return emitErr
+		}
+		if len(stats) == 0 {
+			return errors.New("the repo has no mirrored datastores")
+		}
+		for i := range stats {
+			if err := res.Emit(&RepoScrubResult{Stat: &stats[i]}); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: RepoScrubResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *RepoScrubResult) error {
+			if s := out.Stat; s != nil {
+				_, err := fmt.Fprintf(w, "scrubbed %d keys of %s: %d problems, %d repaired\n",
+					s.Keys, s.Mountpoint, s.Problems, s.Repaired)
+				return err
+			}
+
+			p := out.Problem
+			msg := fmt.Sprintf("replica %d of %s: %s", p.Replica, ds.NewKey(p.Mountpoint).Child(ds.NewKey(p.Key)), p.Kind)
+			if p.Error != "" {
+				msg += ": " + p.Error
+			}
+			if p.Repaired {
+				msg += ", repaired"
+			}
+			_, err := fmt.Fprintln(w, msg)
+			return err
+		}),
+	},
+}
+
+var repoScrubStatusCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the progress of the background block scrubber.",
+		ShortDescription: `
+'ipfs repo scrub status' shows the progress of the background scrubber of the
+daemon, which verifies all blocks against their hash when
+Datastore.ScrubPeriod is set, and lists the corrupt blocks it moved into
+quarantine. Quarantined blocks are restored when the daemon is online and
+fetches them again from the network.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(repoHumanOptionName, "Print sizes in human readable format (e.g., 1K 234M 2G)"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		status, err := n.Scrubber.Status()
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &status)
+	},
+	Type: scrubber.Status{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, st *scrubber.Status) error {
+			wtr := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+			defer wtr.Flush()
+
+			human, _ := req.Options[repoHumanOptionName].(bool)
+			formatSize := func(size uint64) string {
+				if human {
+					return humanize.Bytes(size)
+				}
+				return fmt.Sprintf("%d", size)
+			}
+			formatTime := func(t time.Time) string {
+				if t.IsZero() {
+					return "never"
+				}
+				return t.Format(time.RFC3339)
+			}
+
+			period := "disabled"
+			if st.Period != 0 {
+				period = st.Period.String()
+			}
+			fmt.Fprintf(wtr, "Period:\t%s\n", period)
+			fmt.Fprintf(wtr, "Rate:\t%s/s\n", formatSize(st.Rate))
+			fmt.Fprintf(wtr, "Fetching:\t%t\n", st.Fetching)
+			fmt.Fprintf(wtr, "LastPass:\t%s\n", formatTime(st.LastPass))
+			if !st.PassStarted.IsZero() {
+				fmt.Fprintf(wtr, "CurrentPass:\tstarted %s, %d blocks, %s verified\n",
+					formatTime(st.PassStarted), st.PassBlocks, formatSize(st.PassBytes))
+			}
+			fmt.Fprintf(wtr, "Verified:\t%d blocks, %s\n", st.Blocks, formatSize(st.Bytes))
+			fmt.Fprintf(wtr, "Corrupt:\t%d\n", st.Corrupt)
+			fmt.Fprintf(wtr, "Refetched:\t%d\n", st.Refetched)
+			fmt.Fprintf(wtr, "Errors:\t%d\n", st.Errors)
+			fmt.Fprintf(wtr, "Quarantined:\t%d\n", len(st.Quarantined))
+			for _, q := range st.Quarantined {
+				state := "missing"
+				if q.Restored {
+					state = "restored"
+				}
+				fmt.Fprintf(wtr, "  %s %s, %s\n", q.Cid, formatSize(uint64(q.Size)), state)
+			}
+			return nil
+		}),
+	},
+}
+
 var repoVersionCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Show the repo version.",
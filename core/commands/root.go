@@ -175,6 +175,8 @@ var rootROSubcommands = map[string]*cmds.Command{
 	"name": {
 		Subcommands: map[string]*cmds.Command{
 			"resolve": name.IpnsCmd,
+			"inspect": name.InspectCmd,
+			"get":     name.GetCmd,
 		},
 	},
 	"object": {
@@ -195,6 +197,47 @@ var rootROSubcommands = map[string]*cmds.Command{
 	"version": VersionCmd,
 }
 
+// RootTenant is the version of Root served to the tenants of the node, limited
+// to the commands working on the data of a tenant.
+var RootTenant = &cmds.Command{}
+
+var CommandsDaemonTenantCmd = CommandsCmd(RootTenant)
+
+var rootTenantSubcommands = map[string]*cmds.Command{
+	"add":      AddCmd,
+	"cat":      CatCmd,
+	"commands": CommandsDaemonTenantCmd,
+	"files":    FilesCmd,
+	"get":      GetCmd,
+	"ls":       LsCmd,
+	"pin":      PinCmd,
+	"key":      KeyCmd,
+	"block": &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"stat": blockStatCmd,
+			"get":  blockGetCmd,
+			"put":  blockPutCmd,
+		},
+	},
+	"name": {
+		Subcommands: map[string]*cmds.Command{
+			"publish": name.PublishCmd,
+			"resolve": name.IpnsCmd,
+			"inspect": name.InspectCmd,
+			"get":     name.GetCmd,
+			"put":     name.PutCmd,
+		},
+	},
+	"dag":     dag.DagCmd,
+	"object":  ocmd.ObjectCmd,
+	"dns":     DNSCmd,
+	"resolve": ResolveCmd,
+	"tar":     TarCmd,
+	"file":    unixfs.UnixFSCmd,
+	"cid":     CidCmd,
+	"version": VersionCmd,
+}
+
 func init() {
 	Root.ProcessHelp()
 	*RootRO = *Root
@@ -207,10 +250,14 @@ func init() {
 	// but if we leave it there lgc.NewCommand will be executed
 	// before the value is updated (:/sanitize readonly refs command/)
 	rootROSubcommands["refs"] = RefsROCmd
+	rootTenantSubcommands["refs"] = RefsROCmd
 
 	Root.Subcommands = rootSubcommands
 
 	RootRO.Subcommands = rootROSubcommands
+
+	*RootTenant = *Root
+	RootTenant.Subcommands = rootTenantSubcommands
 }
 
 type MessageOutput struct {
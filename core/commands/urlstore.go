@@ -1,22 +1,24 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
 
 	cmdenv "github.com/ipsn/go-ipfs/core/commands/cmdenv"
+	coreunix "github.com/ipsn/go-ipfs/core/coreunix"
 	filestore "github.com/ipsn/go-ipfs/filestore"
 	pin "github.com/ipsn/go-ipfs/pin"
 
 	cid "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-cid"
-	chunk "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-chunker"
 	cmdkit "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-cmdkit"
 	cmds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-cmds"
-	balanced "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/importer/balanced"
-	ihelper "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/importer/helpers"
-	trickle "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/importer/trickle"
-	mh "github.com/ipsn/go-ipfs/gxlibs/github.com/multiformats/go-multihash"
+	coreiface "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/interface-go-ipfs-core"
 )
 
 var urlStoreCmd = &cmds.Command{
@@ -28,6 +30,14 @@ var urlStoreCmd = &cmds.Command{
 	},
 }
 
+// UrlstoreAddEvent is emitted by 'ipfs urlstore add' for every imported
+// file and, when importing several URLs, for the resulting directory.
+type UrlstoreAddEvent struct {
+	Name string `json:",omitempty"`
+	Key  string
+	Size int64
+}
+
 var urlAdd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Add URL via urlstore.",
@@ -40,6 +50,21 @@ control.
 The file is added using raw-leaves but otherwise using the default
 settings for 'ipfs add'.
 
+Several files can be added at once, building a directory out of them.
+Every argument is then either a bare URL, named after the last element
+of its path, or a manifest line of the form:
+
+  <name> <url> [<size> [<cid>]]
+
+where <name> may contain slashes to create sub-directories, and the
+optional <size> and <cid> are checked against the fetched contents. The
+manifest can also be given on stdin:
+
+  > ipfs urlstore add < manifest.txt
+
+Every URL is fetched once. If an import is interrupted, adding the same
+list of files again resumes it, skipping the files already imported.
+
 This command is considered temporary until a better solution can be
 found.  It may disappear or the semantics can change at any
 time.
@@ -50,19 +75,19 @@ time.
 		cmdkit.BoolOption(pinOptionName, "Pin this object when adding.").WithDefault(true),
 	},
 	Arguments: []cmdkit.Argument{
-		cmdkit.StringArg("url", true, false, "URL to add to IPFS"),
+		cmdkit.StringArg("url", true, true, "URL to add to IPFS, or a manifest line.").EnableStdin(),
 	},
-	Type: &BlockStat{},
+	Type: &UrlstoreAddEvent{},
 
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
-		url := req.Arguments[0]
 		n, err := cmdenv.GetNode(env)
 		if err != nil {
 			return err
 		}
 
-		if !filestore.IsURL(url) {
-			return fmt.Errorf("unsupported url syntax: %s", url)
+		entries, err := parseURLEntries(req.Arguments)
+		if err != nil {
+			return err
 		}
 
 		cfg, err := n.Repo.Config()
@@ -82,66 +107,154 @@ time.
 			return err
 		}
 
-		hreq, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return err
-		}
+		ctx, cancel := context.WithCancel(req.Context)
+		defer cancel()
+		adder := coreunix.NewURLAdder(ctx, n.Pinning, n.Blockstore, n.DAG, n.Repo.Datastore())
+		adder.DirectoryOptions = n.DirectoryOptions
+		adder.Trickle = useTrickledag
+		adder.Pin = dopin
 
-		hres, err := http.DefaultClient.Do(hreq)
-		if err != nil {
-			return err
-		}
-		if hres.StatusCode != http.StatusOK {
-			return fmt.Errorf("expected code 200, got: %d", hres.StatusCode)
-		}
+		// A single unnamed URL is added as a file on its own.
+		if len(req.Arguments) == 1 && len(strings.Fields(req.Arguments[0])) == 1 {
+			if dopin {
+				// Take the pinlock
+				defer n.Blockstore.PinLock().Unlock()
+			}
 
-		if dopin {
-			// Take the pinlock
-			defer n.Blockstore.PinLock().Unlock()
-		}
+			root, size, err := adder.AddURL(entries[0])
+			if err != nil {
+				return err
+			}
 
-		chk := chunk.NewSizeSplitter(hres.Body, chunk.DefaultBlockSize)
-		prefix := cid.NewPrefixV1(cid.DagProtobuf, mh.SHA2_256)
-		dbp := &ihelper.DagBuilderParams{
-			Dagserv:    n.DAG,
-			RawLeaves:  true,
-			Maxlinks:   ihelper.DefaultLinksPerBlock,
-			NoCopy:     true,
-			CidBuilder: &prefix,
-			URL:        url,
-		}
+			c := root.Cid()
+			if dopin {
+				n.Pinning.PinWithMode(c, pin.Recursive)
+				if err := n.Pinning.Flush(); err != nil {
+					return err
+				}
+			}
 
-		layout := balanced.Layout
-		if useTrickledag {
-			layout = trickle.Layout
+			return cmds.EmitOnce(res, &UrlstoreAddEvent{
+				Key:  enc.Encode(c),
+				Size: size,
+			})
 		}
 
-		db, err := dbp.New(chk)
-		if err != nil {
-			return err
-		}
-		root, err := layout(db)
-		if err != nil {
-			return err
-		}
+		events := make(chan interface{}, adderOutChanSize)
+		adder.Out = events
 
-		c := root.Cid()
-		if dopin {
-			n.Pinning.PinWithMode(c, pin.Recursive)
-			if err := n.Pinning.Flush(); err != nil {
+		errCh := make(chan error, 1)
+		go func() {
+			defer close(events)
+			_, err := adder.AddAllAndPin(entries)
+			errCh <- err
+		}()
+		// When returning early, stop the adder and drain its events so that
+		// it doesn't block forever while holding the pin lock.
+		defer func() {
+			cancel()
+			for range events {
+			}
+		}()
+
+		for event := range events {
+			output, ok := event.(*coreiface.AddEvent)
+			if !ok {
+				return errors.New("unknown event type")
+			}
+
+			size, err := strconv.ParseInt(output.Size, 10, 64)
+			if err != nil {
+				return err
+			}
+
+			err = res.Emit(&UrlstoreAddEvent{
+				Name: output.Name,
+				Key:  enc.Encode(output.Path.Cid()),
+				Size: size,
+			})
+			if err != nil {
 				return err
 			}
 		}
 
-		return cmds.EmitOnce(res, &BlockStat{
-			Key:  enc.Encode(c),
-			Size: int(hres.ContentLength),
-		})
+		return <-errCh
 	},
 	Encoders: cmds.EncoderMap{
-		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, bs *BlockStat) error {
-			_, err := fmt.Fprintln(w, bs.Key)
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *UrlstoreAddEvent) error {
+			if out.Name == "" {
+				_, err := fmt.Fprintln(w, out.Key)
+				return err
+			}
+			_, err := fmt.Fprintf(w, "added %s %s\n", out.Key, out.Name)
 			return err
 		}),
 	},
 }
+
+// parseURLEntries parses the arguments of 'ipfs urlstore add', each being
+// either a bare URL or a manifest line.
+func parseURLEntries(args []string) ([]coreunix.URLEntry, error) {
+	entries := make([]coreunix.URLEntry, 0, len(args))
+	names := make(map[string]struct{}, len(args))
+	for _, arg := range args {
+		fields := strings.Fields(arg)
+		if len(fields) == 0 {
+			continue
+		}
+
+		e := coreunix.URLEntry{Size: -1}
+		switch len(fields) {
+		case 1:
+			e.URL = fields[0]
+			u, err := url.Parse(e.URL)
+			if err != nil {
+				return nil, err
+			}
+			e.Name = path.Base(u.Path)
+			if e.Name == "." || e.Name == "/" {
+				// The URL of a site root has no final segment.
+				e.Name = u.Hostname()
+			}
+		case 2, 3, 4:
+			e.Name, e.URL = fields[0], fields[1]
+		default:
+			return nil, fmt.Errorf("invalid manifest line: %q", arg)
+		}
+
+		if !filestore.IsURL(e.URL) {
+			return nil, fmt.Errorf("unsupported url syntax: %s", e.URL)
+		}
+
+		e.Name = path.Clean(strings.TrimPrefix(e.Name, "/"))
+		if e.Name == "." || e.Name == "/" || strings.HasPrefix(e.Name, "../") || e.Name == ".." {
+			return nil, fmt.Errorf("invalid name for %s: %q", e.URL, e.Name)
+		}
+		if _, ok := names[e.Name]; ok {
+			return nil, fmt.Errorf("duplicate name: %s", e.Name)
+		}
+		names[e.Name] = struct{}{}
+
+		if len(fields) > 2 {
+			size, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid size for %s: %s", e.Name, err)
+			}
+			e.Size = size
+		}
+		if len(fields) > 3 {
+			c, err := cid.Decode(fields[3])
+			if err != nil {
+				return nil, fmt.Errorf("invalid cid for %s: %s", e.Name, err)
+			}
+			e.Cid = c
+		}
+
+		entries = append(entries, e)
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.New("no url given")
+	}
+	return entries, nil
+}
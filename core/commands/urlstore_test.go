@@ -0,0 +1,37 @@
+package commands
+
+import (
+	"testing"
+)
+
+func TestParseURLEntries(t *testing.T) {
+	cases := []struct {
+		arg  string
+		name string
+		size int64
+		err  bool
+	}{
+		{arg: "http://example.com/dir/file.txt", name: "file.txt", size: -1},
+		{arg: "http://example.com/", name: "example.com", size: -1},
+		{arg: "http://example.com:8080", name: "example.com", size: -1},
+		{arg: "docs/a.txt http://example.com/a 12", name: "docs/a.txt", size: 12},
+		{arg: "../a.txt http://example.com/a", err: true},
+		{arg: "a.txt ftp://example.com/a", err: true},
+	}
+	for _, tc := range cases {
+		entries, err := parseURLEntries([]string{tc.arg})
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.arg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tc.arg, err)
+			continue
+		}
+		if len(entries) != 1 || entries[0].Name != tc.name || entries[0].Size != tc.size {
+			t.Errorf("%s: expected %s of size %d, got %+v", tc.arg, tc.name, tc.size, entries)
+		}
+	}
+}
@@ -21,6 +21,8 @@ import (
 	"time"
 
 	version "github.com/ipsn/go-ipfs"
+	blockstat "github.com/ipsn/go-ipfs/blocks/blockstat"
+	scrubber "github.com/ipsn/go-ipfs/blocks/scrubber"
 	rp "github.com/ipsn/go-ipfs/exchange/reprovide"
 	filestore "github.com/ipsn/go-ipfs/filestore"
 	mount "github.com/ipsn/go-ipfs/fuse/mount"
@@ -35,11 +37,13 @@ import (
 	bsnet "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-bitswap/network"
 	bserv "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-blockservice"
 	cid "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-cid"
+	ipfsaddr "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-addr"
 	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
 	bstore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-blockstore"
 	config "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-config"
 	exchange "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-exchange-interface"
 	nilrouting "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-routing/none"
+	ipns "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipns"
 	u "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-util"
 	ipld "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipld-format"
 	logging "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-log"
@@ -47,6 +51,7 @@ import (
 	mfs "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-mfs"
 	resolver "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-path/resolver"
 	ft "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs"
+	uio "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/io"
 	goprocess "github.com/ipsn/go-ipfs/gxlibs/github.com/jbenet/goprocess"
 	libp2p "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p"
 	autonat "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-autonat-svc"
@@ -61,6 +66,7 @@ import (
 	peer "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peer"
 	pstore "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peerstore"
 	pnet "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-pnet"
+	protocol "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-protocol"
 	pubsub "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-pubsub"
 	psrouter "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-pubsub-router"
 	quic "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-quic-transport"
@@ -109,6 +115,8 @@ type IpfsNode struct {
 	Peerstore       pstore.Peerstore     // storage for other Peer instances
 	Blockstore      bstore.GCBlockstore  // the block store (lower level)
 	Filestore       *filestore.Filestore // the filestore blockstore
+	BlockStat       *blockstat.Counter   // running counts of the blocks in the blockstore
+	Scrubber        *scrubber.Scrubber   // verifies the blocks in the background
 	BaseBlocks      bstore.Blockstore    // the raw blockstore, no filestore wrapping
 	GCLocker        bstore.GCLocker      // the locker used to protect the blockstore during gc
 	Blocks          bserv.BlockService   // the block service, get/add blocks.
@@ -119,6 +127,12 @@ type IpfsNode struct {
 	FilesRoot       *mfs.Root
 	RecordValidator record.Validator
 
+	DirectoryOptions []uio.DirectoryOption // the sharding of the unixfs directories
+
+	// Tenants
+	Tenant  string   // the name of the tenant, empty for the node itself
+	Tenants *Tenants // the tenants hosted by the node
+
 	// Online
 	PeerHost     p2phost.Host        // the network host (server+client)
 	Bootstrapper io.Closer           // the periodic bootstrapper
@@ -286,6 +300,9 @@ func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption Routin
 	}
 
 	n.P2P = p2p.NewP2P(n.Identity, n.PeerHost, n.Peerstore)
+	if cfg.Experimental.Libp2pStreamMounting {
+		n.restoreP2PListeners(ctx, cfg.P2P.Listeners)
+	}
 
 	// setup local discovery
 	if do != nil {
@@ -555,13 +572,19 @@ func (n *IpfsNode) startOnlineServicesWithHost(ctx context.Context, routingOptio
 	}
 
 	if enableIpnsps {
+		psOpts, err := n.getPSRouterOptions()
+		if err != nil {
+			return err
+		}
 		n.PSRouter = psrouter.NewPubsubValueStore(
 			ctx,
 			n.PeerHost,
 			n.Routing,
 			n.PubSub,
 			n.RecordValidator,
+			psOpts...,
 		)
+		n.restorePubsubSubscriptions(ctx)
 		n.Routing = rhelpers.Tiered{
 			Routers: []routing.IpfsRouting{
 				// Always check pubsub first.
@@ -586,13 +609,129 @@ func (n *IpfsNode) startOnlineServicesWithHost(ctx context.Context, routingOptio
 		return err
 	}
 
+	nsopts, err := n.getNamesysOptions()
+	if err != nil {
+		return err
+	}
+
 	// setup name system
-	n.Namesys = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), size)
+	n.Namesys = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), size, nsopts...)
 
 	// setup ipns republishing
 	return n.setupIpnsRepublisher()
 }
 
+// getNamesysOptions returns the options of the resolve cache
+func (n *IpfsNode) getNamesysOptions() ([]namesys.Option, error) {
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	dnsResolver, err := namesys.NewDNSResolverWithResolvers(cfg.DNS.Resolvers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config setting DNS.Resolvers: %s", err)
+	}
+
+	opts := []namesys.Option{namesys.DNSResolvers(dnsResolver)}
+	if cfg.Ipns.PersistResolveCache {
+		opts = append(opts, namesys.PersistCache())
+	}
+	if cfg.Ipns.ResolveCacheMaxStaleness != "" {
+		d, err := time.ParseDuration(cfg.Ipns.ResolveCacheMaxStaleness)
+		if err != nil {
+			return nil, fmt.Errorf("failure to parse config setting IPNS.ResolveCacheMaxStaleness: %s", err)
+		}
+		opts = append(opts, namesys.MaxCacheStaleness(d))
+	}
+	return opts, nil
+}
+
+// getPSRouterOptions returns the options of the IPNS pubsub router, as set in
+// the config.
+func (n *IpfsNode) getPSRouterOptions() ([]psrouter.Option, error) {
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []psrouter.Option
+	if cfg.Ipns.PubsubRebroadcastInterval != "" {
+		d, err := time.ParseDuration(cfg.Ipns.PubsubRebroadcastInterval)
+		if err != nil {
+			return nil, fmt.Errorf("failure to parse config setting IPNS.PubsubRebroadcastInterval: %s", err)
+		}
+		opts = append(opts, psrouter.WithRebroadcastInterval(d))
+	}
+	return opts, nil
+}
+
+// restorePubsubSubscriptions subscribes the IPNS pubsub router to the names
+// subscribed to with 'ipfs name pubsub subscribe'.
+func (n *IpfsNode) restorePubsubSubscriptions(ctx context.Context) {
+	ids, err := namesys.PubsubSubscriptions(ctx, n.Repo.Datastore())
+	if err != nil {
+		log.Errorf("failed to load IPNS pubsub subscriptions: %s", err)
+		return
+	}
+	for _, id := range ids {
+		if err := n.PSRouter.Subscribe(ipns.RecordKey(id)); err != nil {
+			log.Errorf("failed to restore IPNS pubsub subscription to %s: %s", id.Pretty(), err)
+		}
+	}
+}
+
+// restoreP2PListeners re-creates the p2p listeners persisted in the config.
+// Failing listeners are logged and skipped.
+func (n *IpfsNode) restoreP2PListeners(ctx context.Context, listeners []config.P2PListener) {
+	for _, l := range listeners {
+		if err := n.restoreP2PListener(ctx, l); err != nil {
+			log.Errorf("failed to restore p2p listener %s: %s", l.Protocol, err)
+		}
+	}
+}
+
+func (n *IpfsNode) restoreP2PListener(ctx context.Context, l config.P2PListener) error {
+	proto := protocol.ID(l.Protocol)
+
+	if l.ListenAddress != "" {
+		listen, err := ma.NewMultiaddr(l.ListenAddress)
+		if err != nil {
+			return err
+		}
+		target, err := ipfsaddr.ParseString(l.TargetAddress)
+		if err != nil {
+			return err
+		}
+		n.Peerstore.AddAddr(target.ID(), target.Multiaddr(), pstore.TempAddrTTL)
+		_, err = n.P2P.ForwardLocal(ctx, target.ID(), proto, listen)
+		return err
+	}
+
+	target, err := ma.NewMultiaddr(l.TargetAddress)
+	if err != nil {
+		return err
+	}
+	allowed, err := p2p.ParsePeerIDs(l.AllowPeers)
+	if err != nil {
+		return err
+	}
+	denied, err := p2p.ParsePeerIDs(l.DenyPeers)
+	if err != nil {
+		return err
+	}
+	acl := p2p.NewPeerACL(allowed, denied)
+	if l.Restricted {
+		acl.Restrict()
+	}
+	if l.HTTP {
+		_, err = n.P2P.ForwardHTTP(ctx, proto, target, acl)
+		return err
+	}
+	_, err = n.P2P.ForwardRemote(ctx, proto, target, l.ReportPeerID, acl)
+	return err
+}
+
 // getCacheSize returns cache life and cache size
 func (n *IpfsNode) getCacheSize() (int, error) {
 	cfg, err := n.Repo.Config()
@@ -616,7 +755,8 @@ func (n *IpfsNode) setupIpnsRepublisher() error {
 		return err
 	}
 
-	n.IpnsRepub = ipnsrp.NewRepublisher(n.Namesys, n.Repo.Datastore(), n.PrivateKey, n.Repo.Keystore())
+	n.IpnsRepub = ipnsrp.NewRepublisher(n.Namesys, n.Routing, n.Repo.Datastore(), n.PrivateKey, n.Repo.Keystore())
+	n.IpnsRepub.KeyBook = n.Peerstore
 
 	if cfg.Ipns.RepublishPeriod != "" {
 		d, err := time.ParseDuration(cfg.Ipns.RepublishPeriod)
@@ -675,6 +815,10 @@ func (n *IpfsNode) teardown() error {
 	// needs to use another during its shutdown/cleanup process, it should be
 	// closed before that other object
 
+	if n.Tenants != nil {
+		closers = append(closers, n.Tenants)
+	}
+
 	if n.FilesRoot != nil {
 		closers = append(closers, n.FilesRoot)
 	}
@@ -706,6 +850,10 @@ func (n *IpfsNode) teardown() error {
 		closers = append(closers, n.PeerHost)
 	}
 
+	if n.BlockStat != nil {
+		closers = append(closers, n.BlockStat)
+	}
+
 	// Repo closed last, most things need to preserve state here
 	closers = append(closers, n.Repo)
 
@@ -834,49 +982,55 @@ func (n *IpfsNode) loadBootstrapPeers() ([]pstore.PeerInfo, error) {
 }
 
 func (n *IpfsNode) loadFilesRoot() error {
+	mr, err := openFilesRoot(n.Context(), n.DAG, n.Repo.Datastore(), n.DirectoryOptions...)
+	if err != nil {
+		return err
+	}
+
+	n.FilesRoot = mr
+	return nil
+}
+
+// openFilesRoot opens the MFS root whose CID is stored in d, creating an empty
+// directory if there is none.
+func openFilesRoot(ctx context.Context, dagServ ipld.DAGService, d ds.Datastore, opts ...uio.DirectoryOption) (*mfs.Root, error) {
 	dsk := ds.NewKey("/local/filesroot")
 	pf := func(ctx context.Context, c cid.Cid) error {
-		return n.Repo.Datastore().Put(dsk, c.Bytes())
+		return d.Put(dsk, c.Bytes())
 	}
 
 	var nd *merkledag.ProtoNode
-	val, err := n.Repo.Datastore().Get(dsk)
+	val, err := d.Get(dsk)
 
 	switch {
 	case err == ds.ErrNotFound || val == nil:
 		nd = ft.EmptyDirNode()
-		err := n.DAG.Add(n.Context(), nd)
+		err := dagServ.Add(ctx, nd)
 		if err != nil {
-			return fmt.Errorf("failure writing to dagstore: %s", err)
+			return nil, fmt.Errorf("failure writing to dagstore: %s", err)
 		}
 	case err == nil:
 		c, err := cid.Cast(val)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		rnd, err := n.DAG.Get(n.Context(), c)
+		rnd, err := dagServ.Get(ctx, c)
 		if err != nil {
-			return fmt.Errorf("error loading filesroot from DAG: %s", err)
+			return nil, fmt.Errorf("error loading filesroot from DAG: %s", err)
 		}
 
 		pbnd, ok := rnd.(*merkledag.ProtoNode)
 		if !ok {
-			return merkledag.ErrNotProtobuf
+			return nil, merkledag.ErrNotProtobuf
 		}
 
 		nd = pbnd
 	default:
-		return err
-	}
-
-	mr, err := mfs.NewRoot(n.Context(), n.DAG, nd, pf)
-	if err != nil {
-		return err
+		return nil, err
 	}
 
-	n.FilesRoot = mr
-	return nil
+	return mfs.NewRoot(ctx, dagServ, nd, pf, opts...)
 }
 
 func loadPrivateKey(cfg *config.Identity, id peer.ID) (ic.PrivKey, error) {
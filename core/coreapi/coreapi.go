@@ -32,6 +32,7 @@ import (
 	ipld "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipld-format"
 	logging "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-log"
 	dag "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-merkledag"
+	uio "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/io"
 	coreiface "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/interface-go-ipfs-core"
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/interface-go-ipfs-core/options"
 	ci "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-crypto"
@@ -71,6 +72,8 @@ type CoreAPI struct {
 
 	pubSub *pubsub.PubSub
 
+	dirOpts []uio.DirectoryOption
+
 	checkPublishAllowed func() error
 	checkOnline         func(allowOffline bool) error
 
@@ -181,6 +184,8 @@ func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (coreiface.CoreAPI, e
 
 		pubSub: n.PubSub,
 
+		dirOpts: n.DirectoryOptions,
+
 		nd:         n,
 		parentOpts: settings,
 	}
@@ -12,6 +12,7 @@ import (
 	ipath "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-path"
 	coreiface "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/interface-go-ipfs-core"
 	caopts "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/interface-go-ipfs-core/options"
+	nsopts "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/interface-go-ipfs-core/options/namesys"
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-crypto"
 	ci "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-crypto"
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peer"
@@ -60,12 +61,20 @@ func (api *NameAPI) Publish(ctx context.Context, p coreiface.Path, opts ...caopt
 		return nil, err
 	}
 
+	pubopts := []nsopts.PublishOption{
+		nsopts.PublishWithEOL(time.Now().Add(options.ValidTime)),
+	}
 	if options.TTL != nil {
-		ctx = context.WithValue(ctx, "ipns-publish-ttl", *options.TTL)
+		pubopts = append(pubopts, nsopts.PublishWithTTL(*options.TTL))
+	}
+	if options.Sequence != nil {
+		pubopts = append(pubopts, nsopts.PublishWithSequence(*options.Sequence))
+	}
+	if options.Data != nil {
+		pubopts = append(pubopts, nsopts.PublishWithData(options.Data))
 	}
 
-	eol := time.Now().Add(options.ValidTime)
-	err = api.namesys.PublishWithEOL(ctx, k, pth, eol)
+	err = api.namesys.Publish(ctx, k, pth, pubopts...)
 	if err != nil {
 		return nil, err
 	}
@@ -219,7 +219,7 @@ func (api *ObjectAPI) AddLink(ctx context.Context, base coreiface.Path, name str
 		createfunc = ft.EmptyDirNode
 	}
 
-	e := dagutils.NewDagEditor(basePb, api.dag)
+	e := dagutils.NewDagEditor(basePb, api.dag, api.dirOpts...)
 
 	err = e.InsertNodeAtPath(ctx, name, childNd, createfunc)
 	if err != nil {
@@ -245,7 +245,7 @@ func (api *ObjectAPI) RmLink(ctx context.Context, base coreiface.Path, link stri
 		return nil, dag.ErrNotProtobuf
 	}
 
-	e := dagutils.NewDagEditor(basePb, api.dag)
+	e := dagutils.NewDagEditor(basePb, api.dag, api.dirOpts...)
 
 	err = e.RmLink(ctx, link)
 	if err != nil {
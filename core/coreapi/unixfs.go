@@ -53,6 +53,13 @@ func (api *UnixfsAPI) Add(ctx context.Context, files files.Node, opts ...options
 		return nil, filestore.ErrFilestoreNotEnabled
 	}
 
+	if settings.Resume != "" && settings.OnlyHash {
+		return nil, fmt.Errorf("cannot resume an add which only hashes")
+	}
+	if settings.Partial && settings.NoCopy {
+		return nil, fmt.Errorf("partial adds cannot use the filestore")
+	}
+
 	addblockstore := api.blockstore
 	if !(settings.FsCache || settings.NoCopy) {
 		addblockstore = bstore.NewGCBlockstore(api.baseBlocks, api.blockstore)
@@ -91,6 +98,7 @@ func (api *UnixfsAPI) Add(ctx context.Context, files files.Node, opts ...options
 	fileAdder.Wrap = settings.Wrap
 	fileAdder.Pin = settings.Pin && !settings.OnlyHash
 	fileAdder.Silent = settings.Silent
+	fileAdder.DirectoryOptions = api.dirOpts
 	fileAdder.RawLeaves = settings.RawLeaves
 	fileAdder.NoCopy = settings.NoCopy
 	fileAdder.Name = settings.StdinName
@@ -112,12 +120,23 @@ func (api *UnixfsAPI) Add(ctx context.Context, files files.Node, opts ...options
 		}
 	}
 
+	if settings.Resume != "" {
+		upload, err := coreunix.OpenUpload(api.repo.Datastore(), addblockstore, settings.Resume)
+		if err != nil {
+			return nil, err
+		}
+		defer upload.Close()
+		upload.InputOffset = settings.ResumeOffset
+		upload.Partial = settings.Partial
+		fileAdder.Upload = upload
+	}
+
 	if settings.OnlyHash {
 		md := dagtest.Mock()
 		emptyDirNode := ft.EmptyDirNode()
 		// Use the same prefix for the "empty" MFS root as for the file adder.
 		emptyDirNode.SetCidBuilder(fileAdder.CidBuilder)
-		mr, err := mfs.NewRoot(ctx, md, emptyDirNode, nil)
+		mr, err := mfs.NewRoot(ctx, md, emptyDirNode, nil, api.dirOpts...)
 		if err != nil {
 			return nil, err
 		}
@@ -125,10 +144,23 @@ func (api *UnixfsAPI) Add(ctx context.Context, files files.Node, opts ...options
 		fileAdder.SetMfsRoot(mr)
 	}
 
-	nd, err := fileAdder.AddAllAndPin(files)
+	var nd ipld.Node
+	if settings.AppendTo.Defined() {
+		base, err := dserv.Get(ctx, settings.AppendTo)
+		if err != nil {
+			return nil, err
+		}
+		nd, err = fileAdder.AppendAndPin(base, files)
+	} else {
+		nd, err = fileAdder.AddAllAndPin(files)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if nd == nil {
+		// Only a part of the file was added.
+		return nil, coreiface.ErrPartialAdd
+	}
 
 	if err := api.provider.Provide(nd.Cid()); err != nil {
 		return nil, err
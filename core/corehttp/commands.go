@@ -1,6 +1,7 @@
 package corehttp
 
 import (
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"net"
@@ -37,6 +38,10 @@ cli arguments:
 // APIPath is the path at which the API is mounted.
 const APIPath = "/api/v0"
 
+// TenantHeader is the HTTP header selecting the tenant an API request is
+// handled by.
+const TenantHeader = "X-Ipfs-Tenant"
+
 var defaultLocalhostOrigins = []string{
 	"http://127.0.0.1:<port>",
 	"https://127.0.0.1:<port>",
@@ -119,7 +124,58 @@ func patchCORSVars(c *cmdsHttp.ServerConfig, addr net.Addr) {
 	c.SetAllowedOrigins(newOrigins...)
 }
 
-func commandsOption(cctx oldcmds.Context, command *cmds.Command) ServeOption {
+// tenantHandler dispatches the API requests to the handler of the tenant
+// selected by the TenantHeader, once authenticated with its API token. The
+// requests without the header are handled by the node itself, once
+// authenticated with the root token.
+type tenantHandler struct {
+	node      http.Handler
+	rootToken string
+	tokens    map[string]string
+	tenants   map[string]http.Handler
+}
+
+func (h *tenantHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.Header.Get(TenantHeader)
+	if name == "" {
+		if !hasBearerToken(r, h.rootToken) {
+			http.Error(w, "invalid API token", http.StatusUnauthorized)
+			return
+		}
+		h.node.ServeHTTP(w, r)
+		return
+	}
+
+	handler, ok := h.tenants[name]
+	if !ok || !hasBearerToken(r, h.tokens[name]) {
+		http.Error(w, "unknown tenant or invalid API token", http.StatusUnauthorized)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// hasBearerToken returns whether r is authenticated with token, which must
+// not be empty.
+func hasBearerToken(r *http.Request, token string) bool {
+	auth := r.Header.Get("Authorization")
+	return token != "" && strings.HasPrefix(auth, "Bearer ") &&
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) == 1
+}
+
+// tenantContext returns a copy of the command context whose node is the node
+// of the tenant.
+func tenantContext(cctx *oldcmds.Context, tn *core.IpfsNode) *oldcmds.Context {
+	return &oldcmds.Context{
+		ConfigRoot:    cctx.ConfigRoot,
+		ReqLog:        cctx.ReqLog,
+		Plugins:       cctx.Plugins,
+		LoadConfig:    cctx.LoadConfig,
+		Gateway:       cctx.Gateway,
+		ConstructNode: func() (*core.IpfsNode, error) { return tn, nil },
+	}
+}
+
+func commandsOption(cctx oldcmds.Context, command, tenantCommand *cmds.Command) ServeOption {
 	return func(n *core.IpfsNode, l net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
 
 		cfg := cmdsHttp.NewServerConfig()
@@ -136,7 +192,31 @@ func commandsOption(cctx oldcmds.Context, command *cmds.Command) ServeOption {
 		patchCORSVars(cfg, l.Addr())
 
 		cmdHandler := cmdsHttp.NewHandler(&cctx, command, cfg)
-		mux.Handle(APIPath+"/", cmdHandler)
+		if tenantCommand == nil || n.Tenants == nil || len(rcfg.Tenants) == 0 {
+			mux.Handle(APIPath+"/", cmdHandler)
+			return mux, nil
+		}
+
+		// Otherwise the node itself, including the ipfs command of its
+		// repo, couldn't use the API.
+		if rcfg.API.RootToken == "" {
+			return nil, errors.New("API.RootToken must be set when Tenants are configured")
+		}
+		th := &tenantHandler{
+			node:      cmdHandler,
+			rootToken: rcfg.API.RootToken,
+			tokens:    make(map[string]string),
+			tenants:   make(map[string]http.Handler),
+		}
+		for name, tenant := range rcfg.Tenants {
+			tn, ok := n.Tenants.Node(name)
+			if !ok {
+				continue
+			}
+			th.tokens[name] = tenant.APIToken
+			th.tenants[name] = cmdsHttp.NewHandler(tenantContext(&cctx, tn), tenantCommand, cfg)
+		}
+		mux.Handle(APIPath+"/", th)
 		return mux, nil
 	}
 }
@@ -144,13 +224,13 @@ func commandsOption(cctx oldcmds.Context, command *cmds.Command) ServeOption {
 // CommandsOption constructs a ServerOption for hooking the commands into the
 // HTTP server.
 func CommandsOption(cctx oldcmds.Context) ServeOption {
-	return commandsOption(cctx, corecommands.Root)
+	return commandsOption(cctx, corecommands.Root, corecommands.RootTenant)
 }
 
 // CommandsROOption constructs a ServerOption for hooking the read-only commands
 // into the HTTP server.
 func CommandsROOption(cctx oldcmds.Context) ServeOption {
-	return commandsOption(cctx, corecommands.RootRO)
+	return commandsOption(cctx, corecommands.RootRO, nil)
 }
 
 // CheckVersionOption returns a ServeOption that checks whether the client ipfs version matches. Does nothing when the user agent string does not contain `/go-ipfs/`
@@ -0,0 +1,135 @@
+package corehttp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	oldcmds "github.com/ipsn/go-ipfs/commands"
+	"github.com/ipsn/go-ipfs/core"
+	"github.com/ipsn/go-ipfs/repo"
+
+	datastore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	syncds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/sync"
+	config "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-config"
+)
+
+func TestTenantCommands(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: config.Identity{
+				PeerID: "QmTFauExutTsy4XP6JbMFcw2Wa9645HJt2bTqL6qYDCKfe", // required by offline node
+			},
+			API: config.API{RootToken: "root"},
+			Tenants: map[string]config.Tenant{
+				"alice": {APIToken: "secret"},
+				"bob":   {},
+			},
+		},
+		D: syncds.MutexWrap(datastore.NewMapDatastore()),
+	}
+	n, err := core.NewNode(ctx, &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	cctx := oldcmds.Context{
+		ReqLog:        &oldcmds.ReqLog{},
+		ConstructNode: func() (*core.IpfsNode, error) { return n, nil },
+	}
+	mux, err := CommandsOption(cctx)(n, l, http.NewServeMux())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice, _ := n.Tenants.Node("alice")
+	tcs := []struct {
+		tenant, auth, uri string
+		code              int
+		body              string
+	}{
+		{"", "Bearer root", "/version", http.StatusOK, "Version"},
+		{"", "", "/version", http.StatusUnauthorized, ""},
+		{"", "Bearer secret", "/version", http.StatusUnauthorized, ""},
+		{"alice", "Bearer secret", "/version", http.StatusOK, "Version"},
+		{"alice", "Bearer secret", "/files/stat?arg=/", http.StatusOK, ""},
+		{"alice", "Bearer secret", "/id", http.StatusNotFound, ""},
+		{"alice", "Bearer wrong", "/version", http.StatusUnauthorized, ""},
+		{"alice", "", "/version", http.StatusUnauthorized, ""},
+		{"bob", "Bearer ", "/version", http.StatusUnauthorized, ""},
+		{"carol", "Bearer secret", "/version", http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tcs {
+		req := httptest.NewRequest("POST", APIPath+tc.uri, nil)
+		if tc.tenant != "" {
+			req.Header.Set(TenantHeader, tc.tenant)
+		}
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("%s %s: expected code %d, got %d: %s", tc.tenant, tc.uri, tc.code, w.Code, w.Body)
+			continue
+		}
+		if !strings.Contains(w.Body.String(), tc.body) {
+			t.Errorf("%s %s: expected %q in %q", tc.tenant, tc.uri, tc.body, w.Body)
+		}
+	}
+
+	// The tenant works on its own MFS root.
+	req := httptest.NewRequest("POST", APIPath+"/files/mkdir?arg=/docs", nil)
+	req.Header.Set(TenantHeader, "alice")
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the tenant to create a directory, got %d: %s", w.Code, w.Body)
+	}
+	if _, err := alice.FilesRoot.GetDirectory().Child("docs"); err != nil {
+		t.Errorf("expected the directory in the MFS root of the tenant: %s", err)
+	}
+	if _, err := n.FilesRoot.GetDirectory().Child("docs"); err == nil {
+		t.Error("expected the directory not to be in the MFS root of the node")
+	}
+}
+
+func TestTenantsNeedRootToken(t *testing.T) {
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: config.Identity{
+				PeerID: "QmTFauExutTsy4XP6JbMFcw2Wa9645HJt2bTqL6qYDCKfe", // required by offline node
+			},
+			Tenants: map[string]config.Tenant{"alice": {APIToken: "secret"}},
+		},
+		D: syncds.MutexWrap(datastore.NewMapDatastore()),
+	}
+	n, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	cctx := oldcmds.Context{
+		ReqLog:        &oldcmds.ReqLog{},
+		ConstructNode: func() (*core.IpfsNode, error) { return n, nil },
+	}
+	if _, err := CommandsOption(cctx)(n, l, http.NewServeMux()); err == nil {
+		t.Fatal("expected the API to refuse tenants without a root token")
+	}
+}
@@ -15,7 +15,6 @@ import (
 	"github.com/ipsn/go-ipfs/core"
 	"github.com/ipsn/go-ipfs/dagutils"
 
-	"github.com/dustin/go-humanize"
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-cid"
 	chunker "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-chunker"
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-files"
@@ -25,6 +24,7 @@ import (
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-path/resolver"
 	ft "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs"
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/importer"
+	uio "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/io"
 	coreiface "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/interface-go-ipfs-core"
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-routing"
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/multiformats/go-multibase"
@@ -240,8 +240,7 @@ func (i *gatewayHandler) getOrHeadHandler(ctx context.Context, w http.ResponseWr
 		i.serveFile(w, r, name, modtime, f)
 		return
 	}
-	dir, ok := dr.(files.Directory)
-	if !ok {
+	if _, ok := dr.(files.Directory); !ok {
 		internalWebError(w, fmt.Errorf("unsupported file type"))
 		return
 	}
@@ -273,26 +272,67 @@ func (i *gatewayHandler) getOrHeadHandler(ctx context.Context, w http.ResponseWr
 		return
 	}
 
+	// the listing is rendered as HTML or JSON, depending on Accept
+	w.Header().Add("Vary", "Accept")
+	jsonListing := strings.Contains(r.Header.Get("Accept"), "application/json")
+
+	lr, err := parseListingRange(r.URL.Query())
+	if err != nil {
+		webError(w, "invalid directory listing range", err, http.StatusBadRequest)
+		return
+	}
+
 	if r.Method == "HEAD" {
 		return
 	}
 
-	// storage for directory listing
-	var dirListing []directoryItem
-	dirit := dir.Entries()
-	for dirit.Next() {
-		// See comment above where originalUrlPath is declared.
-		s, err := dirit.Node().Size()
-		if err != nil {
+	dirNode, err := i.api.ResolveNode(ctx, resolvedPath)
+	if err != nil {
+		internalWebError(w, err)
+		return
+	}
+	udir, err := uio.NewDirectoryFromNode(i.node.DAG, dirNode)
+	if err != nil {
+		internalWebError(w, err)
+		return
+	}
+
+	// the listing is abandoned when the handler returns early, e.g. when
+	// the client goes away
+	ctx, cancel := context.WithCancel(ctx)
+	links, errc := enumLinks(ctx, udir, lr)
+	if lr.limit > 0 {
+		// enumerate the page up front, to tell whether there is a next one
+		var page []*ipld.Link
+		for l := range links {
+			page = append(page, l)
+		}
+		if err := <-errc; err != nil {
+			cancel()
 			internalWebError(w, err)
 			return
 		}
 
-		di := directoryItem{humanize.Bytes(uint64(s)), dirit.Name(), gopath.Join(originalUrlPath, dirit.Name())}
-		dirListing = append(dirListing, di)
+		if len(page) > lr.limit {
+			page = page[:lr.limit]
+			w.Header().Set("Link", fmt.Sprintf("<%s%s>; rel=\"next\"", (&url.URL{Path: originalUrlPath}).String(), lr.next()))
+		}
+		links = linkChan(page)
 	}
-	if dirit.Err() != nil {
-		internalWebError(w, dirit.Err())
+	// See comment above where originalUrlPath is declared.
+	dirListing := i.resolveListing(ctx, links, originalUrlPath)
+	defer func() {
+		cancel()
+		if err := <-errc; err != nil && err != context.Canceled {
+			log.Errorf("gateway listing of %s: %s", urlPath, err)
+		}
+	}()
+
+	if jsonListing {
+		w.Header().Set("Content-Type", "application/json")
+		if err := writeJSONListing(w, originalUrlPath, resolvedPath.Cid().String(), dirListing); err != nil {
+			log.Errorf("gateway listing of %s: %s", urlPath, err)
+		}
 		return
 	}
 
@@ -342,7 +382,8 @@ func (i *gatewayHandler) getOrHeadHandler(ctx context.Context, w http.ResponseWr
 	}
 	err = listingTemplate.Execute(w, tplData)
 	if err != nil {
-		internalWebError(w, err)
+		// the response is already being streamed
+		log.Errorf("gateway listing of %s: %s", urlPath, err)
 		return
 	}
 }
@@ -446,7 +487,7 @@ func (i *gatewayHandler) putHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		e := dagutils.NewDagEditor(pbnd, i.node.DAG)
+		e := dagutils.NewDagEditor(pbnd, i.node.DAG, i.node.DirectoryOptions...)
 		err = e.InsertNodeAtPath(ctx, newPath, newnode, ft.EmptyDirNode)
 		if err != nil {
 			webError(w, "putHandler: InsertNodeAtPath failed", err, http.StatusInternalServerError)
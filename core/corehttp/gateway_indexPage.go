@@ -11,7 +11,8 @@ import (
 
 // structs for directory listing
 type listingTemplateData struct {
-	Listing  []directoryItem
+	// Listing is streamed as the template is rendered
+	Listing  <-chan directoryItem
 	Path     string
 	BackLink string
 	Hash     string
@@ -21,6 +22,9 @@ type directoryItem struct {
 	Size string
 	Name string
 	Path string
+
+	Hash  string
+	Bytes uint64
 }
 
 var listingTemplate *template.Template
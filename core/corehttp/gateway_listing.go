@@ -0,0 +1,205 @@
+package corehttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	gopath "path"
+	"strconv"
+
+	humanize "github.com/dustin/go-humanize"
+	ipld "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipld-format"
+	uio "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/io"
+	coreiface "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/interface-go-ipfs-core"
+)
+
+// listingConcurrency is the number of entries of a directory listing whose
+// sizes are resolved concurrently.
+const listingConcurrency = 16
+
+var errListingEnd = errors.New("end of the listing range")
+
+// listingRange is the part of a directory listing requested with the offset
+// and limit query parameters.
+type listingRange struct {
+	offset int
+	limit  int // 0 for no limit
+}
+
+func parseListingRange(q url.Values) (listingRange, error) {
+	var lr listingRange
+	if s := q.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return lr, fmt.Errorf("invalid offset %q", s)
+		}
+		lr.offset = n
+	}
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return lr, fmt.Errorf("invalid limit %q", s)
+		}
+		lr.limit = n
+	}
+	return lr, nil
+}
+
+// next returns the query of the page following this one.
+func (lr listingRange) next() string {
+	return fmt.Sprintf("?offset=%d&limit=%d", lr.offset+lr.limit, lr.limit)
+}
+
+// enumLinks streams the links of dir in the given range, in a stable order.
+// If the range is limited, the link following the range is sent as well when
+// it exists, so that the caller can tell whether there is a next page.
+func enumLinks(ctx context.Context, dir uio.Directory, lr listingRange) (<-chan *ipld.Link, <-chan error) {
+	out := make(chan *ipld.Link, listingConcurrency)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(errc)
+		defer close(out)
+
+		n := 0
+		err := dir.ForEachLink(ctx, func(l *ipld.Link) error {
+			n++
+			if n <= lr.offset {
+				return nil
+			}
+			if lr.limit > 0 && n > lr.offset+lr.limit+1 {
+				return errListingEnd
+			}
+
+			lnk := *l
+			select {
+			case out <- &lnk:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && err != errListingEnd {
+			errc <- err
+		}
+	}()
+
+	return out, errc
+}
+
+// resolveListing turns links into listing entries, resolving the sizes of a
+// few entries at a time while keeping their order.
+func (i *gatewayHandler) resolveListing(ctx context.Context, links <-chan *ipld.Link, basePath string) <-chan directoryItem {
+	pending := make(chan chan directoryItem, listingConcurrency)
+	go func() {
+		defer close(pending)
+		for l := range links {
+			res := make(chan directoryItem, 1)
+			select {
+			case pending <- res:
+			case <-ctx.Done():
+				return
+			}
+			go func(l *ipld.Link) {
+				res <- i.listingItem(ctx, l, basePath)
+			}(l)
+		}
+	}()
+
+	out := make(chan directoryItem)
+	go func() {
+		defer close(out)
+		for res := range pending {
+			var item directoryItem
+			select {
+			case item = <-res:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case out <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (i *gatewayHandler) listingItem(ctx context.Context, l *ipld.Link, basePath string) directoryItem {
+	// See comment above where originalUrlPath is declared.
+	item := directoryItem{
+		Size: "?",
+		Name: l.Name,
+		Path: gopath.Join(basePath, l.Name),
+		Hash: l.Cid.String(),
+	}
+
+	nd, err := i.api.Unixfs().Get(ctx, coreiface.IpfsPath(l.Cid))
+	if err != nil {
+		log.Debugf("gateway listing: cannot resolve %s: %s", item.Path, err)
+		return item
+	}
+	defer nd.Close()
+
+	s, err := nd.Size()
+	if err != nil {
+		log.Debugf("gateway listing: cannot resolve the size of %s: %s", item.Path, err)
+		return item
+	}
+	item.Bytes = uint64(s)
+	item.Size = humanize.Bytes(item.Bytes)
+	return item
+}
+
+// jsonListingEntry is an entry of a JSON directory listing.
+type jsonListingEntry struct {
+	Name string
+	Hash string
+	Size uint64
+}
+
+// writeJSONListing streams a JSON listing of the form
+// {"Path": ..., "Hash": ..., "Entries": [{"Name": ..., "Hash": ..., "Size": ...}, ...]}
+func writeJSONListing(w io.Writer, path, hash string, items <-chan directoryItem) error {
+	head, err := json.Marshal(struct {
+		Path string
+		Hash string
+	}{path, hash})
+	if err != nil {
+		return err
+	}
+	// reopen the object to append the entries
+	if _, err := fmt.Fprintf(w, "%s,\"Entries\":[", head[:len(head)-1]); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	sep := ""
+	for item := range items {
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		sep = ","
+
+		if err := enc.Encode(jsonListingEntry{Name: item.Name, Hash: item.Hash, Size: item.Bytes}); err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+// linkChan returns a closed channel holding the given links.
+func linkChan(links []*ipld.Link) <-chan *ipld.Link {
+	out := make(chan *ipld.Link, len(links))
+	for _, l := range links {
+		out <- l
+	}
+	close(out)
+	return out
+}
@@ -2,6 +2,7 @@ package corehttp
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
@@ -67,7 +68,7 @@ func (m mockNamesys) ResolveAsync(ctx context.Context, name string, opts ...nsop
 	return out
 }
 
-func (m mockNamesys) Publish(ctx context.Context, name ci.PrivKey, value path.Path) error {
+func (m mockNamesys) Publish(ctx context.Context, name ci.PrivKey, value path.Path, _ ...nsopts.PublishOption) error {
 	return errors.New("not implemented for mockNamesys")
 }
 
@@ -540,6 +541,88 @@ func TestIPNSHostnameBacklinks(t *testing.T) {
 	}
 }
 
+func TestDirectoryListingPages(t *testing.T) {
+	ts, api, ctx := newTestServerAndNode(t, mockNamesys{})
+	defer ts.Close()
+
+	entries := make(map[string]files.Node)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		entries[name] = files.NewBytesFile([]byte("contents of " + name))
+	}
+	root, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"dir": files.NewMapDirectory(entries),
+	}), options.Unixfs.Wrap(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := api.ResolvePath(ctx, iface.Join(root, "dir"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(query string) (*http.Response, jsonListing) {
+		req, err := http.NewRequest("GET", ts.URL+k.String()+"/"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", "application/json")
+
+		res, err := doWithoutRedirect(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		var listing jsonListing
+		if err := json.NewDecoder(res.Body).Decode(&listing); err != nil {
+			t.Fatal(err)
+		}
+		return res, listing
+	}
+
+	res, listing := list("?offset=1&limit=2")
+	if len(listing.Entries) != 2 || listing.Entries[0].Name != "b" || listing.Entries[1].Name != "c" {
+		t.Fatalf("unexpected page: %v", listing.Entries)
+	}
+	if listing.Entries[0].Size != uint64(len("contents of b")) {
+		t.Fatalf("unexpected size: %d", listing.Entries[0].Size)
+	}
+	if listing.Hash != k.Cid().String() {
+		t.Fatalf("unexpected hash: %s", listing.Hash)
+	}
+	if link := res.Header.Get("Link"); !strings.Contains(link, "?offset=3&limit=2") {
+		t.Fatalf("expected a link to the next page, got %q", link)
+	}
+
+	res, listing = list("?offset=3&limit=2")
+	if len(listing.Entries) != 2 || listing.Entries[1].Name != "e" {
+		t.Fatalf("unexpected last page: %v", listing.Entries)
+	}
+	if link := res.Header.Get("Link"); link != "" {
+		t.Fatalf("expected no link after the last page, got %q", link)
+	}
+
+	_, listing = list("")
+	if len(listing.Entries) != 5 {
+		t.Fatalf("expected the whole listing, got %v", listing.Entries)
+	}
+
+	res, err = http.Get(ts.URL + k.String() + "/?limit=-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an invalid limit to be rejected, got %d", res.StatusCode)
+	}
+}
+
+type jsonListing struct {
+	Path    string
+	Hash    string
+	Entries []jsonListingEntry
+}
+
 func TestCacheControlImmutable(t *testing.T) {
 	ts, _, _ := newTestServerAndNode(t, nil)
 	t.Logf("test server url: %s", ts.URL)
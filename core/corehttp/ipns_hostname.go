@@ -10,21 +10,31 @@ import (
 	namesys "github.com/ipsn/go-ipfs/namesys"
 
 	nsopts "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/interface-go-ipfs-core/options/namesys"
-	isd "github.com/ipsn/go-ipfs/gxlibs/github.com/jbenet/go-is-domain"
 )
 
 // IPNSHostnameOption rewrites an incoming request if its Host: header contains
 // an IPNS name.
 // The rewritten request points at the resolved name on the gateway handler.
+// Hosts under the domain suffixes listed in DNS.Resolvers in the config are
+// treated as IPNS names, even if their TLD isn't a known one.
 func IPNSHostnameOption() ServeOption {
 	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		cfg, err := n.Repo.Config()
+		if err != nil {
+			return nil, err
+		}
+		dnsResolver, err := namesys.NewDNSResolverWithResolvers(cfg.DNS.Resolvers)
+		if err != nil {
+			return nil, err
+		}
+
 		childMux := http.NewServeMux()
 		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 			ctx, cancel := context.WithCancel(n.Context())
 			defer cancel()
 
 			host := strings.SplitN(r.Host, ":", 2)[0]
-			if len(host) > 0 && isd.IsDomain(host) {
+			if len(host) > 0 && dnsResolver.IsDomain(host) {
 				name := "/ipns/" + host
 				_, err := n.Namesys.Resolve(ctx, name, nsopts.Depth(1))
 				if err == nil || err == namesys.ErrResolveRecursion {
@@ -14,7 +14,9 @@ import (
 	protocol "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-protocol"
 )
 
-// ProxyOption is an endpoint for proxying a HTTP request to another ipfs peer
+// ProxyOption is an endpoint for proxying a HTTP request to another ipfs peer.
+// Headers are passed through, bodies are streamed both ways and connection
+// upgrades, such as WebSockets, are supported.
 func ProxyOption() ServeOption {
 	return func(ipfsNode *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
 		mux.HandleFunc("/p2p/", func(w http.ResponseWriter, request *http.Request) {
@@ -25,6 +27,9 @@ func ProxyOption() ServeOption {
 				return
 			}
 
+			if request.Header.Get("X-Forwarded-Host") == "" {
+				request.Header.Set("X-Forwarded-Host", request.Host)
+			}
 			request.Host = "" // Let URL's Host take precedence.
 			request.URL.Path = parsedRequest.httpPath
 			target, err := url.Parse(fmt.Sprintf("libp2p://%s", parsedRequest.target))
@@ -36,6 +41,10 @@ func ProxyOption() ServeOption {
 			rt := p2phttp.NewTransport(ipfsNode.PeerHost, p2phttp.ProtocolOption(parsedRequest.name))
 			proxy := httputil.NewSingleHostReverseProxy(target)
 			proxy.Transport = rt
+			proxy.FlushInterval = -1
+			proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+				handleError(w, "failed to reach peer", err, http.StatusBadGateway)
+			}
 			proxy.ServeHTTP(w, request)
 		})
 		return mux, nil
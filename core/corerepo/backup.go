@@ -0,0 +1,513 @@
+package corerepo
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ipsn/go-ipfs/core"
+	keystore "github.com/ipsn/go-ipfs/keystore"
+	repo "github.com/ipsn/go-ipfs/repo"
+
+	blocks "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-block-format"
+	cid "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-cid"
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	query "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/query"
+	bstore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-blockstore"
+	config "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-config"
+	mfs "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-mfs"
+	ci "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-crypto"
+)
+
+// Entries of a backup archive, in the order they are written.
+const (
+	backupManifestEntry   = "manifest.json"
+	backupConfigEntry     = "config"
+	backupKeystorePrefix  = "keystore/"
+	backupTenantsPrefix   = "tenants/"
+	backupDatastorePrefix = "datastore"
+	backupIndexEntry      = "index"
+	backupBlocksPrefix    = "blocks/"
+)
+
+// backupDatastorePrefixes are the namespaces of the datastore entries included
+// in backups: the pins, the MFS root and the other state of the node, the
+// published and followed IPNS records, the filestore references and the
+// datastores of the tenants. Blocks are only included with their own entries,
+// and caches such as the peerstore or the DHT records aren't included.
+var backupDatastorePrefixes = []string{"/local", "/ipns", "/ipns-follow", "/filestore", "/tenants"}
+
+// BackupManifest describes a repo backup.
+type BackupManifest struct {
+	// ID identifies the backup.
+	ID string
+	// Base is the ID of the backup an incremental backup builds on.
+	Base string `json:",omitempty"`
+	// Created is the time the backup was taken.
+	Created time.Time
+	// PeerID is the identity of the backed up node.
+	PeerID string
+	// Blocks is whether the backup includes blocks.
+	Blocks bool
+}
+
+// BackupOptions configure a backup.
+type BackupOptions struct {
+	// Blocks includes the blocks of the repo in the backup.
+	Blocks bool
+	// Base is a previous backup including blocks. When set, the backup is
+	// incremental: it only includes the blocks missing from Base and the
+	// backups Base builds on.
+	Base io.Reader
+}
+
+// BackupStat sums up what a backup or restore contained.
+type BackupStat struct {
+	Manifest BackupManifest
+	Keys     int
+	Entries  int
+	Blocks   int
+}
+
+// Backup writes a snapshot of the repo of n to w as a tar archive: its
+// config, keystores of the node and of its tenants, datastore entries such as
+// pins, the MFS root and IPNS records and, optionally, its blocks.
+//
+// Garbage collection is held off while the backup is taken, so all blocks
+// referenced by the backed up pins and MFS root are included.
+func Backup(ctx context.Context, n *core.IpfsNode, w io.Writer, opts BackupOptions) (*BackupStat, error) {
+	stat := &BackupStat{
+		Manifest: BackupManifest{
+			Created: time.Now().UTC(),
+			PeerID:  n.Identity.Pretty(),
+			Blocks:  opts.Blocks || opts.Base != nil,
+		},
+	}
+
+	var have map[string]bool
+	if opts.Base != nil {
+		base, index, err := readBackupIndex(opts.Base)
+		if err != nil {
+			return nil, fmt.Errorf("reading base backup: %s", err)
+		}
+		stat.Manifest.Base = base.ID
+		have = index
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	stat.Manifest.ID = hex.EncodeToString(id)
+
+	unlock := n.Blockstore.PinLock()
+	defer unlock.Unlock()
+
+	if n.FilesRoot != nil {
+		if _, err := mfs.FlushPath(ctx, n.FilesRoot, "/"); err != nil {
+			return nil, err
+		}
+	}
+
+	tw := tar.NewWriter(w)
+	writeFrom := func(name string, size int64, r io.Reader) error {
+		err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    size,
+			ModTime: stat.Manifest.Created,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, r)
+		return err
+	}
+	write := func(name string, data []byte) error {
+		return writeFrom(name, int64(len(data)), bytes.NewReader(data))
+	}
+
+	manifest, err := json.Marshal(&stat.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := write(backupManifestEntry, manifest); err != nil {
+		return nil, err
+	}
+
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	cfgBytes, err := config.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := write(backupConfigEntry, cfgBytes); err != nil {
+		return nil, err
+	}
+
+	if ks := n.Repo.Keystore(); ks != nil {
+		if err := backupKeys(ks, backupKeystorePrefix, write, stat); err != nil {
+			return nil, err
+		}
+	}
+	var tenants []string
+	for name := range cfg.Tenants {
+		tenants = append(tenants, name)
+	}
+	sort.Strings(tenants)
+	for _, name := range tenants {
+		ks, err := n.Repo.TenantKeystore(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := backupKeys(ks, tenantKeystorePrefix(name), write, stat); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, prefix := range backupDatastorePrefixes {
+		if err := backupDatastore(n.Repo.Datastore(), prefix, write, stat); err != nil {
+			return nil, err
+		}
+	}
+
+	if stat.Manifest.Blocks {
+		if err := backupBlocks(ctx, n.Blockstore, have, write, writeFrom, stat); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return stat, nil
+}
+
+// tenantKeystorePrefix is the prefix of the entries of the keystore of the
+// tenant.
+func tenantKeystorePrefix(tenant string) string {
+	return backupTenantsPrefix + tenant + "/" + backupKeystorePrefix
+}
+
+// backupKeys writes the keys of ks, named after prefix.
+func backupKeys(ks keystore.Keystore, prefix string, write func(string, []byte) error, stat *BackupStat) error {
+	names, err := ks.List()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		sk, err := ks.Get(name)
+		if err != nil {
+			return err
+		}
+		b, err := ci.MarshalPrivateKey(sk)
+		if err != nil {
+			return err
+		}
+		if err := write(prefix+name, b); err != nil {
+			return err
+		}
+		stat.Keys++
+	}
+	return nil
+}
+
+// backupDatastore writes the entries of d in the namespace prefix.
+func backupDatastore(d repo.Datastore, prefix string, write func(string, []byte) error, stat *BackupStat) error {
+	res, err := d.Query(query.Query{Prefix: prefix, KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	for e := range res.Next() {
+		if e.Error != nil {
+			return e.Error
+		}
+		// Keys are matched as strings, skip the ones of other namespaces
+		// sharing the prefix.
+		if e.Key != prefix && !strings.HasPrefix(e.Key, prefix+"/") {
+			continue
+		}
+		v, err := d.Get(ds.NewKey(e.Key))
+		if err == ds.ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := write(backupDatastorePrefix+e.Key, v); err != nil {
+			return err
+		}
+		stat.Entries++
+	}
+	return nil
+}
+
+// backupBlocks writes the index of all blocks, then the blocks themselves
+// except the ones in have. The index is spooled to a temporary file and the
+// blocks are listed again to be written, so that neither is held in memory.
+func backupBlocks(ctx context.Context, bs bstore.Blockstore, have map[string]bool, write func(string, []byte) error, writeFrom func(string, int64, io.Reader) error, stat *BackupStat) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	index, err := ioutil.TempFile("", "ipfs-backup-index")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(index.Name())
+	defer index.Close()
+
+	keys, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(index)
+	for c := range keys {
+		buf.WriteString(c.String())
+		buf.WriteByte('\n')
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	size, err := index.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := index.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := writeFrom(backupIndexEntry, size, index); err != nil {
+		return err
+	}
+
+	// Blocks added since the index was written are included too, they
+	// are then included again by the next incremental backup.
+	keys, err = bs.AllKeysChan(ctx)
+	if err != nil {
+		return err
+	}
+	for c := range keys {
+		if have[c.String()] {
+			continue
+		}
+		b, err := bs.Get(c)
+		if err == bstore.ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := write(backupBlocksPrefix+c.String(), b.RawData()); err != nil {
+			return err
+		}
+		stat.Blocks++
+	}
+	return ctx.Err()
+}
+
+// readBackupIndex returns the manifest of a backup and the set of blocks in
+// the repo at the time it was taken.
+func readBackupIndex(r io.Reader) (*BackupManifest, map[string]bool, error) {
+	tr := tar.NewReader(r)
+	manifest, err := readBackupManifest(tr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !manifest.Blocks {
+		return nil, nil, fmt.Errorf("backup %s does not include blocks", manifest.ID)
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, nil, fmt.Errorf("backup %s has no block index", manifest.ID)
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if hdr.Name != backupIndexEntry {
+			continue
+		}
+
+		index := make(map[string]bool)
+		scan := bufio.NewScanner(tr)
+		for scan.Scan() {
+			index[scan.Text()] = true
+		}
+		return manifest, index, scan.Err()
+	}
+}
+
+func readBackupManifest(tr *tar.Reader) (*BackupManifest, error) {
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if hdr.Name != backupManifestEntry {
+		return nil, fmt.Errorf("not a repo backup: missing %s", backupManifestEntry)
+	}
+	var manifest BackupManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// Restore restores backups into r, which must not be in use by a node.
+// Backups are applied in order: the first must be a full backup and each
+// following one must be incremental to the one before it.
+//
+// The datastore configuration of r is kept, everything else in the config is
+// replaced by the one of the last backup.
+func Restore(ctx context.Context, r repo.Repo, backups ...io.Reader) ([]*BackupStat, error) {
+	var stats []*BackupStat
+	var prev string
+	for i, b := range backups {
+		tr := tar.NewReader(b)
+		manifest, err := readBackupManifest(tr)
+		if err != nil {
+			return stats, err
+		}
+		if manifest.Base != prev {
+			if i == 0 {
+				return stats, fmt.Errorf("backup %s is incremental, restore its base %s first", manifest.ID, manifest.Base)
+			}
+			return stats, fmt.Errorf("backup %s does not build on backup %s", manifest.ID, prev)
+		}
+		prev = manifest.ID
+
+		stat, err := restoreBackup(ctx, r, tr)
+		if err != nil {
+			return stats, fmt.Errorf("restoring backup %s: %s", manifest.ID, err)
+		}
+		stat.Manifest = *manifest
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+func restoreBackup(ctx context.Context, r repo.Repo, tr *tar.Reader) (*BackupStat, error) {
+	stat := new(BackupStat)
+	bs := bstore.NewBlockstore(r.Datastore())
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return stat, nil
+		} else if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+
+		switch name := hdr.Name; {
+		case name == backupConfigEntry:
+			if err := restoreConfig(r, data); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(name, backupKeystorePrefix):
+			if err := restoreKey(r, "", strings.TrimPrefix(name, backupKeystorePrefix), data); err != nil {
+				return nil, err
+			}
+			stat.Keys++
+		case strings.HasPrefix(name, backupTenantsPrefix):
+			parts := strings.SplitN(strings.TrimPrefix(name, backupTenantsPrefix), "/"+backupKeystorePrefix, 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("unexpected backup entry %q", name)
+			}
+			if err := restoreKey(r, parts[0], parts[1], data); err != nil {
+				return nil, err
+			}
+			stat.Keys++
+		case strings.HasPrefix(name, backupDatastorePrefix+"/"):
+			k := ds.NewKey(strings.TrimPrefix(name, backupDatastorePrefix))
+			if err := r.Datastore().Put(k, data); err != nil {
+				return nil, err
+			}
+			stat.Entries++
+		case strings.HasPrefix(name, backupBlocksPrefix):
+			c, err := cid.Decode(strings.TrimPrefix(name, backupBlocksPrefix))
+			if err != nil {
+				return nil, err
+			}
+			chk, err := c.Prefix().Sum(data)
+			if err != nil {
+				return nil, err
+			}
+			if !chk.Equals(c) {
+				return nil, fmt.Errorf("block %s is corrupt", c)
+			}
+			blk, err := blocks.NewBlockWithCid(data, c)
+			if err != nil {
+				return nil, err
+			}
+			if err := bs.Put(blk); err != nil {
+				return nil, err
+			}
+			stat.Blocks++
+		}
+	}
+}
+
+func restoreConfig(r repo.Repo, data []byte) error {
+	var cfg config.Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	cur, err := r.Config()
+	if err != nil {
+		return err
+	}
+	cfg.Datastore = cur.Datastore
+	return r.SetConfig(&cfg)
+}
+
+// restoreKey restores a key into the keystore of the tenant, or of the node
+// if tenant is empty.
+func restoreKey(r repo.Repo, tenant, name string, data []byte) error {
+	ks := r.Keystore()
+	if tenant != "" {
+		var err error
+		ks, err = r.TenantKeystore(tenant)
+		if err != nil {
+			return err
+		}
+	}
+	if ks == nil {
+		return fmt.Errorf("repo has no keystore to restore key %q to", name)
+	}
+	sk, err := ci.UnmarshalPrivateKey(data)
+	if err != nil {
+		return err
+	}
+	has, err := ks.Has(name)
+	if err != nil {
+		return err
+	}
+	if has {
+		if err := ks.Delete(name); err != nil {
+			return err
+		}
+	}
+	return ks.Put(name, sk)
+}
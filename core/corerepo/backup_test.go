@@ -0,0 +1,169 @@
+package corerepo
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ipsn/go-ipfs/core"
+	keystore "github.com/ipsn/go-ipfs/keystore"
+	repo "github.com/ipsn/go-ipfs/repo"
+
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	syncds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-blockstore"
+	config "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-config"
+	merkledag "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-merkledag"
+	ci "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-crypto"
+)
+
+func newBackupTestRepo(t *testing.T) *repo.Mock {
+	cfg, err := config.Init(ioutil.Discard, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &repo.Mock{
+		C: *cfg,
+		D: syncds.MutexWrap(ds.NewMapDatastore()),
+		K: keystore.NewMemKeystore(),
+	}
+}
+
+func addPinned(ctx context.Context, t *testing.T, n *core.IpfsNode, data string) *merkledag.ProtoNode {
+	nd := merkledag.NodeWithData([]byte(data))
+	if err := n.DAG.Add(ctx, nd); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Pinning.Pin(ctx, nd, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Pinning.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return nd
+}
+
+func TestBackupRestore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := newBackupTestRepo(t)
+	src.C.Tenants = map[string]config.Tenant{"alice": {APIToken: "secret"}}
+	n, err := core.NewNode(ctx, &core.BuildCfg{Repo: src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	first := addPinned(ctx, t, n, "first")
+	sk, _, err := ci.GenerateKeyPair(ci.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.K.Put("mykey", sk); err != nil {
+		t.Fatal(err)
+	}
+	aliceKeys, err := src.TenantKeystore("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := aliceKeys.Put("alicekey", sk); err != nil {
+		t.Fatal(err)
+	}
+	record := ds.NewKey("/ipns/RECORD")
+	if err := src.D.Put(record, []byte("record")); err != nil {
+		t.Fatal(err)
+	}
+	cached := ds.NewKey("/ipns-cache/RECORD")
+	if err := src.D.Put(cached, []byte("cached")); err != nil {
+		t.Fatal(err)
+	}
+
+	var full bytes.Buffer
+	stat, err := Backup(ctx, n, &full, BackupOptions{Blocks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Keys != 2 || stat.Blocks == 0 {
+		t.Fatalf("unexpected backup stat %+v", stat)
+	}
+
+	second := addPinned(ctx, t, n, "second")
+	var incr bytes.Buffer
+	istat, err := Backup(ctx, n, &incr, BackupOptions{Base: bytes.NewReader(full.Bytes())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if istat.Manifest.Base != stat.Manifest.ID {
+		t.Fatalf("expected the backup to build on %s, got %q", stat.Manifest.ID, istat.Manifest.Base)
+	}
+
+	// Only the blocks added since the full backup are included.
+	tr := tar.NewReader(bytes.NewReader(incr.Bytes()))
+	var included []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		included = append(included, hdr.Name)
+	}
+	for _, name := range included {
+		if name == backupBlocksPrefix+first.Cid().String() {
+			t.Fatal("didn't expect the incremental backup to include blocks of the full backup")
+		}
+	}
+	if istat.Blocks == 0 || istat.Blocks >= stat.Blocks+2 {
+		t.Fatalf("unexpected number of blocks in the incremental backup: %d", istat.Blocks)
+	}
+
+	dst := newBackupTestRepo(t)
+	if _, err := Restore(ctx, dst, bytes.NewReader(incr.Bytes())); err == nil {
+		t.Fatal("expected restoring an incremental backup alone to fail")
+	}
+	stats, err := Restore(ctx, dst, bytes.NewReader(full.Bytes()), bytes.NewReader(incr.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 backups to be restored, got %d", len(stats))
+	}
+
+	if dst.C.Identity.PeerID != src.C.Identity.PeerID {
+		t.Error("expected the identity to be restored")
+	}
+	if has, _ := dst.K.Has("mykey"); !has {
+		t.Error("expected the key to be restored")
+	}
+	if aliceKeys, err := dst.TenantKeystore("alice"); err != nil {
+		t.Error(err)
+	} else if has, _ := aliceKeys.Has("alicekey"); !has {
+		t.Error("expected the key of the tenant to be restored")
+	}
+	if v, err := dst.D.Get(record); err != nil || string(v) != "record" {
+		t.Errorf("expected the datastore entry to be restored, got %q, %v", v, err)
+	}
+	if has, _ := dst.D.Has(cached); has {
+		t.Error("didn't expect cached entries to be backed up")
+	}
+
+	restored, err := core.NewNode(ctx, &core.BuildCfg{Repo: dst})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	bs := bstore.NewBlockstore(dst.D)
+	for _, nd := range []*merkledag.ProtoNode{first, second} {
+		if has, _ := bs.Has(nd.Cid()); !has {
+			t.Errorf("expected block %s to be restored", nd.Cid())
+		}
+		if _, pinned, err := restored.Pinning.IsPinned(nd.Cid()); err != nil || !pinned {
+			t.Errorf("expected %s to be pinned: %v", nd.Cid(), err)
+		}
+	}
+}
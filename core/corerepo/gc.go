@@ -79,16 +79,32 @@ func BestEffortRoots(filesRoot *mfs.Root) ([]cid.Cid, error) {
 	return []cid.Cid{rootDag.Cid()}, nil
 }
 
+// gcRoots returns the best effort roots of the MFS roots of the node and of
+// its tenants.
+func gcRoots(n *core.IpfsNode) ([]cid.Cid, error) {
+	var roots []cid.Cid
+	for _, filesRoot := range n.FilesRoots() {
+		r, err := BestEffortRoots(filesRoot)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, r...)
+	}
+	return roots, nil
+}
+
 func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel() // in case error occurs during operation
-	roots, err := BestEffortRoots(n.FilesRoot)
+	roots, err := gcRoots(n)
 	if err != nil {
 		return err
 	}
-	rmed := gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
+	rmed := gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.GCPinner(), roots)
 
-	return CollectResult(ctx, rmed, nil)
+	err = CollectResult(ctx, rmed, nil)
+	n.BlockStat.PinsChanged()
+	return err
 }
 
 // CollectResult collects the output of a garbage collection run and calls the
@@ -146,7 +162,7 @@ func (e *MultiError) Error() string {
 }
 
 func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) <-chan gc.Result {
-	roots, err := BestEffortRoots(n.FilesRoot)
+	roots, err := gcRoots(n)
 	if err != nil {
 		out := make(chan gc.Result)
 		out <- gc.Result{Error: err}
@@ -154,7 +170,21 @@ func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) <-chan gc.Result
 		return out
 	}
 
-	return gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
+	rmed := gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.GCPinner(), roots)
+
+	// Have the pinned blocks recounted once the collection is done.
+	out := make(chan gc.Result)
+	go func() {
+		defer close(out)
+		defer n.BlockStat.PinsChanged()
+		for res := range rmed {
+			select {
+			case out <- res:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
 }
 
 func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
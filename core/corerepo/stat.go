@@ -6,7 +6,9 @@ import (
 
 	context "context"
 
+	blockstat "github.com/ipsn/go-ipfs/blocks/blockstat"
 	"github.com/ipsn/go-ipfs/core"
+	repo "github.com/ipsn/go-ipfs/repo"
 	fsrepo "github.com/ipsn/go-ipfs/repo/fsrepo"
 
 	humanize "github.com/dustin/go-humanize"
@@ -24,6 +26,10 @@ type Stat struct {
 	NumObjects uint64
 	RepoPath   string
 	Version    string
+	// Tiers reports the usage of the tiered datastores of the repo.
+	Tiers []repo.TierStat `json:",omitempty"`
+	// Blocks breaks the blocks of the repo down by type.
+	Blocks *blockstat.Stat `json:",omitempty"`
 }
 
 // NoLimit represents the value for unlimited storage
@@ -36,17 +42,19 @@ func RepoStat(ctx context.Context, n *core.IpfsNode) (Stat, error) {
 		return Stat{}, err
 	}
 
-	allKeys, err := n.Blockstore.AllKeysChan(ctx)
-	if err != nil {
-		return Stat{}, err
+	// Block counts that can't be trusted are reconciled in the background,
+	// meanwhile they are reported as approximate.
+	if !n.BlockStat.Accurate() {
+		n.BlockStat.ReconcileInBackground()
 	}
+	blocks := n.BlockStat.Stat()
 
-	count := uint64(0)
-	for range allKeys {
-		count++
+	path, err := fsrepo.BestKnownPath()
+	if err != nil {
+		return Stat{}, err
 	}
 
-	path, err := fsrepo.BestKnownPath()
+	tiers, err := n.Repo.DatastoreTiers()
 	if err != nil {
 		return Stat{}, err
 	}
@@ -56,9 +64,11 @@ func RepoStat(ctx context.Context, n *core.IpfsNode) (Stat, error) {
 			RepoSize:   sizeStat.RepoSize,
 			StorageMax: sizeStat.StorageMax,
 		},
-		NumObjects: count,
+		NumObjects: blocks.Blocks,
 		RepoPath:   path,
 		Version:    fmt.Sprintf("fs-repo@%d", fsrepo.RepoVersion),
+		Tiers:      tiers,
+		Blocks:     &blocks,
 	}, nil
 }
 
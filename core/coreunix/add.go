@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	gopath "path"
 	"strconv"
+	"strings"
 
 	"github.com/ipsn/go-ipfs/pin"
 
@@ -24,6 +26,8 @@ import (
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/importer/balanced"
 	ihelper "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/importer/helpers"
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/importer/trickle"
+	uio "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/io"
+	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/mod"
 	coreiface "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/interface-go-ipfs-core"
 )
 
@@ -34,6 +38,8 @@ const progressReaderIncrement = 1024 * 256
 
 var liveCacheSize = uint64(256 << 10)
 
+var errPartialDirectory = errors.New("partial adds only support a single file")
+
 type Link struct {
 	Name, Hash string
 	Size       uint64
@@ -76,12 +82,16 @@ type Adder struct {
 	Name       string
 	NoCopy     bool
 	Chunker    string
+	Upload     *Upload
 	root       ipld.Node
 	mroot      *mfs.Root
 	unlocker   bstore.Unlocker
 	tempRoot   cid.Cid
 	CidBuilder cid.Builder
 	liveNodes  uint64
+
+	// DirectoryOptions configure the sharding of the added directories.
+	DirectoryOptions []uio.DirectoryOption
 }
 
 func (adder *Adder) mfsRoot() (*mfs.Root, error) {
@@ -90,7 +100,7 @@ func (adder *Adder) mfsRoot() (*mfs.Root, error) {
 	}
 	rnode := unixfs.EmptyDirNode()
 	rnode.SetCidBuilder(adder.CidBuilder)
-	mr, err := mfs.NewRoot(adder.ctx, adder.dagService, rnode, nil)
+	mr, err := mfs.NewRoot(adder.ctx, adder.dagService, rnode, nil, adder.DirectoryOptions...)
 	if err != nil {
 		return nil, err
 	}
@@ -103,8 +113,21 @@ func (adder *Adder) SetMfsRoot(r *mfs.Root) {
 	adder.mroot = r
 }
 
-// Constructs a node from reader's data, and adds it. Doesn't pin.
-func (adder *Adder) add(reader io.Reader) (ipld.Node, error) {
+// Constructs a node from reader's data, and adds it. Doesn't pin. When
+// only a part of an upload is added, the returned node is nil.
+func (adder *Adder) add(path string, reader io.Reader) (ipld.Node, error) {
+	var leaves ihelper.LeafSource
+	if adder.Upload != nil {
+		l, r, err := adder.Upload.start(path, reader)
+		if err != nil {
+			return nil, err
+		}
+		if l != nil {
+			leaves = l
+		}
+		reader = r
+	}
+
 	chnk, err := chunker.FromString(reader, adder.Chunker)
 	if err != nil {
 		return nil, err
@@ -121,15 +144,62 @@ func (adder *Adder) add(reader io.Reader) (ipld.Node, error) {
 		CidBuilder: adder.CidBuilder,
 	}
 
+	var holdback *holdbackSplitter
+	if adder.Upload != nil {
+		params.Leaves = leaves
+		params.OnLeaf = func(nd ipld.Node, size uint64) error {
+			return adder.Upload.addLeaf(nd, size, adder.bufferedDS.Commit)
+		}
+		if adder.Upload.Partial {
+			holdback = &holdbackSplitter{Splitter: chnk}
+			chnk = holdback
+		}
+	}
+
 	db, err := params.New(chnk)
 	if err != nil {
 		return nil, err
 	}
-	if adder.Trickle {
-		return trickle.Layout(db)
+
+	var nd ipld.Node
+	switch {
+	case holdback != nil:
+		err = adder.addLeaves(db)
+	case adder.Trickle:
+		nd, err = trickle.Layout(db)
+	default:
+		nd, err = balanced.Layout(db)
+	}
+	if err != nil || holdback == nil {
+		return nd, err
 	}
 
-	return balanced.Layout(db)
+	// Keep the leaves of this part, the DAG built on top of them is
+	// incomplete.
+	if err := adder.bufferedDS.Commit(); err != nil {
+		return nil, err
+	}
+	return nil, adder.Upload.finishPart(holdback.tail)
+}
+
+// addLeaves stores the leaves of the data of db without building a DAG over
+// them, for a part of an upload.
+func (adder *Adder) addLeaves(db *ihelper.DagBuilderHelper) error {
+	// the leaves are typed as the layout would
+	leafType := unixfs.TFile
+	if adder.Trickle {
+		leafType = unixfs.TRaw
+	}
+	for !db.Done() {
+		nd, _, err := db.NewLeafDataNode(leafType)
+		if err != nil {
+			return err
+		}
+		if err := db.Add(nd); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // RootNode returns the root node of the Added.
@@ -327,7 +397,10 @@ func (adder *Adder) AddAllAndPin(file files.Node) (ipld.Node, error) {
 		// single files.File f is treated as a directory, affecting hidden file
 		// semantics.
 		it := tf.Entries()
-		for it.Next() {
+		for i := 0; it.Next(); i++ {
+			if i > 0 && adder.Upload != nil && adder.Upload.Partial {
+				return nil, errPartialDirectory
+			}
 			if err := adder.addFileNode(it.Name(), it.Node()); err != nil {
 				return nil, err
 			}
@@ -343,16 +416,126 @@ func (adder *Adder) AddAllAndPin(file files.Node) (ipld.Node, error) {
 		break
 	}
 
+	if adder.Upload != nil && adder.Upload.Partial {
+		// The file is not complete yet.
+		return nil, nil
+	}
+
 	// copy intermediary nodes from editor to our actual dagservice
 	nd, err := adder.Finalize()
 	if err != nil {
 		return nil, err
 	}
 
-	if !adder.Pin {
-		return nd, nil
+	if adder.Pin {
+		if err := adder.PinRoot(); err != nil {
+			return nil, err
+		}
+	}
+
+	if adder.Upload != nil {
+		return nd, adder.Upload.Remove()
+	}
+	return nd, nil
+}
+
+// fixedChunkSize returns the size of the chunks made by the given chunker,
+// zero if their size depends on the data.
+func fixedChunkSize(spec string) int64 {
+	switch {
+	case spec == "" || spec == "default":
+		return chunker.DefaultBlockSize
+	case strings.HasPrefix(spec, "size-"):
+		size, err := strconv.ParseInt(strings.TrimPrefix(spec, "size-"), 10, 64)
+		if err != nil {
+			return 0
+		}
+		return size
+	default:
+		return 0
+	}
+}
+
+// AppendAndPin appends the given file's data to the unixfs file at root, and
+// pins the resulting root. The data is added with the trickle layout: only
+// the right-most nodes of the original file are rewritten.
+func (adder *Adder) AppendAndPin(root ipld.Node, file files.Node) (ipld.Node, error) {
+	if adder.Pin {
+		adder.unlocker = adder.gcLocker.PinLock()
+	}
+	defer func() {
+		if adder.unlocker != nil {
+			adder.unlocker.Unlock()
+		}
+	}()
+
+	name := ""
+	if dir, ok := file.(files.Directory); ok {
+		it := dir.Entries()
+		if !it.Next() {
+			if it.Err() != nil {
+				return nil, it.Err()
+			}
+			return nil, errors.New("no file to append")
+		}
+		name, file = it.Name(), it.Node()
+		if it.Next() {
+			return nil, errors.New("can only append a single file")
+		}
+	}
+	defer file.Close()
+
+	f, ok := file.(files.File)
+	if !ok {
+		return nil, errors.New("can only append a regular file")
+	}
+
+	if _, err := chunker.FromString(nil, adder.Chunker); err != nil {
+		return nil, err
+	}
+	spl := func(r io.Reader) chunker.Splitter {
+		s, _ := chunker.FromString(r, adder.Chunker)
+		return s
+	}
+
+	dm, err := mod.NewDagModifier(adder.ctx, root, adder.dagService, spl)
+	if err != nil {
+		return nil, err
+	}
+	if adder.RawLeaves {
+		dm.RawLeaves = true
+	}
+	dm.MergeChunkSize = fixedChunkSize(adder.Chunker)
+
+	if _, err := dm.Seek(0, io.SeekEnd); err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader = f
+	if adder.Progress {
+		reader = &progressReader{file: reader, path: name, out: adder.Out}
+	}
+	if _, err := io.Copy(dm, reader); err != nil {
+		return nil, err
+	}
+
+	nd, err := dm.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := adder.dagService.Add(adder.ctx, nd); err != nil {
+		return nil, err
+	}
+
+	if adder.Pin {
+		adder.pinning.PinWithMode(nd.Cid(), pin.Recursive)
+		if err := adder.pinning.Flush(); err != nil {
+			return nil, err
+		}
 	}
-	return nd, adder.PinRoot()
+
+	adder.root = nd
+	return nd, outputDagnode(adder.Out, name, nd)
 }
 
 func (adder *Adder) addFileNode(path string, file files.Node) error {
@@ -405,6 +588,24 @@ func (adder *Adder) addSymlink(path string, l *files.Symlink) error {
 }
 
 func (adder *Adder) addFile(path string, file files.File) error {
+	if adder.Upload != nil {
+		c, err := adder.Upload.done(path)
+		if err != nil {
+			return err
+		}
+		if c.Defined() {
+			// Added by a previous attempt, skip the data.
+			if _, err := io.Copy(ioutil.Discard, file); err != nil {
+				return err
+			}
+			dagnode, err := adder.dagService.Get(adder.ctx, c)
+			if err != nil {
+				return err
+			}
+			return adder.addNode(dagnode, path)
+		}
+	}
+
 	// if the progress flag was specified, wrap the file so that we can send
 	// progress updates to the client (over the output channel)
 	var reader io.Reader = file
@@ -417,11 +618,28 @@ func (adder *Adder) addFile(path string, file files.File) error {
 		}
 	}
 
-	dagnode, err := adder.add(reader)
+	dagnode, err := adder.add(path, reader)
 	if err != nil {
 		return err
 	}
 
+	if adder.Upload != nil {
+		if dagnode == nil {
+			// Only a part of the file was received, report how much
+			// is stored for the next one to continue from there.
+			if adder.Out != nil {
+				adder.Out <- &coreiface.AddEvent{
+					Name:  path,
+					Bytes: adder.Upload.Offset(),
+				}
+			}
+			return nil
+		}
+		if err := adder.Upload.fileDone(path, dagnode.Cid()); err != nil {
+			return err
+		}
+	}
+
 	addFileInfo, ok := file.(files.FileInfo)
 	if ok {
 		if addFileInfo.AbsPath() == os.Stdin.Name() && adder.Name != "" {
@@ -436,6 +654,10 @@ func (adder *Adder) addFile(path string, file files.File) error {
 func (adder *Adder) addDir(path string, dir files.Directory) error {
 	log.Infof("adding directory: %s", path)
 
+	if adder.Upload != nil && adder.Upload.Partial {
+		return errPartialDirectory
+	}
+
 	mr, err := adder.mfsRoot()
 	if err != nil {
 		return err
@@ -516,6 +738,37 @@ func getOutput(dagnode ipld.Node) (*coreiface.AddEvent, error) {
 	return output, nil
 }
 
+// holdbackSplitter withholds the last chunk of a Splitter, so that the data
+// of a partial upload is chunked again along with the next part.
+type holdbackSplitter struct {
+	chunker.Splitter
+	next []byte
+	tail []byte
+}
+
+func (s *holdbackSplitter) NextBytes() ([]byte, error) {
+	if s.next == nil {
+		b, err := s.Splitter.NextBytes()
+		if err != nil {
+			return nil, err
+		}
+		s.next = b
+	}
+
+	b, err := s.Splitter.NextBytes()
+	switch err {
+	case nil:
+		cur := s.next
+		s.next = b
+		return cur, nil
+	case io.EOF:
+		s.tail, s.next = s.next, nil
+		return nil, io.EOF
+	default:
+		return nil, err
+	}
+}
+
 type progressReader struct {
 	file         io.Reader
 	path         string
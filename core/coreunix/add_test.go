@@ -255,3 +255,45 @@ func (fi *dummyFileInfo) Mode() os.FileMode  { return 0 }
 func (fi *dummyFileInfo) ModTime() time.Time { return fi.modTime }
 func (fi *dummyFileInfo) IsDir() bool        { return false }
 func (fi *dummyFileInfo) Sys() interface{}   { return nil }
+
+func TestAppendAndPin(t *testing.T) {
+	data := make([]byte, 300*1024)
+	rand.New(rand.NewSource(3)).Read(data)
+
+	node := getUploadNode(t)
+	newAdder := func() *Adder {
+		adder, err := NewAdder(context.Background(), node.Pinning, node.Blockstore, node.DAG)
+		if err != nil {
+			t.Fatal(err)
+		}
+		adder.Trickle = true
+		adder.RawLeaves = true
+		return adder
+	}
+
+	expected, err := newAdder().AddAllAndPin(files.NewBytesFile(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, err := newAdder().AddAllAndPin(files.NewBytesFile(data[:100*1024+5]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := newAdder().AppendAndPin(base, files.NewBytesFile(data[100*1024+5:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(expected.Cid()) {
+		t.Fatalf("appended file is %s, expected %s", nd.Cid(), expected.Cid())
+	}
+
+	_, pinned, err := node.Pinning.IsPinned(nd.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pinned {
+		t.Fatal("expected appended file to be pinned")
+	}
+}
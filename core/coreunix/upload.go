@@ -0,0 +1,411 @@
+package coreunix
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+
+	cid "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-cid"
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	bstore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-blockstore"
+	ipld "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipld-format"
+)
+
+// uploadPrefix is the datastore namespace holding the progress of resumable
+// adds.
+var uploadPrefix = ds.NewKey("/local/uploads")
+
+// leavesPerCheckpoint is the number of leaves of a file imported between two
+// saves of the progress of an upload.
+const leavesPerCheckpoint = 256
+
+// ErrInvalidUploadID is returned when opening an upload with an ID which
+// cannot be used as a datastore key.
+var ErrInvalidUploadID = errors.New("upload ID must be non-empty and may not contain '/'")
+
+// ErrUploadInProgress is returned when opening an upload which is already
+// open, e.g. by a concurrent add of another part of the same file.
+var ErrUploadInProgress = errors.New("upload is already in progress")
+
+// openUploads holds the IDs of the uploads currently open, so that two adds
+// never write the progress of the same upload.
+var (
+	openUploadsLk sync.Mutex
+	openUploads   = make(map[string]struct{})
+)
+
+// Upload persists the progress of an add in the repo datastore under an
+// upload ID, so that an interrupted add can be continued where it stopped
+// instead of restarting from zero.
+//
+// The progress consists of the roots of the files completely added so far
+// and the leaves of the file which was being added. Leaves are saved in
+// batches so that checkpointing does not rewrite the whole state. The DAG of
+// a file added in parts is only built over its leaves once the last part is
+// received.
+//
+// An upload can only be open once at a time, it must be closed when done.
+type Upload struct {
+	// InputOffset is the offset in the file being added at which the data
+	// given to the adder starts. It must not be past Offset(); the data
+	// already stored is skipped.
+	InputOffset int64
+	// Partial signals that the data given to the adder is only the next
+	// part of a single file. Once it is consumed, the progress is saved
+	// and the add stops without completing the file.
+	Partial bool
+
+	id     string
+	dstore ds.Datastore
+	bs     bstore.Blockstore
+	state  uploadState
+
+	// leaves of the current file not saved yet
+	pending []uploadLeaf
+
+	closeOnce sync.Once
+}
+
+type uploadState struct {
+	// Done maps the paths of completely added files to their roots.
+	Done map[string]string
+	// Path is the file being added when the upload was interrupted.
+	Path string
+	// Offset is the amount of data of Path held by the saved leaves.
+	Offset uint64
+	// Batches is the number of saved batches of leaves of Path.
+	Batches int
+	// Tail is the data of Path past Offset received by a partial add,
+	// which is chunked along with the next part.
+	Tail []byte `json:",omitempty"`
+}
+
+type uploadLeaf struct {
+	Cid  string
+	Size uint64
+}
+
+// OpenUpload returns the upload with the given ID, resuming its progress if
+// it was already started. The blockstore is used to make sure the blocks
+// stored so far were not garbage collected since. ErrUploadInProgress is
+// returned if the upload is already open.
+func OpenUpload(d ds.Datastore, bs bstore.Blockstore, id string) (*Upload, error) {
+	if id == "" || strings.Contains(id, "/") {
+		return nil, ErrInvalidUploadID
+	}
+
+	openUploadsLk.Lock()
+	_, open := openUploads[id]
+	if !open {
+		openUploads[id] = struct{}{}
+	}
+	openUploadsLk.Unlock()
+	if open {
+		return nil, ErrUploadInProgress
+	}
+
+	u, err := openUpload(d, bs, id)
+	if err != nil {
+		releaseUpload(id)
+		return nil, err
+	}
+	return u, nil
+}
+
+func openUpload(d ds.Datastore, bs bstore.Blockstore, id string) (*Upload, error) {
+	u := &Upload{
+		id:     id,
+		dstore: d,
+		bs:     bs,
+		state:  uploadState{Done: make(map[string]string)},
+	}
+
+	val, err := d.Get(u.key())
+	switch err {
+	case nil:
+	case ds.ErrNotFound:
+		return u, nil
+	default:
+		return nil, err
+	}
+
+	if err := json.Unmarshal(val, &u.state); err != nil {
+		return nil, err
+	}
+	if u.state.Done == nil {
+		u.state.Done = make(map[string]string)
+	}
+
+	log.Infof("resuming upload %s: %d files done, %d bytes of %q", id, len(u.state.Done), u.Offset(), u.state.Path)
+	return u, nil
+}
+
+// Close releases the upload, allowing it to be opened again.
+func (u *Upload) Close() {
+	u.closeOnce.Do(func() {
+		releaseUpload(u.id)
+	})
+}
+
+func releaseUpload(id string) {
+	openUploadsLk.Lock()
+	delete(openUploads, id)
+	openUploadsLk.Unlock()
+}
+
+// ID returns the ID of the upload.
+func (u *Upload) ID() string {
+	return u.id
+}
+
+// Offset returns the amount of data of the file being added which has been
+// received so far.
+func (u *Upload) Offset() int64 {
+	return int64(u.state.Offset) + int64(len(u.state.Tail))
+}
+
+// Remove deletes the progress of the upload.
+func (u *Upload) Remove() error {
+	for i := 0; i < u.state.Batches; i++ {
+		if err := u.dstore.Delete(u.batchKey(i)); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	err := u.dstore.Delete(u.key())
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// done returns the root of the file at path if a previous add completed
+// it, or an undefined cid.
+func (u *Upload) done(path string) (cid.Cid, error) {
+	s, ok := u.state.Done[path]
+	if !ok {
+		return cid.Undef, nil
+	}
+
+	c, err := cid.Decode(s)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	has, err := u.bs.Has(c)
+	if err != nil || !has {
+		delete(u.state.Done, path)
+		return cid.Undef, err
+	}
+	return c, nil
+}
+
+// fileDone records the root of the file at path.
+func (u *Upload) fileDone(path string, c cid.Cid) error {
+	if err := u.reset(""); err != nil {
+		return err
+	}
+	u.state.Done[path] = c.String()
+	return u.save()
+}
+
+// reset drops the progress of the file being added, to start adding the
+// file at path.
+func (u *Upload) reset(path string) error {
+	for i := 0; i < u.state.Batches; i++ {
+		if err := u.dstore.Delete(u.batchKey(i)); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+
+	u.state.Path = path
+	u.state.Offset = 0
+	u.state.Batches = 0
+	u.state.Tail = nil
+	u.pending = nil
+	return nil
+}
+
+// start prepares the add of the file at path, returning the leaves already
+// stored for it and a reader over the part of r which has not been stored.
+// No leaves are returned for a partial add, which only stores the leaves of
+// its own part.
+func (u *Upload) start(path string, r io.Reader) (*uploadLeaves, io.Reader, error) {
+	if u.state.Path != path {
+		if u.state.Path != "" {
+			log.Warningf("upload %s: discarding progress of %q", u.id, u.state.Path)
+		}
+		if err := u.reset(path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if u.InputOffset > u.Offset() {
+		return nil, nil, fmt.Errorf("upload %s only has %d bytes of %q, cannot continue at %d", u.id, u.Offset(), path, u.InputOffset)
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, u.Offset()-u.InputOffset); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, nil, err
+	}
+	if len(u.state.Tail) > 0 {
+		r = io.MultiReader(bytes.NewReader(u.state.Tail), r)
+		u.state.Tail = nil
+	}
+
+	if u.Partial {
+		return nil, r, nil
+	}
+	leaves := &uploadLeaves{u: u}
+	if u.state.Batches > 0 {
+		if err := leaves.check(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return leaves, r, nil
+}
+
+// addLeaf records a leaf of the file being added, saving the progress every
+// leavesPerCheckpoint leaves. The last leaf recorded is not saved, as it is
+// not yet guaranteed to be stored: commit must store everything added
+// before it.
+func (u *Upload) addLeaf(nd ipld.Node, size uint64, commit func() error) error {
+	u.pending = append(u.pending, uploadLeaf{Cid: nd.Cid().String(), Size: size})
+	if len(u.pending) <= leavesPerCheckpoint {
+		return nil
+	}
+
+	if err := commit(); err != nil {
+		return err
+	}
+	return u.checkpoint(leavesPerCheckpoint)
+}
+
+// checkpoint saves the first n pending leaves as a new batch.
+func (u *Upload) checkpoint(n int) error {
+	batch := u.pending[:n]
+	val, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	if err := u.dstore.Put(u.batchKey(u.state.Batches), val); err != nil {
+		return err
+	}
+
+	for _, l := range batch {
+		u.state.Offset += l.Size
+	}
+	u.state.Batches++
+	u.pending = append(u.pending[:0], u.pending[n:]...)
+	return u.save()
+}
+
+// finishPart saves all the leaves received by a partial add, followed by the
+// data which did not make a whole leaf.
+func (u *Upload) finishPart(tail []byte) error {
+	if len(u.pending) > 0 {
+		if err := u.checkpoint(len(u.pending)); err != nil {
+			return err
+		}
+	}
+
+	u.state.Tail = tail
+	return u.save()
+}
+
+func (u *Upload) save() error {
+	val, err := json.Marshal(&u.state)
+	if err != nil {
+		return err
+	}
+	return u.dstore.Put(u.key(), val)
+}
+
+func (u *Upload) key() ds.Key {
+	return uploadPrefix.ChildString(u.id)
+}
+
+func (u *Upload) batchKey(i int) ds.Key {
+	return u.key().ChildString("leaves").ChildString(strconv.Itoa(i))
+}
+
+// uploadLeaves implements helpers.LeafSource over the saved leaves of the
+// file being added.
+type uploadLeaves struct {
+	u     *Upload
+	batch int
+	cur   []uploadLeaf
+}
+
+func (l *uploadLeaves) NextLeaf() (ipld.Node, uint64, error) {
+	if len(l.cur) == 0 {
+		if l.batch >= l.u.state.Batches {
+			return nil, 0, nil
+		}
+		batch, err := l.load(l.batch)
+		if err != nil {
+			return nil, 0, err
+		}
+		l.batch++
+		l.cur = batch
+	}
+
+	leaf := l.cur[0]
+	l.cur = l.cur[1:]
+
+	c, err := cid.Decode(leaf.Cid)
+	if err != nil {
+		return nil, 0, err
+	}
+	blk, err := l.u.bs.Get(c)
+	if err != nil {
+		return nil, 0, err
+	}
+	nd, err := ipld.Decode(blk)
+	if err != nil {
+		return nil, 0, err
+	}
+	return nd, leaf.Size, nil
+}
+
+// check makes sure all the saved leaves are still stored.
+func (l *uploadLeaves) check() error {
+	for i := 0; i < l.u.state.Batches; i++ {
+		batch, err := l.load(i)
+		if err != nil {
+			return err
+		}
+		for _, leaf := range batch {
+			c, err := cid.Decode(leaf.Cid)
+			if err != nil {
+				return err
+			}
+			has, err := l.u.bs.Has(c)
+			if err != nil {
+				return err
+			}
+			if !has {
+				return fmt.Errorf("upload %s: blocks of %q were garbage collected, the upload must be restarted", l.u.id, l.u.state.Path)
+			}
+		}
+	}
+	return nil
+}
+
+func (l *uploadLeaves) load(i int) ([]uploadLeaf, error) {
+	val, err := l.u.dstore.Get(l.u.batchKey(i))
+	if err != nil {
+		return nil, err
+	}
+	var batch []uploadLeaf
+	if err := json.Unmarshal(val, &batch); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
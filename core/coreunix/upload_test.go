@@ -0,0 +1,159 @@
+package coreunix
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/ipsn/go-ipfs/core"
+	"github.com/ipsn/go-ipfs/repo"
+
+	datastore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	syncds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/sync"
+	config "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-config"
+	files "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-files"
+	ipld "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipld-format"
+)
+
+const uploadChunker = "size-1024"
+
+func getUploadNode(t *testing.T) *core.IpfsNode {
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: config.Identity{
+				PeerID: testPeerID, // required by offline node
+			},
+		},
+		D: syncds.MutexWrap(datastore.NewMapDatastore()),
+	}
+	node, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+func addUpload(t *testing.T, node *core.IpfsNode, id string, offset int64, partial bool, r io.Reader) (ipld.Node, error) {
+	adder, err := NewAdder(context.Background(), node.Pinning, node.Blockstore, node.DAG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adder.Chunker = uploadChunker
+
+	if id != "" {
+		upload, err := OpenUpload(node.Repo.Datastore(), node.Blockstore, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer upload.Close()
+		upload.InputOffset = offset
+		upload.Partial = partial
+		adder.Upload = upload
+	}
+
+	return adder.AddAllAndPin(files.NewReaderFile(r))
+}
+
+type failingReader struct {
+	r io.Reader
+	n int
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.n <= 0 {
+		return 0, errors.New("connection lost")
+	}
+	if len(p) > f.n {
+		p = p[:f.n]
+	}
+	n, err := f.r.Read(p)
+	f.n -= n
+	return n, err
+}
+
+func TestUploadResume(t *testing.T) {
+	data := make([]byte, 700*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	node := getUploadNode(t)
+	expected, err := addUpload(t, node, "", 0, false, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node = getUploadNode(t)
+	_, err = addUpload(t, node, "up", 0, false, &failingReader{r: bytes.NewReader(data), n: 500 * 1024})
+	if err == nil {
+		t.Fatal("expected the add to fail")
+	}
+
+	upload, err := OpenUpload(node.Repo.Datastore(), node.Blockstore, "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.Offset() != leavesPerCheckpoint*1024 {
+		t.Fatalf("expected %d bytes to be stored, got %d", leavesPerCheckpoint*1024, upload.Offset())
+	}
+	if _, err := OpenUpload(node.Repo.Datastore(), node.Blockstore, "up"); err != ErrUploadInProgress {
+		t.Fatal("expected an open upload not to be opened again, got:", err)
+	}
+	upload.Close()
+
+	nd, err := addUpload(t, node, "up", 0, false, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(expected.Cid()) {
+		t.Fatalf("resumed add returned %s, expected %s", nd.Cid(), expected.Cid())
+	}
+
+	if _, err := node.Repo.Datastore().Get(uploadPrefix.ChildString("up")); err != datastore.ErrNotFound {
+		t.Fatal("expected upload to be removed once done, got:", err)
+	}
+}
+
+func TestUploadParts(t *testing.T) {
+	data := make([]byte, 700*1024)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	node := getUploadNode(t)
+	expected, err := addUpload(t, node, "", 0, false, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node = getUploadNode(t)
+	bounds := []int{0, 1000, 300*1024 + 17, 300*1024 + 17, 650 * 1024, len(data)}
+	for i := 1; i < len(bounds); i++ {
+		part := data[bounds[i-1]:bounds[i]]
+		last := i == len(bounds)-1
+
+		nd, err := addUpload(t, node, "parts", int64(bounds[i-1]), !last, bytes.NewReader(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !last {
+			if nd != nil {
+				t.Fatal("partial add should not return a node")
+			}
+			continue
+		}
+		if !nd.Cid().Equals(expected.Cid()) {
+			t.Fatalf("add in parts returned %s, expected %s", nd.Cid(), expected.Cid())
+		}
+	}
+
+	// Parts may overlap data already sent, but not skip any.
+	if _, err := addUpload(t, node, "gap", 0, true, bytes.NewReader(data[:1000])); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := addUpload(t, node, "gap", 2000, true, bytes.NewReader(data[2000:3000])); err == nil {
+		t.Fatal("expected a part past the stored data to be rejected")
+	}
+	if _, err := addUpload(t, node, "gap", 500, true, bytes.NewReader(data[500:3000])); err != nil {
+		t.Fatal(err)
+	}
+}
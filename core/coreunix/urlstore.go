@@ -0,0 +1,301 @@
+package coreunix
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	gopath "path"
+
+	"github.com/ipsn/go-ipfs/pin"
+
+	cid "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-cid"
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	bstore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-blockstore"
+	chunker "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-chunker"
+	posinfo "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-posinfo"
+	ipld "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipld-format"
+	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-mfs"
+	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs"
+	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/importer/balanced"
+	ihelper "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/importer/helpers"
+	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/importer/trickle"
+	uio "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/io"
+	mh "github.com/ipsn/go-ipfs/gxlibs/github.com/multiformats/go-multihash"
+)
+
+// urlImportPrefix is the datastore namespace holding the progress of
+// interrupted urlstore imports.
+var urlImportPrefix = ds.NewKey("/local/urlstore/imports")
+
+// URLEntry describes a single file of a urlstore import.
+type URLEntry struct {
+	// Name is the path of the file inside the resulting directory.
+	Name string
+	// URL is the location the file contents are streamed from.
+	URL string
+	// Size is the expected size of the contents, or -1 if unknown.
+	Size int64
+	// Cid is the expected root of the file, or undefined if unknown.
+	Cid cid.Cid
+}
+
+// URLAdder builds unixfs files whose leaves reference data served over
+// HTTP instead of storing it in the blockstore.
+type URLAdder struct {
+	ctx        context.Context
+	pinning    pin.Pinner
+	blockstore bstore.GCBlockstore
+	dagService ipld.DAGService
+	dstore     ds.Datastore
+	Client     *http.Client
+	Out        chan<- interface{}
+	Pin        bool
+	Trickle    bool
+	CidBuilder cid.Builder
+
+	// DirectoryOptions configure the sharding of the imported directories.
+	DirectoryOptions []uio.DirectoryOption
+}
+
+// urlImportState is the progress of an import persisted in the datastore
+// so that an interrupted import can be resumed.
+type urlImportState struct {
+	Done map[string]string
+}
+
+// NewURLAdder returns a new URLAdder. Progress of directory imports is kept
+// in the given datastore.
+func NewURLAdder(ctx context.Context, p pin.Pinner, bs bstore.GCBlockstore, dserv ipld.DAGService, d ds.Datastore) *URLAdder {
+	prefix := cid.NewPrefixV1(cid.DagProtobuf, mh.SHA2_256)
+	return &URLAdder{
+		ctx:        ctx,
+		pinning:    p,
+		blockstore: bs,
+		dagService: dserv,
+		dstore:     d,
+		Client:     http.DefaultClient,
+		Pin:        true,
+		CidBuilder: &prefix,
+	}
+}
+
+// AddURL streams the contents of the given entry once, and returns the root
+// of the resulting file together with the number of bytes read. It does not
+// pin.
+func (a *URLAdder) AddURL(e URLEntry) (ipld.Node, int64, error) {
+	hreq, err := http.NewRequest("GET", e.URL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hres, err := a.Client.Do(hreq.WithContext(a.ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer hres.Body.Close()
+
+	if hres.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("%s: expected code 200, got: %d", e.URL, hres.StatusCode)
+	}
+	if e.Size >= 0 && hres.ContentLength >= 0 && hres.ContentLength != e.Size {
+		return nil, 0, fmt.Errorf("%s: expected size %d, got: %d", e.URL, e.Size, hres.ContentLength)
+	}
+
+	cr := &countingReader{r: hres.Body}
+	dbp := &ihelper.DagBuilderParams{
+		Dagserv:    a.dagService,
+		RawLeaves:  true,
+		Maxlinks:   ihelper.DefaultLinksPerBlock,
+		NoCopy:     true,
+		CidBuilder: a.CidBuilder,
+		URL:        e.URL,
+	}
+
+	db, err := dbp.New(chunker.NewSizeSplitter(cr, chunker.DefaultBlockSize))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	layout := balanced.Layout
+	if a.Trickle {
+		layout = trickle.Layout
+	}
+
+	nd, err := layout(db)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if e.Size >= 0 && cr.n != e.Size {
+		return nil, 0, fmt.Errorf("%s: expected size %d, got: %d", e.URL, e.Size, cr.n)
+	}
+	if e.Cid.Defined() && !e.Cid.Equals(nd.Cid()) {
+		return nil, 0, fmt.Errorf("%s: expected %s, got: %s", e.URL, e.Cid, nd.Cid())
+	}
+
+	return nd, cr.n, nil
+}
+
+// AddAllAndPin imports the given entries into a single directory, pinning
+// its root when done. Entries completed by a previous, interrupted import of
+// the same entries are not fetched again.
+func (a *URLAdder) AddAllAndPin(entries []URLEntry) (ipld.Node, error) {
+	if a.Pin {
+		defer a.blockstore.PinLock().Unlock()
+	}
+
+	key := urlImportPrefix.ChildString(urlImportID(entries))
+	state, err := a.loadState(key)
+	if err != nil {
+		return nil, err
+	}
+
+	rnode := unixfs.EmptyDirNode()
+	rnode.SetCidBuilder(a.CidBuilder)
+	mr, err := mfs.NewRoot(a.ctx, a.dagService, rnode, nil, a.DirectoryOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		nd, err := a.resumed(state, e.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		if nd == nil {
+			nd, _, err = a.AddURL(e)
+			if err != nil {
+				return nil, err
+			}
+			if fn, ok := nd.(*posinfo.FilestoreNode); ok {
+				nd = fn.Node
+			}
+
+			state.Done[e.Name] = nd.Cid().String()
+			if err := a.saveState(key, state); err != nil {
+				return nil, err
+			}
+		}
+
+		if dir := gopath.Dir(e.Name); dir != "." {
+			err := mfs.Mkdir(mr, dir, mfs.MkdirOpts{
+				Mkparents:  true,
+				CidBuilder: a.CidBuilder,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := mfs.PutNode(mr, e.Name, nd); err != nil {
+			return nil, err
+		}
+
+		if err := outputDagnode(a.Out, e.Name, nd); err != nil {
+			return nil, err
+		}
+	}
+
+	rootdir := mr.GetDirectory()
+	if err := rootdir.Flush(); err != nil {
+		return nil, err
+	}
+	root, err := rootdir.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := mr.Close(); err != nil {
+		return nil, err
+	}
+
+	if a.Pin {
+		a.pinning.PinWithMode(root.Cid(), pin.Recursive)
+		if err := a.pinning.Flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := a.dstore.Delete(key); err != nil && err != ds.ErrNotFound {
+		return nil, err
+	}
+
+	return root, outputDagnode(a.Out, "", root)
+}
+
+// resumed returns the node recorded for name by a previous import, or nil if
+// the entry has to be fetched (again).
+func (a *URLAdder) resumed(state *urlImportState, name string) (ipld.Node, error) {
+	s, ok := state.Done[name]
+	if !ok {
+		return nil, nil
+	}
+
+	c, err := cid.Decode(s)
+	if err != nil {
+		return nil, err
+	}
+
+	// the root is not pinned until the import completes, make sure it
+	// was not garbage collected in the meantime.
+	has, err := a.blockstore.Has(c)
+	if err != nil || !has {
+		delete(state.Done, name)
+		return nil, err
+	}
+
+	return a.dagService.Get(a.ctx, c)
+}
+
+func (a *URLAdder) loadState(key ds.Key) (*urlImportState, error) {
+	state := &urlImportState{Done: make(map[string]string)}
+
+	val, err := a.dstore.Get(key)
+	switch err {
+	case nil:
+	case ds.ErrNotFound:
+		return state, nil
+	default:
+		return nil, err
+	}
+
+	if err := json.Unmarshal(val, state); err != nil {
+		return nil, err
+	}
+	if state.Done == nil {
+		state.Done = make(map[string]string)
+	}
+	log.Infof("resuming urlstore import %s, %d entries done", key.BaseNamespace(), len(state.Done))
+	return state, nil
+}
+
+func (a *URLAdder) saveState(key ds.Key, state *urlImportState) error {
+	val, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return a.dstore.Put(key, val)
+}
+
+// urlImportID identifies an import by the names and URLs of its entries.
+func urlImportID(entries []URLEntry) string {
+	h := sha256.New()
+	for _, e := range entries {
+		fmt.Fprintf(h, "%s\x00%s\n", e.Name, e.URL)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
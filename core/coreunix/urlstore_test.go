@@ -0,0 +1,157 @@
+package coreunix
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipsn/go-ipfs/core"
+	"github.com/ipsn/go-ipfs/filestore"
+	"github.com/ipsn/go-ipfs/repo"
+
+	datastore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	syncds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/sync"
+	config "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-config"
+	ipld "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipld-format"
+	path "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-path"
+	resolver "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-path/resolver"
+	uio "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/io"
+)
+
+func getURLNode(t *testing.T) *core.IpfsNode {
+	d := syncds.MutexWrap(datastore.NewMapDatastore())
+	fm := filestore.NewFileManager(d, "")
+	fm.AllowUrls = true
+
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: config.Identity{
+				PeerID: testPeerID, // required by offline node
+			},
+			Experimental: config.Experiments{
+				UrlstoreEnabled: true,
+			},
+		},
+		D: d,
+		F: fm,
+	}
+	node, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+func lookup(node *core.IpfsNode, root ipld.Node, name string) (ipld.Node, error) {
+	p, err := path.FromSegments("/ipfs/", root.Cid().String(), name)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.NewBasicResolver(node.DAG).ResolvePath(context.Background(), p)
+}
+
+func TestURLAdderDirectory(t *testing.T) {
+	contents := map[string][]byte{
+		"/a":     []byte("contents of a"),
+		"/b":     bytes.Repeat([]byte("b"), 1<<20),
+		"/fails": []byte("served once"),
+	}
+
+	var mu sync.Mutex
+	fetches := make(map[string]int)
+	failing := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		// ranged requests are reads of already imported blocks
+		if r.Header.Get("Range") == "" {
+			fetches[r.URL.Path]++
+		}
+		fail := failing && r.URL.Path == "/fails"
+		mu.Unlock()
+
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(contents[r.URL.Path]))
+	}))
+	defer srv.Close()
+
+	node := getURLNode(t)
+	entries := []URLEntry{
+		{Name: "a", URL: srv.URL + "/a", Size: int64(len(contents["/a"]))},
+		{Name: "sub/b", URL: srv.URL + "/b", Size: -1},
+		{Name: "c", URL: srv.URL + "/fails", Size: -1},
+	}
+
+	adder := NewURLAdder(context.Background(), node.Pinning, node.Blockstore, node.DAG, node.Repo.Datastore())
+	if _, err := adder.AddAllAndPin(entries); err == nil {
+		t.Fatal("expected the import to fail")
+	}
+
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+
+	root, err := adder.AddAllAndPin(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fetches["/a"] != 1 || fetches["/b"] != 1 || fetches["/fails"] != 2 {
+		t.Fatalf("expected completed files not to be fetched again, got %v", fetches)
+	}
+
+	for name, upath := range map[string]string{"a": "/a", "sub/b": "/b", "c": "/fails"} {
+		nd, err := lookup(node, root, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dr, err := uio.NewDagReader(context.Background(), nd, node.DAG)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(dr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, contents[upath]) {
+			t.Fatalf("%s: contents differ", name)
+		}
+	}
+
+	if _, err := node.Repo.Datastore().Get(urlImportPrefix.ChildString(urlImportID(entries))); err != datastore.ErrNotFound {
+		t.Fatal("expected import state to be removed once done, got:", err)
+	}
+}
+
+func TestURLAdderChecksSize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("12345"))
+	}))
+	defer srv.Close()
+
+	node := getURLNode(t)
+	adder := NewURLAdder(context.Background(), node.Pinning, node.Blockstore, node.DAG, node.Repo.Datastore())
+	if _, _, err := adder.AddURL(URLEntry{URL: srv.URL, Size: 4}); err == nil {
+		t.Fatal("expected size mismatch")
+	}
+
+	nd, size, err := adder.AddURL(URLEntry{URL: srv.URL, Size: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 5 {
+		t.Fatalf("expected 5 bytes, got %d", size)
+	}
+
+	if _, _, err := adder.AddURL(URLEntry{URL: srv.URL, Size: -1, Cid: nd.Cid()}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,263 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+
+	keystore "github.com/ipsn/go-ipfs/keystore"
+	ipnsrp "github.com/ipsn/go-ipfs/namesys/republisher"
+	pin "github.com/ipsn/go-ipfs/pin"
+	repo "github.com/ipsn/go-ipfs/repo"
+
+	bserv "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-blockservice"
+	cid "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-cid"
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	namespace "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/namespace"
+	config "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-config"
+	offline "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-exchange-offline"
+	merkledag "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-merkledag"
+	mfs "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-mfs"
+	ic "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peer"
+)
+
+// TenantsPrefix is the datastore namespace the state of the tenants is stored
+// under, each tenant in a child namespace named after it.
+var TenantsPrefix = ds.NewKey("/tenants")
+
+var tenantKeyKey = ds.NewKey("/local/selfkey")
+
+// Tenants are the logical nodes hosted by a node. A tenant shares the libp2p
+// host, the blockstore and the datastore of the node, but has its own pin set,
+// MFS root, keystore and identity.
+type Tenants struct {
+	root  *IpfsNode
+	nodes map[string]*IpfsNode
+}
+
+// Names returns the sorted names of the tenants.
+func (t *Tenants) Names() []string {
+	names := make([]string, 0, len(t.nodes))
+	for name := range t.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Node returns the node of the given tenant, a view of the hosting node
+// working on the data of the tenant.
+func (t *Tenants) Node(name string) (*IpfsNode, bool) {
+	n, ok := t.nodes[name]
+	return n, ok
+}
+
+// Close flushes and closes the MFS roots of the tenants.
+func (t *Tenants) Close() error {
+	var firstErr error
+	for _, name := range t.Names() {
+		if err := t.nodes[name].FilesRoot.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// tenantRepo is the repo of a tenant, with the keystore of the tenant.
+type tenantRepo struct {
+	repo.Repo
+	keystore keystore.Keystore
+}
+
+func (r *tenantRepo) Keystore() keystore.Keystore {
+	return r.keystore
+}
+
+// setupTenants loads the tenants of the config. It must be called once the
+// node is otherwise set up, as the tenant nodes share its services.
+func (n *IpfsNode) setupTenants(tenants map[string]config.Tenant) error {
+	n.Tenants = &Tenants{root: n, nodes: make(map[string]*IpfsNode)}
+	for name := range tenants {
+		tn, err := n.loadTenant(name)
+		if err != nil {
+			return fmt.Errorf("loading tenant %s: %s", name, err)
+		}
+		n.Tenants.nodes[name] = tn
+	}
+	return nil
+}
+
+func (n *IpfsNode) loadTenant(name string) (*IpfsNode, error) {
+	if err := repo.CheckTenantName(name); err != nil {
+		return nil, err
+	}
+	ks, err := n.Repo.TenantKeystore(name)
+	if err != nil {
+		return nil, err
+	}
+	d := namespace.Wrap(n.Repo.Datastore(), TenantsPrefix.ChildString(name))
+
+	sk, err := loadTenantKey(d)
+	if err != nil {
+		return nil, err
+	}
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return nil, err
+	}
+
+	internalDag := merkledag.NewDAGService(bserv.New(n.Blockstore, offline.Exchange(n.Blockstore)))
+	pinning, err := pin.LoadPinner(d, n.DAG, internalDag)
+	if err != nil {
+		// Like the pinner of the node, a new pinner is created when there
+		// is none stored.
+		pinning = pin.NewPinner(d, n.DAG, internalDag)
+	}
+
+	filesRoot, err := openFilesRoot(n.Context(), n.DAG, d, n.DirectoryOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The tenant only gets the services working on shared data, not the
+	// ones managing the node itself, such as its mounts, its reprovider or
+	// its p2p listeners.
+	tn := &IpfsNode{
+		Identity:   id,
+		PrivateKey: sk,
+		Repo:       &tenantRepo{Repo: n.Repo, keystore: ks},
+		Pinning:    &countingPinner{Pinner: pinning, stat: n.BlockStat},
+		FilesRoot:  filesRoot,
+
+		PNetFingerprint:  n.PNetFingerprint,
+		Peerstore:        n.Peerstore,
+		Blockstore:       n.Blockstore,
+		Filestore:        n.Filestore,
+		BlockStat:        n.BlockStat,
+		BaseBlocks:       n.BaseBlocks,
+		GCLocker:         n.GCLocker,
+		Blocks:           n.Blocks,
+		DAG:              n.DAG,
+		Resolver:         n.Resolver,
+		Reporter:         n.Reporter,
+		RecordValidator:  n.RecordValidator,
+		DirectoryOptions: n.DirectoryOptions,
+
+		Tenant:  name,
+		Tenants: n.Tenants,
+
+		PeerHost: n.PeerHost,
+		Routing:  n.Routing,
+		Exchange: n.Exchange,
+		Namesys:  n.Namesys,
+		Provider: n.Provider,
+		PubSub:   n.PubSub,
+
+		proc: n.proc,
+		ctx:  n.ctx,
+
+		IsOnline: n.IsOnline,
+		IsDaemon: n.IsDaemon,
+	}
+
+	if n.IpnsRepub != nil {
+		// The records are stored by the name system in the datastore of
+		// the node, keyed by peer ID.
+		tn.IpnsRepub = ipnsrp.NewRepublisher(n.Namesys, n.Routing, n.Repo.Datastore(), sk, ks)
+		tn.IpnsRepub.Interval = n.IpnsRepub.Interval
+		tn.IpnsRepub.RecordLifetime = n.IpnsRepub.RecordLifetime
+		tn.IpnsRepub.KeyBook = n.Peerstore
+		n.Process().Go(tn.IpnsRepub.Run)
+	}
+	return tn, nil
+}
+
+// loadTenantKey loads the private key of a tenant, generating it on first use.
+func loadTenantKey(d ds.Datastore) (ic.PrivKey, error) {
+	data, err := d.Get(tenantKeyKey)
+	switch err {
+	case nil:
+		return ic.UnmarshalPrivateKey(data)
+	case ds.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	sk, _, err := ic.GenerateKeyPair(ic.RSA, 2048)
+	if err != nil {
+		return nil, err
+	}
+	data, err = ic.MarshalPrivateKey(sk)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.Put(tenantKeyKey, data); err != nil {
+		return nil, err
+	}
+	return sk, nil
+}
+
+// hostNode returns the node hosting the tenants, n itself if it isn't a
+// tenant.
+func (n *IpfsNode) hostNode() *IpfsNode {
+	if n.Tenants == nil {
+		return n
+	}
+	return n.Tenants.root
+}
+
+// GCPinner returns the pins the garbage collector must keep: the union of the
+// pins of the node and of its tenants. Only the listing of the pins is
+// unioned, the other methods work on the pins of the node.
+func (n *IpfsNode) GCPinner() pin.Pinner {
+	root := n.hostNode()
+	if root.Tenants == nil || len(root.Tenants.nodes) == 0 {
+		return root.Pinning
+	}
+	p := &unionPinner{Pinner: root.Pinning}
+	for _, name := range root.Tenants.Names() {
+		p.tenants = append(p.tenants, root.Tenants.nodes[name].Pinning)
+	}
+	return p
+}
+
+// FilesRoots returns the MFS roots of the node and of its tenants.
+func (n *IpfsNode) FilesRoots() []*mfs.Root {
+	root := n.hostNode()
+	roots := []*mfs.Root{root.FilesRoot}
+	if root.Tenants != nil {
+		for _, name := range root.Tenants.Names() {
+			roots = append(roots, root.Tenants.nodes[name].FilesRoot)
+		}
+	}
+	return roots
+}
+
+type unionPinner struct {
+	pin.Pinner
+	tenants []pin.Pinner
+}
+
+func (p *unionPinner) DirectKeys() []cid.Cid {
+	keys := p.Pinner.DirectKeys()
+	for _, t := range p.tenants {
+		keys = append(keys, t.DirectKeys()...)
+	}
+	return keys
+}
+
+func (p *unionPinner) RecursiveKeys() []cid.Cid {
+	keys := p.Pinner.RecursiveKeys()
+	for _, t := range p.tenants {
+		keys = append(keys, t.RecursiveKeys()...)
+	}
+	return keys
+}
+
+func (p *unionPinner) InternalPins() []cid.Cid {
+	keys := p.Pinner.InternalPins()
+	for _, t := range p.tenants {
+		keys = append(keys, t.InternalPins()...)
+	}
+	return keys
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipsn/go-ipfs/repo"
+
+	cid "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-cid"
+	datastore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	syncds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/sync"
+	config "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-config"
+	merkledag "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-merkledag"
+	mfs "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-mfs"
+	ci "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-crypto"
+)
+
+func hasCid(cids []cid.Cid, c cid.Cid) bool {
+	for _, k := range cids {
+		if k.Equals(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTenants(t *testing.T) {
+	ctx := context.Background()
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: testIdentity,
+			Tenants: map[string]config.Tenant{
+				"alice": {APIToken: "a"},
+				"bob":   {APIToken: "b"},
+			},
+		},
+		D: syncds.MutexWrap(datastore.NewMapDatastore()),
+	}
+	n, err := NewNode(ctx, &BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := n.Tenants.Names(); len(names) != 2 || names[0] != "alice" || names[1] != "bob" {
+		t.Fatalf("unexpected tenants %v", names)
+	}
+	alice, _ := n.Tenants.Node("alice")
+	bob, _ := n.Tenants.Node("bob")
+	if alice.Identity == n.Identity || alice.Identity == bob.Identity {
+		t.Error("expected the tenants to have their own identity")
+	}
+	if n.Scrubber == nil || alice.Scrubber != nil {
+		t.Error("expected the scrubber of the node not to be given to the tenants")
+	}
+
+	// Pins are separate.
+	nd := merkledag.NodeWithData([]byte("alice's data"))
+	if err := alice.DAG.Add(ctx, nd); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.Pinning.Pin(ctx, nd, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.Pinning.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tn := range []*IpfsNode{n, bob} {
+		if _, pinned, _ := tn.Pinning.IsPinned(nd.Cid()); pinned {
+			t.Errorf("expected the pin of alice not to be seen by %q", tn.Tenant)
+		}
+	}
+	if !hasCid(n.GCPinner().RecursiveKeys(), nd.Cid()) {
+		t.Error("expected the garbage collector to keep the pins of the tenants")
+	}
+
+	// MFS roots are separate.
+	if err := mfs.Mkdir(alice.FilesRoot, "/docs", mfs.MkdirOpts{Flush: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mfs.Lookup(n.FilesRoot, "/docs"); err == nil {
+		t.Error("expected the MFS root of alice not to be seen by the node")
+	}
+	if roots := n.FilesRoots(); len(roots) != 3 {
+		t.Errorf("expected the MFS roots of the node and of 2 tenants, got %d", len(roots))
+	}
+
+	// Keystores are separate.
+	sk, _, err := ci.GenerateKeyPair(ci.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.Repo.Keystore().Put("key", sk); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := bob.Repo.Keystore().Has("key"); has {
+		t.Error("expected the key of alice not to be seen by bob")
+	}
+
+	// Tenants are persisted.
+	if err := n.Tenants.Close(); err != nil {
+		t.Fatal(err)
+	}
+	n2, err := NewNode(ctx, &BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice2, ok := n2.Tenants.Node("alice")
+	if !ok {
+		t.Fatal("expected alice to be loaded again")
+	}
+	if alice2.Identity != alice.Identity {
+		t.Error("expected the identity of alice to be persisted")
+	}
+	if _, pinned, _ := alice2.Pinning.IsPinned(nd.Cid()); !pinned {
+		t.Error("expected the pin of alice to be persisted")
+	}
+	if _, err := mfs.Lookup(alice2.FilesRoot, "/docs"); err != nil {
+		t.Errorf("expected the MFS root of alice to be persisted: %s", err)
+	}
+}
+
+func TestInvalidTenant(t *testing.T) {
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: testIdentity,
+			Tenants:  map[string]config.Tenant{"../alice": {}},
+		},
+		D: syncds.MutexWrap(datastore.NewMapDatastore()),
+	}
+	if _, err := NewNode(context.Background(), &BuildCfg{Repo: r}); err == nil {
+		t.Fatal("expected an invalid tenant name to be rejected")
+	}
+}
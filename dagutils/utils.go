@@ -3,11 +3,15 @@ package dagutils
 import (
 	"context"
 	"errors"
+	"os"
 
 	bserv "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-blockservice"
 	dag "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-merkledag"
 	path "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-path"
+	ft "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs"
+	uio "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/io"
 
+	cid "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-cid"
 	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
 	syncds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/sync"
 	bstore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-blockstore"
@@ -27,6 +31,9 @@ type Editor struct {
 	// src is the dagstore with *all* of the data on it, it is used to pull
 	// nodes from for modification (nil is a valid value)
 	src ipld.DAGService
+
+	// dirOpts configures the sharding of the edited unixfs directories
+	dirOpts []uio.DirectoryOption
 }
 
 // NewMemoryDagService returns a new, thread-safe in-memory DAGService.
@@ -41,11 +48,13 @@ func NewMemoryDagService() ipld.DAGService {
 //
 // * root is the node to be modified
 // * source is the dagstore to pull nodes from (optional)
-func NewDagEditor(root *dag.ProtoNode, source ipld.DAGService) *Editor {
+// * opts configure the sharding of the edited unixfs directories
+func NewDagEditor(root *dag.ProtoNode, source ipld.DAGService, opts ...uio.DirectoryOption) *Editor {
 	return &Editor{
-		root: root,
-		tmp:  NewMemoryDagService(),
-		src:  source,
+		root:    root,
+		tmp:     NewMemoryDagService(),
+		src:     source,
+		dirOpts: opts,
 	}
 }
 
@@ -85,6 +94,99 @@ func addLink(ctx context.Context, ds ipld.DAGService, root *dag.ProtoNode, child
 	return root, nil
 }
 
+// unixfsDir returns root as a unixfs directory if it is one. Entries of unixfs
+// directories are edited through go-unixfs/io so that they are sharded as
+// they grow.
+func (e *Editor) unixfsDir(root *dag.ProtoNode) (uio.Directory, error) {
+	fsn, err := ft.FSNodeFromBytes(root.Data())
+	if err != nil {
+		return nil, nil
+	}
+	switch fsn.Type() {
+	case ft.TDirectory, ft.THAMTShard:
+		return uio.NewDirectoryFromNode(&editorDAG{DAGService: e.tmp, src: e.src}, root, e.dirOpts...)
+	default:
+		return nil, nil
+	}
+}
+
+// getLink returns the node linked under name in root, looking it up in the
+// temporary dagstore first and then in the source dagstore.
+func (e *Editor) getLink(ctx context.Context, root *dag.ProtoNode, name string) (*dag.ProtoNode, error) {
+	dir, err := e.unixfsDir(root)
+	if err != nil {
+		return nil, err
+	}
+	if dir == nil {
+		nd, err := root.GetLinkedProtoNode(ctx, e.tmp, name)
+		if err == ipld.ErrNotFound {
+			// try finding it in our source dagstore
+			nd, err = root.GetLinkedProtoNode(ctx, e.src, name)
+		}
+		return nd, err
+	}
+
+	nd, err := dir.Find(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = dag.ErrLinkNotFound
+		}
+		return nil, err
+	}
+	pbnd, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return nil, dag.ErrNotProtobuf
+	}
+	return pbnd, nil
+}
+
+// setLink replaces any link under name in root by a link to nd, and stores
+// both in the temporary dagstore.
+func (e *Editor) setLink(ctx context.Context, root *dag.ProtoNode, name string, nd ipld.Node) (*dag.ProtoNode, error) {
+	dir, err := e.unixfsDir(root)
+	if err != nil {
+		return nil, err
+	}
+	if dir == nil {
+		return addLink(ctx, e.tmp, root, name, nd)
+	}
+
+	if name == "" {
+		return nil, errors.New("cannot create link with no name")
+	}
+
+	// ensure that the node we are adding is in the dagservice
+	if err := e.tmp.Add(ctx, nd); err != nil {
+		return nil, err
+	}
+
+	_ = e.tmp.Remove(ctx, root.Cid())
+
+	if err := dir.AddChild(ctx, name, nd); err != nil {
+		return nil, err
+	}
+	if root, err = dirNode(dir); err != nil {
+		return nil, err
+	}
+
+	if err := e.tmp.Add(ctx, root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func dirNode(dir uio.Directory) (*dag.ProtoNode, error) {
+	nd, err := dir.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	pbnd, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return nil, dag.ErrNotProtobuf
+	}
+	return pbnd, nil
+}
+
 // InsertNodeAtPath inserts a new node in the tree and replaces the current root with the new one.
 func (e *Editor) InsertNodeAtPath(ctx context.Context, pth string, toinsert ipld.Node, create func() *dag.ProtoNode) error {
 	splpath := path.SplitList(pth)
@@ -98,22 +200,19 @@ func (e *Editor) InsertNodeAtPath(ctx context.Context, pth string, toinsert ipld
 
 func (e *Editor) insertNodeAtPath(ctx context.Context, root *dag.ProtoNode, path []string, toinsert ipld.Node, create func() *dag.ProtoNode) (*dag.ProtoNode, error) {
 	if len(path) == 1 {
-		return addLink(ctx, e.tmp, root, path[0], toinsert)
+		return e.setLink(ctx, root, path[0], toinsert)
 	}
 
-	nd, err := root.GetLinkedProtoNode(ctx, e.tmp, path[0])
+	nd, err := e.getLink(ctx, root, path[0])
 	if err != nil {
 		// if 'create' is true, we create directories on the way down as needed
 		if err == dag.ErrLinkNotFound && create != nil {
 			nd = create()
 			err = nil // no longer an error case
-		} else if err == ipld.ErrNotFound {
-			// try finding it in our source dagstore
-			nd, err = root.GetLinkedProtoNode(ctx, e.src, path[0])
 		}
 
-		// if we receive an ErrNotFound, then our second 'GetLinkedNode' call
-		// also fails, we want to error out
+		// if we receive an ErrNotFound from both dagstores, we want to
+		// error out
 		if err != nil {
 			return nil, err
 		}
@@ -124,20 +223,7 @@ func (e *Editor) insertNodeAtPath(ctx context.Context, root *dag.ProtoNode, path
 		return nil, err
 	}
 
-	_ = e.tmp.Remove(ctx, root.Cid())
-
-	_ = root.RemoveNodeLink(path[0])
-	err = root.AddNodeLink(path[0], ndprime)
-	if err != nil {
-		return nil, err
-	}
-
-	err = e.tmp.Add(ctx, root)
-	if err != nil {
-		return nil, err
-	}
-
-	return root, nil
+	return e.setLink(ctx, root, path[0], ndprime)
 }
 
 // RmLink removes the link with the given name and updates the root node of
@@ -155,7 +241,16 @@ func (e *Editor) RmLink(ctx context.Context, pth string) error {
 func (e *Editor) rmLink(ctx context.Context, root *dag.ProtoNode, path []string) (*dag.ProtoNode, error) {
 	if len(path) == 1 {
 		// base case, remove node in question
-		err := root.RemoveNodeLink(path[0])
+		dir, err := e.unixfsDir(root)
+		if err != nil {
+			return nil, err
+		}
+
+		if dir == nil {
+			err = root.RemoveNodeLink(path[0])
+		} else if err = dir.RemoveChild(ctx, path[0]); err == nil {
+			root, err = dirNode(dir)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -169,11 +264,7 @@ func (e *Editor) rmLink(ctx context.Context, root *dag.ProtoNode, path []string)
 	}
 
 	// search for node in both tmp dagstore and source dagstore
-	nd, err := root.GetLinkedProtoNode(ctx, e.tmp, path[0])
-	if err == ipld.ErrNotFound {
-		nd, err = root.GetLinkedProtoNode(ctx, e.src, path[0])
-	}
-
+	nd, err := e.getLink(ctx, root, path[0])
 	if err != nil {
 		return nil, err
 	}
@@ -183,20 +274,7 @@ func (e *Editor) rmLink(ctx context.Context, root *dag.ProtoNode, path []string)
 		return nil, err
 	}
 
-	e.tmp.Remove(ctx, root.Cid())
-
-	_ = root.RemoveNodeLink(path[0])
-	err = root.AddNodeLink(path[0], nnode)
-	if err != nil {
-		return nil, err
-	}
-
-	err = e.tmp.Add(ctx, root)
-	if err != nil {
-		return nil, err
-	}
-
-	return root, nil
+	return e.setLink(ctx, root, path[0], nnode)
 }
 
 // Finalize writes the new DAG to the given DAGService and returns the modified
@@ -232,3 +310,34 @@ func copyDag(ctx context.Context, nd ipld.Node, from, to ipld.DAGService) error
 	}
 	return nil
 }
+
+// editorDAG stores nodes in the temporary dagstore of an editor, and looks
+// them up there first, then in the source dagstore.
+type editorDAG struct {
+	ipld.DAGService
+	src ipld.DAGService
+}
+
+func (d *editorDAG) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	nd, err := d.DAGService.Get(ctx, c)
+	if err == ipld.ErrNotFound && d.src != nil {
+		return d.src.Get(ctx, c)
+	}
+	return nd, err
+}
+
+func (d *editorDAG) GetMany(ctx context.Context, keys []cid.Cid) <-chan *ipld.NodeOption {
+	out := make(chan *ipld.NodeOption, len(keys))
+	go func() {
+		defer close(out)
+		for _, c := range keys {
+			nd, err := d.Get(ctx, c)
+			select {
+			case out <- &ipld.NodeOption{Node: nd, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -2,11 +2,14 @@ package dagutils
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	dag "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-merkledag"
 	mdtest "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-merkledag/test"
 	path "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-path"
+	ft "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs"
+	uio "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/io"
 
 	cid "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-cid"
 	ipld "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipld-format"
@@ -112,3 +115,59 @@ func testInsert(t *testing.T, e *Editor, path, data string, create bool, experr
 
 	assertNodeAtPath(t, e.tmp, e.root, path, child.Cid())
 }
+
+func TestInsertShardsDirectories(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+	child := dag.NodeWithData([]byte("child"))
+	if err := ds.Add(ctx, child); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewDagEditor(ft.EmptyDirNode(), ds, uio.ShardingSize(500))
+	for i := 0; i < 40; i++ {
+		err := e.InsertNodeAtPath(ctx, fmt.Sprintf("dir/entry%d", i), child, ft.EmptyDirNode)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.RmLink(ctx, "dir/entry0"); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := e.Finalize(ctx, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootDir, err := uio.NewDirectoryFromNode(ds, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirNd, err := rootDir.Find(ctx, "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsn, err := ft.FSNodeFromBytes(dirNd.(*dag.ProtoNode).Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsn.Type() != ft.THAMTShard {
+		t.Fatal("expected large directory to be sharded")
+	}
+
+	dir, err := uio.NewDirectoryFromNode(ds, dirNd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dir.Find(ctx, "entry0"); err == nil {
+		t.Fatal("expected entry0 to be removed")
+	}
+	nd, err := dir.Find(ctx, "entry39")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(child.Cid()) {
+		t.Fatal("wrong child node found!")
+	}
+}
@@ -149,11 +149,22 @@ func (rt *RoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
 		}
 	}()
 
-	resp, err := http.ReadResponse(bufio.NewReader(conn), r)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, r)
 	if err != nil {
 		return resp, err
 	}
 
+	// On protocol switches (i.e. WebSockets), the stream is handed over to
+	// the caller as a writable body, as net/http does.
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		resp.Body = &upgradedBody{
+			Reader: br,
+			conn:   conn,
+		}
+		return resp, nil
+	}
+
 	resp.Body = &respBody{
 		ReadCloser: resp.Body,
 		conn:       conn,
@@ -161,3 +172,19 @@ func (rt *RoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
 
 	return resp, nil
 }
+
+// upgradedBody is the body of a response switching protocols. It reads the
+// data buffered while reading the response and the rest of the stream, and
+// writes to the stream.
+type upgradedBody struct {
+	io.Reader
+	conn net.Conn
+}
+
+func (b *upgradedBody) Write(p []byte) (int, error) {
+	return b.conn.Write(p)
+}
+
+func (b *upgradedBody) Close() error {
+	return b.conn.Close()
+}
@@ -76,6 +76,20 @@ func TestLimit(t *testing.T) {
 	})
 }
 
+func TestNaiveQueryApply(t *testing.T) {
+	e := make([]Entry, len(sampleKeys))
+	for i, k := range sampleKeys {
+		e[i] = Entry{Key: k}
+	}
+
+	q := Query{Prefix: "/ab", Offset: 1, Limit: 2}
+	res := NaiveQueryApply(q, ResultsWithEntries(q, e))
+	testResults(t, res, []string{
+		"/ab/cd",
+		"/abce",
+	})
+}
+
 func TestOffset(t *testing.T) {
 
 	testOffset := func(t *testing.T, offset int, keys []string, expect []string) {
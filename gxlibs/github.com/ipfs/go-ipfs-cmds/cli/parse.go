@@ -229,8 +229,9 @@ func parseArgs(req *cmds.Request, root *cmds.Command, stdin *os.File) error {
 
 		argDef := getArgDef(iArgDef, argDefs)
 
-		// skip optional argument definitions if there aren't sufficient remaining inputs
-		for remInputs <= remRequired && !argDef.Required {
+		// skip optional argument definitions if there aren't sufficient
+		// remaining inputs, or if only stdin remains and they can't take it
+		for !argDef.Required && (remInputs <= remRequired || len(inputs) == 0 && !argDef.SupportsStdin) {
 			iArgDef++
 			argDef = getArgDef(iArgDef, argDefs)
 		}
@@ -298,8 +299,8 @@ func parseArgs(req *cmds.Request, root *cmds.Command, stdin *os.File) error {
 				}
 
 				fileArgs[fpath] = file
-			} else if stdin != nil && argDef.SupportsStdin &&
-				argDef.Required && !fillingVariadic {
+			} else if stdin != nil && argDef.SupportsStdin && !fillingVariadic &&
+				(argDef.Required || optionalStdin(req, numRequired, stdin)) {
 				r, err := maybeWrapStdin(stdin, msgStdinInfo)
 				if err != nil {
 					return err
@@ -484,6 +485,17 @@ func appendFile(fpath string, argDef *cmdkit.Argument, recursive, hidden bool) (
 	return files.NewSerialFile(fpath, hidden, stat)
 }
 
+// optionalStdin returns whether stdin may be read for an optional argument:
+// only when no optional argument was given and stdin isn't a terminal, as the
+// user isn't expected to type the value of an optional argument.
+func optionalStdin(req *cmds.Request, numRequired int, stdin *os.File) bool {
+	if len(req.Arguments) > numRequired {
+		return false
+	}
+	isTty, err := isTty(stdin)
+	return err == nil && !isTty
+}
+
 // Inform the user if a file is waiting on input
 func maybeWrapStdin(f *os.File, msg string) (io.ReadCloser, error) {
 	isTty, err := isTty(f)
@@ -513,3 +513,58 @@ func TestBodyArgs(t *testing.T) {
 		}
 	}
 }
+
+func TestOptionalStdinFile(t *testing.T) {
+	rootCmd := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"inspect": {
+				Arguments: []cmdkit.Argument{
+					cmdkit.StringArg("name", false, false, "some arg"),
+					cmdkit.FileArg("record", false, false, "some file").EnableStdin(),
+				},
+			},
+			"dial": {
+				Arguments: []cmdkit.Argument{
+					cmdkit.StringArg("peer", true, false, "some arg"),
+					cmdkit.FileArg("data", false, false, "some file").EnableStdin(),
+				},
+			},
+		},
+	}
+
+	fstdin, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fstdin.Name())
+	if _, err := io.WriteString(fstdin, "stdin"); err != nil {
+		t.Fatal(err)
+	}
+
+	var tcs = []struct {
+		cmd       words
+		posArgs   words
+		fromStdin bool
+	}{
+		// stdin is only read when no optional argument is given
+		{words{"inspect"}, words{}, true},
+		{words{"inspect", "name"}, words{"name"}, false},
+		{words{"dial", "peer"}, words{"peer"}, true},
+	}
+	for _, tc := range tcs {
+		if _, err := fstdin.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		req, err := Parse(context.Background(), tc.cmd, fstdin, rootCmd)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %s", tc.cmd, err)
+			continue
+		}
+		if !sameWords(req.Arguments, tc.posArgs) {
+			t.Errorf("%v: expected arguments %v, got %v", tc.cmd, tc.posArgs, req.Arguments)
+		}
+		if fromStdin := req.Files != nil; fromStdin != tc.fromStdin {
+			t.Errorf("%v: expected stdin to be read: %t, got %t", tc.cmd, tc.fromStdin, fromStdin)
+		}
+	}
+}
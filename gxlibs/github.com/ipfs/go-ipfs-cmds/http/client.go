@@ -33,6 +33,7 @@ type client struct {
 	httpClient    *http.Client
 	ua            string
 	apiPrefix     string
+	headers       http.Header
 }
 
 type ClientOpt func(*client)
@@ -49,6 +50,16 @@ func ClientWithAPIPrefix(apiPrefix string) ClientOpt {
 	}
 }
 
+// ClientWithHeader sets a header on every request sent by the client.
+func ClientWithHeader(key, value string) ClientOpt {
+	return func(c *client) {
+		if c.headers == nil {
+			c.headers = make(http.Header)
+		}
+		c.headers.Set(key, value)
+	}
+}
+
 func NewClient(address string, opts ...ClientOpt) Client {
 	if !strings.HasPrefix(address, "http://") {
 		address = "http://" + address
@@ -140,6 +151,9 @@ func (c *client) toHTTPRequest(req *cmds.Request) (*http.Request, error) {
 		httpReq.Header.Set(contentTypeHeader, applicationOctetStream)
 	}
 	httpReq.Header.Set(uaHeader, c.ua)
+	for k, v := range c.headers {
+		httpReq.Header[k] = v
+	}
 
 	httpReq = httpReq.WithContext(req.Context)
 	httpReq.Close = true
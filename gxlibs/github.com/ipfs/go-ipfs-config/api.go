@@ -2,4 +2,8 @@ package config
 
 type API struct {
 	HTTPHeaders map[string][]string // HTTP headers to return with the API.
+	// RootToken is the bearer token the HTTP API requests handled by the
+	// node itself must carry when tenants are configured. The daemon
+	// doesn't start without it then.
+	RootToken string `json:",omitempty"`
 }
@@ -21,13 +21,20 @@ type Config struct {
 	Discovery Discovery // local node's discovery mechanisms
 	Routing   Routing   // local node's routing settings
 	Ipns      Ipns      // Ipns settings
+	DNS       DNS       // DNSLink lookup settings
 	Bootstrap []string  // local nodes's bootstrap peer addresses
 	Gateway   Gateway   // local node's gateway server options
 	API       API       // local node's API settings
 	Swarm     SwarmConfig
 	Pubsub    PubsubConfig
+	P2P       P2P // libp2p stream mounting settings
+
+	// Tenants maps the names of the tenants hosted by the node to their
+	// settings.
+	Tenants map[string]Tenant `json:",omitempty"`
 
 	Reprovider   Reprovider
+	UnixFS       UnixFS
 	Experimental Experiments
 }
 
@@ -23,6 +23,13 @@ type Datastore struct {
 
 	HashOnRead      bool
 	BloomFilterSize int
+
+	// ScrubPeriod enables verifying all blocks in the background, starting
+	// again every period (in ns, us, ms, s, m, h).
+	ScrubPeriod string `json:",omitempty"`
+	// ScrubRate limits how fast blocks are read when scrubbing, in bytes
+	// per second (in B, kB, kiB, MB, ...).
+	ScrubRate string `json:",omitempty"`
 }
 
 // DataStorePath returns the default data store path given a configuration root
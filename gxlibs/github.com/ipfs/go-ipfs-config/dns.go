@@ -0,0 +1,11 @@
+package config
+
+// DNS holds the settings of the DNS lookups done to resolve DNSLink names.
+type DNS struct {
+	// Resolvers maps domain suffixes (e.g. "eth." or "." for all the names)
+	// to the resolver used to look up the names under them: either a
+	// DNS-over-HTTPS URL (e.g. "https://cloudflare-dns.com/dns-query") or the
+	// address of a DNS server (e.g. "192.168.1.1:53"). Names matching no
+	// suffix are looked up with the system resolver.
+	Resolvers map[string]string `json:",omitempty"`
+}
@@ -8,4 +8,8 @@ type Gateway struct {
 	PathPrefixes []string
 	APICommands  []string
 	NoFetch      bool
+
+	// P2PProxy serves the /p2p/ reverse proxy to the HTTP services of other
+	// peers on the gateway.
+	P2PProxy bool
 }
@@ -5,4 +5,14 @@ type Ipns struct {
 	RecordLifetime  string
 
 	ResolveCacheSize int
+
+	// PersistResolveCache stores the resolve cache in the repo datastore.
+	PersistResolveCache bool
+	// ResolveCacheMaxStaleness is how long past their TTL cached entries
+	// may still be served while they are refreshed in the background.
+	ResolveCacheMaxStaleness string
+
+	// PubsubRebroadcastInterval is how often the latest known records of
+	// the names subscribed to over pubsub are published again.
+	PubsubRebroadcastInterval string
 }
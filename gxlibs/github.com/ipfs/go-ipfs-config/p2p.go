@@ -0,0 +1,39 @@
+package config
+
+// P2P holds the settings of libp2p stream mounting.
+type P2P struct {
+	// Listeners are re-created when the daemon starts.
+	Listeners []P2PListener `json:",omitempty"`
+}
+
+// P2PListener describes a persisted 'ipfs p2p listen' or 'ipfs p2p forward'
+// listener.
+type P2PListener struct {
+	Protocol string
+
+	// ListenAddress is the local address connections are accepted on, only
+	// set for 'ipfs p2p forward' listeners.
+	ListenAddress string `json:",omitempty"`
+
+	// TargetAddress is the local address libp2p streams are proxied to for
+	// 'ipfs p2p listen' listeners, and the /ipfs/ address of the remote peer
+	// for 'ipfs p2p forward' listeners.
+	TargetAddress string
+
+	// HTTP makes 'ipfs p2p listen' listeners terminate HTTP and reverse-proxy
+	// the requests to the target.
+	HTTP bool `json:",omitempty"`
+
+	// ReportPeerID makes 'ipfs p2p listen' listeners send the peer ID of
+	// the remote peer to the target when a new connection is established.
+	ReportPeerID bool `json:",omitempty"`
+
+	// AllowPeers and DenyPeers are the peer IDs allowed or denied to
+	// connect to 'ipfs p2p listen' listeners.
+	AllowPeers []string `json:",omitempty"`
+	DenyPeers  []string `json:",omitempty"`
+
+	// Restricted makes only the peers of AllowPeers allowed to connect,
+	// even when it's empty. It's implied by a non-empty AllowPeers.
+	Restricted bool `json:",omitempty"`
+}
@@ -105,14 +105,10 @@ Inverse profile of the test profile.`,
 		Description: `Replaces default datastore configuration with experimental
 badger datastore.
 
-If you apply this profile after ipfs init, you will need
-to convert your datastore to the new configuration.
-You can do this using ipfs-ds-convert.
-
-For more on ipfs-ds-convert see
-$ ipfs-ds-convert --help
-and
-$ ipfs-ds-convert convert --help
+To switch an existing repo to this configuration, don't
+apply this profile: convert the datastore instead, which
+also updates the config:
+$ ipfs repo convert --to=badgerds
 
 WARNING: badger datastore is experimental.
 Make sure to backup your data frequently.`,
@@ -134,14 +130,10 @@ Make sure to backup your data frequently.`,
 	"default-datastore": {
 		Description: `Restores default datastore configuration.
 
-If you apply this profile after ipfs init, you will need
-to convert your datastore to the new configuration.
-You can do this using ipfs-ds-convert.
-
-For more on ipfs-ds-convert see
-$ ipfs-ds-convert --help
-and
-$ ipfs-ds-convert convert --help
+To switch an existing repo to this configuration, don't
+apply this profile: convert the datastore instead, which
+also updates the config:
+$ ipfs repo convert --to=default-datastore
 `,
 
 		Transform: func(c *Config) error {
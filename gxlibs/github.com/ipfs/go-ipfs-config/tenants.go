@@ -0,0 +1,10 @@
+package config
+
+// Tenant holds the settings of a tenant, a logical node hosted by the daemon
+// sharing its libp2p host and blockstore but with its own pins, MFS root,
+// keystore and identity.
+type Tenant struct {
+	// APIToken is the bearer token the HTTP API requests of the tenant must
+	// carry.
+	APIToken string
+}
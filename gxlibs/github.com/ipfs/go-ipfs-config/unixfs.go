@@ -0,0 +1,10 @@
+package config
+
+// UnixFS holds the settings of the unixfs files and directories built by the
+// node.
+type UnixFS struct {
+	// ShardingThreshold is the estimated size of a directory (e.g. "256KiB")
+	// above which it is sharded. "0" disables automatic sharding, empty uses
+	// the default.
+	ShardingThreshold string `json:",omitempty"`
+}
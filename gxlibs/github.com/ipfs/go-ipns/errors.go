@@ -35,3 +35,15 @@ var ErrPublicKeyMismatch = errors.New("public key in record did not match expect
 
 // ErrBadRecord should be returned when an ipns record cannot be unmarshalled
 var ErrBadRecord = errors.New("record could not be unmarshalled")
+
+// ErrBadRecordData should be returned when the data of an ipns record cannot
+// be decoded
+var ErrBadRecordData = errors.New("record data could not be decoded")
+
+// ErrDataMismatch should be returned when the data of an ipns record doesn't
+// match the fields of the record
+var ErrDataMismatch = errors.New("record data did not match record fields")
+
+// ErrReservedDataKey should be returned when the extra data of an ipns record
+// uses the key of one of the fields of the record
+var ErrReservedDataKey = errors.New("reserved record data key")
@@ -8,6 +8,7 @@ import (
 	pb "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipns/pb"
 
 	u "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-util"
+	cbor "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipld-cbor"
 	ic "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peer"
 )
@@ -34,13 +35,111 @@ func Create(sk ic.PrivKey, val []byte, seq uint64, eol time.Time) (*pb.IpnsEntry
 	return entry, nil
 }
 
+// Keys of the data map that mirror the protobuf fields of the record. They may
+// not be used for extra data.
+const (
+	dataValueKey        = "Value"
+	dataValidityKey     = "Validity"
+	dataValidityTypeKey = "ValidityType"
+	dataSequenceKey     = "Sequence"
+	dataTTLKey          = "TTL"
+)
+
+var reservedDataKeys = map[string]bool{
+	dataValueKey:        true,
+	dataValidityKey:     true,
+	dataValidityTypeKey: true,
+	dataSequenceKey:     true,
+	dataTTLKey:          true,
+}
+
+// CreateWithData creates a new IPNS entry with the given TTL, if not nil, and
+// extra data, and signs it with the given private key.
+//
+// Besides the legacy signature, the entry carries a CBOR data map holding all
+// of its fields (including the TTL and the sequence number, which the legacy
+// signature doesn't cover) along with the extra data, signed as a whole. The
+// extra data may not use the keys of the fields of the record.
+func CreateWithData(sk ic.PrivKey, val []byte, seq uint64, eol time.Time, ttl *time.Duration, extra map[string]interface{}) (*pb.IpnsEntry, error) {
+	if ttl != nil && *ttl < 0 {
+		return nil, fmt.Errorf("negative ttl: %s", *ttl)
+	}
+
+	entry, err := Create(sk, val, seq, eol)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(map[string]interface{}, len(extra)+len(reservedDataKeys))
+	for k, v := range extra {
+		if reservedDataKeys[k] {
+			return nil, fmt.Errorf("%s: %q", ErrReservedDataKey, k)
+		}
+		data[k] = v
+	}
+	data[dataValueKey] = entry.Value
+	data[dataValidityKey] = entry.Validity
+	data[dataValidityTypeKey] = uint64(entry.GetValidityType())
+	data[dataSequenceKey] = seq
+	if ttl != nil {
+		nsTTL := uint64(ttl.Nanoseconds())
+		entry.Ttl = &nsTTL
+		data[dataTTLKey] = nsTTL
+	}
+
+	entry.Data, err = cbor.DumpObject(data)
+	if err != nil {
+		return nil, err
+	}
+	entry.SignatureV2, err = sk.Sign(ipnsEntryDataForSigV2(entry))
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// GetExtraData returns the extra data attached to the IPNS entry, without the
+// fields of the record. It returns an empty map when the entry carries no
+// data.
+//
+// NOTE: It *does not* validate the record, the caller is responsible for
+// calling `Validate` first.
+func GetExtraData(entry *pb.IpnsEntry) (map[string]interface{}, error) {
+	extra := make(map[string]interface{})
+	if entry.GetData() == nil {
+		return extra, nil
+	}
+	var data map[string]interface{}
+	if err := cbor.DecodeInto(entry.GetData(), &data); err != nil {
+		return nil, ErrBadRecordData
+	}
+	for k, v := range data {
+		if !reservedDataKeys[k] {
+			extra[k] = v
+		}
+	}
+	return extra, nil
+}
+
 // Validates validates the given IPNS entry against the given public key.
+//
+// When the entry carries a data map, its signature is checked as well and
+// its fields must match the ones of the record.
 func Validate(pk ic.PubKey, entry *pb.IpnsEntry) error {
 	// Check the ipns record signature with the public key
 	if ok, err := pk.Verify(ipnsEntryDataForSig(entry), entry.GetSignature()); err != nil || !ok {
 		return ErrSignature
 	}
 
+	if entry.GetData() != nil || entry.GetSignatureV2() != nil {
+		if ok, err := pk.Verify(ipnsEntryDataForSigV2(entry), entry.GetSignatureV2()); err != nil || !ok {
+			return ErrSignature
+		}
+		if err := validateData(entry); err != nil {
+			return err
+		}
+	}
+
 	eol, err := GetEOL(entry)
 	if err != nil {
 		return err
@@ -120,6 +219,12 @@ func ExtractPublicKey(pid peer.ID, entry *pb.IpnsEntry) (ic.PubKey, error) {
 // * 0 if a and b cannot be ordered (this doesn't mean that they are equal)
 // * +1 if a is newer than b
 //
+// Entries are ordered by sequence number first, so that records of
+// publishers that only sign legacy entries keep replacing older ones. Of two
+// entries with the same sequence number, an entry signed with a data
+// signature is newer than a legacy entry, as a legacy entry may have been
+// made by stripping the data of the other one.
+//
 // It returns an error when either a or b are malformed.
 //
 // NOTE: It *does not* validate the records, the caller is responsible for calling
@@ -139,6 +244,13 @@ func Compare(a, b *pb.IpnsEntry) (int, error) {
 		return -1, nil
 	}
 
+	switch av, bv := a.GetSignatureV2() != nil, b.GetSignatureV2() != nil; {
+	case av && !bv:
+		return 1, nil
+	case bv && !av:
+		return -1, nil
+	}
+
 	at, err := u.ParseRFC3339(string(a.GetValidity()))
 	if err != nil {
 		return 0, err
@@ -158,6 +270,58 @@ func Compare(a, b *pb.IpnsEntry) (int, error) {
 	return 0, nil
 }
 
+// validateData checks that the fields of the data map of the entry match the
+// protobuf fields, which aren't all covered by the legacy signature.
+func validateData(entry *pb.IpnsEntry) error {
+	var data map[string]interface{}
+	if err := cbor.DecodeInto(entry.GetData(), &data); err != nil {
+		return ErrBadRecordData
+	}
+
+	value, ok := data[dataValueKey].([]byte)
+	if !ok || !bytes.Equal(value, entry.GetValue()) {
+		return ErrDataMismatch
+	}
+	validity, ok := data[dataValidityKey].([]byte)
+	if !ok || !bytes.Equal(validity, entry.GetValidity()) {
+		return ErrDataMismatch
+	}
+	for k, expected := range map[string]uint64{
+		dataValidityTypeKey: uint64(entry.GetValidityType()),
+		dataSequenceKey:     entry.GetSequence(),
+	} {
+		if v, ok := dataUint(data[k]); !ok || v != expected {
+			return ErrDataMismatch
+		}
+	}
+	ttl, hasTTL := data[dataTTLKey]
+	if hasTTL != (entry.Ttl != nil) {
+		return ErrDataMismatch
+	}
+	if v, ok := dataUint(ttl); hasTTL && (!ok || v != entry.GetTtl()) {
+		return ErrDataMismatch
+	}
+	return nil
+}
+
+// dataUint converts an integer decoded from CBOR to an uint64.
+func dataUint(v interface{}) (uint64, bool) {
+	switch v := v.(type) {
+	case uint64:
+		return v, true
+	case int64:
+		return uint64(v), v >= 0
+	case int:
+		return uint64(v), v >= 0
+	default:
+		return 0, false
+	}
+}
+
+func ipnsEntryDataForSigV2(e *pb.IpnsEntry) []byte {
+	return append([]byte("ipns-signature:"), e.GetData()...)
+}
+
 func ipnsEntryDataForSig(e *pb.IpnsEntry) []byte {
 	return bytes.Join([][]byte{
 		e.Value,
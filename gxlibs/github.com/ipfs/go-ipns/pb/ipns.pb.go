@@ -71,7 +71,13 @@ type IpnsEntry struct {
 	// key associated with it. For old RSA keys, its easiest if we just send this as part of
 	// the record itself. For newer ed25519 keys, the public key can be embedded in the
 	// peerID, making this field unnecessary.
-	PubKey               []byte   `protobuf:"bytes,7,opt,name=pubKey" json:"pubKey,omitempty"`
+	PubKey []byte `protobuf:"bytes,7,opt,name=pubKey" json:"pubKey,omitempty"`
+	// signatureV2 signs "ipns-signature:" followed by data. It covers all the
+	// fields of the record, including the ttl and the sequence.
+	SignatureV2 []byte `protobuf:"bytes,8,opt,name=signatureV2" json:"signatureV2,omitempty"`
+	// data is a CBOR map holding the value, validity, validityType, sequence
+	// and ttl of the record, along with any extra data attached to the name.
+	Data                 []byte   `protobuf:"bytes,9,opt,name=data" json:"data,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -159,6 +165,20 @@ func (m *IpnsEntry) GetPubKey() []byte {
 	return nil
 }
 
+func (m *IpnsEntry) GetSignatureV2() []byte {
+	if m != nil {
+		return m.SignatureV2
+	}
+	return nil
+}
+
+func (m *IpnsEntry) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterEnum("ipns.pb.IpnsEntry_ValidityType", IpnsEntry_ValidityType_name, IpnsEntry_ValidityType_value)
 	proto.RegisterType((*IpnsEntry)(nil), "ipns.pb.IpnsEntry")
@@ -167,21 +187,23 @@ func init() {
 func init() { proto.RegisterFile("ipns.proto", fileDescriptor_4d5b16fb32bfe8ea) }
 
 var fileDescriptor_4d5b16fb32bfe8ea = []byte{
-	// 221 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0xca, 0x2c, 0xc8, 0x2b,
-	0xd6, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x87, 0xb0, 0x93, 0x94, 0xfe, 0x33, 0x72, 0x71,
-	0x7a, 0x16, 0xe4, 0x15, 0xbb, 0xe6, 0x95, 0x14, 0x55, 0x0a, 0x89, 0x70, 0xb1, 0x96, 0x25, 0xe6,
-	0x94, 0xa6, 0x4a, 0x30, 0x2a, 0x30, 0x69, 0xf0, 0x04, 0x41, 0x38, 0x42, 0x32, 0x5c, 0x9c, 0xc5,
-	0x99, 0xe9, 0x79, 0x89, 0x25, 0xa5, 0x45, 0xa9, 0x12, 0x4c, 0x60, 0x19, 0x84, 0x80, 0x90, 0x33,
-	0x17, 0x4f, 0x59, 0x62, 0x4e, 0x66, 0x4a, 0x66, 0x49, 0x65, 0x48, 0x65, 0x41, 0xaa, 0x04, 0xb3,
-	0x02, 0xa3, 0x06, 0x9f, 0x91, 0xbc, 0x1e, 0xd4, 0x06, 0x3d, 0xb8, 0xe9, 0x7a, 0x61, 0x48, 0xca,
-	0x82, 0x50, 0x34, 0x09, 0x49, 0x71, 0x71, 0xc0, 0xf8, 0x12, 0x2c, 0x0a, 0x8c, 0x1a, 0x3c, 0x41,
-	0x70, 0x3e, 0x48, 0xae, 0x38, 0xb5, 0xb0, 0x34, 0x35, 0x2f, 0x39, 0x55, 0x82, 0x55, 0x81, 0x51,
-	0x83, 0x25, 0x08, 0xce, 0x17, 0x12, 0xe0, 0x62, 0x2e, 0x29, 0xc9, 0x91, 0x60, 0x03, 0x0b, 0x83,
-	0x98, 0x42, 0x62, 0x5c, 0x6c, 0x05, 0xa5, 0x49, 0xde, 0xa9, 0x95, 0x12, 0xec, 0x60, 0x73, 0xa0,
-	0x3c, 0x25, 0x71, 0x2e, 0x1e, 0x64, 0xfb, 0x85, 0xd8, 0xb9, 0x98, 0x5d, 0xfd, 0x7d, 0x04, 0x18,
-	0x9c, 0x78, 0x4e, 0x3c, 0x92, 0x63, 0xbc, 0xf0, 0x48, 0x8e, 0xf1, 0xc1, 0x23, 0x39, 0x46, 0x40,
-	0x00, 0x00, 0x00, 0xff, 0xff, 0x32, 0x35, 0xc7, 0xf2, 0x25, 0x01, 0x00, 0x00,
+	// 244 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x54, 0x8e, 0xc1, 0x4a, 0xc3, 0x40,
+	0x10, 0x86, 0xdd, 0x24, 0x6d, 0x9a, 0x71, 0x91, 0x32, 0x88, 0x0e, 0x22, 0x71, 0xe9, 0x29, 0xa7,
+	0x1c, 0xfa, 0x08, 0x4a, 0x0f, 0xa2, 0x20, 0x04, 0xe9, 0x7d, 0x6b, 0x17, 0x09, 0x84, 0xed, 0x9a,
+	0x6c, 0x0a, 0x79, 0x30, 0xdf, 0xc1, 0xa3, 0x8f, 0x20, 0x79, 0x12, 0xe9, 0x36, 0xae, 0xe9, 0xed,
+	0xff, 0xfe, 0x6f, 0x77, 0x66, 0x00, 0x4a, 0xa3, 0x9b, 0xdc, 0xd4, 0x3b, 0xbb, 0xc3, 0xf8, 0x98,
+	0x37, 0x8b, 0xcf, 0x00, 0x92, 0x47, 0xa3, 0x9b, 0x95, 0xb6, 0x75, 0x87, 0x97, 0x30, 0xd9, 0xcb,
+	0xaa, 0x55, 0xc4, 0x44, 0x90, 0xf1, 0xe2, 0x08, 0x78, 0x0b, 0x49, 0x53, 0xbe, 0x6b, 0x69, 0xdb,
+	0x5a, 0x51, 0xe0, 0xcc, 0x7f, 0x81, 0x0f, 0xc0, 0xf7, 0xb2, 0x2a, 0xb7, 0xa5, 0xed, 0x5e, 0x3b,
+	0xa3, 0x28, 0x14, 0x2c, 0xbb, 0x58, 0xde, 0xe5, 0xc3, 0x86, 0xdc, 0x4f, 0xcf, 0xd7, 0xa3, 0x67,
+	0xc5, 0xc9, 0x27, 0xbc, 0x81, 0xd9, 0x1f, 0x53, 0x24, 0x58, 0xc6, 0x0b, 0xcf, 0x07, 0xd7, 0xa8,
+	0x8f, 0x56, 0xe9, 0x37, 0x45, 0x13, 0xc1, 0xb2, 0xa8, 0xf0, 0x8c, 0x73, 0x08, 0xad, 0xad, 0x68,
+	0xea, 0xea, 0x43, 0xc4, 0x2b, 0x98, 0x9a, 0x76, 0xf3, 0xa4, 0x3a, 0x8a, 0xdd, 0x9c, 0x81, 0x50,
+	0xc0, 0xb9, 0xbf, 0x79, 0xbd, 0xa4, 0x99, 0x93, 0xe3, 0x0a, 0x11, 0xa2, 0xad, 0xb4, 0x92, 0x12,
+	0xa7, 0x5c, 0x5e, 0x5c, 0x03, 0x1f, 0x5f, 0x8d, 0x31, 0x84, 0xab, 0x97, 0xe7, 0xf9, 0xd9, 0x3d,
+	0xff, 0xea, 0x53, 0xf6, 0xdd, 0xa7, 0xec, 0xa7, 0x4f, 0xd9, 0xef, 0x00, 0xd6, 0xda, 0x42, 0x0a,
+	0x5b, 0x01, 0x00, 0x00,
 }
 
 func (m *IpnsEntry) Marshal() (dAtA []byte, err error) {
@@ -242,6 +264,18 @@ func (m *IpnsEntry) MarshalTo(dAtA []byte) (int, error) {
 		i = encodeVarintIpns(dAtA, i, uint64(len(m.PubKey)))
 		i += copy(dAtA[i:], m.PubKey)
 	}
+	if m.SignatureV2 != nil {
+		dAtA[i] = 0x42
+		i++
+		i = encodeVarintIpns(dAtA, i, uint64(len(m.SignatureV2)))
+		i += copy(dAtA[i:], m.SignatureV2)
+	}
+	if m.Data != nil {
+		dAtA[i] = 0x4a
+		i++
+		i = encodeVarintIpns(dAtA, i, uint64(len(m.Data)))
+		i += copy(dAtA[i:], m.Data)
+	}
 	if m.XXX_unrecognized != nil {
 		i += copy(dAtA[i:], m.XXX_unrecognized)
 	}
@@ -288,6 +322,14 @@ func (m *IpnsEntry) Size() (n int) {
 		l = len(m.PubKey)
 		n += 1 + l + sovIpns(uint64(l))
 	}
+	if m.SignatureV2 != nil {
+		l = len(m.SignatureV2)
+		n += 1 + l + sovIpns(uint64(l))
+	}
+	if m.Data != nil {
+		l = len(m.Data)
+		n += 1 + l + sovIpns(uint64(l))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -535,6 +577,74 @@ func (m *IpnsEntry) Unmarshal(dAtA []byte) error {
 				m.PubKey = []byte{}
 			}
 			iNdEx = postIndex
+		case 8:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SignatureV2", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIpns
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthIpns
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIpns
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.SignatureV2 = append(m.SignatureV2[:0], dAtA[iNdEx:postIndex]...)
+			if m.SignatureV2 == nil {
+				m.SignatureV2 = []byte{}
+			}
+			iNdEx = postIndex
+		case 9:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Data", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIpns
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthIpns
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIpns
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Data = append(m.Data[:0], dAtA[iNdEx:postIndex]...)
+			if m.Data == nil {
+				m.Data = []byte{}
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipIpns(dAtA[iNdEx:])
@@ -124,3 +124,39 @@ func TestOrdering(t *testing.T) {
 
 	_ = []interface{}{e1, e2, e3, e4, e5, e6}
 }
+
+func TestNoDowngrade(t *testing.T) {
+	ts := time.Unix(1000000, 0)
+	r := u.NewSeededRand(15)
+	priv, _, err := ci.GenerateKeyPairWithReader(ci.RSA, 1024, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e1, err := CreateWithData(priv, []byte("foo"), 1, ts.Add(time.Hour), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The data of e1 is stripped, making a legacy entry with the same
+	// sequence number.
+	e2 := proto.Clone(e1).(*pb.IpnsEntry)
+	e2.Data = nil
+	e2.SignatureV2 = nil
+
+	if err := AssertSelected(e1, e1, e2); err != nil {
+		t.Fatal(err)
+	}
+
+	// A legacy entry with a higher sequence number, as published by older
+	// nodes, is newer.
+	e3, err := Create(priv, []byte("bar"), 2, ts.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e3.Data = nil
+	e3.SignatureV2 = nil
+	if err := AssertSelected(e3, e1, e3); err != nil {
+		t.Fatal(err)
+	}
+}
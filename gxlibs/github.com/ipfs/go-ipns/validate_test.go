@@ -176,3 +176,75 @@ func genKeys(t *testing.T) (ci.PrivKey, peer.ID, string) {
 
 	return priv, pid, ipnsKey
 }
+
+func TestDataValidate(t *testing.T) {
+	sr := u.NewTimeSeededRand()
+	priv, pub, err := ci.GenerateKeyPairWithReader(ci.RSA, 1024, sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := []byte("/ipfs/QmfM2r8seH2GiRaC4esTjeraXEachRt8ZsSeGaWTPLyMoG")
+	eol := time.Now().Add(time.Hour)
+	extra := map[string]interface{}{"Comment": "hello", "Revision": 3}
+	ttl := 5 * time.Minute
+	entry, err := CreateWithData(priv, p, 7, eol, &ttl, extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(pub, entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.GetTtl() != uint64(5*time.Minute) {
+		t.Fatalf("unexpected ttl %d", entry.GetTtl())
+	}
+
+	got, err := GetExtraData(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["Comment"] != "hello" {
+		t.Fatalf("unexpected extra data: %v", got)
+	}
+	if v, ok := dataUint(got["Revision"]); !ok || v != 3 {
+		t.Fatalf("unexpected revision: %v", got["Revision"])
+	}
+
+	// Fields covered only by the data signature can't be tampered with.
+	tampered := proto.Clone(entry).(*pb.IpnsEntry)
+	tamperedTTL := uint64(time.Hour)
+	tampered.Ttl = &tamperedTTL
+	if err := Validate(pub, tampered); err != ErrDataMismatch {
+		t.Fatalf("expected %s, got %v", ErrDataMismatch, err)
+	}
+
+	tampered = proto.Clone(entry).(*pb.IpnsEntry)
+	seq := uint64(8)
+	tampered.Sequence = &seq
+	if err := Validate(pub, tampered); err != ErrDataMismatch {
+		t.Fatalf("expected %s, got %v", ErrDataMismatch, err)
+	}
+
+	tampered = proto.Clone(entry).(*pb.IpnsEntry)
+	tampered.SignatureV2 = nil
+	if err := Validate(pub, tampered); err != ErrSignature {
+		t.Fatalf("expected %s, got %v", ErrSignature, err)
+	}
+
+	// Records carry no TTL unless one is given.
+	entry, err = CreateWithData(priv, p, 7, eol, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Ttl != nil {
+		t.Fatalf("unexpected ttl %d", entry.GetTtl())
+	}
+	if err := Validate(pub, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = CreateWithData(priv, p, 7, eol, nil, map[string]interface{}{"Sequence": 1})
+	if err == nil {
+		t.Fatal("expected reserved data key to be rejected")
+	}
+}
@@ -40,6 +40,9 @@ type Directory struct {
 	// reading and editing directories.
 	unixfsDir uio.Directory
 
+	// Options of the UnixFS directories, inherited by the subdirectories.
+	dirOpts []uio.DirectoryOption
+
 	modTime time.Time
 }
 
@@ -47,8 +50,8 @@ type Directory struct {
 //
 // You probably don't want to call this directly. Instead, construct a new root
 // using NewRoot.
-func NewDirectory(ctx context.Context, name string, node ipld.Node, parent parent, dserv ipld.DAGService) (*Directory, error) {
-	db, err := uio.NewDirectoryFromNode(dserv, node)
+func NewDirectory(ctx context.Context, name string, node ipld.Node, parent parent, dserv ipld.DAGService, opts ...uio.DirectoryOption) (*Directory, error) {
+	db, err := uio.NewDirectoryFromNode(dserv, node, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -61,6 +64,7 @@ func NewDirectory(ctx context.Context, name string, node ipld.Node, parent paren
 		},
 		ctx:          ctx,
 		unixfsDir:    db,
+		dirOpts:      opts,
 		entriesCache: make(map[string]FSNode),
 		modTime:      time.Now(),
 	}, nil
@@ -164,7 +168,7 @@ func (d *Directory) cacheNode(name string, nd ipld.Node) (FSNode, error) {
 
 		switch fsn.Type() {
 		case ft.TDirectory, ft.THAMTShard:
-			ndir, err := NewDirectory(d.ctx, name, nd, d, d.dagService)
+			ndir, err := NewDirectory(d.ctx, name, nd, d, d.dagService, d.dirOpts...)
 			if err != nil {
 				return nil, err
 			}
@@ -318,7 +322,7 @@ func (d *Directory) Mkdir(name string) (*Directory, error) {
 		return nil, err
 	}
 
-	dirobj, err := NewDirectory(d.ctx, name, ndir, d, d.dagService)
+	dirobj, err := NewDirectory(d.ctx, name, ndir, d, d.dagService, d.dirOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -369,21 +373,9 @@ func (d *Directory) AddChild(name string, nd ipld.Node) error {
 	return nil
 }
 
-// addUnixFSChild adds a child to the inner UnixFS directory
-// and transitions to a HAMT implementation if needed.
+// addUnixFSChild adds a child to the inner UnixFS directory, which
+// transitions between the basic and HAMT implementations as needed.
 func (d *Directory) addUnixFSChild(c child) error {
-	if uio.UseHAMTSharding {
-		// If the directory HAMT implementation is being used and this
-		// directory is actually a basic implementation switch it to HAMT.
-		if basicDir, ok := d.unixfsDir.(*uio.BasicDirectory); ok {
-			hamtDir, err := basicDir.SwitchToSharding(d.ctx)
-			if err != nil {
-				return err
-			}
-			d.unixfsDir = hamtDir
-		}
-	}
-
 	err := d.unixfsDir.AddChild(d.ctx, c.Name, c.Node)
 	if err != nil {
 		return err
@@ -105,6 +105,9 @@ func (fi *File) Open(flags Flags) (_ FileDescriptor, _retErr error) {
 		return nil, err
 	}
 	dmod.RawLeaves = fi.RawLeaves
+	if flags.Append {
+		dmod.MergeChunkSize = chunker.DefaultBlockSize
+	}
 
 	return &fileDescriptor{
 		inode: fi,
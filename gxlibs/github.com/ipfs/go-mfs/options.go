@@ -4,4 +4,7 @@ type Flags struct {
 	Read  bool
 	Write bool
 	Sync  bool
+	// Append makes the writes past the end of the file write a short last
+	// leaf again along with the new data, see mod.DagModifier.MergeChunkSize.
+	Append bool
 }
@@ -221,6 +221,17 @@ func (ds *Shard) Set(ctx context.Context, name string, nd ipld.Node) error {
 	return ds.modifyValue(ctx, hv, name, lnk)
 }
 
+// SetLink sets 'name' to point to the target of the given link, without
+// fetching or storing the linked node.
+func (ds *Shard) SetLink(ctx context.Context, name string, lnk *ipld.Link) error {
+	hv := &hashBits{b: hash([]byte(name))}
+
+	lnk2 := *lnk
+	lnk2.Name = ds.linkNamePrefix(0) + name
+
+	return ds.modifyValue(ctx, hv, name, &lnk2)
+}
+
 // Remove deletes the named entry if it exists, this operation is idempotent.
 func (ds *Shard) Remove(ctx context.Context, name string) error {
 	hv := &hashBits{b: hash([]byte(name))}
@@ -339,7 +350,14 @@ func (ds *Shard) EnumLinksAsync(ctx context.Context) <-chan format.LinkResult {
 		defer cancel()
 		getLinks := makeAsyncTrieGetLinks(ds.dserv, linkResults)
 		cset := cid.NewSet()
-		err := dag.EnumerateChildrenAsync(ctx, getLinks, ds.cid, cset.Visit)
+		// serialize the shard first, it may have been built or modified in
+		// memory since it was loaded
+		rootNode, err := ds.Node()
+		if err != nil {
+			emitResult(ctx, linkResults, format.LinkResult{Link: nil, Err: err})
+			return
+		}
+		err = dag.EnumerateChildrenAsync(ctx, getLinks, rootNode.Cid(), cset.Visit)
 		if err != nil {
 			emitResult(ctx, linkResults, format.LinkResult{Link: nil, Err: err})
 		}
@@ -44,6 +44,20 @@ type DagBuilderHelper struct {
 	// is not reused to construct another DAG, but a new one (with a
 	// zero `offset`) is created.
 	offset uint64
+
+	// Resume support variables.
+	leaves       LeafSource
+	nextLeaf     ipld.Node
+	nextLeafSize uint64
+	onLeaf       func(node ipld.Node, dataSize uint64) error
+}
+
+// LeafSource provides leaves built by a previous, interrupted, import of
+// the same file.
+type LeafSource interface {
+	// NextLeaf returns the next leaf and the size of the file data it
+	// holds, or a nil node once all leaves have been returned.
+	NextLeaf() (ipld.Node, uint64, error)
 }
 
 // DagBuilderParams wraps configuration options to create a DagBuilderHelper
@@ -70,6 +84,16 @@ type DagBuilderParams struct {
 	// file will not be stored in the datastore but instead retrieved
 	// from this location via the urlstore.
 	URL string
+
+	// Leaves, if set, provides the first leaves of the DAG, which are
+	// used before any data is read from the Splitter. This allows to
+	// resume an interrupted import without importing again the data
+	// it already stored.
+	Leaves LeafSource
+
+	// OnLeaf, if set, is called with every leaf data node built from
+	// the Splitter data, before it is added to the DAG.
+	OnLeaf func(node ipld.Node, dataSize uint64) error
 }
 
 // New generates a new DagBuilderHelper from the given params and a given
@@ -81,6 +105,8 @@ func (dbp *DagBuilderParams) New(spl chunker.Splitter) (*DagBuilderHelper, error
 		rawLeaves:  dbp.RawLeaves,
 		cidBuilder: dbp.CidBuilder,
 		maxlinks:   dbp.Maxlinks,
+		leaves:     dbp.Leaves,
+		onLeaf:     dbp.OnLeaf,
 	}
 	if fi, ok := spl.Reader().(files.FileInfo); dbp.NoCopy && ok {
 		db.fullPath = fi.AbsPath()
@@ -103,10 +129,19 @@ func (dbp *DagBuilderParams) New(spl chunker.Splitter) (*DagBuilderHelper, error
 // it will do nothing.
 func (db *DagBuilderHelper) prepareNext() {
 	// if we already have data waiting to be consumed, we're ready
-	if db.nextData != nil || db.recvdErr != nil {
+	if db.nextData != nil || db.nextLeaf != nil || db.recvdErr != nil {
 		return
 	}
 
+	// previously built leaves come first
+	if db.leaves != nil {
+		db.nextLeaf, db.nextLeafSize, db.recvdErr = db.leaves.NextLeaf()
+		if db.nextLeaf != nil || db.recvdErr != nil {
+			return
+		}
+		db.leaves = nil
+	}
+
 	db.nextData, db.recvdErr = db.spl.NextBytes()
 	if db.recvdErr == io.EOF {
 		db.recvdErr = nil
@@ -121,7 +156,7 @@ func (db *DagBuilderHelper) Done() bool {
 	if db.recvdErr != nil {
 		return false
 	}
-	return db.nextData == nil
+	return db.nextData == nil && db.nextLeaf == nil
 }
 
 // Next returns the next chunk of data to be inserted into the dag
@@ -213,6 +248,16 @@ func (db *DagBuilderHelper) FillNodeLayer(node *FSNodeOverDag) error {
 // after that it will be hidden by `NewLeafNode` inside a generic
 // `ipld.Node` representation.
 func (db *DagBuilderHelper) NewLeafDataNode(fsNodeType pb.Data_DataType) (node ipld.Node, dataSize uint64, err error) {
+	db.prepareNext() // idempotent
+	if db.nextLeaf != nil {
+		// Reuse a previously built leaf, keeping track of its data
+		// for the Filestore offsets of the following ones.
+		node, dataSize = db.nextLeaf, db.nextLeafSize
+		db.nextLeaf = nil
+		db.offset += dataSize
+		return node, dataSize, nil
+	}
+
 	fileData, err := db.Next()
 	if err != nil {
 		return nil, 0, err
@@ -228,6 +273,12 @@ func (db *DagBuilderHelper) NewLeafDataNode(fsNodeType pb.Data_DataType) (node i
 	// Convert this leaf to a `FilestoreNode` if needed.
 	node = db.ProcessFileStore(node, dataSize)
 
+	if db.onLeaf != nil {
+		if err := db.onLeaf(node, dataSize); err != nil {
+			return nil, 0, err
+		}
+	}
+
 	return node, dataSize, nil
 }
 
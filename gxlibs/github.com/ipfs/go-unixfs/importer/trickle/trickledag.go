@@ -88,14 +88,7 @@ func fillTrickleRec(db *h.DagBuilderHelper, node *h.FSNodeOverDag, maxDepth int)
 
 // Append appends the data in `db` to the dag, using the Trickledag format
 func Append(ctx context.Context, basen ipld.Node, db *h.DagBuilderHelper) (out ipld.Node, errOut error) {
-	base, ok := basen.(*dag.ProtoNode)
-	if !ok {
-		return nil, dag.ErrNotProtobuf
-	}
-
-	// Convert to unixfs node for working with easily
-
-	fsn, err := h.NewFSNFromDag(base)
+	fsn, err := appendBase(basen, db)
 	if err != nil {
 		return nil, err
 	}
@@ -149,6 +142,37 @@ func Append(ctx context.Context, basen ipld.Node, db *h.DagBuilderHelper) (out i
 	return fsn.GetDagNode()
 }
 
+// appendBase converts the root of the dag to append to into an unixfs node.
+// A root which is a single leaf holding data (e.g. the root of a small file
+// added with the balanced layout) becomes the first child of a new root.
+func appendBase(basen ipld.Node, db *h.DagBuilderHelper) (*h.FSNodeOverDag, error) {
+	switch base := basen.(type) {
+	case *dag.RawNode:
+		fsn := db.NewFSNodeOverDag(ft.TFile)
+		if err := fsn.AddChild(base, uint64(len(base.RawData())), db); err != nil {
+			return nil, err
+		}
+		return fsn, nil
+	case *dag.ProtoNode:
+		// Convert to unixfs node for working with easily
+		fsn, err := h.NewFSNFromDag(base)
+		if err != nil {
+			return nil, err
+		}
+		if len(base.Links()) > 0 || fsn.FileSize() == 0 {
+			return fsn, nil
+		}
+
+		root := db.NewFSNodeOverDag(ft.TFile)
+		if err := root.AddChild(base, fsn.FileSize(), db); err != nil {
+			return nil, err
+		}
+		return root, nil
+	default:
+		return nil, dag.ErrNotProtobuf
+	}
+}
+
 func appendFillLastChild(ctx context.Context, fsn *h.FSNodeOverDag, depth int, repeatNumber int, db *h.DagBuilderHelper) error {
 	if fsn.NumChildren() <= db.Maxlinks() {
 		return nil
@@ -14,10 +14,22 @@ import (
 	ipld "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipld-format"
 )
 
-// UseHAMTSharding is a global flag that signifies whether or not to use the
-// HAMT sharding scheme for directory creation
+// UseHAMTSharding is a global flag that forces the HAMT sharding scheme for
+// all directories, regardless of their size. It's the default of the
+// ForceSharding option, and must not be changed while directories are in use.
 var UseHAMTSharding = false
 
+// HAMTShardingSize is the estimated size, in bytes, above which a directory is
+// switched to the HAMT sharding scheme. A sharded directory whose size falls
+// back to (or under) it is switched back to a basic directory. The size of a
+// directory is estimated as the sum of the lengths of the names and CIDs of
+// its entries. Zero disables automatic sharding. It's the default of the
+// ShardingSize option, and must not be changed while directories are in use.
+var HAMTShardingSize = DefaultHAMTShardingSize
+
+// DefaultHAMTShardingSize is the default value of HAMTShardingSize.
+const DefaultHAMTShardingSize = 256 * 1024
+
 // DefaultShardWidth is the default value used for hamt sharding width.
 var DefaultShardWidth = 256
 
@@ -68,6 +80,9 @@ type Directory interface {
 type BasicDirectory struct {
 	node  *mdag.ProtoNode
 	dserv ipld.DAGService
+
+	// estimated size of the entries, see HAMTShardingSize
+	estimatedSize int
 }
 
 // HAMTDirectory is the HAMT implementation of `Directory`.
@@ -75,11 +90,59 @@ type BasicDirectory struct {
 type HAMTDirectory struct {
 	shard *hamt.Shard
 	dserv ipld.DAGService
+
+	// estimated size of the entries, see HAMTShardingSize, if sizeKnown.
+	// The size of a directory loaded from a node is only computed once an
+	// entry is removed from it.
+	estimatedSize int
+	sizeKnown     bool
+}
+
+// DynamicDirectory wraps a `Directory`, switching it between the basic and the
+// HAMT implementations as entries are added and removed, following its
+// sharding options.
+type DynamicDirectory struct {
+	Directory
+
+	shardingSize  int
+	forceSharding bool
+}
+
+// DirectoryOption configures when a directory switches between the basic and
+// the HAMT implementations.
+type DirectoryOption func(*DynamicDirectory)
+
+// ShardingSize sets the estimated size above which the directory is sharded,
+// instead of HAMTShardingSize. Zero disables automatic sharding.
+func ShardingSize(size int) DirectoryOption {
+	return func(d *DynamicDirectory) {
+		d.shardingSize = size
+	}
+}
+
+// ForceSharding sets whether the directory always uses the HAMT
+// implementation, instead of UseHAMTSharding.
+func ForceSharding(force bool) DirectoryOption {
+	return func(d *DynamicDirectory) {
+		d.forceSharding = force
+	}
+}
+
+func newDynamicDirectory(opts []DirectoryOption) *DynamicDirectory {
+	d := &DynamicDirectory{
+		shardingSize:  HAMTShardingSize,
+		forceSharding: UseHAMTSharding,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
 }
 
 // NewDirectory returns a Directory. It needs a `DAGService` to add the children.
-func NewDirectory(dserv ipld.DAGService) Directory {
-	if UseHAMTSharding {
+func NewDirectory(dserv ipld.DAGService, opts ...DirectoryOption) Directory {
+	d := newDynamicDirectory(opts)
+	if d.forceSharding {
 		dir := new(HAMTDirectory)
 		s, err := hamt.NewShard(dserv, DefaultShardWidth)
 		if err != nil {
@@ -87,13 +150,16 @@ func NewDirectory(dserv ipld.DAGService) Directory {
 		}
 		dir.shard = s
 		dir.dserv = dserv
-		return dir
+		dir.sizeKnown = true
+		d.Directory = dir
+		return d
 	}
 
 	dir := new(BasicDirectory)
 	dir.node = format.EmptyDirNode()
 	dir.dserv = dserv
-	return dir
+	d.Directory = dir
+	return d
 }
 
 // ErrNotADir implies that the given node was not a unixfs directory
@@ -101,7 +167,7 @@ var ErrNotADir = fmt.Errorf("merkledag node was not a directory or shard")
 
 // NewDirectoryFromNode loads a unixfs directory from the given IPLD node and
 // DAGService.
-func NewDirectoryFromNode(dserv ipld.DAGService, node ipld.Node) (Directory, error) {
+func NewDirectoryFromNode(dserv ipld.DAGService, node ipld.Node, opts ...DirectoryOption) (Directory, error) {
 	protoBufNode, ok := node.(*mdag.ProtoNode)
 	if !ok {
 		return nil, ErrNotADir
@@ -114,19 +180,27 @@ func NewDirectoryFromNode(dserv ipld.DAGService, node ipld.Node) (Directory, err
 
 	switch fsNode.Type() {
 	case format.TDirectory:
-		return &BasicDirectory{
+		dir := &BasicDirectory{
 			dserv: dserv,
 			node:  protoBufNode.Copy().(*mdag.ProtoNode),
-		}, nil
+		}
+		for _, l := range dir.node.Links() {
+			dir.estimatedSize += linkSize(l.Name, l.Cid)
+		}
+		d := newDynamicDirectory(opts)
+		d.Directory = dir
+		return d, nil
 	case format.THAMTShard:
 		shard, err := hamt.NewHamtFromDag(dserv, node)
 		if err != nil {
 			return nil, err
 		}
-		return &HAMTDirectory{
+		d := newDynamicDirectory(opts)
+		d.Directory = &HAMTDirectory{
 			dserv: dserv,
 			shard: shard,
-		}, nil
+		}
+		return d, nil
 	}
 
 	return nil, ErrNotADir
@@ -140,10 +214,35 @@ func (d *BasicDirectory) SetCidBuilder(builder cid.Builder) {
 // AddChild implements the `Directory` interface. It adds (or replaces)
 // a link to the given `node` under `name`.
 func (d *BasicDirectory) AddChild(ctx context.Context, name string, node ipld.Node) error {
-	d.node.RemoveNodeLink(name)
+	d.removeLink(name)
 	// Remove old link (if it existed), don't check a potential `ErrNotFound`.
 
-	return d.node.AddNodeLink(name, node)
+	if err := d.node.AddNodeLink(name, node); err != nil {
+		return err
+	}
+	d.estimatedSize += linkSize(name, node.Cid())
+	return nil
+}
+
+// addLink adds (or replaces) a link under `name` pointing to the target of
+// `lnk`, without fetching it.
+func (d *BasicDirectory) addLink(name string, lnk *ipld.Link) error {
+	d.removeLink(name)
+
+	if err := d.node.AddRawLink(name, lnk); err != nil {
+		return err
+	}
+	d.estimatedSize += linkSize(name, lnk.Cid)
+	return nil
+}
+
+func (d *BasicDirectory) removeLink(name string) error {
+	lnk, err := d.node.GetNodeLink(name)
+	if err != nil {
+		return err
+	}
+	d.estimatedSize -= linkSize(name, lnk.Cid)
+	return d.node.RemoveNodeLink(name)
 }
 
 // EnumLinksAsync returns a channel which will receive Links in the directory
@@ -196,7 +295,7 @@ func (d *BasicDirectory) Find(ctx context.Context, name string) (ipld.Node, erro
 
 // RemoveChild implements the `Directory` interface.
 func (d *BasicDirectory) RemoveChild(ctx context.Context, name string) error {
-	return d.node.RemoveNodeLink(name)
+	return d.removeLink(name)
 }
 
 // GetNode implements the `Directory` interface.
@@ -213,6 +312,8 @@ func (d *BasicDirectory) GetCidBuilder() cid.Builder {
 func (d *BasicDirectory) SwitchToSharding(ctx context.Context) (Directory, error) {
 	hamtDir := new(HAMTDirectory)
 	hamtDir.dserv = d.dserv
+	hamtDir.estimatedSize = d.estimatedSize
+	hamtDir.sizeKnown = true
 
 	shard, err := hamt.NewShard(d.dserv, DefaultShardWidth)
 	if err != nil {
@@ -222,12 +323,7 @@ func (d *BasicDirectory) SwitchToSharding(ctx context.Context) (Directory, error
 	hamtDir.shard = shard
 
 	for _, lnk := range d.node.Links() {
-		node, err := d.dserv.Get(ctx, lnk.Cid)
-		if err != nil {
-			return nil, err
-		}
-
-		err = hamtDir.shard.Set(ctx, lnk.Name, node)
+		err = hamtDir.shard.SetLink(ctx, lnk.Name, lnk)
 		if err != nil {
 			return nil, err
 		}
@@ -243,7 +339,28 @@ func (d *HAMTDirectory) SetCidBuilder(builder cid.Builder) {
 
 // AddChild implements the `Directory` interface.
 func (d *HAMTDirectory) AddChild(ctx context.Context, name string, nd ipld.Node) error {
-	return d.shard.Set(ctx, name, nd)
+	if err := d.removeSize(ctx, name); err != nil {
+		return err
+	}
+	if err := d.shard.Set(ctx, name, nd); err != nil {
+		return err
+	}
+	d.estimatedSize += linkSize(name, nd.Cid())
+	return nil
+}
+
+// removeSize accounts for the removal of the entry `name`, if it exists.
+func (d *HAMTDirectory) removeSize(ctx context.Context, name string) error {
+	lnk, err := d.shard.Find(ctx, name)
+	switch err {
+	case nil:
+		d.estimatedSize -= linkSize(name, lnk.Cid)
+		return nil
+	case os.ErrNotExist:
+		return nil
+	default:
+		return err
+	}
 }
 
 // ForEachLink implements the `Directory` interface.
@@ -274,6 +391,14 @@ func (d *HAMTDirectory) Find(ctx context.Context, name string) (ipld.Node, error
 
 // RemoveChild implements the `Directory` interface.
 func (d *HAMTDirectory) RemoveChild(ctx context.Context, name string) error {
+	if !d.sizeKnown {
+		if err := d.computeSize(ctx); err != nil {
+			return err
+		}
+	}
+	if err := d.removeSize(ctx, name); err != nil {
+		return err
+	}
 	return d.shard.Remove(ctx, name)
 }
 
@@ -286,3 +411,88 @@ func (d *HAMTDirectory) GetNode() (ipld.Node, error) {
 func (d *HAMTDirectory) GetCidBuilder() cid.Builder {
 	return d.shard.CidBuilder()
 }
+
+// computeSize computes the estimated size of the directory by enumerating
+// all its entries.
+func (d *HAMTDirectory) computeSize(ctx context.Context) error {
+	size := 0
+	err := d.shard.ForEachLink(ctx, func(l *ipld.Link) error {
+		size += linkSize(l.Name, l.Cid)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	d.estimatedSize = size
+	d.sizeKnown = true
+	return nil
+}
+
+// switchToBasic returns a basic implementation of this directory.
+func (d *HAMTDirectory) switchToBasic(ctx context.Context) (*BasicDirectory, error) {
+	basicDir := new(BasicDirectory)
+	basicDir.dserv = d.dserv
+	basicDir.node = format.EmptyDirNode()
+	basicDir.node.SetCidBuilder(d.shard.CidBuilder())
+
+	err := d.shard.ForEachLink(ctx, func(l *ipld.Link) error {
+		return basicDir.addLink(l.Name, l)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return basicDir, nil
+}
+
+// AddChild implements the `Directory` interface, switching to the HAMT
+// implementation when the directory grows above its sharding size.
+func (d *DynamicDirectory) AddChild(ctx context.Context, name string, nd ipld.Node) error {
+	if err := d.Directory.AddChild(ctx, name, nd); err != nil {
+		return err
+	}
+	return d.rebalance(ctx)
+}
+
+// RemoveChild implements the `Directory` interface, switching back to the
+// basic implementation when the directory shrinks to its sharding size.
+func (d *DynamicDirectory) RemoveChild(ctx context.Context, name string) error {
+	if err := d.Directory.RemoveChild(ctx, name); err != nil {
+		return err
+	}
+	return d.rebalance(ctx)
+}
+
+// rebalance switches the implementation of the directory if its size
+// crossed its sharding size.
+func (d *DynamicDirectory) rebalance(ctx context.Context) error {
+	switch dir := d.Directory.(type) {
+	case *BasicDirectory:
+		if !d.forceSharding && (d.shardingSize <= 0 || dir.estimatedSize <= d.shardingSize) {
+			return nil
+		}
+
+		hamtDir, err := dir.SwitchToSharding(ctx)
+		if err != nil {
+			return err
+		}
+		d.Directory = hamtDir
+	case *HAMTDirectory:
+		// the size is known once the directory shrinks, which is the only
+		// way it may have to switch back
+		if d.forceSharding || d.shardingSize <= 0 || !dir.sizeKnown || dir.estimatedSize > d.shardingSize {
+			return nil
+		}
+
+		basicDir, err := dir.switchToBasic(ctx)
+		if err != nil {
+			return err
+		}
+		d.Directory = basicDir
+	}
+	return nil
+}
+
+func linkSize(name string, c cid.Cid) int {
+	return len(name) + len(c.Bytes())
+}
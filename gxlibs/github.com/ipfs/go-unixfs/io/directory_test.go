@@ -182,3 +182,115 @@ func TestDirBuilder(t *testing.T) {
 		t.Fatal("wrong number of links", len(asyncLinks), count)
 	}
 }
+
+func TestDirectoryAutoSharding(t *testing.T) {
+	const shardingSize = 1000
+
+	ds := mdtest.Mock()
+	ctx := context.Background()
+	child := ft.EmptyDirNode()
+	ds.Add(ctx, child)
+	entrySize := linkSize("entry00", child.Cid())
+	nentries := shardingSize / entrySize
+
+	isSharded := func(dir Directory) bool {
+		_, ok := dir.(*DynamicDirectory).Directory.(*HAMTDirectory)
+		return ok
+	}
+
+	dir := NewDirectory(ds, ShardingSize(shardingSize))
+	for i := 0; i < nentries; i++ {
+		if err := dir.AddChild(ctx, fmt.Sprintf("entry%02d", i), child); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if isSharded(dir) {
+		t.Fatal("directory below the threshold should not be sharded")
+	}
+	basic, err := dir.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	basicCid := basic.Cid()
+
+	// replacing an entry does not change the size
+	if err := dir.AddChild(ctx, "entry00", child); err != nil {
+		t.Fatal(err)
+	}
+	if isSharded(dir) {
+		t.Fatal("directory below the threshold should not be sharded")
+	}
+
+	if err := dir.AddChild(ctx, "last", child); err != nil {
+		t.Fatal(err)
+	}
+	if !isSharded(dir) {
+		t.Fatal("directory above the threshold should be sharded")
+	}
+	nd, err := dir.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds.Add(ctx, nd)
+
+	// a reloaded shard switches back once it shrinks
+	dir, err = NewDirectoryFromNode(ds, nd, ShardingSize(shardingSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.RemoveChild(ctx, "last"); err != nil {
+		t.Fatal(err)
+	}
+	if isSharded(dir) {
+		t.Fatal("directory back below the threshold should not be sharded")
+	}
+	nd, err = dir.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(basicCid) {
+		t.Fatalf("expected %s after switching back, got %s", basicCid, nd.Cid())
+	}
+}
+
+func TestShardSizeTracking(t *testing.T) {
+	const shardingSize = 1000
+
+	ds := mdtest.Mock()
+	ctx := context.Background()
+	child := ft.EmptyDirNode()
+	ds.Add(ctx, child)
+	entrySize := linkSize("entry00", child.Cid())
+	nentries := 2 * shardingSize / entrySize
+
+	dir := NewDirectory(ds, ShardingSize(shardingSize))
+	for i := 0; i < nentries; i++ {
+		if err := dir.AddChild(ctx, fmt.Sprintf("entry%02d", i), child); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nd, err := dir.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds.Add(ctx, nd)
+
+	dir, err = NewDirectoryFromNode(ds, nd, ShardingSize(shardingSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shard := dir.(*DynamicDirectory).Directory.(*HAMTDirectory)
+	if shard.sizeKnown {
+		t.Fatal("expected the size of a loaded shard not to be computed before a removal")
+	}
+
+	// The size is computed once, then tracked.
+	for i := 0; i < nentries/4; i++ {
+		if err := dir.RemoveChild(ctx, fmt.Sprintf("entry%02d", i)); err != nil {
+			t.Fatal(err)
+		}
+		if !shard.sizeKnown || shard.estimatedSize != (nentries-i-1)*entrySize {
+			t.Fatalf("expected a size of %d, got %d", (nentries-i-1)*entrySize, shard.estimatedSize)
+		}
+	}
+}
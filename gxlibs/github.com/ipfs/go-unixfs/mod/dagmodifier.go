@@ -47,6 +47,12 @@ type DagModifier struct {
 	Prefix    cid.Prefix
 	RawLeaves bool
 
+	// MergeChunkSize, if not zero, is the size of the chunks made by the
+	// splitter. Writes past the end of the file then write the last leaf
+	// again along with the new data if it holds less than a chunk, so that
+	// a file growing through small appends isn't made of small leaves.
+	MergeChunkSize int64
+
 	read uio.DagReader
 }
 
@@ -210,20 +216,26 @@ func (dm *DagModifier) Sync() error {
 		}
 	}
 
-	// overwrite existing dag nodes
-	thisc, err := dm.modifyDag(dm.curNode, dm.writeStart)
-	if err != nil {
-		return err
-	}
+	// overwrite existing dag nodes, unless only appending with merged leaves
+	if dm.MergeChunkSize == 0 || dm.writeStart < fs {
+		thisc, err := dm.modifyDag(dm.curNode, dm.writeStart)
+		if err != nil {
+			return err
+		}
 
-	dm.curNode, err = dm.dagserv.Get(dm.ctx, thisc)
-	if err != nil {
-		return err
+		dm.curNode, err = dm.dagserv.Get(dm.ctx, thisc)
+		if err != nil {
+			return err
+		}
 	}
 
 	// need to write past end of current dag
 	if dm.wrBuf.Len() > 0 {
-		dm.curNode, err = dm.appendData(dm.curNode, dm.splitter(dm.wrBuf))
+		if dm.MergeChunkSize > 0 {
+			dm.curNode, err = dm.appendMerged(dm.curNode, dm.wrBuf)
+		} else {
+			dm.curNode, err = dm.appendData(dm.curNode, dm.splitter(dm.wrBuf))
+		}
 		if err != nil {
 			return err
 		}
@@ -369,6 +381,118 @@ func (dm *DagModifier) appendData(nd ipld.Node, spl chunker.Splitter) (ipld.Node
 	}
 }
 
+// appendMerged appends the data from r to the end of this dag. If the last
+// leaf of the dag holds less than MergeChunkSize bytes, it is removed and
+// its data written again along with r, so that a file growing through small
+// appends is not made of small leaves. Only the nodes on the right-most path
+// of the dag are modified.
+func (dm *DagModifier) appendMerged(nd ipld.Node, r io.Reader) (ipld.Node, error) {
+	base, tail, err := dm.popShortLeaf(nd)
+	if err != nil {
+		return nil, err
+	}
+	if tail != nil {
+		r = io.MultiReader(bytes.NewReader(tail), r)
+	}
+
+	if base != nil {
+		return dm.appendData(base, dm.splitter(r))
+	}
+
+	// The whole file was in the removed leaf, start over.
+	dbp := &help.DagBuilderParams{
+		Dagserv:    dm.dagserv,
+		Maxlinks:   help.DefaultLinksPerBlock,
+		CidBuilder: dm.Prefix,
+		RawLeaves:  dm.RawLeaves,
+	}
+	db, err := dbp.New(dm.splitter(r))
+	if err != nil {
+		return nil, err
+	}
+	return trickle.Layout(db)
+}
+
+// popShortLeaf removes the last leaf of the given node if it holds less than
+// MergeChunkSize bytes, returning the modified node and the data of the
+// removed leaf. Nodes left without children are removed as well, in which
+// case the returned node is nil. If the last leaf is not removed, the node
+// is returned unchanged along with nil data.
+func (dm *DagModifier) popShortLeaf(n ipld.Node) (ipld.Node, []byte, error) {
+	if len(n.Links()) == 0 {
+		var data []byte
+		switch nd := n.(type) {
+		case *mdag.ProtoNode:
+			fsn, err := ft.FSNodeFromBytes(nd.Data())
+			if err != nil {
+				return nil, nil, err
+			}
+			data = fsn.Data()
+		case *mdag.RawNode:
+			data = nd.RawData()
+		default:
+			return nil, nil, ErrNotUnixfs
+		}
+
+		if int64(len(data)) >= dm.MergeChunkSize {
+			return n, nil, nil
+		}
+		return nil, data, nil
+	}
+
+	nd, ok := n.(*mdag.ProtoNode)
+	if !ok {
+		return nil, nil, ErrNotUnixfs
+	}
+
+	fsn, err := ft.FSNodeFromBytes(nd.Data())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	last := len(nd.Links()) - 1
+	if fsn.NumChildren() != len(nd.Links()) {
+		// Unexpected layout, leave it alone.
+		return n, nil, nil
+	}
+
+	child, err := nd.Links()[last].GetNode(dm.ctx, dm.dagserv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nchild, tail, err := dm.popShortLeaf(child)
+	if err != nil || tail == nil {
+		return n, nil, err
+	}
+
+	childSize := fsn.BlockSize(last)
+	fsn.RemoveBlockSize(last)
+
+	nnd := nd.Copy().(*mdag.ProtoNode)
+	nnd.SetLinks(nnd.Links()[:last])
+	if nchild != nil {
+		if err := dm.dagserv.Add(dm.ctx, nchild); err != nil {
+			return nil, nil, err
+		}
+		if err := nnd.AddNodeLink("", nchild); err != nil {
+			return nil, nil, err
+		}
+		fsn.AddBlockSize(childSize - uint64(len(tail)))
+	}
+
+	if len(nnd.Links()) == 0 && len(fsn.Data()) == 0 {
+		return nil, tail, nil
+	}
+
+	b, err := fsn.GetBytes()
+	if err != nil {
+		return nil, nil, err
+	}
+	nnd.SetData(b)
+	return nnd, tail, nil
+}
+
 // Read data from this dag starting at the current offset
 func (dm *DagModifier) Read(b []byte) (int, error) {
 	err := dm.readPrep()
@@ -1,6 +1,7 @@
 package mod
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -13,6 +14,7 @@ import (
 	uio "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/io"
 	testu "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs/test"
 
+	chunker "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-chunker"
 	u "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-util"
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs"
 )
@@ -858,3 +860,140 @@ func getOffset(reader uio.DagReader) int64 {
 	}
 	return offset
 }
+
+func TestAppendMergesShortLeaves(t *testing.T) {
+	runAllSubtests(t, testAppendMergesShortLeaves)
+}
+func testAppendMergesShortLeaves(t *testing.T, opts testu.NodeOpts) {
+	dserv := testu.GetDAGServ()
+	n := testu.GetEmptyNode(t, dserv, opts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A chunk size other than the default one, to check that the leaves
+	// are merged up to the size of the chunks actually made.
+	const chunkSize = 64 * 1024
+	dagmod, err := NewDagModifier(ctx, n, dserv, chunker.SizeSplitterGen(chunkSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.ForceRawLeaves {
+		dagmod.RawLeaves = true
+	}
+	dagmod.MergeChunkSize = chunkSize
+
+	data := make([]byte, 600*1024)
+	u.NewTimeSeededRand().Read(data)
+
+	// Grow the file like a log, syncing every small write.
+	for off := 0; off < len(data); off += 7000 {
+		end := off + 7000
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := dagmod.Write(data[off:end]); err != nil {
+			t.Fatal(err)
+		}
+		if err := dagmod.Sync(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	verifyNode(t, data, dagmod, opts)
+
+	// The result must be the same as adding the data at once.
+	dbp := h.DagBuilderParams{
+		Dagserv:    dserv,
+		Maxlinks:   h.DefaultLinksPerBlock,
+		CidBuilder: opts.Prefix,
+		RawLeaves:  opts.RawLeavesUsed,
+	}
+	db, err := dbp.New(chunker.NewSizeSplitter(bytes.NewReader(data), chunkSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := trickle.Layout(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := dagmod.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nd.Cid().Equals(expected.Cid()) {
+		t.Fatalf("appended file is %s, expected %s", nd.Cid(), expected.Cid())
+	}
+}
+
+func TestAppendKeepsShortLeaves(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	n := testu.GetEmptyNode(t, dserv, testu.UseProtoBufLeaves)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dagmod, err := NewDagModifier(ctx, n, dserv, chunker.DefaultSplitter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := dagmod.Write([]byte("short write")); err != nil {
+			t.Fatal(err)
+		}
+		if err := dagmod.Sync(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without MergeChunkSize, the leaves written by each sync are kept.
+	nd, err := dagmod.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nd.Links()) != 2 {
+		t.Fatalf("expected 2 leaves, got %d", len(nd.Links()))
+	}
+}
+
+func TestAppendToLeafRoot(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A full raw leaf as the root of the file, as added by the
+	// balanced layout.
+	data := make([]byte, chunker.DefaultBlockSize+100)
+	u.NewTimeSeededRand().Read(data)
+	root := dag.NewRawNode(data[:chunker.DefaultBlockSize])
+	if err := dserv.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	dagmod, err := NewDagModifier(ctx, root, dserv, chunker.DefaultSplitter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dagmod.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dagmod.Write(data[chunker.DefaultBlockSize:]); err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := dagmod.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd, err := uio.NewDagReader(ctx, nd, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testu.ArrComp(out, data); err != nil {
+		t.Fatal(err)
+	}
+}
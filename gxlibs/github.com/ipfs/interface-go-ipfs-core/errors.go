@@ -7,4 +7,7 @@ var (
 	ErrNotFile      = errors.New("this dag node is not a regular file")
 	ErrOffline      = errors.New("this action must be run in online mode, try running 'ipfs daemon' first")
 	ErrNotSupported = errors.New("operation not supported")
+	// ErrPartialAdd is returned by a partial add, which stores the next part
+	// of a file without producing a path.
+	ErrPartialAdd = errors.New("only a part of the file was added")
 )
@@ -16,6 +16,9 @@ type NamePublishSettings struct {
 
 	TTL *time.Duration
 
+	Sequence *uint64
+	Data     map[string]interface{}
+
 	AllowOffline bool
 }
 
@@ -104,6 +107,26 @@ func (nameOpts) TTL(ttl time.Duration) NamePublishOption {
 	}
 }
 
+// Sequence is an option for Name.Publish which specifies an explicit sequence
+// number for the record. It may not be lower than the sequence number of the
+// previously published record. By default, the previous sequence number is
+// incremented when the value changes.
+func (nameOpts) Sequence(seq uint64) NamePublishOption {
+	return func(settings *NamePublishSettings) error {
+		settings.Sequence = &seq
+		return nil
+	}
+}
+
+// Data is an option for Name.Publish which specifies extra data to sign along
+// with the record. The data must be encodable as CBOR.
+func (nameOpts) Data(data map[string]interface{}) NamePublishOption {
+	return func(settings *NamePublishSettings) error {
+		settings.Data = data
+		return nil
+	}
+}
+
 // Cache is an option for Name.Resolve which specifies if cache should be used.
 // Default value is true
 func (nameOpts) Cache(cache bool) NameResolveOption {
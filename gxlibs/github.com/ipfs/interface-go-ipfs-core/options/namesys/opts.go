@@ -27,6 +27,9 @@ type ResolveOpts struct {
 	// timeout (although there is an implicit timeout due to dial
 	// timeouts within the DHT)
 	DhtTimeout time.Duration
+	// Whether a cached entry that expired less than the max staleness of the
+	// cache ago may be returned, while it is revalidated in the background
+	StaleOK bool
 }
 
 // DefaultResolveOpts returns the default options for resolving
@@ -36,6 +39,7 @@ func DefaultResolveOpts() ResolveOpts {
 		Depth:          DefaultDepthLimit,
 		DhtRecordCount: 16,
 		DhtTimeout:     time.Minute,
+		StaleOK:        true,
 	}
 }
 
@@ -64,6 +68,14 @@ func DhtTimeout(timeout time.Duration) ResolveOpt {
 	}
 }
 
+// StaleOK sets whether a stale cached entry may be returned while it is
+// revalidated in the background
+func StaleOK(ok bool) ResolveOpt {
+	return func(o *ResolveOpts) {
+		o.StaleOK = ok
+	}
+}
+
 // ProcessOpts converts an array of ResolveOpt into a ResolveOpts object
 func ProcessOpts(opts []ResolveOpt) ResolveOpts {
 	rsopts := DefaultResolveOpts()
@@ -72,3 +84,73 @@ func ProcessOpts(opts []ResolveOpt) ResolveOpts {
 	}
 	return rsopts
 }
+
+// DefaultPublishLifetime is the default validity of published records.
+const DefaultPublishLifetime = 24 * time.Hour
+
+// PublishOptions specifies options for publishing an IPNS record
+type PublishOptions struct {
+	// The time at which the record stops being valid
+	EOL time.Time
+	// The amount of time the record may be cached for by resolvers. When
+	// nil, the record carries no TTL and resolvers use their default
+	TTL *time.Duration
+	// The sequence number of the record. When nil, the sequence number of
+	// the previously published record is used, incremented if the value
+	// changes
+	Sequence *uint64
+	// Extra data signed along with the record
+	Data map[string]interface{}
+}
+
+// DefaultPublishOpts returns the default options for publishing an IPNS
+// record
+func DefaultPublishOpts() PublishOptions {
+	return PublishOptions{
+		EOL: time.Now().Add(DefaultPublishLifetime),
+	}
+}
+
+// PublishOption is used to set an option
+type PublishOption func(*PublishOptions)
+
+// PublishWithEOL sets the time at which the record stops being valid
+func PublishWithEOL(eol time.Time) PublishOption {
+	return func(o *PublishOptions) {
+		o.EOL = eol
+	}
+}
+
+// PublishWithTTL sets the amount of time the record may be cached for
+func PublishWithTTL(ttl time.Duration) PublishOption {
+	return func(o *PublishOptions) {
+		o.TTL = &ttl
+	}
+}
+
+// PublishWithSequence sets an explicit sequence number for the record. It
+// may not be lower than the sequence number of the previously published
+// record
+func PublishWithSequence(seq uint64) PublishOption {
+	return func(o *PublishOptions) {
+		o.Sequence = &seq
+	}
+}
+
+// PublishWithData attaches extra data to the record. The data is signed
+// along with the record and must be encodable as CBOR
+func PublishWithData(data map[string]interface{}) PublishOption {
+	return func(o *PublishOptions) {
+		o.Data = data
+	}
+}
+
+// ProcessPublishOptions converts an array of PublishOption into a
+// PublishOptions object
+func ProcessPublishOptions(opts []PublishOption) PublishOptions {
+	pubopts := DefaultPublishOpts()
+	for _, option := range opts {
+		option(&pubopts)
+	}
+	return pubopts
+}
@@ -40,6 +40,12 @@ type UnixfsAddSettings struct {
 	Events   chan<- interface{}
 	Silent   bool
 	Progress bool
+
+	Resume       string
+	ResumeOffset int64
+	Partial      bool
+
+	AppendTo cid.Cid
 }
 
 type UnixfsLsSettings struct {
@@ -74,6 +80,12 @@ func UnixfsAddOptions(opts ...UnixfsAddOption) (*UnixfsAddSettings, cid.Prefix,
 		Events:   nil,
 		Silent:   false,
 		Progress: false,
+
+		Resume:       "",
+		ResumeOffset: 0,
+		Partial:      false,
+
+		AppendTo: cid.Undef,
 	}
 
 	for _, opt := range opts {
@@ -94,6 +106,19 @@ func UnixfsAddOptions(opts ...UnixfsAddOption) (*UnixfsAddSettings, cid.Prefix,
 		options.RawLeaves = true
 	}
 
+	// partial -> resume
+	if (options.Partial || options.ResumeOffset != 0) && options.Resume == "" {
+		return nil, cid.Prefix{}, errors.New("partial adds require an upload ID to resume")
+	}
+
+	// append -> single trickle file
+	if options.AppendTo.Defined() {
+		if options.Wrap || options.NoCopy || options.OnlyHash || options.Resume != "" {
+			return nil, cid.Prefix{}, errors.New("appending to a file cannot be combined with wrap, nocopy, only-hash or resume")
+		}
+		options.Layout = TrickleLayout
+	}
+
 	// (hash != "sha2-256") -> CIDv1
 	if options.MhType != mh.SHA2_256 {
 		switch options.CidVersion {
@@ -311,6 +336,51 @@ func (unixfsOpts) Nocopy(enable bool) UnixfsAddOption {
 	}
 }
 
+// Resume persists the progress of the add under the given upload ID, and
+// continues a previous add with the same ID where it stopped.
+//
+// Experimental
+func (unixfsOpts) Resume(id string) UnixfsAddOption {
+	return func(settings *UnixfsAddSettings) error {
+		settings.Resume = id
+		return nil
+	}
+}
+
+// ResumeOffset specifies the offset, in the file being resumed, at which the
+// given data starts. Data which was already added is skipped.
+//
+// Experimental
+func (unixfsOpts) ResumeOffset(offset int64) UnixfsAddOption {
+	return func(settings *UnixfsAddSettings) error {
+		settings.ResumeOffset = offset
+		return nil
+	}
+}
+
+// Partial tells the adder that the given data is only a part of a single
+// file. Its progress is saved for a subsequent add to continue, and no path
+// is returned: the add fails with ErrPartialAdd instead.
+//
+// Experimental
+func (unixfsOpts) Partial(partial bool) UnixfsAddOption {
+	return func(settings *UnixfsAddSettings) error {
+		settings.Partial = partial
+		return nil
+	}
+}
+
+// AppendTo appends the added data to the unixfs file with the given root
+// instead of adding a new file. The trickle layout is used.
+//
+// Experimental
+func (unixfsOpts) AppendTo(root cid.Cid) UnixfsAddOption {
+	return func(settings *UnixfsAddSettings) error {
+		settings.AppendTo = root
+		return nil
+	}
+}
+
 func (unixfsOpts) ResolveChildren(resolve bool) UnixfsLsOption {
 	return func(settings *UnixfsLsSettings) error {
 		settings.ResolveChildren = resolve
@@ -38,6 +38,7 @@ func (tp *provider) TestUnixfs(t *testing.T) {
 	t.Run("TestAdd", tp.TestAdd)
 	t.Run("TestAddPinned", tp.TestAddPinned)
 	t.Run("TestAddHashOnly", tp.TestAddHashOnly)
+	t.Run("TestAddPartial", tp.TestAddPartial)
 	t.Run("TestGetEmptyFile", tp.TestGetEmptyFile)
 	t.Run("TestGetDir", tp.TestGetDir)
 	t.Run("TestGetNonUnixfs", tp.TestGetNonUnixfs)
@@ -620,6 +621,37 @@ func (tp *provider) TestAddPinned(t *testing.T) {
 	}
 }
 
+func (tp *provider) TestAddPartial(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	api, err := tp.makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := strings.Repeat("partial add ", 100)
+	half := len(data) / 2
+	p, err := api.Unixfs().Add(ctx, strFile(data[:half])(), options.Unixfs.Resume("upload"), options.Unixfs.Partial(true))
+	if err != coreiface.ErrPartialAdd {
+		t.Fatalf("expected ErrPartialAdd, got %v", err)
+	}
+	if p != nil {
+		t.Fatalf("expected no path, got %s", p)
+	}
+
+	p, err = api.Unixfs().Add(ctx, strFile(data[half:])(), options.Unixfs.Resume("upload"), options.Unixfs.ResumeOffset(int64(half)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	whole, err := api.Unixfs().Add(ctx, strFile(data)(), options.Unixfs.HashOnly(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != whole.String() {
+		t.Errorf("expected the resumed add to produce %s, got %s", whole, p)
+	}
+}
+
 func (tp *provider) TestAddHashOnly(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
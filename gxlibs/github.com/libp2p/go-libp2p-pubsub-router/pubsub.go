@@ -25,6 +25,10 @@ import (
 
 var log = logging.Logger("pubsub-valuestore")
 
+// DefaultRebroadcastInterval is the default interval at which the latest
+// known records of the subscribed keys are published again.
+const DefaultRebroadcastInterval = 10 * time.Minute
+
 type watchGroup struct {
 	// Note: this chan must be buffered, see notifyWatchers
 	listeners map[chan []byte]struct{}
@@ -47,9 +51,24 @@ type PubsubValueStore struct {
 	watchLk  sync.Mutex
 	watching map[string]*watchGroup
 
+	rebroadcastInterval time.Duration
+
 	Validator record.Validator
 }
 
+// Option configures a PubsubValueStore.
+type Option func(*PubsubValueStore)
+
+// WithRebroadcastInterval sets the interval at which the latest known records
+// of the subscribed keys are published again, so peers joining a topic late
+// get the current value without waiting for the next update. A zero interval
+// disables rebroadcasting.
+func WithRebroadcastInterval(d time.Duration) Option {
+	return func(p *PubsubValueStore) {
+		p.rebroadcastInterval = d
+	}
+}
+
 // KeyToTopic converts a binary record key to a pubsub topic key.
 func KeyToTopic(key string) string {
 	// Record-store keys are arbitrary binary. However, pubsub requires UTF-8 string topic IDs.
@@ -60,8 +79,8 @@ func KeyToTopic(key string) string {
 // NewPubsubPublisher constructs a new Publisher that publishes IPNS records through pubsub.
 // The constructor interface is complicated by the need to bootstrap the pubsub topic.
 // This could be greatly simplified if the pubsub implementation handled bootstrap itself
-func NewPubsubValueStore(ctx context.Context, host p2phost.Host, cr routing.ContentRouting, ps *pubsub.PubSub, validator record.Validator) *PubsubValueStore {
-	return &PubsubValueStore{
+func NewPubsubValueStore(ctx context.Context, host p2phost.Host, cr routing.ContentRouting, ps *pubsub.PubSub, validator record.Validator, opts ...Option) *PubsubValueStore {
+	p := &PubsubValueStore{
 		ctx: ctx,
 
 		ds:   dssync.MutexWrap(ds.NewMapDatastore()),
@@ -72,8 +91,18 @@ func NewPubsubValueStore(ctx context.Context, host p2phost.Host, cr routing.Cont
 		subs:     make(map[string]*pubsub.Subscription),
 		watching: make(map[string]*watchGroup),
 
+		rebroadcastInterval: DefaultRebroadcastInterval,
+
 		Validator: validator,
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.rebroadcastInterval > 0 {
+		go p.rebroadcast()
+	}
+	return p
 }
 
 // Publish publishes an IPNS record through pubsub with default TTL
@@ -94,10 +123,50 @@ func (p *PubsubValueStore) PutValue(ctx context.Context, key string, value []byt
 		p.mx.Unlock()
 	}
 
+	// Keep the value around, so it can be rebroadcast.
+	if p.isBetter(key, value) {
+		if err := p.ds.Put(dshelp.NewKeyFromBinary([]byte(key)), value); err != nil {
+			log.Warningf("PubsubPublish: error storing value for %s: %s", key, err)
+		}
+	}
+
 	log.Debugf("PubsubPublish: publish value for key", key)
 	return p.ps.Publish(topic, value)
 }
 
+// rebroadcast periodically publishes the latest known valid record of every
+// key we have subscribed to or published to.
+func (p *PubsubValueStore) rebroadcast() {
+	ticker := time.NewTicker(p.rebroadcastInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.mx.Lock()
+			keys := make([]string, 0, len(p.subs))
+			for key := range p.subs {
+				keys = append(keys, key)
+			}
+			p.mx.Unlock()
+
+			for _, key := range keys {
+				val, err := p.getLocal(key)
+				if err != nil {
+					// Nothing (valid) to rebroadcast.
+					continue
+				}
+				log.Debugf("PubsubRebroadcast: rebroadcast value for key %s", key)
+				if err := p.ps.Publish(KeyToTopic(key), val); err != nil {
+					log.Warningf("PubsubRebroadcast: error publishing %s: %s", key, err)
+				}
+			}
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
 func (p *PubsubValueStore) isBetter(key string, val []byte) bool {
 	if p.Validator.Validate(key, val) != nil {
 		return false
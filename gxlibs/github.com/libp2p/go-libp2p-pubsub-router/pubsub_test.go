@@ -278,3 +278,37 @@ func checkValue(ctx context.Context, t *testing.T, i int, vs routing.ValueStore,
 		t.Fatalf("[ValueStore %d] unexpected value: expected '%s', got '%s'", i, val, xval)
 	}
 }
+
+func TestRebroadcast(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	key := "/namespace/key"
+	val := []byte("valid for key")
+
+	hosts := newNetHosts(ctx, t, 2)
+	vss := make([]*PubsubValueStore, len(hosts))
+	for i, h := range hosts {
+		fs, err := pubsub.NewFloodSub(ctx, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vss[i] = NewPubsubValueStore(ctx, h, rhelper.Null{}, fs, testValidator{},
+			WithRebroadcastInterval(100*time.Millisecond))
+	}
+
+	// Publish before anyone else has joined the topic.
+	if err := vss[0].PutValue(ctx, key, val); err != nil {
+		t.Fatal(err)
+	}
+
+	// The late joiner subscribes, then connects to the publisher.
+	checkNotFound(ctx, t, 1, vss[1], key)
+	pubinfo := hosts[0].Peerstore().PeerInfo(hosts[0].ID())
+	if err := hosts[1].Connect(ctx, pubinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Second * 1)
+	checkValue(ctx, t, 1, vss[1], key, val)
+}
@@ -1,47 +1,181 @@
 package namesys
 
 import (
+	"encoding/json"
+	"sort"
+	"strings"
 	"time"
 
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	query "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/query"
 	path "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-path"
+	base32 "github.com/ipsn/go-ipfs/gxlibs/github.com/whyrusleeping/base32"
 )
 
-func (ns *mpns) cacheGet(name string) (path.Path, bool) {
+// cacheGet returns the cached value of a name. Entries past their TTL are
+// returned as stale for up to the max staleness of the cache, so they can be
+// served while being revalidated.
+func (ns *mpns) cacheGet(name string) (val path.Path, stale bool, ok bool) {
 	if ns.cache == nil {
-		return "", false
+		return "", false, false
 	}
 
+	var entry cacheEntry
 	ientry, ok := ns.cache.Get(name)
-	if !ok {
-		return "", false
+	if ok {
+		entry, ok = ientry.(cacheEntry)
+		if !ok {
+			// should never happen, purely for sanity
+			log.Panicf("unexpected type %T in cache for %q.", ientry, name)
+		}
+	} else {
+		entry, ok = ns.cacheLoad(name)
+		if !ok {
+			return "", false, false
+		}
+		ns.cache.Add(name, entry)
 	}
 
-	entry, ok := ientry.(cacheEntry)
-	if !ok {
-		// should never happen, purely for sanity
-		log.Panicf("unexpected type %T in cache for %q.", ientry, name)
+	now := time.Now()
+	if now.Before(entry.eol) {
+		return entry.val, false, true
 	}
-
-	if time.Now().Before(entry.eol) {
-		return entry.val, true
+	if now.Before(entry.eol.Add(ns.maxStaleness)) {
+		return entry.val, true, true
 	}
 
+	// The persisted entry is deleted along with the evicted one.
 	ns.cache.Remove(name)
 
-	return "", false
+	return "", false, false
 }
 
 func (ns *mpns) cacheSet(name string, val path.Path, ttl time.Duration) {
 	if ns.cache == nil || ttl <= 0 {
 		return
 	}
-	ns.cache.Add(name, cacheEntry{
+	entry := cacheEntry{
 		val: val,
 		eol: time.Now().Add(ttl),
-	})
+	}
+	ns.cache.Add(name, entry)
+	ns.cacheStore(name, entry)
 }
 
 type cacheEntry struct {
 	val path.Path
 	eol time.Time
 }
+
+// persistedCacheEntry is the datastore representation of a cacheEntry.
+type persistedCacheEntry struct {
+	Value string
+	EOL   time.Time
+}
+
+const cachePrefix = "/ipns-cache/"
+
+func cacheDsKey(name string) ds.Key {
+	return ds.NewKey(cachePrefix + base32.RawStdEncoding.EncodeToString([]byte(name)))
+}
+
+// cacheEvicted deletes the persisted copy of the entries evicted from the
+// cache, so that the persisted cache doesn't outgrow it.
+func (ns *mpns) cacheEvicted(name, _ interface{}) {
+	ns.cacheDelete(name.(string))
+}
+
+// loadCache fills the cache with the persisted entries. The entries past
+// their max staleness are deleted, as are the ones expiring first when there
+// are more entries than the cache holds.
+func (ns *mpns) loadCache() {
+	res, err := ns.ds.Query(query.Query{Prefix: cachePrefix})
+	if err != nil {
+		log.Errorf("failed to load the persisted cache: %s", err)
+		return
+	}
+	results, err := res.Rest()
+	if err != nil {
+		log.Errorf("failed to load the persisted cache: %s", err)
+		return
+	}
+
+	type namedEntry struct {
+		name  string
+		entry cacheEntry
+	}
+	var entries []namedEntry
+	now := time.Now()
+	for _, r := range results {
+		name, err := base32.RawStdEncoding.DecodeString(strings.TrimPrefix(r.Key, cachePrefix))
+		if err != nil {
+			log.Errorf("invalid cached entry key %s", r.Key)
+			continue
+		}
+		entry, err := decodeCacheEntry(r.Value)
+		if err != nil || !now.Before(entry.eol.Add(ns.maxStaleness)) {
+			ns.cacheDelete(string(name))
+			continue
+		}
+		entries = append(entries, namedEntry{string(name), entry})
+	}
+
+	// Added last, the entries expiring last are the ones kept.
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].entry.eol.Before(entries[j].entry.eol)
+	})
+	for _, e := range entries {
+		ns.cache.Add(e.name, e.entry)
+	}
+}
+
+// cacheLoad looks up a name in the persistent cache, if enabled.
+func (ns *mpns) cacheLoad(name string) (cacheEntry, bool) {
+	if !ns.persistCache {
+		return cacheEntry{}, false
+	}
+	data, err := ns.ds.Get(cacheDsKey(name))
+	if err != nil {
+		if err != ds.ErrNotFound {
+			log.Errorf("failed to load cached entry for %s: %s", name, err)
+		}
+		return cacheEntry{}, false
+	}
+	entry, err := decodeCacheEntry(data)
+	if err != nil {
+		log.Errorf("invalid cached entry for %s: %s", name, err)
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+func decodeCacheEntry(data []byte) (cacheEntry, error) {
+	var pe persistedCacheEntry
+	if err := json.Unmarshal(data, &pe); err != nil {
+		return cacheEntry{}, err
+	}
+	return cacheEntry{val: path.Path(pe.Value), eol: pe.EOL}, nil
+}
+
+func (ns *mpns) cacheStore(name string, entry cacheEntry) {
+	if !ns.persistCache {
+		return
+	}
+	data, err := json.Marshal(persistedCacheEntry{Value: entry.val.String(), EOL: entry.eol})
+	if err != nil {
+		log.Errorf("failed to encode cached entry for %s: %s", name, err)
+		return
+	}
+	if err := ns.ds.Put(cacheDsKey(name), data); err != nil {
+		log.Errorf("failed to persist cached entry for %s: %s", name, err)
+	}
+}
+
+func (ns *mpns) cacheDelete(name string) {
+	if !ns.persistCache {
+		return
+	}
+	if err := ns.ds.Delete(cacheDsKey(name)); err != nil && err != ds.ErrNotFound {
+		log.Errorf("failed to delete cached entry for %s: %s", name, err)
+	}
+}
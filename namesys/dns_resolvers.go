@@ -0,0 +1,201 @@
+package namesys
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	isd "github.com/ipsn/go-ipfs/gxlibs/github.com/jbenet/go-is-domain"
+	dns "github.com/miekg/dns"
+)
+
+// dohMediaType is the media type of DNS-over-HTTPS queries and responses
+// (RFC 8484).
+const dohMediaType = "application/dns-message"
+
+// maxDoHResponseSize bounds the size of DNS-over-HTTPS responses.
+const maxDoHResponseSize = 64 * 1024
+
+// lookupTXTWithTTLFunc looks up the TXT records of a name, along with the
+// time they may be cached for.
+type lookupTXTWithTTLFunc func(ctx context.Context, name string) (txt []string, ttl time.Duration, err error)
+
+// suffixResolver looks up the names under a domain suffix.
+type suffixResolver struct {
+	suffix string
+	lookup lookupTXTWithTTLFunc
+}
+
+// NewDNSResolverWithResolvers constructs a name resolver using DNS TXT
+// records, which looks up the names under the given domain suffixes with
+// specific resolvers. Resolvers are either DNS-over-HTTPS URLs, such as
+// "https://cloudflare-dns.com/dns-query" (plain http URLs are accepted for
+// local resolvers), or the addresses of plain DNS
+// servers, such as "192.168.1.1" or "192.168.1.1:5353". The most specific
+// suffix matching a name wins, "." matches all the names. Names matching no
+// suffix are looked up with the system resolver.
+func NewDNSResolverWithResolvers(resolvers map[string]string) (*DNSResolver, error) {
+	r := NewDNSResolver()
+	for suffix, addr := range resolvers {
+		lookup, err := newLookupTXTWithTTL(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resolver for %q: %s", suffix, err)
+		}
+		r.resolvers = append(r.resolvers, suffixResolver{
+			suffix: dns.Fqdn(strings.ToLower(suffix)),
+			lookup: lookup,
+		})
+	}
+	sort.Slice(r.resolvers, func(i, j int) bool {
+		return len(r.resolvers[i].suffix) > len(r.resolvers[j].suffix)
+	})
+	return r, nil
+}
+
+func newLookupTXTWithTTL(addr string) (lookupTXTWithTTLFunc, error) {
+	switch {
+	case strings.HasPrefix(addr, "https://"), strings.HasPrefix(addr, "http://"):
+		return dohLookupTXT(addr), nil
+	case strings.Contains(addr, "://"):
+		return nil, fmt.Errorf("unsupported resolver URL %q", addr)
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), "53")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, err
+	}
+	return serverLookupTXT(addr), nil
+}
+
+// IsDomain returns whether the given name is a domain name, either under a
+// known TLD or under one of the domain suffixes with a specific resolver.
+func (r *DNSResolver) IsDomain(name string) bool {
+	if isd.IsDomain(name) {
+		return true
+	}
+	name = dns.Fqdn(strings.ToLower(name))
+	if _, ok := dns.IsDomainName(name); !ok || dns.CountLabel(name) < 2 {
+		return false
+	}
+	for _, sr := range r.resolvers {
+		if sr.suffix != "." && strings.HasSuffix(name, "."+sr.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup looks up the TXT records of a fully qualified name with the resolver
+// of its domain suffix, if any.
+func (r *DNSResolver) lookup(ctx context.Context, fqdn string) ([]string, time.Duration, error) {
+	name := strings.ToLower(fqdn)
+	for _, sr := range r.resolvers {
+		if sr.suffix == "." || name == sr.suffix || strings.HasSuffix(name, "."+sr.suffix) {
+			return sr.lookup(ctx, fqdn)
+		}
+	}
+
+	// The system resolver doesn't tell the TTL of the records.
+	txt, err := r.lookupTXT(fqdn)
+	return txt, 0, err
+}
+
+func txtQuery(name string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), dns.TypeTXT)
+	m.RecursionDesired = true
+	return m
+}
+
+// txtAnswers returns the TXT records of a response and the lowest of their
+// TTLs.
+func txtAnswers(name string, resp *dns.Msg) ([]string, time.Duration, error) {
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, 0, fmt.Errorf("lookup %s: %s", name, dns.RcodeToString[resp.Rcode])
+	}
+
+	var txts []string
+	var ttl uint32
+	for _, rr := range resp.Answer {
+		txt, ok := rr.(*dns.TXT)
+		if !ok {
+			continue
+		}
+		if len(txts) == 0 || txt.Hdr.Ttl < ttl {
+			ttl = txt.Hdr.Ttl
+		}
+		txts = append(txts, strings.Join(txt.Txt, ""))
+	}
+	if len(txts) == 0 {
+		return nil, 0, fmt.Errorf("lookup %s: no TXT records", name)
+	}
+	return txts, time.Duration(ttl) * time.Second, nil
+}
+
+// serverLookupTXT looks up TXT records with a plain DNS server.
+func serverLookupTXT(addr string) lookupTXTWithTTLFunc {
+	return func(ctx context.Context, name string) ([]string, time.Duration, error) {
+		client := new(dns.Client)
+		resp, _, err := client.ExchangeContext(ctx, txtQuery(name), addr)
+		if err != nil {
+			return nil, 0, err
+		}
+		if resp.Truncated {
+			client.Net = "tcp"
+			resp, _, err = client.ExchangeContext(ctx, txtQuery(name), addr)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return txtAnswers(name, resp)
+	}
+}
+
+// dohLookupTXT looks up TXT records with a DNS-over-HTTPS server.
+func dohLookupTXT(url string) lookupTXTWithTTLFunc {
+	return func(ctx context.Context, name string) ([]string, time.Duration, error) {
+		q := txtQuery(name)
+		// RFC 8484 recommends a zero ID to maximize HTTP cache hits.
+		q.Id = 0
+		wire, err := q.Pack()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		req, err := http.NewRequest("POST", url, bytes.NewReader(wire))
+		if err != nil {
+			return nil, 0, err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", dohMediaType)
+		req.Header.Set("Accept", dohMediaType)
+
+		httpResp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer httpResp.Body.Close()
+		if httpResp.StatusCode != http.StatusOK {
+			return nil, 0, fmt.Errorf("lookup %s: DNS-over-HTTPS server returned %s", name, httpResp.Status)
+		}
+
+		body, err := ioutil.ReadAll(&io.LimitedReader{R: httpResp.Body, N: maxDoHResponseSize})
+		if err != nil {
+			return nil, 0, err
+		}
+		resp := new(dns.Msg)
+		if err := resp.Unpack(body); err != nil {
+			return nil, 0, fmt.Errorf("lookup %s: invalid DNS-over-HTTPS response: %s", name, err)
+		}
+		return txtAnswers(name, resp)
+	}
+}
@@ -0,0 +1,115 @@
+package namesys
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	opts "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/interface-go-ipfs-core/options/namesys"
+	dns "github.com/miekg/dns"
+)
+
+// txtHandler answers TXT queries from a map of names to dnslink values.
+func txtHandler(records map[string]string, ttl uint32) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, q *dns.Msg) {
+		w.WriteMsg(txtReply(q, records, ttl))
+	}
+}
+
+func txtReply(q *dns.Msg, records map[string]string, ttl uint32) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(q)
+	name := q.Question[0].Name
+	val, ok := records[name]
+	if !ok {
+		m.Rcode = dns.RcodeNameError
+		return m
+	}
+	m.Answer = append(m.Answer, &dns.TXT{
+		Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: ttl},
+		Txt: []string{val},
+	})
+	return m
+}
+
+func TestDNSResolvers(t *testing.T) {
+	// A plain DNS server for .internal names.
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{
+		PacketConn: pc,
+		Handler: txtHandler(map[string]string{
+			"_dnslink.docs.internal.": "dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD",
+		}, 300),
+	}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	// A DNS-over-HTTPS server for .eth names.
+	doh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != dohMediaType {
+			http.Error(w, "bad content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		q := new(dns.Msg)
+		if err := q.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		wire, _ := txtReply(q, map[string]string{
+			"_dnslink.vitalik.eth.": "dnslink=/ipfs/QmYvMB9yrsSf7RKBghkfwmHJkzJhW2ZgVwq3LxBXXPasFr",
+		}, 60).Pack()
+		w.Header().Set("Content-Type", dohMediaType)
+		w.Write(wire)
+	}))
+	defer doh.Close()
+
+	r, err := NewDNSResolverWithResolvers(map[string]string{
+		"internal": pc.LocalAddr().String(),
+		"eth.":     doh.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.lookupTXT = func(name string) ([]string, error) {
+		t.Errorf("unexpected system lookup of %s", name)
+		return nil, nil
+	}
+
+	if !r.IsDomain("docs.internal") || r.IsDomain("docs.unknowntld") {
+		t.Fatal("expected names under configured suffixes to be domains")
+	}
+	testDNSTTL(t, r, "docs.internal", "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", 300*time.Second)
+	testDNSTTL(t, r, "vitalik.eth", "/ipfs/QmYvMB9yrsSf7RKBghkfwmHJkzJhW2ZgVwq3LxBXXPasFr", time.Minute)
+
+	if _, err := NewDNSResolverWithResolvers(map[string]string{"eth.": "tls://1.1.1.1"}); err == nil {
+		t.Fatal("expected unsupported resolver URL to be rejected")
+	}
+}
+
+func testDNSTTL(t *testing.T, r *DNSResolver, name, expected string, ttl time.Duration) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var found bool
+	for res := range r.resolveOnceAsync(ctx, name, opts.DefaultResolveOpts()) {
+		if res.err != nil {
+			continue
+		}
+		if res.value.String() != expected || res.ttl != ttl {
+			t.Fatalf("%s resolved to %s with ttl %s, expected %s with ttl %s", name, res.value, res.ttl, expected, ttl)
+		}
+		found = true
+	}
+	if !found {
+		t.Fatalf("failed to resolve %s", name)
+	}
+}
@@ -98,7 +98,7 @@ type Publisher interface {
 
 	// Publish establishes a name-value mapping.
 	// TODO make this not PrivKey specific.
-	Publish(ctx context.Context, name ci.PrivKey, value path.Path) error
+	Publish(ctx context.Context, name ci.PrivKey, value path.Path, options ...opts.PublishOption) error
 
 	// TODO: to be replaced by a more generic 'PublishWithValidity' type
 	// call once the records spec is implemented
@@ -3,6 +3,7 @@ package namesys
 import (
 	"context"
 	"strings"
+	"sync"
 	"time"
 
 	lru "github.com/hashicorp/golang-lru"
@@ -29,27 +30,73 @@ type mpns struct {
 	dnsResolver, proquintResolver, ipnsResolver resolver
 	ipnsPublisher                               Publisher
 
-	cache *lru.Cache
+	cache        *lru.Cache
+	ds           ds.Datastore
+	persistCache bool
+	maxStaleness time.Duration
+
+	revalidatingMu sync.Mutex
+	revalidating   map[string]struct{}
 }
 
-// NewNameSystem will construct the IPFS naming system based on Routing
-func NewNameSystem(r routing.ValueStore, ds ds.Datastore, cachesize int) NameSystem {
-	var cache *lru.Cache
-	if cachesize > 0 {
-		cache, _ = lru.New(cachesize)
+// Option configures the cache of a name system.
+type Option func(*mpns)
+
+// PersistCache stores the resolution cache in the datastore, so it survives
+// restarts. It has no effect when the cache is disabled.
+func PersistCache() Option {
+	return func(ns *mpns) {
+		ns.persistCache = true
 	}
+}
 
-	return &mpns{
+// MaxCacheStaleness sets how long past their TTL cached entries may still be
+// returned, to resolvers accepting stale entries, while they are revalidated
+// in the background.
+func MaxCacheStaleness(d time.Duration) Option {
+	return func(ns *mpns) {
+		ns.maxStaleness = d
+	}
+}
+
+// DNSResolvers sets the DNS resolver used to resolve DNSLink names.
+func DNSResolvers(r *DNSResolver) Option {
+	return func(ns *mpns) {
+		ns.dnsResolver = r
+	}
+}
+
+// NewNameSystem will construct the IPFS naming system based on Routing
+func NewNameSystem(r routing.ValueStore, ds ds.Datastore, cachesize int, options ...Option) NameSystem {
+	ns := &mpns{
 		dnsResolver:      NewDNSResolver(),
 		proquintResolver: new(ProquintResolver),
 		ipnsResolver:     NewIpnsResolver(r),
 		ipnsPublisher:    NewIpnsPublisher(r, ds),
-		cache:            cache,
+		ds:               ds,
+		revalidating:     make(map[string]struct{}),
+	}
+	for _, option := range options {
+		option(ns)
 	}
+
+	if cachesize > 0 {
+		if ns.persistCache {
+			ns.cache, _ = lru.NewWithEvict(cachesize, ns.cacheEvicted)
+			ns.loadCache()
+		} else {
+			ns.cache, _ = lru.New(cachesize)
+		}
+	}
+	return ns
 }
 
 const DefaultResolverCacheTTL = time.Minute
 
+// RevalidationTimeout bounds the background resolution of stale cache
+// entries.
+var RevalidationTimeout = time.Minute
+
 // Resolve implements Resolver.
 func (ns *mpns) Resolve(ctx context.Context, name string, options ...opts.ResolveOpt) (path.Path, error) {
 	if strings.HasPrefix(name, "/ipfs/") {
@@ -97,7 +144,12 @@ func (ns *mpns) resolveOnceAsync(ctx context.Context, name string, options opts.
 
 	key := segments[2]
 
-	if p, ok := ns.cacheGet(key); ok {
+	res := ns.resolverFor(key)
+
+	if p, stale, ok := ns.cacheGet(key); ok && (!stale || options.StaleOK) {
+		if stale {
+			ns.revalidate(res, key, options)
+		}
 		if len(segments) > 3 {
 			var err error
 			p, err = path.FromSegments("", strings.TrimRight(p.String(), "/"), segments[3])
@@ -111,20 +163,6 @@ func (ns *mpns) resolveOnceAsync(ctx context.Context, name string, options opts.
 		return out
 	}
 
-	// Resolver selection:
-	// 1. if it is a multihash resolve through "ipns".
-	// 2. if it is a domain name, resolve through "dns"
-	// 3. otherwise resolve through the "proquint" resolver
-
-	var res resolver
-	if _, err := mh.FromB58String(key); err == nil {
-		res = ns.ipnsResolver
-	} else if isd.IsDomain(key) {
-		res = ns.dnsResolver
-	} else {
-		res = ns.proquintResolver
-	}
-
 	resCh := res.resolveOnceAsync(ctx, key, options)
 	var best onceResult
 	go func() {
@@ -162,6 +200,61 @@ func (ns *mpns) resolveOnceAsync(ctx context.Context, name string, options opts.
 	return out
 }
 
+// resolverFor selects the resolver of a name:
+// 1. if it is a multihash resolve through "ipns".
+// 2. if it is a domain name, resolve through "dns"
+// 3. otherwise resolve through the "proquint" resolver
+func (ns *mpns) resolverFor(key string) resolver {
+	if _, err := mh.FromB58String(key); err == nil {
+		return ns.ipnsResolver
+	} else if ns.isDomain(key) {
+		return ns.dnsResolver
+	}
+	return ns.proquintResolver
+}
+
+// isDomain returns whether the name is resolved through DNS.
+func (ns *mpns) isDomain(key string) bool {
+	if r, ok := ns.dnsResolver.(*DNSResolver); ok {
+		return r.IsDomain(key)
+	}
+	return isd.IsDomain(key)
+}
+
+// revalidate refreshes the cached entry of a name in the background. Only one
+// revalidation runs at a time for a given name.
+func (ns *mpns) revalidate(res resolver, key string, options opts.ResolveOpts) {
+	ns.revalidatingMu.Lock()
+	defer ns.revalidatingMu.Unlock()
+	if _, ok := ns.revalidating[key]; ok {
+		return
+	}
+	ns.revalidating[key] = struct{}{}
+
+	go func() {
+		defer func() {
+			ns.revalidatingMu.Lock()
+			delete(ns.revalidating, key)
+			ns.revalidatingMu.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), RevalidationTimeout)
+		defer cancel()
+
+		var best onceResult
+		for r := range res.resolveOnceAsync(ctx, key, options) {
+			if r.err == nil {
+				best = r
+			}
+		}
+		if best == (onceResult{}) {
+			log.Debugf("failed to revalidate cached entry for %s", key)
+			return
+		}
+		ns.cacheSet(key, best.value, best.ttl)
+	}()
+}
+
 func emitOnceResult(ctx context.Context, outCh chan<- onceResult, r onceResult) {
 	select {
 	case outCh <- r:
@@ -170,22 +263,28 @@ func emitOnceResult(ctx context.Context, outCh chan<- onceResult, r onceResult)
 }
 
 // Publish implements Publisher
-func (ns *mpns) Publish(ctx context.Context, name ci.PrivKey, value path.Path) error {
-	return ns.PublishWithEOL(ctx, name, value, time.Now().Add(DefaultRecordEOL))
-}
-
-func (ns *mpns) PublishWithEOL(ctx context.Context, name ci.PrivKey, value path.Path, eol time.Time) error {
+func (ns *mpns) Publish(ctx context.Context, name ci.PrivKey, value path.Path, options ...opts.PublishOption) error {
 	id, err := peer.IDFromPrivateKey(name)
 	if err != nil {
 		return err
 	}
-	if err := ns.ipnsPublisher.PublishWithEOL(ctx, name, value, eol); err != nil {
+	if err := ns.ipnsPublisher.Publish(ctx, name, value, options...); err != nil {
 		return err
 	}
+
+	// Cache the value for as long as resolvers of the record would.
+	pubopts := opts.ProcessPublishOptions(options)
 	ttl := DefaultResolverCacheTTL
-	if ttEol := eol.Sub(time.Now()); ttEol < ttl {
+	if pubopts.TTL != nil {
+		ttl = *pubopts.TTL
+	}
+	if ttEol := pubopts.EOL.Sub(time.Now()); ttEol < ttl {
 		ttl = ttEol
 	}
 	ns.cacheSet(peer.IDB58Encode(id), value, ttl)
 	return nil
 }
+
+func (ns *mpns) PublishWithEOL(ctx context.Context, name ci.PrivKey, value path.Path, eol time.Time) error {
+	return ns.Publish(ctx, name, value, opts.PublishWithEOL(eol))
+}
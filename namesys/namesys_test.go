@@ -3,9 +3,12 @@ package namesys
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	query "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/query"
 	dssync "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/sync"
 	offroute "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-routing/offline"
 	ipns "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipns"
@@ -106,3 +109,175 @@ func TestPublishWithCache0(t *testing.T) {
 	}
 	nsys.Publish(context.Background(), priv, p)
 }
+
+func TestPublishWithOptions(t *testing.T) {
+	dst := dssync.MutexWrap(ds.NewMapDatastore())
+	priv, _, err := ci.GenerateKeyPair(ci.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := pstoremem.NewPeerstore()
+	pid, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ps.AddPrivKey(pid, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routing := offroute.NewOfflineRouter(dst, ipns.Validator{KeyBook: ps})
+	nsys := NewNameSystem(routing, dst, 128).(*mpns)
+	publisher := nsys.ipnsPublisher.(*IpnsPublisher)
+
+	ctx := context.Background()
+	p := path.FromString("/ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy")
+	err = nsys.Publish(ctx, priv, p,
+		opts.PublishWithTTL(time.Hour),
+		opts.PublishWithSequence(10),
+		opts.PublishWithData(map[string]interface{}{"comment": "hello"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := publisher.GetPublished(ctx, pid, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.GetSequence() != 10 {
+		t.Fatalf("expected sequence 10, got %d", entry.GetSequence())
+	}
+	if entry.GetTtl() != uint64(time.Hour) {
+		t.Fatalf("expected a ttl of 1h, got %d", entry.GetTtl())
+	}
+	if err := ipns.Validate(priv.GetPublic(), entry); err != nil {
+		t.Fatal(err)
+	}
+	extra, err := ipns.GetExtraData(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extra["comment"] != "hello" {
+		t.Fatalf("unexpected extra data: %v", extra)
+	}
+
+	// The cache honors the ttl of the record rather than the default one.
+	ientry, ok := nsys.cache.Get(peer.IDB58Encode(pid))
+	if !ok {
+		t.Fatal("expected published value to be cached")
+	}
+	if eol := ientry.(cacheEntry).eol; time.Until(eol) <= DefaultResolverCacheTTL {
+		t.Fatalf("expected cache entry to live for the record ttl, expires in %s", time.Until(eol))
+	}
+
+	// The sequence number may not go backwards.
+	err = nsys.Publish(ctx, priv, p, opts.PublishWithSequence(9))
+	if err == nil {
+		t.Fatal("expected publishing with a lower sequence number to fail")
+	}
+}
+
+type ttlResolver struct {
+	value path.Path
+	ttl   time.Duration
+	calls int32
+}
+
+func (r *ttlResolver) resolveOnceAsync(ctx context.Context, name string, options opts.ResolveOpts) <-chan onceResult {
+	atomic.AddInt32(&r.calls, 1)
+	out := make(chan onceResult, 1)
+	out <- onceResult{value: r.value, ttl: r.ttl}
+	close(out)
+	return out
+}
+
+func TestPersistentStaleCache(t *testing.T) {
+	dst := dssync.MutexWrap(ds.NewMapDatastore())
+	routing := offroute.NewOfflineRouter(dst, ipns.Validator{})
+	name := "/ipns/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy"
+	oldVal := path.FromString("/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj")
+	newVal := path.FromString("/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD")
+
+	first := NewNameSystem(routing, dst, 16, PersistCache(), MaxCacheStaleness(time.Hour)).(*mpns)
+	first.ipnsResolver = &ttlResolver{value: oldVal, ttl: 10 * time.Millisecond}
+	testResolution(t, first, name, opts.DefaultDepthLimit, oldVal.String(), nil)
+
+	// A new name system, as after a restart, finds the entry in the
+	// datastore once it has gone stale.
+	time.Sleep(20 * time.Millisecond)
+	res := &ttlResolver{value: newVal, ttl: time.Hour}
+	second := NewNameSystem(routing, dst, 16, PersistCache(), MaxCacheStaleness(time.Hour)).(*mpns)
+	second.ipnsResolver = res
+
+	p, err := second.Resolve(context.Background(), name, opts.StaleOK(false))
+	if err != nil || p != newVal {
+		t.Fatalf("expected a fresh resolution without stale entries, got %s, %v", p, err)
+	}
+
+	if _, err := dst.Get(cacheDsKey("QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy")); err != nil {
+		t.Fatal(err)
+	}
+	// Make the persisted entry stale again.
+	second.cacheStore("QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy", cacheEntry{val: oldVal, eol: time.Now().Add(-time.Minute)})
+	third := NewNameSystem(routing, dst, 16, PersistCache(), MaxCacheStaleness(time.Hour)).(*mpns)
+	third.ipnsResolver = res
+	calls := atomic.LoadInt32(&res.calls)
+
+	p, err = third.Resolve(context.Background(), name)
+	if err != nil || p != oldVal {
+		t.Fatalf("expected the stale entry, got %s, %v", p, err)
+	}
+
+	// The entry gets revalidated in the background.
+	for i := 0; i < 100; i++ {
+		if p, _, _ := third.cacheGet("QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy"); p == newVal {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&res.calls) != calls+1 {
+		t.Fatal("expected the stale entry to be revalidated once")
+	}
+	testResolution(t, third, name, opts.DefaultDepthLimit, newVal.String(), nil)
+}
+
+func TestPersistentCachePruning(t *testing.T) {
+	dst := dssync.MutexWrap(ds.NewMapDatastore())
+	routing := offroute.NewOfflineRouter(dst, ipns.Validator{})
+	val := path.FromString("/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj")
+
+	first := NewNameSystem(routing, dst, 4, PersistCache()).(*mpns)
+	for i := 0; i < 8; i++ {
+		first.cacheSet(fmt.Sprintf("name%d", i), val, time.Duration(i+1)*time.Hour)
+	}
+	// An entry past its TTL, and past the max staleness of the next cache.
+	first.cacheStore("expired", cacheEntry{val: val, eol: time.Now().Add(-time.Minute)})
+
+	countPersisted := func() int {
+		res, err := dst.Query(query.Query{Prefix: "/ipns-cache/", KeysOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := res.Rest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(entries)
+	}
+	// Evicted entries are deleted from the datastore.
+	if n := countPersisted(); n != 5 {
+		t.Fatalf("expected 4 entries and the expired one to be persisted, got %d", n)
+	}
+
+	// Loading the cache drops the expired entries, and the ones expiring
+	// first beyond the size of the cache.
+	second := NewNameSystem(routing, dst, 2, PersistCache()).(*mpns)
+	if n := countPersisted(); n != 2 {
+		t.Fatalf("expected 2 persisted entries, got %d", n)
+	}
+	for _, name := range []string{"name6", "name7"} {
+		if _, _, ok := second.cacheGet(name); !ok {
+			t.Errorf("expected %s to be cached", name)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package namesys
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"sync"
 	"time"
@@ -15,6 +16,7 @@ import (
 	pb "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipns/pb"
 	path "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-path"
 	ft "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-unixfs"
+	opts "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/interface-go-ipfs-core/options/namesys"
 	ci "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peer"
 	routing "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-routing"
@@ -46,9 +48,14 @@ func NewIpnsPublisher(route routing.ValueStore, ds ds.Datastore) *IpnsPublisher
 
 // Publish implements Publisher. Accepts a keypair and a value,
 // and publishes it out to the routing system
-func (p *IpnsPublisher) Publish(ctx context.Context, k ci.PrivKey, value path.Path) error {
+func (p *IpnsPublisher) Publish(ctx context.Context, k ci.PrivKey, value path.Path, options ...opts.PublishOption) error {
 	log.Debugf("Publish %s", value)
-	return p.PublishWithEOL(ctx, k, value, time.Now().Add(DefaultRecordEOL))
+	record, err := p.updateRecord(ctx, k, value, opts.ProcessPublishOptions(options))
+	if err != nil {
+		return err
+	}
+
+	return PutRecordToRouting(ctx, p.routing, k.GetPublic(), record)
 }
 
 func IpnsDsKey(id peer.ID) ds.Key {
@@ -139,7 +146,7 @@ func (p *IpnsPublisher) GetPublished(ctx context.Context, id peer.ID, checkRouti
 	return e, nil
 }
 
-func (p *IpnsPublisher) updateRecord(ctx context.Context, k ci.PrivKey, value path.Path, eol time.Time) (*pb.IpnsEntry, error) {
+func (p *IpnsPublisher) updateRecord(ctx context.Context, k ci.PrivKey, value path.Path, options opts.PublishOptions) (*pb.IpnsEntry, error) {
 	id, err := peer.IDFromPrivateKey(k)
 	if err != nil {
 		return nil, err
@@ -155,25 +162,24 @@ func (p *IpnsPublisher) updateRecord(ctx context.Context, k ci.PrivKey, value pa
 	}
 
 	seqno := rec.GetSequence() // returns 0 if rec is nil
-	if rec != nil && value != path.Path(rec.GetValue()) {
+	switch {
+	case options.Sequence != nil:
+		if *options.Sequence < seqno {
+			return nil, fmt.Errorf("sequence number %d is lower than the one of the last published record (%d)", *options.Sequence, seqno)
+		}
+		seqno = *options.Sequence
+	case rec != nil && value != path.Path(rec.GetValue()):
 		// Don't bother incrementing the sequence number unless the
 		// value changes.
 		seqno++
 	}
 
 	// Create record
-	entry, err := ipns.Create(k, []byte(value), seqno, eol)
+	entry, err := ipns.CreateWithData(k, []byte(value), seqno, options.EOL, options.TTL, options.Data)
 	if err != nil {
 		return nil, err
 	}
 
-	// Set the TTL
-	// TODO: Make this less hacky.
-	ttl, ok := checkCtxTTL(ctx)
-	if ok {
-		entry.Ttl = proto.Uint64(uint64(ttl.Nanoseconds()))
-	}
-
 	data, err := proto.Marshal(entry)
 	if err != nil {
 		return nil, err
@@ -189,25 +195,7 @@ func (p *IpnsPublisher) updateRecord(ctx context.Context, k ci.PrivKey, value pa
 // PublishWithEOL is a temporary stand in for the ipns records implementation
 // see here for more details: https://github.com/ipfs/specs/tree/master/records
 func (p *IpnsPublisher) PublishWithEOL(ctx context.Context, k ci.PrivKey, value path.Path, eol time.Time) error {
-	record, err := p.updateRecord(ctx, k, value, eol)
-	if err != nil {
-		return err
-	}
-
-	return PutRecordToRouting(ctx, p.routing, k.GetPublic(), record)
-}
-
-// setting the TTL on published records is an experimental feature.
-// as such, i'm using the context to wire it through to avoid changing too
-// much code along the way.
-func checkCtxTTL(ctx context.Context) (time.Duration, bool) {
-	v := ctx.Value("ipns-publish-ttl")
-	if v == nil {
-		return 0, false
-	}
-
-	d, ok := v.(time.Duration)
-	return d, ok
+	return p.Publish(ctx, k, value, opts.PublishWithEOL(eol))
 }
 
 func PutRecordToRouting(ctx context.Context, r routing.ValueStore, k ci.PubKey, entry *pb.IpnsEntry) error {
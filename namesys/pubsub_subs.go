@@ -0,0 +1,67 @@
+package namesys
+
+import (
+	"context"
+	"strings"
+
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	dsquery "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/query"
+	peer "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peer"
+	base32 "github.com/ipsn/go-ipfs/gxlibs/github.com/whyrusleeping/base32"
+)
+
+const pubsubSubsPrefix = "/ipns-pubsub-subs/"
+
+func pubsubSubDsKey(id peer.ID) ds.Key {
+	return ds.NewKey(pubsubSubsPrefix + base32.RawStdEncoding.EncodeToString([]byte(id)))
+}
+
+// AddPubsubSubscription records a name the IPNS pubsub router should stay
+// subscribed to, so the subscription can be restored when the node restarts.
+func AddPubsubSubscription(d ds.Datastore, id peer.ID) error {
+	return d.Put(pubsubSubDsKey(id), []byte{})
+}
+
+// RemovePubsubSubscription removes a name from the persisted subscriptions.
+// It returns whether the name was there.
+func RemovePubsubSubscription(d ds.Datastore, id peer.ID) (bool, error) {
+	has, err := d.Has(pubsubSubDsKey(id))
+	if err != nil || !has {
+		return false, err
+	}
+	return true, d.Delete(pubsubSubDsKey(id))
+}
+
+// PubsubSubscriptions returns the names of the persisted IPNS pubsub
+// subscriptions.
+func PubsubSubscriptions(ctx context.Context, d ds.Datastore) ([]peer.ID, error) {
+	query, err := d.Query(dsquery.Query{
+		Prefix:   pubsubSubsPrefix,
+		KeysOnly: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer query.Close()
+
+	var ids []peer.ID
+	for {
+		select {
+		case result, ok := <-query.Next():
+			if !ok {
+				return ids, nil
+			}
+			if result.Error != nil {
+				return nil, result.Error
+			}
+			pid, err := base32.RawStdEncoding.DecodeString(strings.TrimPrefix(result.Key, pubsubSubsPrefix))
+			if err != nil {
+				log.Errorf("pubsub subscription ds key invalid: %s", result.Key)
+				continue
+			}
+			ids = append(ids, peer.ID(pid))
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
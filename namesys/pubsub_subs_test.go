@@ -0,0 +1,47 @@
+package namesys
+
+import (
+	"context"
+	"testing"
+
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	dssync "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/sync"
+	testutil "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-testutil"
+)
+
+func TestPubsubSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+
+	id, err := testutil.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AddPubsubSubscription(d, id); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := PubsubSubscriptions(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != id {
+		t.Fatalf("expected the subscription to be persisted, got %v", ids)
+	}
+
+	removed, err := RemovePubsubSubscription(d, id)
+	if err != nil || !removed {
+		t.Fatalf("expected the subscription to be removed: %v", err)
+	}
+	removed, err = RemovePubsubSubscription(d, id)
+	if err != nil || removed {
+		t.Fatalf("expected nothing to remove: %v", err)
+	}
+	ids, err = PubsubSubscriptions(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Fatalf("expected no subscriptions, got %v", ids)
+	}
+}
@@ -0,0 +1,198 @@
+package republisher
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	proto "github.com/gogo/protobuf/proto"
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	dsquery "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/query"
+	ipns "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipns"
+	pb "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipns/pb"
+	peer "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peer"
+	base32 "github.com/ipsn/go-ipfs/gxlibs/github.com/whyrusleeping/base32"
+)
+
+// ErrNotFollowed is returned when unfollowing a name that isn't followed.
+var ErrNotFollowed = errors.New("name is not followed")
+
+// ErrNoValidRecord is returned when no valid record is known for a followed
+// name.
+var ErrNoValidRecord = errors.New("no valid record found for followed name")
+
+const followPrefix = "/ipns-follow/"
+
+// followLock serializes the changes to the keepalive list with the updates of
+// the records stored in it, so that a record fetched while its name is being
+// unfollowed isn't stored again.
+var followLock sync.Mutex
+
+// FollowDsKey returns the datastore key under which the latest record of a
+// followed name is stored.
+func FollowDsKey(id peer.ID) ds.Key {
+	return ds.NewKey(followPrefix + base32.RawStdEncoding.EncodeToString([]byte(id)))
+}
+
+// Follow adds a third-party name to the keepalive list. The republisher
+// fetches the latest valid record of followed names and puts it back to the
+// routing system on every republish, without needing their private keys.
+//
+// Following a name that's already followed is a no-op.
+func Follow(d ds.Datastore, id peer.ID) error {
+	followLock.Lock()
+	defer followLock.Unlock()
+
+	has, err := d.Has(FollowDsKey(id))
+	if err != nil || has {
+		return err
+	}
+	// The record is fetched on the next republish.
+	return d.Put(FollowDsKey(id), []byte{})
+}
+
+// Unfollow removes a name from the keepalive list, along with its stored
+// record.
+func Unfollow(d ds.Datastore, id peer.ID) error {
+	followLock.Lock()
+	defer followLock.Unlock()
+
+	has, err := d.Has(FollowDsKey(id))
+	if err != nil {
+		return err
+	}
+	if !has {
+		return ErrNotFollowed
+	}
+	return d.Delete(FollowDsKey(id))
+}
+
+// ListFollowed returns the followed names along with the latest record stored
+// for each of them, nil if none has been fetched yet.
+func ListFollowed(ctx context.Context, d ds.Datastore) (map[peer.ID]*pb.IpnsEntry, error) {
+	query, err := d.Query(dsquery.Query{
+		Prefix: followPrefix,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer query.Close()
+
+	followed := make(map[peer.ID]*pb.IpnsEntry)
+	for {
+		select {
+		case result, ok := <-query.Next():
+			if !ok {
+				return followed, nil
+			}
+			if result.Error != nil {
+				return nil, result.Error
+			}
+			pid, err := base32.RawStdEncoding.DecodeString(strings.TrimPrefix(result.Key, followPrefix))
+			if err != nil {
+				log.Errorf("followed name ds key invalid: %s", result.Key)
+				continue
+			}
+			var e *pb.IpnsEntry
+			if len(result.Value) > 0 {
+				e = new(pb.IpnsEntry)
+				if err := proto.Unmarshal(result.Value, e); err != nil {
+					log.Error("found an invalid followed IPNS entry:", err)
+					e = nil
+				}
+			}
+			followed[peer.ID(pid)] = e
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// RepublishFollowed fetches the latest record of a followed name, stores it
+// if it's newer than the stored one and puts the best of both back to the
+// routing system. It returns the republished record.
+func (rp *Republisher) RepublishFollowed(ctx context.Context, id peer.ID) (*pb.IpnsEntry, error) {
+	stored, err := rp.ds.Get(FollowDsKey(id))
+	switch err {
+	case nil:
+	case ds.ErrNotFound:
+		return nil, ErrNotFollowed
+	default:
+		return nil, err
+	}
+
+	log.Debugf("republishing followed ipns entry for %s", id)
+
+	key := ipns.RecordKey(id)
+	records := [][]byte{stored}
+	fetched, err := rp.routing.GetValue(ctx, key)
+	if err != nil {
+		// The publisher may be offline, fall back to the stored record.
+		log.Debugf("failed to fetch record of followed name %s: %s", id, err)
+	} else {
+		records = append(records, fetched)
+	}
+
+	// Only keep valid records, the stored one may have expired.
+	validator := ipns.Validator{KeyBook: rp.KeyBook}
+	var candidates [][]byte
+	for _, r := range records {
+		if len(r) > 0 && validator.Validate(key, r) == nil {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoValidRecord
+	}
+	best, err := validator.Select(key, candidates)
+	if err != nil {
+		return nil, err
+	}
+	record := candidates[best]
+
+	if err := rp.storeFollowed(id, record); err != nil {
+		return nil, err
+	}
+	if err := rp.routing.PutValue(ctx, key, record); err != nil {
+		return nil, err
+	}
+
+	e := new(pb.IpnsEntry)
+	if err := proto.Unmarshal(record, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// storeFollowed stores the record of a followed name, unless the name was
+// unfollowed while the record was fetched.
+func (rp *Republisher) storeFollowed(id peer.ID, record []byte) error {
+	followLock.Lock()
+	defer followLock.Unlock()
+
+	has, err := rp.ds.Has(FollowDsKey(id))
+	if err != nil {
+		return err
+	}
+	if !has {
+		return ErrNotFollowed
+	}
+	return rp.ds.Put(FollowDsKey(id), record)
+}
+
+// republishFollowed republishes the followed names. The names are
+// republished independently of each other, failures are only logged.
+func (rp *Republisher) republishFollowed(ctx context.Context) {
+	followed, err := ListFollowed(ctx, rp.ds)
+	if err != nil {
+		log.Info("failed to list followed names: ", err)
+		return
+	}
+
+	for id := range followed {
+		if _, err := rp.RepublishFollowed(ctx, id); err != nil {
+			log.Infof("failed to republish followed name %s: %s", id, err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package republisher_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	namesys "github.com/ipsn/go-ipfs/namesys"
+	. "github.com/ipsn/go-ipfs/namesys/republisher"
+
+	proto "github.com/gogo/protobuf/proto"
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	dsquery "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/sync"
+	offroute "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-routing/offline"
+	ipns "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipns"
+	path "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-path"
+	ci "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peer"
+	pstoremem "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peerstore/pstoremem"
+	routing "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-routing"
+	ropts "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-routing/options"
+)
+
+func TestRepublishFollowed(t *testing.T) {
+	ctx := context.Background()
+
+	// The "network" only holds what was last put to it.
+	netds := dssync.MutexWrap(ds.NewMapDatastore())
+	routing := offroute.NewOfflineRouter(netds, ipns.Validator{})
+
+	sk, _, err := ci.GenerateKeyPair(ci.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publisher := namesys.NewIpnsPublisher(routing, dssync.MutexWrap(ds.NewMapDatastore()))
+	p1 := path.FromString("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn")
+	if err := publisher.PublishWithEOL(ctx, sk, p1, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	follower := dssync.MutexWrap(ds.NewMapDatastore())
+	repub := NewRepublisher(nil, routing, follower, nil, nil)
+
+	if _, err := repub.RepublishFollowed(ctx, pid); err != ErrNotFollowed {
+		t.Fatalf("expected %s, got %v", ErrNotFollowed, err)
+	}
+	if err := Follow(follower, pid); err != nil {
+		t.Fatal(err)
+	}
+	e, err := repub.RepublishFollowed(ctx, pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Path(e.GetValue()) != p1 {
+		t.Fatalf("unexpected republished value %s", e.GetValue())
+	}
+
+	// The record disappears from the network, the stored one gets put back.
+	clearDatastore(t, netds)
+	if _, err := repub.RepublishFollowed(ctx, pid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := routing.GetValue(ctx, ipns.RecordKey(pid)); err != nil {
+		t.Fatalf("expected followed record to be put back: %s", err)
+	}
+
+	// Newer records replace the stored one.
+	p2 := path.FromString("/ipfs/QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n")
+	if err := publisher.PublishWithEOL(ctx, sk, p2, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repub.RepublishFollowed(ctx, pid); err != nil {
+		t.Fatal(err)
+	}
+	followed, err := ListFollowed(ctx, follower)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(followed) != 1 || path.Path(followed[pid].GetValue()) != p2 {
+		t.Fatalf("expected newer record to be stored, got %v", followed)
+	}
+
+	if err := Unfollow(follower, pid); err != nil {
+		t.Fatal(err)
+	}
+	if err := Unfollow(follower, pid); err != ErrNotFollowed {
+		t.Fatalf("expected %s, got %v", ErrNotFollowed, err)
+	}
+}
+
+func TestRepublishFollowedKeyBook(t *testing.T) {
+	ctx := context.Background()
+	netds := dssync.MutexWrap(ds.NewMapDatastore())
+
+	sk, pk, err := ci.GenerateKeyPair(ci.RSA, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := pstoremem.NewPeerstore()
+	if err := ps.AddPubKey(pid, pk); err != nil {
+		t.Fatal(err)
+	}
+
+	// The record doesn't embed the public key of the name.
+	e, err := ipns.Create(sk, []byte("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"), 1, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := proto.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := offroute.NewOfflineRouter(netds, ipns.Validator{KeyBook: ps})
+	if err := router.PutValue(ctx, ipns.RecordKey(pid), record); err != nil {
+		t.Fatal(err)
+	}
+
+	follower := dssync.MutexWrap(ds.NewMapDatastore())
+	if err := Follow(follower, pid); err != nil {
+		t.Fatal(err)
+	}
+	repub := NewRepublisher(nil, router, follower, nil, nil)
+	if _, err := repub.RepublishFollowed(ctx, pid); err != ErrNoValidRecord {
+		t.Fatalf("expected %s without the public key, got %v", ErrNoValidRecord, err)
+	}
+	repub.KeyBook = ps
+	if _, err := repub.RepublishFollowed(ctx, pid); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// unfollowingRouter unfollows the fetched name while fetching its record.
+type unfollowingRouter struct {
+	routing.ValueStore
+	follower ds.Datastore
+	id       peer.ID
+}
+
+func (r *unfollowingRouter) GetValue(ctx context.Context, key string, opts ...ropts.Option) ([]byte, error) {
+	if err := Unfollow(r.follower, r.id); err != nil {
+		return nil, err
+	}
+	return r.ValueStore.GetValue(ctx, key, opts...)
+}
+
+func TestUnfollowWhileRepublishing(t *testing.T) {
+	ctx := context.Background()
+	netds := dssync.MutexWrap(ds.NewMapDatastore())
+	router := offroute.NewOfflineRouter(netds, ipns.Validator{})
+
+	sk, _, err := ci.GenerateKeyPair(ci.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publisher := namesys.NewIpnsPublisher(router, dssync.MutexWrap(ds.NewMapDatastore()))
+	p := path.FromString("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn")
+	if err := publisher.PublishWithEOL(ctx, sk, p, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	follower := dssync.MutexWrap(ds.NewMapDatastore())
+	if err := Follow(follower, pid); err != nil {
+		t.Fatal(err)
+	}
+	repub := NewRepublisher(nil, &unfollowingRouter{router, follower, pid}, follower, nil, nil)
+	if _, err := repub.RepublishFollowed(ctx, pid); err != ErrNotFollowed {
+		t.Fatalf("expected %s, got %v", ErrNotFollowed, err)
+	}
+	followed, err := ListFollowed(ctx, follower)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(followed) != 0 {
+		t.Fatalf("expected the unfollowed name not to be stored again, got %v", followed)
+	}
+}
+
+func clearDatastore(t *testing.T, d ds.Datastore) {
+	t.Helper()
+	res, err := d.Query(dsquery.Query{KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if err := d.Delete(ds.NewKey(e.Key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -11,12 +11,16 @@ import (
 
 	proto "github.com/gogo/protobuf/proto"
 	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	ipns "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipns"
 	pb "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipns/pb"
 	logging "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-log"
+	opts "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/interface-go-ipfs-core/options/namesys"
 	goprocess "github.com/ipsn/go-ipfs/gxlibs/github.com/jbenet/goprocess"
 	gpctx "github.com/ipsn/go-ipfs/gxlibs/github.com/jbenet/goprocess/context"
 	ic "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peerstore"
+	routing "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-routing"
 )
 
 var errNoEntry = errors.New("no previous entry")
@@ -36,21 +40,28 @@ var FailureRetryInterval = time.Minute * 5
 const DefaultRecordLifetime = time.Hour * 24
 
 type Republisher struct {
-	ns   namesys.Publisher
-	ds   ds.Datastore
-	self ic.PrivKey
-	ks   keystore.Keystore
+	ns      namesys.Publisher
+	routing routing.ValueStore
+	ds      ds.Datastore
+	self    ic.PrivKey
+	ks      keystore.Keystore
 
 	Interval time.Duration
 
 	// how long records that are republished should be valid for
 	RecordLifetime time.Duration
+
+	// KeyBook holds the public keys of the followed names whose records
+	// don't embed them.
+	KeyBook pstore.KeyBook
 }
 
-// NewRepublisher creates a new Republisher
-func NewRepublisher(ns namesys.Publisher, ds ds.Datastore, self ic.PrivKey, ks keystore.Keystore) *Republisher {
+// NewRepublisher creates a new Republisher. The routing system is used to
+// fetch and put back the records of followed names.
+func NewRepublisher(ns namesys.Publisher, r routing.ValueStore, ds ds.Datastore, self ic.PrivKey, ks keystore.Keystore) *Republisher {
 	return &Republisher{
 		ns:             ns,
+		routing:        r,
 		ds:             ds,
 		self:           self,
 		ks:             ks,
@@ -87,6 +98,15 @@ func (rp *Republisher) republishEntries(p goprocess.Process) error {
 	ctx, cancel := context.WithCancel(gpctx.OnClosingContext(p))
 	defer cancel()
 
+	err := rp.republishKeys(ctx)
+
+	// The followed names don't depend on our keys, and failing to
+	// republish one of them must not make us retry our own records early.
+	rp.republishFollowed(ctx)
+	return err
+}
+
+func (rp *Republisher) republishKeys(ctx context.Context) error {
 	// TODO: Use rp.ipns.ListPublished(). We can't currently *do* that
 	// because:
 	// 1. There's no way to get keys from the keystore by ID.
@@ -113,7 +133,6 @@ func (rp *Republisher) republishEntries(p goprocess.Process) error {
 
 		}
 	}
-
 	return nil
 }
 
@@ -126,7 +145,7 @@ func (rp *Republisher) republishEntry(ctx context.Context, priv ic.PrivKey) erro
 	log.Debugf("republishing ipns entry for %s", id)
 
 	// Look for it locally only
-	p, err := rp.getLastVal(id)
+	e, err := rp.getLastEntry(id)
 	if err != nil {
 		if err == errNoEntry {
 			return nil
@@ -134,25 +153,35 @@ func (rp *Republisher) republishEntry(ctx context.Context, priv ic.PrivKey) erro
 		return err
 	}
 
-	// update record with same sequence number
-	eol := time.Now().Add(rp.RecordLifetime)
-	return rp.ns.PublishWithEOL(ctx, priv, p, eol)
+	// update record with same sequence number, keeping its ttl and data
+	extra, err := ipns.GetExtraData(e)
+	if err != nil {
+		return err
+	}
+	options := []opts.PublishOption{
+		opts.PublishWithEOL(time.Now().Add(rp.RecordLifetime)),
+		opts.PublishWithData(extra),
+	}
+	if e.Ttl != nil {
+		options = append(options, opts.PublishWithTTL(time.Duration(e.GetTtl())))
+	}
+	return rp.ns.Publish(ctx, priv, path.Path(e.GetValue()), options...)
 }
 
-func (rp *Republisher) getLastVal(id peer.ID) (path.Path, error) {
+func (rp *Republisher) getLastEntry(id peer.ID) (*pb.IpnsEntry, error) {
 	// Look for it locally only
 	val, err := rp.ds.Get(namesys.IpnsDsKey(id))
 	switch err {
 	case nil:
 	case ds.ErrNotFound:
-		return "", errNoEntry
+		return nil, errNoEntry
 	default:
-		return "", err
+		return nil, err
 	}
 
 	e := new(pb.IpnsEntry)
 	if err := proto.Unmarshal(val, e); err != nil {
-		return "", err
+		return nil, err
 	}
-	return path.Path(e.Value), nil
+	return e, nil
 }
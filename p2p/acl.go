@@ -0,0 +1,154 @@
+package p2p
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	peer "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peer"
+)
+
+// PeerACL restricts the peers allowed to open streams to a listener. Denied
+// peers are always rejected. Once peers have been allowed, the ACL is
+// restricted: only the peers on the allow list are accepted, even after they
+// have all been removed from it, until the ACL is opened again.
+type PeerACL struct {
+	// rejected is updated atomically, it comes first to be 64-bit aligned
+	// on 32-bit platforms.
+	rejected uint64
+
+	lk         sync.RWMutex
+	allowed    map[peer.ID]struct{}
+	denied     map[peer.ID]struct{}
+	restricted bool
+}
+
+// NewPeerACL creates a new PeerACL with the given allow and deny lists.
+func NewPeerACL(allowed, denied []peer.ID) *PeerACL {
+	acl := &PeerACL{
+		allowed: map[peer.ID]struct{}{},
+		denied:  map[peer.ID]struct{}{},
+	}
+	acl.Allow(allowed...)
+	acl.Deny(denied...)
+	return acl
+}
+
+// Allow adds peers to the allow list, removing them from the deny list, and
+// restricts the ACL to the allow list.
+func (a *PeerACL) Allow(ids ...peer.ID) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	for _, id := range ids {
+		delete(a.denied, id)
+		a.allowed[id] = struct{}{}
+		a.restricted = true
+	}
+}
+
+// Restrict restricts the ACL to the allow list, even if it's empty.
+func (a *PeerACL) Restrict() {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	a.restricted = true
+}
+
+// Open clears the allow list, letting any peer that isn't denied in.
+func (a *PeerACL) Open() {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	a.allowed = map[peer.ID]struct{}{}
+	a.restricted = false
+}
+
+// Restricted returns whether only the peers on the allow list are accepted.
+func (a *PeerACL) Restricted() bool {
+	a.lk.RLock()
+	defer a.lk.RUnlock()
+	return a.restricted
+}
+
+// Deny adds peers to the deny list, removing them from the allow list.
+func (a *PeerACL) Deny(ids ...peer.ID) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	for _, id := range ids {
+		delete(a.allowed, id)
+		a.denied[id] = struct{}{}
+	}
+}
+
+// Remove removes peers from both lists. The ACL stays restricted when the
+// last allowed peer is removed.
+func (a *PeerACL) Remove(ids ...peer.ID) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	for _, id := range ids {
+		delete(a.allowed, id)
+		delete(a.denied, id)
+	}
+}
+
+// Allowed returns the allow list.
+func (a *PeerACL) Allowed() []peer.ID {
+	a.lk.RLock()
+	defer a.lk.RUnlock()
+	return sortedPeers(a.allowed)
+}
+
+// Denied returns the deny list.
+func (a *PeerACL) Denied() []peer.ID {
+	a.lk.RLock()
+	defer a.lk.RUnlock()
+	return sortedPeers(a.denied)
+}
+
+// Check returns whether the peer may open a stream, counting rejections.
+func (a *PeerACL) Check(id peer.ID) bool {
+	a.lk.RLock()
+	_, denied := a.denied[id]
+	_, allowed := a.allowed[id]
+	ok := !denied && (allowed || !a.restricted)
+	a.lk.RUnlock()
+
+	if !ok {
+		atomic.AddUint64(&a.rejected, 1)
+	}
+	return ok
+}
+
+// Rejected returns the number of streams rejected so far.
+func (a *PeerACL) Rejected() uint64 {
+	return atomic.LoadUint64(&a.rejected)
+}
+
+func sortedPeers(set map[peer.ID]struct{}) []peer.ID {
+	ids := make([]peer.ID, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// ParsePeerIDs parses peer IDs for an ACL, optionally prefixed with /ipfs/.
+// Blank entries are skipped.
+func ParsePeerIDs(ids []string) ([]peer.ID, error) {
+	var out []peer.ID
+	for _, s := range ids {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		id, err := peer.IDB58Decode(strings.TrimPrefix(s, "/ipfs/"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer ID %q: %s", s, err)
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
@@ -0,0 +1,162 @@
+package p2p
+
+import (
+	"io"
+	gonet "net"
+	"sync"
+	"time"
+
+	net "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-net"
+)
+
+// streamConn adapts a libp2p stream to a net.Conn. Read deadlines also apply
+// to pending reads, which net/http relies on to hijack connections, even if
+// the stream muxer only checks them when a read starts.
+type streamConn struct {
+	net.Stream
+
+	chunks  chan []byte
+	err     error // set before chunks is closed
+	pending []byte
+
+	lk              sync.Mutex
+	readDeadline    time.Time
+	deadlineChanged chan struct{}
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newStreamConn(s net.Stream) *streamConn {
+	c := &streamConn{
+		Stream:          s,
+		chunks:          make(chan []byte),
+		deadlineChanged: make(chan struct{}),
+		closed:          make(chan struct{}),
+	}
+	go c.pump()
+	return c
+}
+
+// pump reads the stream in the background. Once the conn is closed, it waits
+// for the EOF of the stream, so it isn't leaked.
+func (c *streamConn) pump() {
+	for {
+		buf := make([]byte, 32*1024)
+		n, err := c.Stream.Read(buf)
+		if n > 0 {
+			select {
+			case c.chunks <- buf[:n]:
+			case <-c.closed:
+				c.Stream.Reset()
+				return
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				c.Stream.Reset()
+			}
+			c.err = err
+			close(c.chunks)
+			return
+		}
+	}
+}
+
+func (c *streamConn) Read(b []byte) (int, error) {
+	if len(c.pending) > 0 {
+		n := copy(b, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+
+	for {
+		c.lk.Lock()
+		deadline, changed := c.readDeadline, c.deadlineChanged
+		c.lk.Unlock()
+
+		n, done, err := c.readUntil(b, deadline, changed)
+		if done {
+			return n, err
+		}
+	}
+}
+
+// readUntil waits for a chunk until the deadline. It's not done if the
+// deadline changed meanwhile.
+func (c *streamConn) readUntil(b []byte, deadline time.Time, changed <-chan struct{}) (int, bool, error) {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return 0, true, errTimeout
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case chunk, ok := <-c.chunks:
+		if !ok {
+			return 0, true, c.err
+		}
+		n := copy(b, chunk)
+		c.pending = chunk[n:]
+		return n, true, nil
+	case <-timeout:
+		return 0, true, errTimeout
+	case <-changed:
+		return 0, false, nil
+	case <-c.closed:
+		return 0, true, errListenerClosed
+	}
+}
+
+func (c *streamConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.Stream.SetWriteDeadline(t)
+}
+
+func (c *streamConn) SetReadDeadline(t time.Time) error {
+	c.lk.Lock()
+	c.readDeadline = t
+	close(c.deadlineChanged)
+	c.deadlineChanged = make(chan struct{})
+	c.lk.Unlock()
+	return nil
+}
+
+func (c *streamConn) LocalAddr() gonet.Addr {
+	return peerAddr(c.Conn().LocalPeer().Pretty())
+}
+
+func (c *streamConn) RemoteAddr() gonet.Addr {
+	return peerAddr(c.Conn().RemotePeer().Pretty())
+}
+
+func (c *streamConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	// So the pump doesn't wait for the EOF forever.
+	c.Stream.SetReadDeadline(time.Now().Add(net.EOFTimeout))
+	if err := c.Stream.Close(); err != nil {
+		c.Stream.Reset()
+		return err
+	}
+	return nil
+}
+
+// peerAddr is the net.Addr of a peer.
+type peerAddr string
+
+func (a peerAddr) Network() string { return "libp2p" }
+func (a peerAddr) String() string  { return string(a) }
+
+// errTimeout is returned by reads past the read deadline.
+var errTimeout gonet.Error = timeoutError{}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -0,0 +1,191 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	gonet "net"
+	"net/http"
+	"net/http/httputil"
+	"time"
+
+	net "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-net"
+	protocol "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-protocol"
+	ma "github.com/ipsn/go-ipfs/gxlibs/github.com/multiformats/go-multiaddr"
+	manet "github.com/ipsn/go-ipfs/gxlibs/github.com/multiformats/go-multiaddr-net"
+)
+
+// PeerIDHeader is set on the requests proxied by HTTP listeners to the peer
+// ID of the peer that sent them. Values sent by the peer are overwritten.
+const PeerIDHeader = "X-Libp2p-Peer-Id"
+
+var errListenerClosed = errors.New("listener closed")
+
+// httpListener accepts libp2p streams carrying HTTP requests and
+// reverse-proxies the requests to a local HTTP service
+type httpListener struct {
+	p2p *P2P
+
+	// Application proto identifier.
+	proto protocol.ID
+
+	// Address of the HTTP service
+	addr ma.Multiaddr
+
+	// acl decides which peers may open streams to the listener
+	acl *PeerACL
+
+	server *http.Server
+	conns  chan gonet.Conn
+	done   chan struct{}
+}
+
+// ForwardHTTP creates a new p2p listener terminating HTTP on this node. The
+// requests sent over libp2p streams of the given protocol are proxied to the
+// HTTP service at the target address, a TCP address or a /unix/ socket path.
+// Headers are passed through, bodies are streamed and connection upgrades,
+// such as WebSockets, are supported. The requests carry the peer ID of the
+// peer that sent them in the PeerIDHeader header.
+//
+// Only the peers accepted by the ACL may open streams to the listener, a nil
+// ACL accepts all peers.
+func (p2p *P2P) ForwardHTTP(ctx context.Context, proto protocol.ID, addr ma.Multiaddr, acl *PeerACL) (Listener, error) {
+	if acl == nil {
+		acl = NewPeerACL(nil, nil)
+	}
+
+	host := "localhost"
+	if _, err := addr.ValueForProtocol(ma.P_UNIX); err != nil {
+		_, h, err := manet.DialArgs(addr)
+		if err != nil {
+			return nil, err
+		}
+		host = h
+	}
+
+	listener := &httpListener{
+		p2p: p2p,
+
+		proto: proto,
+		addr:  addr,
+
+		acl: acl,
+
+		conns: make(chan gonet.Conn),
+		done:  make(chan struct{}),
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = host
+			// Let the URL's host take precedence over the peer ID.
+			req.Host = ""
+		},
+		Transport: peerIDTransport{&http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (gonet.Conn, error) {
+				var d manet.Dialer
+				return d.DialContext(ctx, addr)
+			},
+			IdleConnTimeout: 90 * time.Second,
+		}},
+		// Stream the responses.
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Warningf("failed to proxy request from %s to %s: %s", r.RemoteAddr, addr, err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	listener.server = &http.Server{Handler: proxy}
+
+	if err := p2p.ListenersP2P.Register(listener); err != nil {
+		return nil, err
+	}
+
+	go listener.server.Serve(listener)
+
+	return listener, nil
+}
+
+// peerIDTransport sets the PeerIDHeader of the proxied requests. It's set
+// here rather than by the director of the proxy, as the proxy removes the
+// headers listed in the Connection header of the request after the director
+// ran, which would let peers drop it.
+type peerIDTransport struct {
+	http.RoundTripper
+}
+
+func (t peerIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	out := new(http.Request)
+	*out = *req
+	out.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		out.Header[k] = v
+	}
+	out.Header.Set(PeerIDHeader, req.RemoteAddr)
+	return t.RoundTripper.RoundTrip(out)
+}
+
+func (l *httpListener) handleStream(remote net.Stream) {
+	peer := remote.Conn().RemotePeer()
+	if !l.acl.Check(peer) {
+		log.Warningf("rejected stream from %s to %s: peer not allowed", peer.Pretty(), l.proto)
+		remote.Reset()
+		return
+	}
+
+	select {
+	case l.conns <- newStreamConn(remote):
+	case <-l.done:
+		remote.Reset()
+	}
+}
+
+// Accept implements net.Listener for the HTTP server.
+func (l *httpListener) Accept() (gonet.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, errListenerClosed
+	}
+}
+
+// Close implements net.Listener for the HTTP server.
+func (l *httpListener) Close() error {
+	return nil
+}
+
+// Addr implements net.Listener for the HTTP server.
+func (l *httpListener) Addr() gonet.Addr {
+	return peerAddr(l.p2p.identity.Pretty())
+}
+
+func (l *httpListener) Protocol() protocol.ID {
+	return l.proto
+}
+
+func (l *httpListener) ListenAddress() ma.Multiaddr {
+	addr, err := ma.NewMultiaddr(maPrefix + l.p2p.identity.Pretty())
+	if err != nil {
+		panic(err)
+	}
+	return addr
+}
+
+func (l *httpListener) TargetAddress() ma.Multiaddr {
+	return l.addr
+}
+
+// ACL returns the access control list of the listener.
+func (l *httpListener) ACL() *PeerACL {
+	return l.acl
+}
+
+func (l *httpListener) close() {
+	close(l.done)
+	l.server.Close()
+}
+
+func (l *httpListener) key() string {
+	return string(l.proto)
+}
@@ -22,6 +22,11 @@ type Listener interface {
 	close()
 }
 
+// streamHandler is implemented by the listeners accepting libp2p streams
+type streamHandler interface {
+	handleStream(net.Stream)
+}
+
 // Listeners manages a group of Listener implementations,
 // checking for conflicts and optionally dispatching connections
 type Listeners struct {
@@ -53,7 +58,7 @@ func newListenersP2P(host p2phost.Host) *Listeners {
 
 		l := reg.Listeners[string(stream.Protocol())]
 		if l != nil {
-			go l.(*remoteListener).handleStream(stream)
+			go l.(streamHandler).handleStream(stream)
 		}
 	})
 
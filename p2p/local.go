@@ -2,6 +2,8 @@ package p2p
 
 import (
 	"context"
+	gonet "net"
+	"os"
 	"time"
 
 	tec "github.com/jbenet/go-temp-err-catcher"
@@ -25,7 +27,8 @@ type localListener struct {
 	listener manet.Listener
 }
 
-// ForwardLocal creates new P2P stream to a remote listener
+// ForwardLocal creates new P2P stream to a remote listener. The bind address
+// may be a TCP/UDP address or a /unix/ socket path.
 func (p2p *P2P) ForwardLocal(ctx context.Context, peer peer.ID, proto protocol.ID, bindAddr ma.Multiaddr) (Listener, error) {
 	listener := &localListener{
 		ctx:   ctx,
@@ -34,7 +37,7 @@ func (p2p *P2P) ForwardLocal(ctx context.Context, peer peer.ID, proto protocol.I
 		peer:  peer,
 	}
 
-	maListener, err := manet.Listen(bindAddr)
+	maListener, err := listen(bindAddr)
 	if err != nil {
 		return nil, err
 	}
@@ -51,6 +54,29 @@ func (p2p *P2P) ForwardLocal(ctx context.Context, peer peer.ID, proto protocol.I
 	return listener, nil
 }
 
+// listen listens on the given address. A unix socket left behind by a
+// previous daemon is removed first, unless something is still listening on it.
+func listen(addr ma.Multiaddr) (manet.Listener, error) {
+	if path, err := addr.ValueForProtocol(ma.P_UNIX); err == nil {
+		removeStaleSocket(path)
+	}
+	return manet.Listen(addr)
+}
+
+func removeStaleSocket(path string) {
+	fi, err := os.Lstat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	if conn, err := gonet.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		log.Warningf("failed to remove stale socket %s: %s", path, err)
+	}
+}
+
 func (l *localListener) dial(ctx context.Context) (net.Stream, error) {
 	cctx, cancel := context.WithTimeout(ctx, time.Second*30) //TODO: configurable?
 	defer cancel()
@@ -80,10 +106,16 @@ func (l *localListener) setupStream(local manet.Conn) {
 		return
 	}
 
+	// Unix socket clients usually have no address.
+	origin := local.RemoteMultiaddr()
+	if origin == nil {
+		origin = l.laddr
+	}
+
 	stream := &Stream{
 		Protocol: l.proto,
 
-		OriginAddr: local.RemoteMultiaddr(),
+		OriginAddr: origin,
 		TargetAddr: l.TargetAddress(),
 		peer:       l.peer,
 
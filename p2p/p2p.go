@@ -1,10 +1,15 @@
 package p2p
 
 import (
+	"context"
+	"time"
+
 	logging "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-log"
 	p2phost "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-host"
+	net "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-net"
 	peer "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peer"
 	pstore "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peerstore"
+	protocol "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-protocol"
 )
 
 var log = logging.Logger("p2p-mount")
@@ -51,3 +56,25 @@ func (p2p *P2P) CheckProtoExists(proto string) bool {
 	}
 	return false
 }
+
+// DialStream opens a libp2p stream to the given service of a peer, for the
+// caller to use directly instead of proxying it to a local connection.
+func (p2p *P2P) DialStream(ctx context.Context, peer peer.ID, proto protocol.ID) (net.Stream, error) {
+	cctx, cancel := context.WithTimeout(ctx, time.Second*30) //TODO: configurable?
+	defer cancel()
+
+	return p2p.peerHost.NewStream(cctx, peer, proto)
+}
+
+// ListenerACL returns the access control list of the p2p listener of the
+// given protocol.
+func (p2p *P2P) ListenerACL(proto protocol.ID) (*PeerACL, bool) {
+	p2p.ListenersP2P.RLock()
+	defer p2p.ListenersP2P.RUnlock()
+
+	l, ok := p2p.ListenersP2P.Listeners[string(proto)].(interface{ ACL() *PeerACL })
+	if !ok {
+		return nil, false
+	}
+	return l.ACL(), true
+}
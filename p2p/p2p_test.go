@@ -0,0 +1,332 @@
+package p2p
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	gonet "net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	p2phttp "github.com/ipsn/go-ipfs/gxlibs/github.com/hsanjuan/go-libp2p-http"
+	bhost "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-blankhost"
+	p2phost "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-host"
+	peer "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-peer"
+	swarmt "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-swarm/testing"
+	mocknet "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p/p2p/net/mock"
+	ma "github.com/ipsn/go-ipfs/gxlibs/github.com/multiformats/go-multiaddr"
+	manet "github.com/ipsn/go-ipfs/gxlibs/github.com/multiformats/go-multiaddr-net"
+)
+
+func TestForwardUnixSockets(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "p2p-unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mn, err := mocknet.FullMeshConnected(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+	client := NewP2P(hosts[0].ID(), hosts[0], hosts[0].Peerstore())
+	server := NewP2P(hosts[1].ID(), hosts[1], hosts[1].Peerstore())
+
+	// The service behind the remote listener echoes a line back.
+	servicePath := filepath.Join(dir, "service.sock")
+	service, err := gonet.Listen("unix", servicePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+	go func() {
+		for {
+			conn, err := service.Accept()
+			if err != nil {
+				return
+			}
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			conn.Write([]byte(line))
+			conn.Close()
+		}
+	}()
+
+	target, err := ma.NewMultiaddr("/unix/" + servicePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.ForwardRemote(ctx, "/x/echo", target, false, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Leave a stale socket behind, as a crashed daemon would.
+	bindPath := filepath.Join(dir, "bind.sock")
+	stale, err := gonet.Listen("unix", bindPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*gonet.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	bind, err := ma.NewMultiaddr("/unix/" + bindPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ForwardLocal(ctx, hosts[1].ID(), "/x/echo", bind); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := gonet.Dial("unix", bindPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "hello\n" {
+		t.Fatalf("expected the line to be echoed, got %q", line)
+	}
+
+	// The stream dialed through a unix socket is listed with the bind address
+	// as origin.
+	client.Streams.Lock()
+	for _, s := range client.Streams.Streams {
+		if !s.OriginAddr.Equal(bind) {
+			t.Errorf("expected origin %s, got %s", bind, s.OriginAddr)
+		}
+	}
+	client.Streams.Unlock()
+}
+
+func TestListenerACL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+	client := NewP2P(hosts[0].ID(), hosts[0], hosts[0].Peerstore())
+	server := NewP2P(hosts[1].ID(), hosts[1], hosts[1].Peerstore())
+
+	service, err := gonet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+	go func() {
+		for {
+			conn, err := service.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("welcome\n"))
+			conn.Close()
+		}
+	}()
+
+	target, err := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/" + strconv.Itoa(service.Addr().(*gonet.TCPAddr).Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	acl := NewPeerACL(nil, []peer.ID{hosts[0].ID()})
+	if _, err := server.ForwardRemote(ctx, "/x/acl", target, false, acl); err != nil {
+		t.Fatal(err)
+	}
+
+	dial := func() (string, error) {
+		s, err := client.DialStream(ctx, hosts[1].ID(), "/x/acl")
+		if err != nil {
+			return "", err
+		}
+		defer s.Close()
+		return bufio.NewReader(s).ReadString('\n')
+	}
+
+	if _, err := dial(); err == nil {
+		t.Fatal("expected the denied peer to be rejected")
+	}
+	if acl.Rejected() != 1 {
+		t.Fatalf("expected 1 rejected stream, got %d", acl.Rejected())
+	}
+
+	// Changing the ACL at runtime applies to new streams.
+	serverACL, ok := server.ListenerACL("/x/acl")
+	if !ok {
+		t.Fatal("expected the listener to have an ACL")
+	}
+	serverACL.Allow(hosts[0].ID())
+	line, err := dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "welcome\n" {
+		t.Fatalf("unexpected response %q", line)
+	}
+
+	// Only allowed peers get in once the allow list isn't empty.
+	serverACL.Remove(hosts[0].ID())
+	serverACL.Allow(hosts[1].ID())
+	if _, err := dial(); err == nil {
+		t.Fatal("expected the peer not on the allow list to be rejected")
+	}
+	if acl.Rejected() != 2 {
+		t.Fatalf("expected 2 rejected streams, got %d", acl.Rejected())
+	}
+
+	// Removing the last allowed peer doesn't open the listener to all.
+	serverACL.Remove(hosts[1].ID())
+	if _, err := dial(); err == nil {
+		t.Fatal("expected the listener to stay restricted")
+	}
+	serverACL.Open()
+	if _, err := dial(); err != nil {
+		t.Fatalf("expected the opened listener to accept any peer: %s", err)
+	}
+}
+
+func TestForwardHTTP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Upgrades need stream deadlines, which mocknet doesn't support.
+	hosts := []p2phost.Host{
+		bhost.NewBlankHost(swarmt.GenSwarm(t, ctx)),
+		bhost.NewBlankHost(swarmt.GenSwarm(t, ctx)),
+	}
+	if err := hosts[0].Connect(ctx, hosts[1].Peerstore().PeerInfo(hosts[1].ID())); err != nil {
+		t.Fatal(err)
+	}
+	server := NewP2P(hosts[1].ID(), hosts[1], hosts[1].Peerstore())
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" {
+			w.Header().Set("X-Echo", r.Header.Get("X-Test"))
+			fmt.Fprintf(w, "%s %s", r.URL.Path, r.Header.Get(PeerIDHeader))
+			return
+		}
+
+		// Switch to a line echo protocol.
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		brw.Flush()
+		line, _ := brw.ReadString('\n')
+		brw.WriteString(line)
+		brw.Flush()
+	}))
+	defer backend.Close()
+
+	target, err := manet.FromNetAddr(backend.Listener.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	acl := NewPeerACL([]peer.ID{hosts[0].ID()}, nil)
+	if _, err := server.ForwardHTTP(ctx, "/x/app/http", target, acl); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: p2phttp.NewTransport(hosts[0], p2phttp.ProtocolOption("/x/app/http"))}
+	url := "libp2p://" + hosts[1].ID().Pretty()
+
+	req, err := http.NewRequest("GET", url+"/hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Test", "passed")
+	req.Header.Set(PeerIDHeader, "spoofed")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get("X-Echo") != "passed" {
+		t.Errorf("expected request headers to be passed through, got %q", resp.Header.Get("X-Echo"))
+	}
+	if expected := "/hello " + hosts[0].ID().Pretty(); string(body) != expected {
+		t.Errorf("expected %q, got %q", expected, body)
+	}
+
+	// The header can't be dropped by listing it in the Connection header.
+	req, err = http.NewRequest("GET", url+"/hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Connection", PeerIDHeader)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "/hello " + hosts[0].ID().Pretty(); string(body) != expected {
+		t.Errorf("expected %q, got %q", expected, body)
+	}
+
+	// Upgrade the connection.
+	req, err = http.NewRequest("GET", url+"/echo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "echo")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected the protocol switch, got %s", resp.Status)
+	}
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		t.Fatal("expected a writable body")
+	}
+	defer rwc.Close()
+	if _, err := rwc.Write([]byte("ping\n")); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(rwc).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "ping\n" {
+		t.Fatalf("expected the line to be echoed, got %q", line)
+	}
+
+	// Peers not on the allow list are rejected.
+	acl.Remove(hosts[0].ID())
+	acl.Allow(hosts[1].ID())
+	if _, err := client.Get(url + "/hello"); err == nil {
+		t.Fatal("expected the request to be rejected")
+	}
+	if acl.Rejected() != 1 {
+		t.Fatalf("expected 1 rejected stream, got %d", acl.Rejected())
+	}
+}
@@ -25,10 +25,19 @@ type remoteListener struct {
 	// reportRemote if set to true makes the handler send '<base58 remote peerid>\n'
 	// to target before any data is forwarded
 	reportRemote bool
+
+	// acl decides which peers may open streams to the listener
+	acl *PeerACL
 }
 
-// ForwardRemote creates new p2p listener
-func (p2p *P2P) ForwardRemote(ctx context.Context, proto protocol.ID, addr ma.Multiaddr, reportRemote bool) (Listener, error) {
+// ForwardRemote creates new p2p listener. The target address may be a TCP/UDP
+// address or a /unix/ socket path. Only the peers accepted by the ACL may open
+// streams to the listener, a nil ACL accepts all peers.
+func (p2p *P2P) ForwardRemote(ctx context.Context, proto protocol.ID, addr ma.Multiaddr, reportRemote bool, acl *PeerACL) (Listener, error) {
+	if acl == nil {
+		acl = NewPeerACL(nil, nil)
+	}
+
 	listener := &remoteListener{
 		p2p: p2p,
 
@@ -36,6 +45,8 @@ func (p2p *P2P) ForwardRemote(ctx context.Context, proto protocol.ID, addr ma.Mu
 		addr:  addr,
 
 		reportRemote: reportRemote,
+
+		acl: acl,
 	}
 
 	if err := p2p.ListenersP2P.Register(listener); err != nil {
@@ -46,14 +57,19 @@ func (p2p *P2P) ForwardRemote(ctx context.Context, proto protocol.ID, addr ma.Mu
 }
 
 func (l *remoteListener) handleStream(remote net.Stream) {
+	peer := remote.Conn().RemotePeer()
+	if !l.acl.Check(peer) {
+		log.Warningf("rejected stream from %s to %s: peer not allowed", peer.Pretty(), l.proto)
+		remote.Reset()
+		return
+	}
+
 	local, err := manet.Dial(l.addr)
 	if err != nil {
 		remote.Reset()
 		return
 	}
 
-	peer := remote.Conn().RemotePeer()
-
 	if l.reportRemote {
 		if _, err := fmt.Fprintf(local, "%s\n", peer.Pretty()); err != nil {
 			remote.Reset()
@@ -99,6 +115,11 @@ func (l *remoteListener) TargetAddress() ma.Multiaddr {
 	return l.addr
 }
 
+// ACL returns the access control list of the listener.
+func (l *remoteListener) ACL() *PeerACL {
+	return l.acl
+}
+
 func (l *remoteListener) close() {}
 
 func (l *remoteListener) key() string {
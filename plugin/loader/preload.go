@@ -6,6 +6,7 @@ import (
 	pluginflatfs "github.com/ipsn/go-ipfs/plugin/plugins/flatfs"
 	pluginipldgit "github.com/ipsn/go-ipfs/plugin/plugins/git"
 	pluginlevelds "github.com/ipsn/go-ipfs/plugin/plugins/levelds"
+	plugins3ds "github.com/ipsn/go-ipfs/plugin/plugins/s3ds"
 )
 
 // DO NOT EDIT THIS FILE
@@ -17,4 +18,5 @@ var preloadPlugins = []plugin.Plugin{
 	pluginbadgerds.Plugins[0],
 	pluginflatfs.Plugins[0],
 	pluginlevelds.Plugins[0],
+	plugins3ds.Plugins[0],
 }
@@ -0,0 +1,214 @@
+package s3ds
+
+import (
+	"strings"
+	"sync"
+
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	query "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/query"
+)
+
+// Datastore stores its entries as objects of an S3 bucket, named after their
+// key below a prefix.
+type Datastore struct {
+	client *client
+	prefix string
+
+	// sem limits the number of concurrent requests.
+	sem chan struct{}
+}
+
+var _ ds.Batching = (*Datastore)(nil)
+
+func (d *Datastore) acquire() func() {
+	d.sem <- struct{}{}
+	return func() { <-d.sem }
+}
+
+// objectName returns the name of the object storing key.
+func (d *Datastore) objectName(key ds.Key) string {
+	name := strings.TrimPrefix(key.String(), "/")
+	if d.prefix == "" {
+		return name
+	}
+	return d.prefix + "/" + name
+}
+
+// key returns the key stored in the object name.
+func (d *Datastore) key(name string) string {
+	if d.prefix != "" {
+		name = strings.TrimPrefix(name, d.prefix+"/")
+	}
+	return "/" + name
+}
+
+func (d *Datastore) Put(key ds.Key, value []byte) error {
+	defer d.acquire()()
+	return d.client.put(d.objectName(key), value)
+}
+
+func (d *Datastore) Get(key ds.Key) ([]byte, error) {
+	defer d.acquire()()
+	value, err := d.client.get(d.objectName(key))
+	if isNotFound(err) {
+		return nil, ds.ErrNotFound
+	}
+	return value, err
+}
+
+func (d *Datastore) Has(key ds.Key) (bool, error) {
+	_, err := d.GetSize(key)
+	if err == ds.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (d *Datastore) GetSize(key ds.Key) (int, error) {
+	defer d.acquire()()
+	size, err := d.client.head(d.objectName(key))
+	if isNotFound(err) {
+		return -1, ds.ErrNotFound
+	} else if err != nil {
+		return -1, err
+	}
+	return int(size), nil
+}
+
+// Delete removes the object storing key. S3 doesn't report whether the object
+// existed, so ds.ErrNotFound is only returned by stores that do.
+func (d *Datastore) Delete(key ds.Key) error {
+	defer d.acquire()()
+	err := d.client.delete(d.objectName(key))
+	if isNotFound(err) {
+		return ds.ErrNotFound
+	}
+	return err
+}
+
+// Query lists the objects below the prefix of the query, fetching their values
+// one by one unless q.KeysOnly is set. Filters and orders are applied after
+// listing.
+func (d *Datastore) Query(q query.Query) (query.Results, error) {
+	prefix := d.objectName(ds.NewKey(q.Prefix))
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	var page *listResult
+	var token string
+	var err error
+	done := false
+	res := query.ResultsFromIterator(q, query.Iterator{
+		Next: func() (query.Result, bool) {
+			for !done && (page == nil || len(page.Contents) == 0) {
+				if page != nil && !page.IsTruncated {
+					done = true
+					break
+				}
+				release := d.acquire()
+				page, err = d.client.list(prefix, token)
+				release()
+				if err != nil {
+					done = true
+					return query.Result{Error: err}, true
+				}
+				token = page.NextContinuationToken
+			}
+			if done {
+				return query.Result{}, false
+			}
+
+			obj := page.Contents[0]
+			page.Contents = page.Contents[1:]
+			e := query.Entry{Key: d.key(obj.Key)}
+			if !q.KeysOnly {
+				value, err := d.Get(ds.RawKey(e.Key))
+				if err != nil {
+					return query.Result{Error: err}, true
+				}
+				e.Value = value
+			}
+			return query.Result{Entry: e}, true
+		},
+	})
+
+	return query.NaiveQueryApply(q, res), nil
+}
+
+// Batch returns a batch sending its writes concurrently when committed.
+func (d *Datastore) Batch() (ds.Batch, error) {
+	return &batch{d: d, ops: make(map[ds.Key][]byte)}, nil
+}
+
+// Close does nothing: there are no resources to release.
+func (d *Datastore) Close() error {
+	return nil
+}
+
+type batch struct {
+	d *Datastore
+	// ops maps keys to their new value, nil if they are deleted.
+	ops map[ds.Key][]byte
+}
+
+func (b *batch) Put(key ds.Key, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	b.ops[key] = value
+	return nil
+}
+
+func (b *batch) Delete(key ds.Key) error {
+	b.ops[key] = nil
+	return nil
+}
+
+// Commit sends the writes of the batch, as many at a time as the datastore
+// allows, and returns the first error.
+func (b *batch) Commit() error {
+	type op struct {
+		key   ds.Key
+		value []byte
+	}
+	ops := make(chan op)
+	errs := make(chan error, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(b.d.sem); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for o := range ops {
+				var err error
+				if o.value == nil {
+					err = b.d.Delete(o.key)
+					if err == ds.ErrNotFound {
+						err = nil
+					}
+				} else {
+					err = b.d.Put(o.key, o.value)
+				}
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+				}
+			}
+		}()
+	}
+	for key, value := range b.ops {
+		ops <- op{key, value}
+	}
+	close(ops)
+	wg.Wait()
+	b.ops = make(map[ds.Key][]byte)
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
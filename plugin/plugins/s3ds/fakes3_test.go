@@ -0,0 +1,127 @@
+package s3ds
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fakeS3 is an in-process S3 server holding a single bucket in memory. It
+// lists objects in small pages to exercise pagination.
+type fakeS3 struct {
+	bucket    string
+	accessKey string
+	pageSize  int
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(bucket, accessKey string) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{
+		bucket:    bucket,
+		accessKey: accessKey,
+		pageSize:  3,
+		objects:   make(map[string][]byte),
+	}
+	return f, httptest.NewServer(f)
+}
+
+func (f *fakeS3) error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(&s3Error{Code: code, Message: code})
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), signAlgorithm+" Credential="+f.accessKey+"/") {
+		f.error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, name := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		bucket, name = path[:i], path[i+1:]
+	}
+	if bucket != f.bucket {
+		f.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if name == "" {
+		if r.Method != http.MethodGet || r.URL.Query().Get("list-type") != "2" {
+			f.error(w, http.StatusNotImplemented, "NotImplemented")
+			return
+		}
+		f.list(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			f.error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[name] = b
+	case http.MethodGet, http.MethodHead:
+		b, ok := f.objects[name]
+		if !ok {
+			f.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		if r.Method == http.MethodGet {
+			w.Write(b)
+		}
+	case http.MethodDelete:
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	after := r.URL.Query().Get("continuation-token")
+
+	var names []string
+	for name := range f.objects {
+		if strings.HasPrefix(name, prefix) && name > after {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var res struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+		Contents              []struct {
+			Key  string
+			Size int
+		}
+	}
+	if len(names) > f.pageSize {
+		names = names[:f.pageSize]
+		res.IsTruncated = true
+		res.NextContinuationToken = names[len(names)-1]
+	}
+	for _, name := range names {
+		res.Contents = append(res.Contents, struct {
+			Key  string
+			Size int
+		}{name, len(f.objects[name])})
+	}
+	xml.NewEncoder(w).Encode(&res)
+}
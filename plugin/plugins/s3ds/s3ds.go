@@ -0,0 +1,220 @@
+package s3ds
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ipsn/go-ipfs/plugin"
+	"github.com/ipsn/go-ipfs/repo"
+	"github.com/ipsn/go-ipfs/repo/fsrepo"
+)
+
+// Plugins is exported list of plugins that will be loaded
+var Plugins = []plugin.Plugin{
+	&s3dsPlugin{},
+}
+
+type s3dsPlugin struct{}
+
+var _ plugin.PluginDatastore = (*s3dsPlugin)(nil)
+
+func (*s3dsPlugin) Name() string {
+	return "ds-s3"
+}
+
+func (*s3dsPlugin) Version() string {
+	return "0.1.0"
+}
+
+func (*s3dsPlugin) Init() error {
+	return nil
+}
+
+func (*s3dsPlugin) DatastoreTypeName() string {
+	return "s3ds"
+}
+
+// DefaultRegion is the region used when none is configured.
+const DefaultRegion = "us-east-1"
+
+// DefaultConcurrency is the number of concurrent requests used when none is
+// configured.
+const DefaultConcurrency = 16
+
+// DefaultTimeout is the time limit of a request used when none is configured.
+const DefaultTimeout = time.Minute
+
+// responseHeaderTimeout is how long to wait for the response headers of a
+// request, at most the timeout of the request.
+const responseHeaderTimeout = 30 * time.Second
+
+// Options configure an S3 datastore.
+type Options struct {
+	// Bucket is the bucket storing the objects.
+	Bucket string
+	// Prefix is prepended to the object names, separated by a slash.
+	Prefix string
+	// Region is the region of the bucket.
+	Region string
+	// Endpoint is the URL of the object store. It defaults to the AWS
+	// endpoint of the region.
+	Endpoint string
+
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	// Concurrency is the maximum number of concurrent requests.
+	Concurrency int
+	// Timeout is the time limit of a request, including reading the
+	// response.
+	Timeout time.Duration
+}
+
+// New returns a datastore storing its entries in an S3 bucket. Credentials
+// missing from the options are read from the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func New(opts Options) (*Datastore, error) {
+	if opts.Bucket == "" {
+		return nil, fmt.Errorf("no bucket configured")
+	}
+	if opts.Region == "" {
+		opts.Region = DefaultRegion
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = "https://s3." + opts.Region + ".amazonaws.com"
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	headerTimeout := responseHeaderTimeout
+	if headerTimeout > opts.Timeout {
+		headerTimeout = opts.Timeout
+	}
+	if opts.AccessKey == "" && opts.SecretKey == "" {
+		opts.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		opts.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if opts.SessionToken == "" {
+			opts.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		}
+	}
+
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %s", err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("invalid endpoint %q: expected an http or https URL", opts.Endpoint)
+	}
+
+	return &Datastore{
+		client: &client{
+			endpoint:     endpoint,
+			bucket:       opts.Bucket,
+			region:       opts.Region,
+			accessKey:    opts.AccessKey,
+			secretKey:    opts.SecretKey,
+			sessionToken: opts.SessionToken,
+			http: &http.Client{
+				Timeout: opts.Timeout,
+				Transport: &http.Transport{
+					Proxy: http.ProxyFromEnvironment,
+					DialContext: (&net.Dialer{
+						Timeout:   30 * time.Second,
+						KeepAlive: 30 * time.Second,
+					}).DialContext,
+					TLSHandshakeTimeout:   10 * time.Second,
+					ResponseHeaderTimeout: headerTimeout,
+					MaxIdleConnsPerHost:   opts.Concurrency,
+				},
+			},
+		},
+		prefix: strings.Trim(opts.Prefix, "/"),
+		sem:    make(chan struct{}, opts.Concurrency),
+	}, nil
+}
+
+type datastoreConfig struct {
+	opts Options
+}
+
+// DatastoreConfigParser returns a configuration stub for an S3 datastore
+// from the given parameters
+func (*s3dsPlugin) DatastoreConfigParser() fsrepo.ConfigFromMap {
+	return func(params map[string]interface{}) (fsrepo.DatastoreConfig, error) {
+		var c datastoreConfig
+
+		for _, f := range []struct {
+			name     string
+			value    *string
+			required bool
+		}{
+			{"bucket", &c.opts.Bucket, true},
+			{"prefix", &c.opts.Prefix, false},
+			{"region", &c.opts.Region, false},
+			{"endpoint", &c.opts.Endpoint, false},
+			{"accessKey", &c.opts.AccessKey, false},
+			{"secretKey", &c.opts.SecretKey, false},
+			{"sessionToken", &c.opts.SessionToken, false},
+		} {
+			v, ok := params[f.name]
+			if !ok {
+				if f.required {
+					return nil, fmt.Errorf("'%s' field is missing", f.name)
+				}
+				continue
+			}
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("'%s' field was not a string", f.name)
+			}
+			*f.value = s
+		}
+
+		if v, ok := params["concurrency"]; ok {
+			n, ok := v.(float64)
+			if !ok || n < 1 || n != float64(int(n)) {
+				return nil, fmt.Errorf("'concurrency' field was not a positive integer")
+			}
+			c.opts.Concurrency = int(n)
+		}
+
+		if v, ok := params["timeout"]; ok {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("'timeout' field was not a string")
+			}
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid 'timeout' field %q: expected a positive duration", s)
+			}
+			c.opts.Timeout = d
+		}
+
+		return &c, nil
+	}
+}
+
+func (c *datastoreConfig) DiskSpec() fsrepo.DiskSpec {
+	spec := map[string]interface{}{
+		"type":   "s3ds",
+		"bucket": c.opts.Bucket,
+		"prefix": strings.Trim(c.opts.Prefix, "/"),
+	}
+	if c.opts.Endpoint != "" {
+		spec["endpoint"] = c.opts.Endpoint
+	}
+	return spec
+}
+
+func (c *datastoreConfig) Create(string) (repo.Datastore, error) {
+	return New(c.opts)
+}
@@ -1,15 +1,22 @@
 package fsrepo_test
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/ipsn/go-ipfs/plugin/loader"
+	"github.com/ipsn/go-ipfs/repo"
 	"github.com/ipsn/go-ipfs/repo/fsrepo"
 
+	blocks "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-block-format"
+	datastore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	dshelp "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-ds-help"
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-config"
 )
 
@@ -234,3 +241,286 @@ func TestMeasureConfig(t *testing.T) {
 		t.Errorf("expected '*measure.measure' got '%s'", typ)
 	}
 }
+
+var tieredConfig = []byte(`{
+      "mounts": [
+        {
+          "mountpoint": "/blocks",
+          "type": "tiered",
+          "coldAfter": "1h",
+          "migrateInterval": "0s",
+          "hot": {
+            "compression": "none",
+            "path": "hot",
+            "type": "levelds"
+          },
+          "cold": {
+            "path": "blocks",
+            "shardFunc": "/repo/flatfs/shard/v1/next-to-last/2",
+            "sync": true,
+            "type": "flatfs"
+          }
+        },
+        {
+          "mountpoint": "/",
+          "type": "mem"
+        }
+      ],
+      "type": "mount"
+}`)
+
+func TestTieredConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipfs-datastore-config-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	spec := make(map[string]interface{})
+	err = json.Unmarshal(tieredConfig, &spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dsc, err := fsrepo.AnyDatastoreConfig(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"mounts":[{"cold":{"path":"blocks","shardFunc":"/repo/flatfs/shard/v1/next-to-last/2","type":"flatfs"},"hot":{"path":"hot","type":"levelds"},"mountpoint":"/blocks","type":"tiered"},{"mountpoint":"/"}],"type":"mount"}`
+	if dsc.DiskSpec().String() != expected {
+		t.Errorf("expected '%s' got '%s' as DiskId", expected, dsc.DiskSpec().String())
+	}
+
+	cfg, err := config.Init(ioutil.Discard, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Datastore.Spec = spec
+	if err := fsrepo.Init(dir, cfg); err != nil {
+		t.Fatal(err)
+	}
+	r, err := fsrepo.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	key := datastore.NewKey("/blocks/A")
+	if err := r.Datastore().Put(key, []byte("block")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Datastore().Get(key); err != nil {
+		t.Fatal(err)
+	}
+	tiers, err := r.DatastoreTiers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tiers) != 1 || tiers[0].Mountpoint != "/blocks" {
+		t.Fatalf("expected a tiered datastore mounted at /blocks, got %+v", tiers)
+	}
+	if tiers[0].HotReads != 1 || tiers[0].ColdReads != 0 {
+		t.Errorf("expected the block to be read from the hot tier, got %+v", tiers[0])
+	}
+}
+
+var encryptConfig = []byte(`{
+      "type": "encrypt",
+      "env": "IPFS_TEST_DATASTORE_KEY",
+      "child": {
+        "type": "compress",
+        "algorithm": "gzip",
+        "child": {
+          "compression": "none",
+          "path": "datastore",
+          "type": "levelds"
+        }
+      }
+}`)
+
+func TestEncryptConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipfs-datastore-config-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	spec := make(map[string]interface{})
+	err = json.Unmarshal(encryptConfig, &spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dsc, err := fsrepo.AnyDatastoreConfig(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"child":{"algorithm":"gzip","child":{"path":"datastore","type":"levelds"},"type":"compress"},"type":"encrypt"}`
+	if dsc.DiskSpec().String() != expected {
+		t.Errorf("expected '%s' got '%s' as DiskId", expected, dsc.DiskSpec().String())
+	}
+
+	os.Unsetenv("IPFS_TEST_DATASTORE_KEY")
+	if _, err := dsc.Create(dir); err == nil {
+		t.Fatal("expected an error without a key")
+	}
+	os.Setenv("IPFS_TEST_DATASTORE_KEY", strings.Repeat("ab", 32))
+	defer os.Unsetenv("IPFS_TEST_DATASTORE_KEY")
+
+	ds, err := dsc.Create(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+	key := datastore.NewKey("/secret")
+	if err := ds.Put(key, []byte("private")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := ds.Get(key); err != nil || string(v) != "private" {
+		t.Errorf("expected %q, got %q, %v", "private", v, err)
+	}
+
+	os.Setenv("IPFS_TEST_DATASTORE_KEY", strings.Repeat("cd", 32))
+	if _, err := dsc.Create(dir); err == nil {
+		t.Error("expected an error with another key than the datastore was created with")
+	}
+
+	spec["keystore"] = "dskey"
+	if _, err := fsrepo.AnyDatastoreConfig(spec); err == nil {
+		t.Error("expected an error with two key sources")
+	}
+}
+
+var mirrorConfig = []byte(`{
+      "mounts": [
+        {
+          "mountpoint": "/blocks",
+          "type": "mirror",
+          "replicas": [
+            {
+              "path": "blocks",
+              "shardFunc": "/repo/flatfs/shard/v1/next-to-last/2",
+              "sync": true,
+              "type": "flatfs"
+            },
+            {
+              "path": "blocks-mirror",
+              "shardFunc": "/repo/flatfs/shard/v1/next-to-last/2",
+              "sync": true,
+              "type": "flatfs"
+            }
+          ]
+        },
+        {
+          "mountpoint": "/",
+          "type": "mem"
+        }
+      ],
+      "type": "mount"
+}`)
+
+func TestMirrorConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipfs-datastore-config-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	spec := make(map[string]interface{})
+	err = json.Unmarshal(mirrorConfig, &spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Init(ioutil.Discard, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Datastore.Spec = spec
+	if err := fsrepo.Init(dir, cfg); err != nil {
+		t.Fatal(err)
+	}
+	r, err := fsrepo.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	blk := blocks.NewBlock([]byte("mirrored block"))
+	key := datastore.NewKey("/blocks").Child(dshelp.CidToDsKey(blk.Cid()))
+	if err := r.Datastore().Put(key, blk.RawData()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lose the block on the second replica.
+	err = filepath.Walk(filepath.Join(dir, "blocks-mirror"), func(p string, info os.FileInfo, err error) error {
+		if err == nil && strings.HasSuffix(p, ".data") {
+			return os.Remove(p)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var problems []repo.ScrubProblem
+	stats, err := r.ScrubDatastores(context.Background(), true, func(p repo.ScrubProblem) {
+		problems = append(problems, p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Mountpoint != "/blocks" || stats[0].Keys != 1 || stats[0].Repaired != 1 {
+		t.Fatalf("unexpected scrub stats %+v", stats)
+	}
+	if len(problems) != 1 || problems[0].Replica != 1 || problems[0].Kind != "missing" {
+		t.Fatalf("expected the block to be missing from the second replica, got %+v", problems)
+	}
+
+	stats, err = r.ScrubDatastores(context.Background(), false, func(repo.ScrubProblem) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats[0].Problems != 0 {
+		t.Errorf("expected the replica to be repaired, got %+v", stats[0])
+	}
+}
+
+func TestMirrorBelowCompress(t *testing.T) {
+	spec := map[string]interface{}{
+		"type":      "compress",
+		"algorithm": "gzip",
+		"child": map[string]interface{}{
+			"type": "mirror",
+			"replicas": []interface{}{
+				map[string]interface{}{"type": "mem"},
+				map[string]interface{}{"type": "mem"},
+			},
+		},
+	}
+	dsc, err := fsrepo.AnyDatastoreConfig(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := dsc.Create("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	// The mirror only sees compressed blocks, which don't match their CID.
+	blk := blocks.NewBlock([]byte(strings.Repeat("compressible block ", 100)))
+	key := datastore.NewKey("/blocks").Child(dshelp.CidToDsKey(blk.Cid()))
+	if err := d.Put(key, blk.RawData()); err != nil {
+		t.Fatal(err)
+	}
+	v, err := d.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v) != string(blk.RawData()) {
+		t.Error("got a different block back")
+	}
+}
@@ -0,0 +1,586 @@
+package fsrepo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	repo "github.com/ipsn/go-ipfs/repo"
+
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	query "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/query"
+	lockfile "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-fs-lock"
+	config "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-config"
+	serialize "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-config/serialize"
+	util "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-util"
+)
+
+const (
+	// convertDir holds the new datastore while a conversion is in progress.
+	convertDir = "datastore-convert"
+	// convertBackupDir holds the old datastore while it is being swapped out.
+	convertBackupDir = "datastore-convert-backup"
+	// convertJournalFile records a datastore swap until it is complete.
+	convertJournalFile = "datastore-convert-journal"
+	// convertCheckpointFile records the progress of an interrupted
+	// conversion, relative to convertDir.
+	convertCheckpointFile = "checkpoint"
+)
+
+// ConvertCheckpointInterval is the number of keys copied between two
+// checkpoints of a datastore conversion.
+var ConvertCheckpointInterval = 1024
+
+// Datastore conversion phases, as reported by ConvertProgress.
+const (
+	ConvertPhaseCopy   = "copy"
+	ConvertPhaseVerify = "verify"
+	ConvertPhaseSwap   = "swap"
+)
+
+// ConvertProgress describes the progress of a datastore conversion.
+type ConvertProgress struct {
+	Phase string
+	// Keys is the number of keys processed so far in this phase.
+	Keys int
+	// Resumed is the number of keys found already copied by an interrupted
+	// conversion.
+	Resumed int
+}
+
+type convertCheckpoint struct {
+	From string
+	To   string
+	Keys int
+}
+
+// ConvertDatastore copies every key of the datastore of the repo at repoPath
+// into a new datastore created from spec and makes it the repo's datastore.
+//
+// The new datastore is built inside the repo next to the old one and is only
+// swapped in, together with the Datastore.Spec config entry and the
+// datastore_spec file, once all keys have been copied and verified. The swap
+// is journaled: if it is interrupted, it is finished or rolled back the next
+// time the repo is opened. An interrupted conversion to the same spec resumes
+// from its last checkpoint.
+//
+// If the repo is open in this process, as it is in a running daemon, the
+// datastore is converted while it is in use, see convertOnline.
+func ConvertDatastore(ctx context.Context, repoPath string, spec map[string]interface{}, progress func(ConvertProgress)) error {
+	if progress == nil {
+		progress = func(ConvertProgress) {}
+	}
+
+	r, err := newFSRepo(repoPath)
+	if err != nil {
+		return err
+	}
+
+	packageLock.Lock()
+	open := openRepos[r.path]
+	packageLock.Unlock()
+	if open != nil {
+		return open.convertOnline(ctx, spec, progress)
+	}
+	return r.convertOffline(ctx, spec, progress)
+}
+
+func (r *FSRepo) convertOffline(ctx context.Context, spec map[string]interface{}, progress func(ConvertProgress)) error {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	if err := checkInitialized(r.path); err != nil {
+		return err
+	}
+
+	lock, err := lockfile.Lock(r.path, LockFile)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	if err := r.recoverSwap(); err != nil {
+		return err
+	}
+	if err := r.openConfig(); err != nil {
+		return err
+	}
+	if r.config.Datastore.Spec == nil {
+		return fmt.Errorf("required Datastore.Spec entry missing from config file")
+	}
+
+	from, err := AnyDatastoreConfig(r.config.Datastore.Spec)
+	if err != nil {
+		return err
+	}
+	to, err := AnyDatastoreConfig(spec)
+	if err != nil {
+		return err
+	}
+	fromSpec, toSpec := from.DiskSpec().String(), to.DiskSpec().String()
+
+	oldSpec, err := r.readSpec()
+	if err != nil {
+		return err
+	}
+	if oldSpec != fromSpec {
+		return fmt.Errorf("datastore configuration of '%s' does not match what is on disk '%s'; "+
+			"restore Datastore.Spec and let 'ipfs repo convert' change it", fromSpec, oldSpec)
+	}
+	if fromSpec == toSpec {
+		return fmt.Errorf("datastore is already stored as '%s'", toSpec)
+	}
+
+	fromPaths, err := diskSpecPaths(from.DiskSpec())
+	if err != nil {
+		return err
+	}
+	toPaths, err := diskSpecPaths(to.DiskSpec())
+	if err != nil {
+		return err
+	}
+	if err := r.checkConvertPaths(fromPaths, toPaths); err != nil {
+		return err
+	}
+
+	cp, err := r.prepareConvertDir(fromSpec, toSpec)
+	if err != nil {
+		return err
+	}
+
+	src, err := from.Create(r.path)
+	if err != nil {
+		return err
+	}
+	dst, err := to.Create(filepath.Join(r.path, convertDir))
+	if err != nil {
+		src.Close()
+		return err
+	}
+
+	err = r.copyDatastore(ctx, src, dst, cp, progress)
+	if err == nil {
+		err = verifyDatastore(ctx, src, dst, progress)
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := src.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	progress(ConvertProgress{Phase: ConvertPhaseSwap})
+	j, err := r.commitSwap(spec, to.DiskSpec(), fromPaths, toPaths)
+	if err != nil {
+		return err
+	}
+	return r.finishSwap(j)
+}
+
+// diskSpecPaths returns the repo relative paths of the on-disk datastores
+// described by spec.
+func diskSpecPaths(spec map[string]interface{}) ([]string, error) {
+	var paths []string
+	if p, ok := spec["path"].(string); ok {
+		if filepath.IsAbs(p) {
+			return nil, fmt.Errorf("cannot convert datastores outside of the repo: %s", p)
+		}
+		paths = append(paths, filepath.Clean(p))
+	}
+
+	children, _ := spec["mounts"].([]interface{})
+	replicas, _ := spec["replicas"].([]interface{})
+	children = append(children, replicas...)
+	for _, field := range []string{"child", "hot", "cold"} {
+		if child, ok := spec[field]; ok {
+			children = append(children, child)
+		}
+	}
+	for _, c := range children {
+		var cspec map[string]interface{}
+		switch c := c.(type) {
+		case DiskSpec:
+			cspec = c
+		case map[string]interface{}:
+			cspec = c
+		default:
+			continue
+		}
+		cp, err := diskSpecPaths(cspec)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, cp...)
+	}
+	return paths, nil
+}
+
+// checkConvertPaths makes sure the new datastore won't overwrite anything
+// but the old one when it is moved into place.
+func (r *FSRepo) checkConvertPaths(fromPaths, toPaths []string) error {
+	old := make(map[string]bool, len(fromPaths))
+	for _, p := range fromPaths {
+		old[p] = true
+	}
+	for _, p := range toPaths {
+		if p == convertDir || p == convertBackupDir {
+			return fmt.Errorf("datastore path %q is reserved", p)
+		}
+		if old[p] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(r.path, p)); err == nil {
+			return fmt.Errorf("datastore path %q already exists in the repo", p)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareConvertDir sets up the directory the new datastore is built in,
+// keeping the work of a previous conversion to the same spec.
+func (r *FSRepo) prepareConvertDir(from, to string) (*convertCheckpoint, error) {
+	dir := filepath.Join(r.path, convertDir)
+	cp := &convertCheckpoint{From: from, To: to}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, convertCheckpointFile))
+	if err == nil {
+		var prev convertCheckpoint
+		if json.Unmarshal(b, &prev) == nil && prev.From == from && prev.To == to {
+			return &prev, nil
+		}
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	return cp, writeCheckpoint(dir, cp)
+}
+
+func writeCheckpoint(dir string, cp *convertCheckpoint) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, convertCheckpointFile), b)
+}
+
+// copyDatastore copies all keys from src to dst in batches, writing a
+// checkpoint after each one. Keys already present in dst are skipped, so an
+// interrupted copy picks up where it left off.
+func (r *FSRepo) copyDatastore(ctx context.Context, src, dst repo.Datastore, cp *convertCheckpoint, progress func(ConvertProgress)) error {
+	// Not all datastores (flatfs) can list values, fetch them one by one.
+	res, err := src.Query(query.Query{KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	dir := filepath.Join(r.path, convertDir)
+	p := ConvertProgress{Phase: ConvertPhaseCopy}
+	resume := cp.Keys > 0
+	var batch ds.Batch
+	pending := 0
+
+	commit := func() error {
+		if batch != nil {
+			if err := batch.Commit(); err != nil {
+				return err
+			}
+			batch = nil
+		}
+		pending = 0
+		cp.Keys = p.Keys
+		if err := writeCheckpoint(dir, cp); err != nil {
+			return err
+		}
+		progress(p)
+		return nil
+	}
+
+	for e := range res.Next() {
+		if e.Error != nil {
+			return e.Error
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		k := ds.NewKey(e.Key)
+		p.Keys++
+		if resume {
+			has, err := dst.Has(k)
+			if err != nil {
+				return err
+			}
+			if has {
+				p.Resumed++
+				continue
+			}
+		}
+
+		if batch == nil {
+			batch, err = dst.Batch()
+			if err == ds.ErrBatchUnsupported {
+				batch = unbatched{dst}
+			} else if err != nil {
+				return err
+			}
+		}
+		v, err := src.Get(k)
+		if err != nil {
+			return err
+		}
+		if err := batch.Put(k, v); err != nil {
+			return err
+		}
+		pending++
+		if pending >= ConvertCheckpointInterval {
+			if err := commit(); err != nil {
+				return err
+			}
+		}
+	}
+	return commit()
+}
+
+// unbatched writes straight through to datastores that don't support
+// batching.
+type unbatched struct {
+	ds.Datastore
+}
+
+func (unbatched) Commit() error { return nil }
+
+// verifyDatastore checks that every key of src is present in dst with the
+// same value.
+func verifyDatastore(ctx context.Context, src, dst repo.Datastore, progress func(ConvertProgress)) error {
+	res, err := src.Query(query.Query{KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	p := ConvertProgress{Phase: ConvertPhaseVerify}
+	for e := range res.Next() {
+		if e.Error != nil {
+			return e.Error
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		k := ds.NewKey(e.Key)
+		orig, err := src.Get(k)
+		if err != nil {
+			return err
+		}
+		v, err := dst.Get(k)
+		if err != nil {
+			return fmt.Errorf("verifying %s: %s", e.Key, err)
+		}
+		if !bytes.Equal(v, orig) {
+			return fmt.Errorf("verifying %s: value differs from the original", e.Key)
+		}
+
+		p.Keys++
+		if p.Keys%ConvertCheckpointInterval == 0 {
+			progress(p)
+		}
+	}
+	progress(p)
+	return nil
+}
+
+// convertJournal records a datastore swap in progress, so that a swap
+// interrupted by a crash can be finished or rolled back.
+type convertJournal struct {
+	// DiskSpec is the new contents of the datastore_spec file. The swap is
+	// committed once the file holds it.
+	DiskSpec string
+	// OldConfig is the config file from before the swap.
+	OldConfig []byte
+	FromPaths []string
+	ToPaths   []string
+}
+
+// commitSwap points the config and the datastore_spec file at the converted
+// datastore, journaling the swap first. The datastores are not moved yet, see
+// finishSwap.
+func (r *FSRepo) commitSwap(spec map[string]interface{}, diskSpec DiskSpec, fromPaths, toPaths []string) (*convertJournal, error) {
+	// Once committed, a missing staged datastore is taken as already moved
+	// into place, so make sure they are all there.
+	for _, p := range toPaths {
+		if _, err := os.Stat(filepath.Join(r.path, convertDir, p)); err != nil {
+			return nil, fmt.Errorf("converted datastore is incomplete: %s", err)
+		}
+	}
+
+	configFilename, err := config.Filename(r.path)
+	if err != nil {
+		return nil, err
+	}
+	oldConfig, err := ioutil.ReadFile(configFilename)
+	if err != nil {
+		return nil, err
+	}
+	j := &convertJournal{
+		DiskSpec:  diskSpec.String(),
+		OldConfig: oldConfig,
+		FromPaths: fromPaths,
+		ToPaths:   toPaths,
+	}
+	b, err := json.Marshal(j)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filepath.Join(r.path, convertJournalFile), b); err != nil {
+		return nil, err
+	}
+
+	err = r.writeDatastoreSpec(configFilename, spec)
+	if err == nil {
+		var specFilename string
+		specFilename, err = config.Path(r.path, specFn)
+		if err == nil {
+			err = writeFileAtomic(specFilename, diskSpec.Bytes())
+		}
+	}
+	if err != nil {
+		if rerr := r.rollbackSwap(j); rerr != nil {
+			log.Errorf("failed to roll back datastore conversion: %s", rerr)
+		}
+		return nil, err
+	}
+	return j, nil
+}
+
+// writeDatastoreSpec sets Datastore.Spec in the config file, leaving the
+// other entries as they are.
+func (r *FSRepo) writeDatastoreSpec(configFilename string, spec map[string]interface{}) error {
+	var mapconf map[string]interface{}
+	if err := serialize.ReadConfigFile(configFilename, &mapconf); err != nil {
+		return err
+	}
+	dsconf, ok := mapconf["Datastore"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("Datastore entry missing from config file")
+	}
+	dsconf["Spec"] = spec
+	return serialize.WriteConfigFile(configFilename, mapconf)
+}
+
+// finishSwap moves a committed datastore swap into place: the old datastore
+// goes into the backup directory and the converted one out of the staging
+// directory, then both are removed. It can be run again if it is interrupted.
+func (r *FSRepo) finishSwap(j *convertJournal) error {
+	backup := filepath.Join(r.path, convertBackupDir)
+	staging := filepath.Join(r.path, convertDir)
+
+	staged := make(map[string]bool, len(j.ToPaths))
+	for _, p := range j.ToPaths {
+		staged[p] = util.FileExists(filepath.Join(staging, p))
+	}
+	move := func(from, to string) error {
+		if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+			return err
+		}
+		return os.Rename(from, to)
+	}
+
+	for _, p := range j.FromPaths {
+		if moved, ok := staged[p]; ok && !moved {
+			// The converted datastore is already in its place.
+			continue
+		}
+		if util.FileExists(filepath.Join(r.path, p)) {
+			if err := move(filepath.Join(r.path, p), filepath.Join(backup, p)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, p := range j.ToPaths {
+		if staged[p] {
+			if err := move(filepath.Join(staging, p), filepath.Join(r.path, p)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := os.Remove(filepath.Join(r.path, convertJournalFile)); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(staging); err != nil {
+		log.Warningf("failed to remove %s: %s", staging, err)
+	}
+	if err := os.RemoveAll(backup); err != nil {
+		log.Warningf("failed to remove the old datastore in %s: %s", backup, err)
+	}
+	return nil
+}
+
+// rollbackSwap undoes a datastore swap that wasn't committed. Nothing was
+// moved yet, so only the config needs to be restored.
+func (r *FSRepo) rollbackSwap(j *convertJournal) error {
+	configFilename, err := config.Filename(r.path)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(configFilename, j.OldConfig); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(r.path, convertJournalFile))
+}
+
+// recoverSwap finishes or rolls back a datastore swap left behind by a crash
+// or by a conversion done while the repo was open.
+func (r *FSRepo) recoverSwap() error {
+	b, err := ioutil.ReadFile(filepath.Join(r.path, convertJournalFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var j convertJournal
+	if err := json.Unmarshal(b, &j); err != nil {
+		return fmt.Errorf("invalid datastore conversion journal: %s", err)
+	}
+
+	spec, err := r.readSpec()
+	if err != nil {
+		return err
+	}
+	if spec != j.DiskSpec {
+		log.Warning("rolling back an interrupted datastore conversion")
+		return r.rollbackSwap(&j)
+	}
+	if err := r.finishSwap(&j); err != nil {
+		return fmt.Errorf("failed to finish the datastore conversion: %s", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the contents of fn so that readers either see the
+// old or the new contents.
+func writeFileAtomic(fn string, data []byte) error {
+	tmp := fn + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
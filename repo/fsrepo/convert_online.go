@@ -0,0 +1,400 @@
+package fsrepo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	repo "github.com/ipsn/go-ipfs/repo"
+
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	query "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/query"
+)
+
+// convertLock serializes the conversions of open repos.
+var convertLock sync.Mutex
+
+// convertOnline converts the datastore of the open repo r while it is in use.
+//
+// Writes made while the keys are copied and verified go to both datastores.
+// The new datastore is swapped in without closing the repo: it keeps running
+// from the staging directory and the old one stays open for the readers that
+// still use it, until the repo is closed. Both are moved into place the next
+// time the repo is opened. Unlike offline conversions, an interrupted online
+// conversion starts over.
+func (r *FSRepo) convertOnline(ctx context.Context, spec map[string]interface{}, progress func(ConvertProgress)) error {
+	convertLock.Lock()
+	defer convertLock.Unlock()
+
+	packageLock.Lock()
+	closed, from, sds := r.closed, r.dsc, r.sds
+	packageLock.Unlock()
+	if closed {
+		return errors.New("cannot convert the datastore, repo not open")
+	}
+
+	to, err := AnyDatastoreConfig(spec)
+	if err != nil {
+		return err
+	}
+	fromSpec, toSpec := from.DiskSpec().String(), to.DiskSpec().String()
+	if fromSpec == toSpec {
+		return fmt.Errorf("datastore is already stored as '%s'", toSpec)
+	}
+
+	fromPaths, err := diskSpecPaths(from.DiskSpec())
+	if err != nil {
+		return err
+	}
+	toPaths, err := diskSpecPaths(to.DiskSpec())
+	if err != nil {
+		return err
+	}
+	if err := r.checkConvertPaths(fromPaths, toPaths); err != nil {
+		return err
+	}
+
+	staging := filepath.Join(r.path, convertDir)
+	if err := os.RemoveAll(staging); err != nil {
+		return err
+	}
+	if err := os.Mkdir(staging, 0755); err != nil {
+		return err
+	}
+	dst, err := to.Create(staging)
+	if err != nil {
+		return err
+	}
+
+	sds.startMirroring(dst)
+	err = sds.copyToMirror(ctx, progress)
+	if err == nil {
+		err = sds.verifyMirror(ctx, progress)
+	}
+	if err == nil {
+		progress(ConvertProgress{Phase: ConvertPhaseSwap})
+		err = sds.swap(func() error {
+			_, err := r.commitSwap(spec, to.DiskSpec(), fromPaths, toPaths)
+			return err
+		})
+	}
+	if err != nil {
+		sds.stopMirroring()
+		dst.Close()
+		if rerr := os.RemoveAll(staging); rerr != nil {
+			log.Warningf("failed to remove %s: %s", staging, rerr)
+		}
+		return err
+	}
+
+	packageLock.Lock()
+	defer packageLock.Unlock()
+	conf, err := r.config.Clone()
+	if err != nil {
+		return err
+	}
+	conf.Datastore.Spec = spec
+	r.config = conf
+	r.dsc = to
+	return nil
+}
+
+// swappableDatastore is the datastore of an open repo. While the datastore is
+// converted, it mirrors the writes to the new datastore until it swaps it in.
+type swappableDatastore struct {
+	// lk guards cur and retired, and is held for writing to swap them.
+	lk      sync.RWMutex
+	cur     repo.Datastore
+	retired []repo.Datastore
+
+	// writeLk is held for reading by writes, and for writing when keys are
+	// copied or verified so that they don't race with writes.
+	writeLk sync.RWMutex
+	mirror  repo.Datastore
+
+	// mirrorErr is the first error writing to the mirror, guarded by
+	// mirrorErrLk as concurrent writes may set it.
+	mirrorErrLk sync.Mutex
+	mirrorErr   error
+}
+
+var _ repo.Datastore = (*swappableDatastore)(nil)
+var _ ds.PersistentDatastore = (*swappableDatastore)(nil)
+
+func (d *swappableDatastore) current() repo.Datastore {
+	d.lk.RLock()
+	defer d.lk.RUnlock()
+	return d.cur
+}
+
+func (d *swappableDatastore) Get(key ds.Key) ([]byte, error) {
+	return d.current().Get(key)
+}
+
+func (d *swappableDatastore) Has(key ds.Key) (bool, error) {
+	return d.current().Has(key)
+}
+
+func (d *swappableDatastore) GetSize(key ds.Key) (int, error) {
+	return d.current().GetSize(key)
+}
+
+func (d *swappableDatastore) Query(q query.Query) (query.Results, error) {
+	return d.current().Query(q)
+}
+
+func (d *swappableDatastore) Put(key ds.Key, value []byte) error {
+	return d.write(func(dst repo.Datastore) error { return dst.Put(key, value) })
+}
+
+func (d *swappableDatastore) Delete(key ds.Key) error {
+	return d.write(func(dst repo.Datastore) error { return dst.Delete(key) })
+}
+
+// write applies op to the current datastore and to the mirror, if any. A
+// failure on the mirror fails the conversion, not the write.
+func (d *swappableDatastore) write(op func(repo.Datastore) error) error {
+	d.writeLk.RLock()
+	defer d.writeLk.RUnlock()
+
+	if err := op(d.current()); err != nil {
+		return err
+	}
+	if d.mirror != nil {
+		if err := op(d.mirror); err != nil && err != ds.ErrNotFound {
+			d.setMirrorErr(err)
+		}
+	}
+	return nil
+}
+
+func (d *swappableDatastore) setMirrorErr(err error) {
+	d.mirrorErrLk.Lock()
+	defer d.mirrorErrLk.Unlock()
+	if d.mirrorErr == nil {
+		d.mirrorErr = err
+	}
+}
+
+// Batch records the operations and applies them on Commit, so that a batch
+// created before a swap is committed to the datastore in use.
+func (d *swappableDatastore) Batch() (ds.Batch, error) {
+	return &swappableBatch{d: d}, nil
+}
+
+type swappableBatch struct {
+	d   *swappableDatastore
+	ops []func(ds.Write) error
+}
+
+func (b *swappableBatch) Put(key ds.Key, value []byte) error {
+	b.ops = append(b.ops, func(dst ds.Write) error { return dst.Put(key, value) })
+	return nil
+}
+
+func (b *swappableBatch) Delete(key ds.Key) error {
+	b.ops = append(b.ops, func(dst ds.Write) error { return dst.Delete(key) })
+	return nil
+}
+
+func (b *swappableBatch) Commit() error {
+	return b.d.write(func(dst repo.Datastore) error {
+		batch, err := newBatch(dst)
+		if err != nil {
+			return err
+		}
+		for _, op := range b.ops {
+			if err := op(batch); err != nil {
+				return err
+			}
+		}
+		return batch.Commit()
+	})
+}
+
+func newBatch(d repo.Datastore) (ds.Batch, error) {
+	b, err := d.Batch()
+	if err == ds.ErrBatchUnsupported {
+		return unbatched{d}, nil
+	}
+	return b, err
+}
+
+func (d *swappableDatastore) Close() error {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+
+	err := d.cur.Close()
+	for _, old := range d.retired {
+		if cerr := old.Close(); err == nil {
+			err = cerr
+		}
+	}
+	d.retired = nil
+	return err
+}
+
+func (d *swappableDatastore) DiskUsage() (uint64, error) {
+	return ds.DiskUsage(d.current())
+}
+
+func (d *swappableDatastore) Check() error {
+	if c, ok := d.current().(ds.CheckedDatastore); ok {
+		return c.Check()
+	}
+	return nil
+}
+
+func (d *swappableDatastore) Scrub() error {
+	if c, ok := d.current().(ds.ScrubbedDatastore); ok {
+		return c.Scrub()
+	}
+	return nil
+}
+
+func (d *swappableDatastore) CollectGarbage() error {
+	if c, ok := d.current().(ds.GCDatastore); ok {
+		return c.CollectGarbage()
+	}
+	return nil
+}
+
+func (d *swappableDatastore) startMirroring(dst repo.Datastore) {
+	d.writeLk.Lock()
+	defer d.writeLk.Unlock()
+	d.mirror = dst
+	d.mirrorErr = nil
+}
+
+func (d *swappableDatastore) stopMirroring() {
+	d.writeLk.Lock()
+	defer d.writeLk.Unlock()
+	d.mirror = nil
+}
+
+// swap makes the mirror the current datastore once commit succeeds. Writes
+// are held off meanwhile, so none is lost.
+func (d *swappableDatastore) swap(commit func() error) error {
+	d.writeLk.Lock()
+	defer d.writeLk.Unlock()
+
+	if d.mirrorErr != nil {
+		return fmt.Errorf("writing to the converted datastore: %s", d.mirrorErr)
+	}
+	if err := commit(); err != nil {
+		return err
+	}
+
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	d.retired = append(d.retired, d.cur)
+	d.cur = d.mirror
+	d.mirror = nil
+	return nil
+}
+
+// eachKeys calls fn with the keys of the current datastore, in chunks of
+// ConvertCheckpointInterval keys, holding off writes during each call. fn
+// returns the number of keys it processed, reported as the progress of phase.
+func (d *swappableDatastore) eachKeys(ctx context.Context, phase string, progress func(ConvertProgress), fn func(src repo.Datastore, keys []ds.Key) (int, error)) error {
+	src := d.current()
+	res, err := src.Query(query.Query{KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	p := ConvertProgress{Phase: phase}
+	call := func(keys []ds.Key) error {
+		d.writeLk.Lock()
+		if d.mirrorErr != nil {
+			d.writeLk.Unlock()
+			return fmt.Errorf("writing to the converted datastore: %s", d.mirrorErr)
+		}
+		n, err := fn(src, keys)
+		d.writeLk.Unlock()
+		if err != nil {
+			return err
+		}
+
+		// Report progress without holding off writes.
+		p.Keys += n
+		progress(p)
+		return nil
+	}
+
+	keys := make([]ds.Key, 0, ConvertCheckpointInterval)
+	for e := range res.Next() {
+		if e.Error != nil {
+			return e.Error
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		keys = append(keys, ds.NewKey(e.Key))
+		if len(keys) >= ConvertCheckpointInterval {
+			if err := call(keys); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+	return call(keys)
+}
+
+// copyToMirror copies the keys of the current datastore to the mirror. Keys
+// deleted since they were listed are skipped: the mirror saw the delete.
+func (d *swappableDatastore) copyToMirror(ctx context.Context, progress func(ConvertProgress)) error {
+	return d.eachKeys(ctx, ConvertPhaseCopy, progress, func(src repo.Datastore, keys []ds.Key) (int, error) {
+		batch, err := newBatch(d.mirror)
+		if err != nil {
+			return 0, err
+		}
+		n := 0
+		for _, k := range keys {
+			v, err := src.Get(k)
+			if err == ds.ErrNotFound {
+				continue
+			} else if err != nil {
+				return 0, err
+			}
+			if err := batch.Put(k, v); err != nil {
+				return 0, err
+			}
+			n++
+		}
+		return n, batch.Commit()
+	})
+}
+
+// verifyMirror checks that every key of the current datastore is present in
+// the mirror with the same value.
+func (d *swappableDatastore) verifyMirror(ctx context.Context, progress func(ConvertProgress)) error {
+	return d.eachKeys(ctx, ConvertPhaseVerify, progress, func(src repo.Datastore, keys []ds.Key) (int, error) {
+		n := 0
+		for _, k := range keys {
+			orig, err := src.Get(k)
+			if err == ds.ErrNotFound {
+				continue
+			} else if err != nil {
+				return 0, err
+			}
+			v, err := d.mirror.Get(k)
+			if err != nil {
+				return 0, fmt.Errorf("verifying %s: %s", k, err)
+			}
+			if !bytes.Equal(v, orig) {
+				return 0, fmt.Errorf("verifying %s: value differs from the original", k)
+			}
+			n++
+		}
+		return n, nil
+	})
+}
@@ -0,0 +1,414 @@
+package fsrepo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	repo "github.com/ipsn/go-ipfs/repo"
+
+	datastore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	query "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/query"
+	flatfs "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ds-flatfs"
+	levelds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ds-leveldb"
+	config "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-config"
+)
+
+// convertTestDatastoreConfig stands in for the flatfs and levelds plugins,
+// which can't be imported from here. It creates a flatfs datastore when a
+// shard function is given and a leveldb one otherwise.
+type convertTestDatastoreConfig struct {
+	path  string
+	shard string
+}
+
+func init() {
+	AddDatastoreConfigHandler("converttest", func(params map[string]interface{}) (DatastoreConfig, error) {
+		path, _ := params["path"].(string)
+		shard, _ := params["shardFunc"].(string)
+		return &convertTestDatastoreConfig{path, shard}, nil
+	})
+}
+
+func (c *convertTestDatastoreConfig) DiskSpec() DiskSpec {
+	spec := DiskSpec{"type": "converttest", "path": c.path}
+	if c.shard != "" {
+		spec["shardFunc"] = c.shard
+	}
+	return spec
+}
+
+func (c *convertTestDatastoreConfig) Create(path string) (repo.Datastore, error) {
+	p := filepath.Join(path, c.path)
+	if c.shard == "" {
+		return levelds.NewDatastore(p, nil)
+	}
+	shard, err := flatfs.ParseShardFunc(c.shard)
+	if err != nil {
+		return nil, err
+	}
+	return flatfs.CreateOrOpen(p, shard, false)
+}
+
+func convertTestSpec(shard string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "mount",
+		"mounts": []interface{}{
+			map[string]interface{}{
+				"mountpoint": "/blocks",
+				"type":       "converttest",
+				"path":       "blocks",
+				"shardFunc":  shard,
+			},
+			map[string]interface{}{
+				"mountpoint": "/",
+				"type":       "converttest",
+				"path":       "datastore",
+			},
+		},
+	}
+}
+
+func TestConvertDatastore(t *testing.T) {
+	defer func(interval int) { ConvertCheckpointInterval = interval }(ConvertCheckpointInterval)
+	ConvertCheckpointInterval = 3
+
+	path := testRepoPath("convert", t)
+	defer os.RemoveAll(path)
+
+	from := convertTestSpec("/repo/flatfs/shard/v1/next-to-last/2")
+	if err := Init(path, &config.Config{Datastore: config.Datastore{Spec: from}}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := make(map[datastore.Key][]byte)
+	for i := 0; i < 10; i++ {
+		entries[datastore.NewKey(fmt.Sprintf("/blocks/BLOCK%d", i))] = []byte(fmt.Sprintf("block %d", i))
+		entries[datastore.NewKey(fmt.Sprintf("/local/key%d", i))] = []byte(fmt.Sprintf("value %d", i))
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range entries {
+		if err := r.Datastore().Put(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	to := convertTestSpec("/repo/flatfs/shard/v1/prefix/3")
+
+	// Interrupt the conversion after the first checkpoint.
+	ctx, cancel := context.WithCancel(context.Background())
+	err = ConvertDatastore(ctx, path, to, func(p ConvertProgress) {
+		if p.Phase == ConvertPhaseCopy {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected the conversion to be canceled, got %v", err)
+	}
+
+	// The repo is left untouched.
+	r, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var last ConvertProgress
+	var verified int
+	err = ConvertDatastore(context.Background(), path, to, func(p ConvertProgress) {
+		switch p.Phase {
+		case ConvertPhaseCopy:
+			last = p
+		case ConvertPhaseVerify:
+			verified = p.Keys
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Keys != len(entries) || last.Resumed == 0 {
+		t.Errorf("expected to copy %d keys resuming from the checkpoint, got %+v", len(entries), last)
+	}
+	if verified != len(entries) {
+		t.Errorf("expected %d keys to be verified, got %d", len(entries), verified)
+	}
+
+	for _, dir := range []string{convertDir, convertBackupDir} {
+		if _, err := os.Stat(filepath.Join(path, dir)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", dir)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(path, "blocks", "BLO")); err != nil {
+		t.Errorf("expected blocks to be sharded by prefix: %s", err)
+	}
+
+	r, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range entries {
+		got, err := r.Datastore().Get(k)
+		if err != nil {
+			t.Fatalf("%s: %s", k, err)
+		}
+		if string(got) != string(v) {
+			t.Errorf("%s: expected %q, got %q", k, v, got)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ConvertDatastore(context.Background(), path, to, nil); err == nil {
+		t.Error("expected converting to the current datastore to fail")
+	}
+}
+
+// stageConversion copies the datastore of the repo at path into the staging
+// directory of a conversion to spec, like ConvertDatastore before the swap.
+func stageConversion(t *testing.T, path string, spec map[string]interface{}) (*FSRepo, []string, []string) {
+	r, err := newFSRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.openConfig(); err != nil {
+		t.Fatal(err)
+	}
+	from, err := AnyDatastoreConfig(r.config.Datastore.Spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := AnyDatastoreConfig(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromPaths, err := diskSpecPaths(from.DiskSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	toPaths, err := diskSpecPaths(to.DiskSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cp, err := r.prepareConvertDir(from.DiskSpec().String(), to.DiskSpec().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := from.Create(r.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	dst, err := to.Create(filepath.Join(r.path, convertDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if err := r.copyDatastore(context.Background(), src, dst, cp, func(ConvertProgress) {}); err != nil {
+		t.Fatal(err)
+	}
+	return r, fromPaths, toPaths
+}
+
+func TestConvertSwapRecovery(t *testing.T) {
+	path := testRepoPath("convertswap", t)
+	defer os.RemoveAll(path)
+
+	from := convertTestSpec("/repo/flatfs/shard/v1/next-to-last/2")
+	to := convertTestSpec("/repo/flatfs/shard/v1/prefix/3")
+	if err := Init(path, &config.Config{Datastore: config.Datastore{Spec: from}}); err != nil {
+		t.Fatal(err)
+	}
+
+	key, value := datastore.NewKey("/blocks/BLOCK"), []byte("block")
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Datastore().Put(key, value); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(spec map[string]interface{}) {
+		t.Helper()
+		r, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		if v, err := r.Datastore().Get(key); err != nil || string(v) != string(value) {
+			t.Errorf("expected %q, got %q (%v)", value, v, err)
+		}
+		cfg, err := r.Config()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := fmt.Sprint(cfg.Datastore.Spec), fmt.Sprint(spec); got != want {
+			t.Errorf("expected Datastore.Spec %s, got %s", want, got)
+		}
+		if _, err := os.Stat(filepath.Join(path, convertJournalFile)); !os.IsNotExist(err) {
+			t.Error("expected the journal to be removed")
+		}
+	}
+
+	// Crash after updating the config but before committing to the new
+	// datastore_spec: the swap is rolled back.
+	fr, fromPaths, toPaths := stageConversion(t, path, to)
+	toConfig, err := AnyDatastoreConfig(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fr.commitSwap(to, toConfig.DiskSpec(), fromPaths, toPaths); err != nil {
+		t.Fatal(err)
+	}
+	fromConfig, err := AnyDatastoreConfig(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	specFilename, err := config.Path(path, specFn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(specFilename, fromConfig.DiskSpec().Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	check(from)
+
+	// Crash after committing but before moving the datastores: the swap is
+	// finished.
+	fr, fromPaths, toPaths = stageConversion(t, path, to)
+	if _, err := fr.commitSwap(to, toConfig.DiskSpec(), fromPaths, toPaths); err != nil {
+		t.Fatal(err)
+	}
+	check(to)
+	for _, dir := range []string{convertDir, convertBackupDir} {
+		if _, err := os.Stat(filepath.Join(path, dir)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", dir)
+		}
+	}
+}
+
+func TestConvertDatastoreOnline(t *testing.T) {
+	defer func(interval int) { ConvertCheckpointInterval = interval }(ConvertCheckpointInterval)
+	ConvertCheckpointInterval = 3
+
+	path := testRepoPath("convertonline", t)
+	defer os.RemoveAll(path)
+
+	from := convertTestSpec("/repo/flatfs/shard/v1/next-to-last/2")
+	to := convertTestSpec("/repo/flatfs/shard/v1/prefix/3")
+	if err := Init(path, &config.Config{Datastore: config.Datastore{Spec: from}}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := r.Datastore()
+	entries := make(map[datastore.Key][]byte)
+	for i := 0; i < 20; i++ {
+		k := datastore.NewKey(fmt.Sprintf("/blocks/BLOCK%d", i))
+		entries[k] = []byte(fmt.Sprintf("block %d", i))
+		if err := d.Put(k, entries[k]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Write while the datastore is converted, from the progress callback so
+	// that writes land between copied chunks.
+	n := 0
+	err = ConvertDatastore(context.Background(), path, to, func(p ConvertProgress) {
+		if p.Phase != ConvertPhaseCopy {
+			return
+		}
+		k := datastore.NewKey(fmt.Sprintf("/blocks/BLOCK%d", n))
+		if err := d.Delete(k); err != nil {
+			t.Error(err)
+		}
+		delete(entries, k)
+
+		k = datastore.NewKey(fmt.Sprintf("/blocks/NEW%d", n))
+		entries[k] = []byte(fmt.Sprintf("new %d", n))
+		if err := d.Put(k, entries[k]); err != nil {
+			t.Error(err)
+		}
+		n++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(r repo.Repo) {
+		t.Helper()
+		res, err := r.Datastore().Query(query.Query{KeysOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		all, err := res.Rest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != len(entries) {
+			t.Errorf("expected %d keys, got %d", len(entries), len(all))
+		}
+		for k, v := range entries {
+			got, err := r.Datastore().Get(k)
+			if err != nil {
+				t.Fatalf("%s: %s", k, err)
+			}
+			if string(got) != string(v) {
+				t.Errorf("%s: expected %q, got %q", k, v, got)
+			}
+		}
+		cfg, err := r.Config()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := fmt.Sprint(cfg.Datastore.Spec), fmt.Sprint(to); got != want {
+			t.Errorf("expected Datastore.Spec %s, got %s", want, got)
+		}
+	}
+
+	// The repo keeps running from the converted datastore.
+	check(r)
+	k := datastore.NewKey("/blocks/AFTER")
+	entries[k] = []byte("after")
+	if err := d.Put(k, entries[k]); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// It is moved into place when the repo is opened again.
+	r, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	check(r)
+	if _, err := os.Stat(filepath.Join(path, "blocks", "BLO")); err != nil {
+		t.Errorf("expected blocks to be sharded by prefix: %s", err)
+	}
+	for _, f := range []string{convertDir, convertBackupDir, convertJournalFile} {
+		if _, err := os.Stat(filepath.Join(path, f)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", f)
+		}
+	}
+}
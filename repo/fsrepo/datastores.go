@@ -2,16 +2,30 @@ package fsrepo
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sort"
+	"strings"
+	"time"
 
+	"github.com/ipsn/go-ipfs/keystore"
 	"github.com/ipsn/go-ipfs/repo"
+	"github.com/ipsn/go-ipfs/thirdparty/mirror"
+	"github.com/ipsn/go-ipfs/thirdparty/tiered"
+	"github.com/ipsn/go-ipfs/thirdparty/valuetransform"
 
 	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/mount"
 	dssync "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/sync"
 	"github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ds-measure"
+	bstore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-blockstore"
+	dshelp "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-ds-help"
 )
 
 // ConfigFromMap creates a new datastore config from a map
@@ -57,10 +71,14 @@ var datastores map[string]ConfigFromMap
 
 func init() {
 	datastores = map[string]ConfigFromMap{
-		"mount":   MountDatastoreConfig,
-		"mem":     MemDatastoreConfig,
-		"log":     LogDatastoreConfig,
-		"measure": MeasureDatastoreConfig,
+		"mount":    MountDatastoreConfig,
+		"mem":      MemDatastoreConfig,
+		"log":      LogDatastoreConfig,
+		"measure":  MeasureDatastoreConfig,
+		"tiered":   TieredDatastoreConfig,
+		"compress": CompressDatastoreConfig,
+		"encrypt":  EncryptDatastoreConfig,
+		"mirror":   MirrorDatastoreConfig,
 	}
 }
 
@@ -246,3 +264,413 @@ func (c measureDatastoreConfig) Create(path string) (repo.Datastore, error) {
 	}
 	return measure.New(c.prefix, child), nil
 }
+
+// Defaults of the runtime parameters of tiered datastores.
+const (
+	DefaultTieredColdAfter       = 24 * time.Hour
+	DefaultTieredMigrateInterval = time.Hour
+)
+
+type tieredDatastoreConfig struct {
+	hot, cold DatastoreConfig
+	opts      tiered.Options
+
+	// ds is the datastore created from the config, for reporting stats.
+	ds *tiered.Datastore
+}
+
+// TieredDatastoreConfig returns a tiered DatastoreConfig from a spec
+func TieredDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error) {
+	c := &tieredDatastoreConfig{
+		opts: tiered.Options{
+			ColdAfter:       DefaultTieredColdAfter,
+			MigrateInterval: DefaultTieredMigrateInterval,
+		},
+	}
+
+	for _, tier := range []struct {
+		name string
+		dsc  *DatastoreConfig
+	}{{"hot", &c.hot}, {"cold", &c.cold}} {
+		field, ok := params[tier.name].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("'%s' field is missing or not a map", tier.name)
+		}
+		dsc, err := AnyDatastoreConfig(field)
+		if err != nil {
+			return nil, err
+		}
+		*tier.dsc = dsc
+	}
+
+	for _, opt := range []struct {
+		name string
+		d    *time.Duration
+	}{{"coldAfter", &c.opts.ColdAfter}, {"migrateInterval", &c.opts.MigrateInterval}} {
+		v, ok := params[opt.name]
+		if !ok {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("'%s' field was not a string", opt.name)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid '%s' field: %s", opt.name, err)
+		}
+		*opt.d = d
+	}
+
+	return c, nil
+}
+
+func (c *tieredDatastoreConfig) DiskSpec() DiskSpec {
+	return map[string]interface{}{
+		"type": "tiered",
+		"hot":  c.hot.DiskSpec(),
+		"cold": c.cold.DiskSpec(),
+	}
+}
+
+func (c *tieredDatastoreConfig) Create(path string) (repo.Datastore, error) {
+	hot, err := c.hot.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	cold, err := c.cold.Create(path)
+	if err != nil {
+		hot.Close()
+		return nil, err
+	}
+	c.ds = tiered.New(hot, cold, c.opts)
+	return c.ds, nil
+}
+
+// walkDatastoreConfigs calls fn with every datastore config in the tree of
+// dsc and the prefix it is mounted at.
+func walkDatastoreConfigs(dsc DatastoreConfig, prefix ds.Key, fn func(DatastoreConfig, ds.Key)) {
+	fn(dsc, prefix)
+	switch c := dsc.(type) {
+	case *mountDatastoreConfig:
+		for _, m := range c.mounts {
+			walkDatastoreConfigs(m.ds, prefix.Child(m.prefix), fn)
+		}
+	case *logDatastoreConfig:
+		walkDatastoreConfigs(c.child, prefix, fn)
+	case *measureDatastoreConfig:
+		walkDatastoreConfigs(c.child, prefix, fn)
+	case *tieredDatastoreConfig:
+		walkDatastoreConfigs(c.hot, prefix, fn)
+		walkDatastoreConfigs(c.cold, prefix, fn)
+	case *compressDatastoreConfig:
+		walkDatastoreConfigs(c.child, prefix, fn)
+	case *encryptDatastoreConfig:
+		walkDatastoreConfigs(c.child, prefix, fn)
+	case *mirrorDatastoreConfig:
+		for _, r := range c.replicas {
+			walkDatastoreConfigs(r, prefix, fn)
+		}
+	}
+}
+
+type compressDatastoreConfig struct {
+	child     DatastoreConfig
+	algorithm string
+}
+
+// CompressDatastoreConfig returns a compress DatastoreConfig from a spec
+func CompressDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error) {
+	childField, ok := params["child"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("'child' field is missing or not a map")
+	}
+	child, err := AnyDatastoreConfig(childField)
+	if err != nil {
+		return nil, err
+	}
+	unverifiedMirrors(child)
+
+	algorithm := valuetransform.Snappy
+	if v, ok := params["algorithm"]; ok {
+		algorithm, ok = v.(string)
+		if !ok {
+			return nil, fmt.Errorf("'algorithm' field was not a string")
+		}
+	}
+	if _, err := valuetransform.Compression(algorithm); err != nil {
+		return nil, err
+	}
+	return &compressDatastoreConfig{child, algorithm}, nil
+}
+
+func (c *compressDatastoreConfig) DiskSpec() DiskSpec {
+	return map[string]interface{}{
+		"type":      "compress",
+		"algorithm": c.algorithm,
+		"child":     c.child.DiskSpec(),
+	}
+}
+
+func (c *compressDatastoreConfig) Create(path string) (repo.Datastore, error) {
+	codec, err := valuetransform.Compression(c.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	child, err := c.child.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return valuetransform.Wrap(child, codec), nil
+}
+
+type encryptDatastoreConfig struct {
+	child DatastoreConfig
+	// Exactly one of keyName, the name of a key in the keystore, and keyEnv,
+	// an environment variable holding the hex encoded key, is set.
+	keyName string
+	keyEnv  string
+}
+
+// EncryptDatastoreConfig returns an encrypt DatastoreConfig from a spec
+func EncryptDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error) {
+	childField, ok := params["child"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("'child' field is missing or not a map")
+	}
+	child, err := AnyDatastoreConfig(childField)
+	if err != nil {
+		return nil, err
+	}
+	unverifiedMirrors(child)
+
+	c := &encryptDatastoreConfig{child: child}
+	for _, f := range []struct {
+		name  string
+		value *string
+	}{{"keystore", &c.keyName}, {"env", &c.keyEnv}} {
+		v, ok := params[f.name]
+		if !ok {
+			continue
+		}
+		if *f.value, ok = v.(string); !ok || *f.value == "" {
+			return nil, fmt.Errorf("'%s' field was not a string", f.name)
+		}
+	}
+	if (c.keyName == "") == (c.keyEnv == "") {
+		return nil, fmt.Errorf("expected exactly one of the 'keystore' and 'env' fields")
+	}
+	return c, nil
+}
+
+// DiskSpec leaves out where the key comes from: the same key can be moved
+// from the environment to the keystore.
+func (c *encryptDatastoreConfig) DiskSpec() DiskSpec {
+	return map[string]interface{}{
+		"type":  "encrypt",
+		"child": c.child.DiskSpec(),
+	}
+}
+
+func (c *encryptDatastoreConfig) Create(path string) (repo.Datastore, error) {
+	key, err := c.key(path)
+	if err != nil {
+		return nil, err
+	}
+	// Encrypted datastores are told apart by their child.
+	id := sha256.Sum256(c.DiskSpec().Bytes())
+	check := filepath.Join(repoRoot(path), fmt.Sprintf("encrypt-%x.check", id[:8]))
+	if err := checkEncryptionKey(check, key); err != nil {
+		return nil, err
+	}
+	codec, err := valuetransform.Encryption(key)
+	if err != nil {
+		return nil, err
+	}
+	child, err := c.child.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return valuetransform.Wrap(child, codec), nil
+}
+
+// key returns the encryption key. Keys from the keystore are hashed into an
+// encryption key, keys from the environment are used as is.
+func (c *encryptDatastoreConfig) key(path string) ([]byte, error) {
+	if c.keyEnv != "" {
+		v := os.Getenv(c.keyEnv)
+		if v == "" {
+			return nil, fmt.Errorf("datastore encryption key variable %s is not set", c.keyEnv)
+		}
+		key, err := hex.DecodeString(v)
+		if err != nil || len(key) != valuetransform.KeySize {
+			return nil, fmt.Errorf("%s must hold a hex encoded %d bytes key", c.keyEnv, valuetransform.KeySize)
+		}
+		return key, nil
+	}
+
+	ks, err := keystore.NewFSKeystore(filepath.Join(repoRoot(path), "keystore"))
+	if err != nil {
+		return nil, err
+	}
+	sk, err := ks.Get(c.keyName)
+	if err != nil {
+		return nil, fmt.Errorf("datastore encryption key %q: %s", c.keyName, err)
+	}
+	b, err := sk.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write([]byte("go-ipfs datastore encryption\x00"))
+	h.Write(b)
+	return h.Sum(nil), nil
+}
+
+// checkEncryptionKey makes sure key is the key the datastore was created
+// with, comparing its fingerprint with the one stored in the check file. The
+// check file is written on first use.
+func checkEncryptionKey(check string, key []byte) error {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("go-ipfs datastore encryption check"))
+	fingerprint := hex.EncodeToString(mac.Sum(nil))
+
+	b, err := ioutil.ReadFile(check)
+	switch {
+	case os.IsNotExist(err):
+		return ioutil.WriteFile(check, []byte(fingerprint+"\n"), 0600)
+	case err != nil:
+		return err
+	}
+	if !hmac.Equal(bytes.TrimSpace(b), []byte(fingerprint)) {
+		return fmt.Errorf("the datastore encryption key is not the one the datastore was created with (see %s)", check)
+	}
+	return nil
+}
+
+// datastoreKeys returns the names of the keys of the keystore that encrypt
+// datastores of spec.
+func datastoreKeys(spec map[string]interface{}) ([]string, error) {
+	dsc, err := AnyDatastoreConfig(spec)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	walkDatastoreConfigs(dsc, ds.NewKey("/"), func(c DatastoreConfig, _ ds.Key) {
+		if ec, ok := c.(*encryptDatastoreConfig); ok && ec.keyName != "" {
+			names = append(names, ec.keyName)
+		}
+	})
+	return names, nil
+}
+
+type mirrorDatastoreConfig struct {
+	replicas []DatastoreConfig
+	// unverified is set below value transforming datastores, whose stored
+	// values can't be checked against the block CIDs.
+	unverified bool
+
+	// ds is the datastore created from the config, for scrubbing.
+	ds *mirror.Datastore
+}
+
+// MirrorDatastoreConfig returns a mirror DatastoreConfig from a spec
+func MirrorDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error) {
+	replicas, ok := params["replicas"].([]interface{})
+	if !ok || len(replicas) == 0 {
+		return nil, fmt.Errorf("'replicas' field is missing or not a non-empty array")
+	}
+	var c mirrorDatastoreConfig
+	for _, iface := range replicas {
+		cfg, ok := iface.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected map for replica")
+		}
+		replica, err := AnyDatastoreConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		c.replicas = append(c.replicas, replica)
+	}
+	return &c, nil
+}
+
+func (c *mirrorDatastoreConfig) DiskSpec() DiskSpec {
+	replicas := make([]interface{}, len(c.replicas))
+	for i, r := range c.replicas {
+		replicas[i] = r.DiskSpec()
+	}
+	return map[string]interface{}{
+		"type":     "mirror",
+		"replicas": replicas,
+	}
+}
+
+func (c *mirrorDatastoreConfig) Create(path string) (repo.Datastore, error) {
+	var replicas []ds.Batching
+	for _, r := range c.replicas {
+		d, err := r.Create(path)
+		if err != nil {
+			for _, d := range replicas {
+				d.Close()
+			}
+			return nil, err
+		}
+		replicas = append(replicas, d)
+	}
+	// Mirrors are told apart by their replicas.
+	id := sha256.Sum256(c.DiskSpec().Bytes())
+	opts := mirror.Options{
+		Deleted: filepath.Join(repoRoot(path), fmt.Sprintf("mirror-%x.deleted", id[:8])),
+		Written: filepath.Join(repoRoot(path), fmt.Sprintf("mirror-%x.written", id[:8])),
+	}
+	if !c.unverified {
+		opts.Verify = verifyBlock
+	}
+	d, err := mirror.New(replicas, opts)
+	if err != nil {
+		for _, d := range replicas {
+			d.Close()
+		}
+		return nil, err
+	}
+	c.ds = d
+	return d, nil
+}
+
+// repoRoot returns the root of the repo datastores are created in: datastores
+// being converted to are created in the conversion directory of the repo.
+func repoRoot(path string) string {
+	if filepath.Base(path) == convertDir {
+		return filepath.Dir(path)
+	}
+	return path
+}
+
+// unverifiedMirrors turns off block verification in the mirrors below dsc,
+// which transforms the values they store.
+func unverifiedMirrors(dsc DatastoreConfig) {
+	walkDatastoreConfigs(dsc, ds.NewKey("/"), func(c DatastoreConfig, _ ds.Key) {
+		if mc, ok := c.(*mirrorDatastoreConfig); ok {
+			mc.unverified = true
+		}
+	})
+}
+
+// verifyBlock checks that the value of block keys hashes to their CID. Block
+// keys are checked whether the mirror is mounted at /blocks or above.
+func verifyBlock(key ds.Key, value []byte) (checked, valid bool) {
+	k := key.String()
+	if blocks := bstore.BlockPrefix.String() + "/"; strings.HasPrefix(k, blocks) {
+		k = k[len(blocks)-1:]
+	}
+	c, err := dshelp.DsKeyToCid(ds.RawKey(k))
+	if err != nil {
+		return false, false
+	}
+	sum, err := c.Prefix().Sum(value)
+	if err != nil {
+		return true, false
+	}
+	return true, sum.Equals(c)
+}
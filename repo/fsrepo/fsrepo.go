@@ -1,12 +1,14 @@
 package fsrepo
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -17,6 +19,8 @@ import (
 	"github.com/ipsn/go-ipfs/repo/common"
 	mfsr "github.com/ipsn/go-ipfs/repo/fsrepo/migrations"
 	dir "github.com/ipsn/go-ipfs/thirdparty/dir"
+	mirror "github.com/ipsn/go-ipfs/thirdparty/mirror"
+	tiered "github.com/ipsn/go-ipfs/thirdparty/tiered"
 
 	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
 	measure "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ds-measure"
@@ -87,6 +91,9 @@ var (
 	// daemon, `ipfs config` tries to save work by not building the
 	// full IpfsNode, but accessing the Repo directly.
 	onlyOne repo.OnlyOne
+
+	// openRepos maps the paths of the repos open in this process to them.
+	openRepos = make(map[string]*FSRepo)
 )
 
 // FSRepo represents an IPFS FileSystem Repo. It is safe for use by multiple
@@ -100,7 +107,11 @@ type FSRepo struct {
 	// the same fsrepo path concurrently
 	lockfile io.Closer
 	config   *config.Config
+	dsc      DatastoreConfig
 	ds       repo.Datastore
+	// sds is the datastore under the metrics wrapper of ds, swapped when
+	// the datastore is converted while the repo is open.
+	sds      *swappableDatastore
 	keystore keystore.Keystore
 	filemgr  *filestore.FileManager
 }
@@ -163,6 +174,10 @@ func open(repoPath string) (repo.Repo, error) {
 		return nil, err
 	}
 
+	if err := r.recoverSwap(); err != nil {
+		return nil, err
+	}
+
 	if err := r.openConfig(); err != nil {
 		return nil, err
 	}
@@ -182,6 +197,7 @@ func open(repoPath string) (repo.Repo, error) {
 	}
 
 	keepLocked = true
+	openRepos[r.path] = r
 	return r, nil
 }
 
@@ -353,6 +369,19 @@ func (r *FSRepo) Keystore() keystore.Keystore {
 	return r.keystore
 }
 
+// TenantKeystore returns the keystore of the tenant, stored under the tenants
+// directory of the repo.
+func (r *FSRepo) TenantKeystore(tenant string) (keystore.Keystore, error) {
+	if err := repo.CheckTenantName(tenant); err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(r.path, "tenants", tenant)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return keystore.NewFSKeystore(filepath.Join(dir, "keystore"))
+}
+
 func (r *FSRepo) Path() string {
 	return r.path
 }
@@ -390,11 +419,35 @@ func (r *FSRepo) openKeystore() error {
 		return err
 	}
 
-	r.keystore = ks
+	r.keystore = &repoKeystore{Keystore: ks, r: r}
 
 	return nil
 }
 
+// repoKeystore is the keystore of the repo. It refuses to delete the keys
+// encrypting the datastore.
+type repoKeystore struct {
+	keystore.Keystore
+	r *FSRepo
+}
+
+func (ks *repoKeystore) Delete(name string) error {
+	cfg, err := ks.r.Config()
+	if err != nil {
+		return err
+	}
+	names, err := datastoreKeys(cfg.Datastore.Spec)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if n == name {
+			return fmt.Errorf("key %q encrypts the datastore and cannot be removed", name)
+		}
+	}
+	return ks.Keystore.Delete(name)
+}
+
 // openDatastore returns an error if the config file is not present.
 func (r *FSRepo) openDatastore() error {
 	if r.config.Datastore.Type != "" || r.config.Datastore.Path != "" {
@@ -425,11 +478,12 @@ func (r *FSRepo) openDatastore() error {
 	if err != nil {
 		return err
 	}
-	r.ds = d
+	r.dsc = dsc
+	r.sds = &swappableDatastore{cur: d}
 
 	// Wrap it with metrics gathering
 	prefix := "ipfs.fsrepo.datastore"
-	r.ds = measure.New(prefix, r.ds)
+	r.ds = measure.New(prefix, r.sds)
 
 	return nil
 }
@@ -473,6 +527,7 @@ func (r *FSRepo) Close() error {
 	// logging.Configure(logging.Output(os.Stderr))
 
 	r.closed = true
+	delete(openRepos, r.path)
 	return r.lockfile.Close()
 }
 
@@ -682,6 +737,70 @@ func (r *FSRepo) GetStorageUsage() (uint64, error) {
 	return ds.DiskUsage(r.Datastore())
 }
 
+// DatastoreTiers returns the usage of the tiered datastores of the repo,
+// sorted by mountpoint.
+func (r *FSRepo) DatastoreTiers() ([]repo.TierStat, error) {
+	packageLock.Lock()
+	dsc := r.dsc
+	packageLock.Unlock()
+	if dsc == nil {
+		return nil, nil
+	}
+
+	var stats []repo.TierStat
+	var err error
+	walkDatastoreConfigs(dsc, ds.NewKey("/"), func(c DatastoreConfig, prefix ds.Key) {
+		tc, ok := c.(*tieredDatastoreConfig)
+		if !ok || tc.ds == nil || err != nil {
+			return
+		}
+		var s tiered.Stat
+		s, err = tc.ds.Stat()
+		stats = append(stats, repo.TierStat{Mountpoint: prefix.String(), Stat: s})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].Mountpoint < stats[j].Mountpoint
+	})
+	return stats, nil
+}
+
+// ScrubDatastores compares the replicas of the mirrored datastores of the
+// repo, verifying blocks against their CID.
+func (r *FSRepo) ScrubDatastores(ctx context.Context, repair bool, report func(repo.ScrubProblem)) ([]repo.ScrubStat, error) {
+	packageLock.Lock()
+	dsc := r.dsc
+	packageLock.Unlock()
+	if dsc == nil {
+		return nil, nil
+	}
+
+	type mounted struct {
+		prefix string
+		ds     *mirror.Datastore
+	}
+	var mirrors []mounted
+	walkDatastoreConfigs(dsc, ds.NewKey("/"), func(c DatastoreConfig, prefix ds.Key) {
+		if mc, ok := c.(*mirrorDatastoreConfig); ok && mc.ds != nil {
+			mirrors = append(mirrors, mounted{prefix.String(), mc.ds})
+		}
+	})
+
+	var stats []repo.ScrubStat
+	for _, m := range mirrors {
+		s, err := m.ds.Scrub(ctx, repair, func(p mirror.Problem) {
+			report(repo.ScrubProblem{Mountpoint: m.prefix, Problem: p})
+		})
+		if err != nil {
+			return stats, err
+		}
+		stats = append(stats, repo.ScrubStat{Mountpoint: m.prefix, ScrubStat: s})
+	}
+	return stats, nil
+}
+
 func (r *FSRepo) SwarmKey() ([]byte, error) {
 	repoPath := filepath.Clean(r.path)
 	spath := filepath.Join(repoPath, swarmKeyFile)
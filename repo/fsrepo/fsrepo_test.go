@@ -7,10 +7,12 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/ipsn/go-ipfs/keystore"
 	"github.com/ipsn/go-ipfs/thirdparty/assert"
 
 	datastore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
 	config "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-config"
+	ci "github.com/ipsn/go-ipfs/gxlibs/github.com/libp2p/go-libp2p-crypto"
 )
 
 // swap arg order
@@ -116,3 +118,31 @@ func TestOpenMoreThanOnceInSameProcess(t *testing.T) {
 	assert.Nil(r1.Close(), t)
 	assert.Nil(r2.Close(), t)
 }
+
+func TestDatastoreKeyNotRemovable(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("", t)
+	defer os.RemoveAll(path)
+
+	ks, err := keystore.NewFSKeystore(filepath.Join(path, "keystore"))
+	assert.Nil(err, t)
+	for _, name := range []string{"dskey", "other"} {
+		sk, _, err := ci.GenerateKeyPair(ci.Ed25519, 0)
+		assert.Nil(err, t)
+		assert.Nil(ks.Put(name, sk), t)
+	}
+
+	cfg := &config.Config{Datastore: config.DefaultDatastoreConfig()}
+	cfg.Datastore.Spec = map[string]interface{}{
+		"type":     "encrypt",
+		"keystore": "dskey",
+		"child":    map[string]interface{}{"type": "mem"},
+	}
+	assert.Nil(Init(path, cfg), t)
+	r, err := Open(path)
+	assert.Nil(err, t)
+	defer r.Close()
+
+	assert.Err(r.Keystore().Delete("dskey"), t, "the key encrypting the datastore should not be removable")
+	assert.Nil(r.Keystore().Delete("other"), t)
+}
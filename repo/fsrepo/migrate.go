@@ -0,0 +1,63 @@
+package fsrepo
+
+import (
+	"fmt"
+
+	repo "github.com/ipsn/go-ipfs/repo"
+	mfsr "github.com/ipsn/go-ipfs/repo/fsrepo/migrations"
+
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	lockfile "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-fs-lock"
+)
+
+// Migrate runs the built-in migrations moving the repo at repoPath to version
+// to, giving them access to the datastore configured in the repo. The repo
+// must not be in use.
+func Migrate(repoPath string, to int, opts mfsr.MigrateOptions) ([]mfsr.Step, error) {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	r, err := newFSRepo(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkInitialized(r.path); err != nil {
+		return nil, err
+	}
+
+	lock, err := lockfile.Lock(r.path, LockFile)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+
+	var d repo.Datastore
+	defer func() {
+		if d != nil {
+			d.Close()
+		}
+	}()
+
+	env := &mfsr.Env{
+		Path: mfsr.RepoPath(r.path),
+		Datastore: func() (ds.Batching, error) {
+			if d != nil {
+				return d, nil
+			}
+			// Earlier migrations may have changed the config.
+			if err := r.openConfig(); err != nil {
+				return nil, err
+			}
+			if r.config.Datastore.Spec == nil {
+				return nil, fmt.Errorf("required Datastore.Spec entry missing from config file")
+			}
+			dsc, err := AnyDatastoreConfig(r.config.Datastore.Spec)
+			if err != nil {
+				return nil, err
+			}
+			d, err = dsc.Create(r.path)
+			return d, err
+		},
+	}
+	return mfsr.Migrate(env, to, opts)
+}
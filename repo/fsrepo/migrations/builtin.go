@@ -0,0 +1,224 @@
+package mfsr
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+)
+
+// BackupDir is the directory, relative to the repo, holding the backups taken
+// before running built-in migrations.
+const BackupDir = "migration-backups"
+
+// backupFiles are the repo files saved before running built-in migrations.
+var backupFiles = []string{"config", VersionFile, "datastore_spec"}
+
+// Migration is a built-in migration moving a repo between Version-1 and
+// Version.
+type Migration struct {
+	// Version is the repo version Up migrates to, and Down migrates from.
+	Version int
+	// Description briefly describes what the migration changes.
+	Description string
+
+	Up   func(env *Env) error
+	Down func(env *Env) error
+}
+
+// Env gives migrations access to the repo being migrated.
+type Env struct {
+	Path RepoPath
+
+	// Datastore opens the repo datastore. It's nil when the datastore can't
+	// be opened.
+	Datastore func() (ds.Batching, error)
+}
+
+var builtin = make(map[int]*Migration)
+
+// Register adds a built-in migration.
+func Register(m *Migration) error {
+	if m.Version < 1 || m.Up == nil || m.Down == nil {
+		return fmt.Errorf("invalid migration to version %d", m.Version)
+	}
+	if _, ok := builtin[m.Version]; ok {
+		return fmt.Errorf("already have a migration to version %d", m.Version)
+	}
+	builtin[m.Version] = m
+	return nil
+}
+
+// Step is a built-in migration to run, reverted when migrating down.
+type Step struct {
+	*Migration
+	Revert bool
+}
+
+// run applies the step and records the resulting repo version.
+func (s Step) run(env *Env) error {
+	run, version := s.Up, s.Version
+	if s.Revert {
+		run, version = s.Down, s.Version-1
+	}
+	if err := run(env); err != nil {
+		return err
+	}
+	return env.Path.WriteVersion(version)
+}
+
+// undo reverts a step that ran.
+func (s Step) undo(env *Env) error {
+	return Step{s.Migration, !s.Revert}.run(env)
+}
+
+func (s Step) String() string {
+	if s.Revert {
+		return fmt.Sprintf("%d-to-%d: revert %s", s.Version, s.Version-1, s.Description)
+	}
+	return fmt.Sprintf("%d-to-%d: %s", s.Version-1, s.Version, s.Description)
+}
+
+// Plan returns the built-in migrations needed to move a repo from version
+// from to version to.
+func Plan(from, to int) ([]Step, error) {
+	var steps []Step
+	for v := from; v < to; v++ {
+		m, ok := builtin[v+1]
+		if !ok {
+			return nil, fmt.Errorf("no built-in migration from version %d to %d", v, v+1)
+		}
+		steps = append(steps, Step{Migration: m})
+	}
+	for v := from; v > to; v-- {
+		m, ok := builtin[v]
+		if !ok {
+			return nil, fmt.Errorf("no built-in migration from version %d to %d", v, v-1)
+		}
+		steps = append(steps, Step{Migration: m, Revert: true})
+	}
+	return steps, nil
+}
+
+// Versions returns the repo versions built-in migrations can migrate to,
+// in ascending order.
+func Versions() []int {
+	vs := make([]int, 0, len(builtin))
+	for v := range builtin {
+		vs = append(vs, v)
+	}
+	sort.Ints(vs)
+	return vs
+}
+
+// MigrateOptions configure a run of built-in migrations.
+type MigrateOptions struct {
+	// DryRun only reports the migrations that would run.
+	DryRun bool
+	// Out receives progress messages; defaults to ioutil.Discard.
+	Out io.Writer
+}
+
+// Migrate runs the built-in migrations moving the repo of env to version to.
+//
+// The config, version and datastore_spec files are backed up to BackupDir
+// first. If a migration fails, the ones that already ran are reverted and
+// the backed up files are restored.
+func Migrate(env *Env, to int, opts MigrateOptions) ([]Step, error) {
+	out := opts.Out
+	if out == nil {
+		out = ioutil.Discard
+	}
+
+	from, err := env.Path.Version()
+	if err != nil {
+		return nil, err
+	}
+	steps, err := Plan(from, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(steps) == 0 || opts.DryRun {
+		for _, s := range steps {
+			fmt.Fprintf(out, "  => Would run %s\n", s)
+		}
+		return steps, nil
+	}
+
+	backup, err := backupRepoFiles(env.Path, fmt.Sprintf("%d-to-%d-%d", from, to, time.Now().Unix()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up the repo: %s", err)
+	}
+	fmt.Fprintf(out, "  => Backed up the repo config to %s\n", backup)
+
+	for i, s := range steps {
+		fmt.Fprintf(out, "  => Running %s\n", s)
+		if err := s.run(env); err != nil {
+			fmt.Fprintf(out, "  => Failed: %s\n", err)
+			rollback(env, steps[:i], backup, out)
+			return nil, fmt.Errorf("migration %s failed: %s", s, err)
+		}
+	}
+
+	fmt.Fprintf(out, "  => Success: fs-repo has been migrated to version %d.\n", to)
+	return steps, nil
+}
+
+// rollback reverts the steps that already ran, then restores the files
+// backed up before migrating.
+func rollback(env *Env, steps []Step, backup string, out io.Writer) {
+	for i := len(steps) - 1; i >= 0; i-- {
+		fmt.Fprintf(out, "  => Reverting %s\n", steps[i])
+		if err := steps[i].undo(env); err != nil {
+			fmt.Fprintf(out, "  => Failed to revert: %s\n", err)
+		}
+	}
+	if err := restoreRepoFiles(env.Path, backup); err != nil {
+		fmt.Fprintf(out, "  => Failed to restore the backup in %s: %s\n", backup, err)
+		return
+	}
+	fmt.Fprintf(out, "  => Restored the repo from %s\n", backup)
+}
+
+// backupRepoFiles copies the backed up repo files to a new directory named
+// name in BackupDir and returns its path.
+func backupRepoFiles(rp RepoPath, name string) (string, error) {
+	dir := filepath.Join(string(rp), BackupDir, name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	for _, fn := range backupFiles {
+		err := copyFile(filepath.Join(string(rp), fn), filepath.Join(dir, fn))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+func restoreRepoFiles(rp RepoPath, dir string) error {
+	for _, fn := range backupFiles {
+		err := copyFile(filepath.Join(dir, fn), filepath.Join(string(rp), fn))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(from, to string) error {
+	b, err := ioutil.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(to, b, fi.Mode())
+}
@@ -0,0 +1,199 @@
+package mfsr
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	serialize "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-config/serialize"
+)
+
+// appendToConfig returns a migration function appending s to the test config.
+func appendToConfig(s string) func(*Env) error {
+	return func(env *Env) error {
+		fn := filepath.Join(string(env.Path), "config")
+		b, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(fn, append(b, s...), 0600)
+	}
+}
+
+func trimConfig(n int) func(*Env) error {
+	return func(env *Env) error {
+		fn := filepath.Join(string(env.Path), "config")
+		b, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(fn, b[:len(b)-n], 0600)
+	}
+}
+
+func init() {
+	for v := 1001; v <= 1002; v++ {
+		s := strconv.Itoa(v)
+		if err := Register(&Migration{
+			Version:     v,
+			Description: "test " + s,
+			Up:          appendToConfig(s),
+			Down:        trimConfig(len(s)),
+		}); err != nil {
+			panic(err)
+		}
+	}
+	if err := Register(&Migration{
+		Version:     1003,
+		Description: "failing test",
+		Up:          func(*Env) error { return errors.New("failed") },
+		Down:        func(*Env) error { return nil },
+	}); err != nil {
+		panic(err)
+	}
+}
+
+func TestBuiltinMigrations(t *testing.T) {
+	rp := testVersionFile("migrate", t)
+	defer os.RemoveAll(string(rp))
+	env := &Env{Path: rp}
+
+	config := filepath.Join(string(rp), "config")
+	checkRepo := func(version int, content string) {
+		t.Helper()
+		if err := rp.CheckVersion(version); err != nil {
+			t.Error(err)
+		}
+		b, err := ioutil.ReadFile(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != content {
+			t.Errorf("expected config %q, got %q", content, b)
+		}
+	}
+
+	if err := rp.WriteVersion(1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(config, []byte("config"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	steps, err := Migrate(env, 1002, MigrateOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 2 {
+		t.Fatalf("expected 2 steps, got %v", steps)
+	}
+	checkRepo(1000, "config")
+
+	if _, err := Migrate(env, 1002, MigrateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	checkRepo(1002, "config10011002")
+
+	backups, err := ioutil.ReadDir(filepath.Join(string(rp), BackupDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("expected a backup, got %d", len(backups))
+	}
+	b, err := ioutil.ReadFile(filepath.Join(string(rp), BackupDir, backups[0].Name(), "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "config" {
+		t.Errorf("expected the original config to be backed up, got %q", b)
+	}
+
+	steps, err = Migrate(env, 1001, MigrateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 1 || !steps[0].Revert {
+		t.Fatalf("expected a step down, got %v", steps)
+	}
+	checkRepo(1001, "config1001")
+
+	// 1001-to-1002 is reverted when 1002-to-1003 fails.
+	if _, err := Migrate(env, 1003, MigrateOptions{}); err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+	checkRepo(1001, "config1001")
+
+	if _, err := Plan(999, 1001); err == nil {
+		t.Error("expected an error when a migration is missing")
+	}
+}
+
+func TestMigration6To7(t *testing.T) {
+	rp := testVersionFile("migrate", t)
+	defer os.RemoveAll(string(rp))
+	env := &Env{Path: rp}
+	config := filepath.Join(string(rp), "config")
+
+	bootstrap := func() []interface{} {
+		var cfg map[string]interface{}
+		if err := serialize.ReadConfigFile(config, &cfg); err != nil {
+			t.Fatal(err)
+		}
+		if cfg["Other"] != "kept" {
+			t.Errorf("expected the rest of the config to be kept, got %v", cfg)
+		}
+		list, _ := cfg["Bootstrap"].([]interface{})
+		return list
+	}
+
+	custom := "/ip4/1.2.3.4/tcp/4001/ipfs/QmSoLer265NRgSp2LA3dPaeykiS1J6DifTC88f5uVQKNAd"
+	err := serialize.WriteConfigFile(config, map[string]interface{}{
+		"Bootstrap": []string{custom},
+		"Other":     "kept",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rp.WriteVersion(6); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Migrate(env, 7, MigrateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var expected []interface{}
+	for _, p := range dnsaddrBootstrapPeers {
+		expected = append(expected, p)
+	}
+	expected = append(expected, custom)
+	if list := bootstrap(); !reflect.DeepEqual(list, expected) {
+		t.Errorf("expected %v, got %v", expected, list)
+	}
+
+	if _, err := Migrate(env, 6, MigrateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if list := bootstrap(); !reflect.DeepEqual(list, []interface{}{custom}) {
+		t.Errorf("expected the dnsaddr peers to be removed, got %v", list)
+	}
+
+	// Custom bootstrap lists are left alone.
+	err = serialize.WriteConfigFile(config, map[string]interface{}{
+		"Bootstrap": []string{"/ip4/1.2.3.4/tcp/4001/ipfs/QmcZf59bWwK5XFi76CZX8cbJ4BhTzzA3gU1ZjYZcYW3dwt"},
+		"Other":     "kept",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Migrate(env, 7, MigrateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if list := bootstrap(); len(list) != 1 {
+		t.Errorf("expected a custom bootstrap list to be left alone, got %v", list)
+	}
+}
@@ -0,0 +1,114 @@
+package mfsr
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	serialize "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-config/serialize"
+)
+
+// dnsaddrBootstrapPeers are the bootstrap peers reached through
+// /dnsaddr/bootstrap.libp2p.io, added to the default bootstrap list in
+// repo version 7.
+var dnsaddrBootstrapPeers = []string{
+	"/dnsaddr/bootstrap.libp2p.io/ipfs/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN",
+	"/dnsaddr/bootstrap.libp2p.io/ipfs/QmQCU2EcMqAqQPR2i9bChDtGNJchTbq5TbXJJ16u19uLTa",
+	"/dnsaddr/bootstrap.libp2p.io/ipfs/QmbLHAnMoJPWSCR5Zhtx6BHJX9KiKNN6tpvbUcqanj75Nb",
+	"/dnsaddr/bootstrap.libp2p.io/ipfs/QmcZf59bWwK5XFi76CZX8cbJ4BhTzzA3gU1ZjYZcYW3dwt",
+}
+
+// defaultBootstrapPeerIDs identify the bootstrap peers that were part of the
+// default list before version 7. Repos bootstrapping from any of them are
+// assumed to use the defaults.
+var defaultBootstrapPeerIDs = []string{
+	"QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ",
+	"QmSoLPppuBtQSGwKDZT2M73ULpjvfd3aZ6ha4oFGL1KrGM",
+	"QmSoLSafTMBsPKadTEgaXctDQVcqN88CNLHXMkTNwMKPnu",
+	"QmSoLV4Bbm51jM9C4gDYZQ9Cy3U6aXMJDAbzgu2fzaDs64",
+	"QmSoLer265NRgSp2LA3dPaeykiS1J6DifTC88f5uVQKNAd",
+}
+
+func init() {
+	if err := Register(&Migration{
+		Version:     7,
+		Description: "add the /dnsaddr bootstrap peers to the default bootstrap list",
+		Up:          addDnsaddrBootstrapPeers,
+		Down:        removeDnsaddrBootstrapPeers,
+	}); err != nil {
+		panic(err)
+	}
+}
+
+func addDnsaddrBootstrapPeers(env *Env) error {
+	return editBootstrap(env, func(peers []string) []string {
+		usesDefaults := false
+		for _, p := range peers {
+			for _, id := range defaultBootstrapPeerIDs {
+				if strings.HasSuffix(p, "/"+id) {
+					usesDefaults = true
+				}
+			}
+		}
+		if !usesDefaults {
+			return peers
+		}
+
+		var added []string
+		for _, p := range dnsaddrBootstrapPeers {
+			if !containsString(peers, p) {
+				added = append(added, p)
+			}
+		}
+		return append(added, peers...)
+	})
+}
+
+func removeDnsaddrBootstrapPeers(env *Env) error {
+	return editBootstrap(env, func(peers []string) []string {
+		var kept []string
+		for _, p := range peers {
+			if !containsString(dnsaddrBootstrapPeers, p) {
+				kept = append(kept, p)
+			}
+		}
+		return kept
+	})
+}
+
+// editBootstrap rewrites the Bootstrap list of the repo config, leaving the
+// rest of the config untouched.
+func editBootstrap(env *Env, edit func([]string) []string) error {
+	fn := filepath.Join(string(env.Path), "config")
+	var cfg map[string]interface{}
+	if err := serialize.ReadConfigFile(fn, &cfg); err != nil {
+		return err
+	}
+
+	var peers []string
+	if list, ok := cfg["Bootstrap"].([]interface{}); ok {
+		for _, p := range list {
+			s, ok := p.(string)
+			if !ok {
+				return fmt.Errorf("invalid Bootstrap entry: %v", p)
+			}
+			peers = append(peers, s)
+		}
+	}
+
+	edited := edit(peers)
+	if edited == nil {
+		edited = []string{}
+	}
+	cfg["Bootstrap"] = edited
+	return serialize.WriteConfigFile(fn, cfg)
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
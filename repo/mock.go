@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"context"
 	"errors"
 
 	filestore "github.com/ipsn/go-ipfs/filestore"
@@ -17,6 +18,7 @@ type Mock struct {
 	C config.Config
 	D Datastore
 	K keystore.Keystore
+	T map[string]keystore.Keystore
 	F *filestore.FileManager
 }
 
@@ -45,12 +47,31 @@ func (m *Mock) Datastore() Datastore { return m.D }
 
 func (m *Mock) GetStorageUsage() (uint64, error) { return 0, nil }
 
+func (m *Mock) DatastoreTiers() ([]TierStat, error) { return nil, nil }
+
+func (m *Mock) ScrubDatastores(context.Context, bool, func(ScrubProblem)) ([]ScrubStat, error) {
+	return nil, nil
+}
+
 func (m *Mock) Close() error { return errTODO }
 
 func (m *Mock) SetAPIAddr(addr ma.Multiaddr) error { return errTODO }
 
 func (m *Mock) Keystore() keystore.Keystore { return m.K }
 
+func (m *Mock) TenantKeystore(tenant string) (keystore.Keystore, error) {
+	if err := CheckTenantName(tenant); err != nil {
+		return nil, err
+	}
+	if m.T == nil {
+		m.T = make(map[string]keystore.Keystore)
+	}
+	if m.T[tenant] == nil {
+		m.T[tenant] = keystore.NewMemKeystore()
+	}
+	return m.T[tenant], nil
+}
+
 func (m *Mock) SwarmKey() ([]byte, error) {
 	return nil, nil
 }
@@ -1,11 +1,16 @@
 package repo
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"regexp"
 
 	filestore "github.com/ipsn/go-ipfs/filestore"
 	keystore "github.com/ipsn/go-ipfs/keystore"
+	mirror "github.com/ipsn/go-ipfs/thirdparty/mirror"
+	tiered "github.com/ipsn/go-ipfs/thirdparty/tiered"
 
 	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
 	config "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-ipfs-config"
@@ -41,9 +46,21 @@ type Repo interface {
 	// GetStorageUsage returns the number of bytes stored.
 	GetStorageUsage() (uint64, error)
 
+	// DatastoreTiers returns the usage of the tiered datastores of the repo.
+	DatastoreTiers() ([]TierStat, error)
+
+	// ScrubDatastores compares the replicas of the mirrored datastores of
+	// the repo, reporting problems as they are found and repairing them if
+	// repair is set.
+	ScrubDatastores(ctx context.Context, repair bool, report func(ScrubProblem)) ([]ScrubStat, error)
+
 	// Keystore returns a reference to the key management interface.
 	Keystore() keystore.Keystore
 
+	// TenantKeystore returns a reference to the key management interface
+	// of the given tenant.
+	TenantKeystore(tenant string) (keystore.Keystore, error)
+
 	// FileManager returns a reference to the filestore file manager.
 	FileManager() *filestore.FileManager
 
@@ -56,6 +73,38 @@ type Repo interface {
 	io.Closer
 }
 
+var tenantNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// CheckTenantName returns an error if the tenant name is not made of letters,
+// digits, dashes and underscores only.
+func CheckTenantName(name string) error {
+	if !tenantNameRe.MatchString(name) {
+		return fmt.Errorf("invalid tenant name %q: only letters, digits, '-' and '_' are allowed", name)
+	}
+	return nil
+}
+
+// TierStat reports the usage of the tiers of a tiered datastore.
+type TierStat struct {
+	// Mountpoint is where the tiered datastore is mounted.
+	Mountpoint string
+	tiered.Stat
+}
+
+// ScrubProblem is a problem found in a replica of a mirrored datastore.
+type ScrubProblem struct {
+	// Mountpoint is where the mirrored datastore is mounted.
+	Mountpoint string
+	mirror.Problem
+}
+
+// ScrubStat sums up the scrub of a mirrored datastore.
+type ScrubStat struct {
+	// Mountpoint is where the mirrored datastore is mounted.
+	Mountpoint string
+	mirror.ScrubStat
+}
+
 // Datastore is the interface required from a datastore to be
 // acceptable to FSRepo.
 type Datastore interface {
@@ -0,0 +1,870 @@
+// Package mirror implements a datastore replicating its entries to several
+// child datastores, like RAID 1 does for disks.
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	query "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/query"
+	logging "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("mirror")
+
+// RetryInterval is how long a replica that failed is skipped by reads before
+// it is tried again.
+var RetryInterval = time.Minute
+
+// keyLocks is the number of locks serializing the writes to the keys.
+const keyLocks = 256
+
+// Options configure a mirrored datastore.
+type Options struct {
+	// Verify checks value against key. It returns whether the value could
+	// be checked and if so, whether it's valid. Values that can't be
+	// checked are trusted on reads and decided by majority when scrubbing.
+	Verify func(key ds.Key, value []byte) (checked, valid bool)
+
+	// Deleted is the file recording the keys that were deleted from some
+	// replicas only, because the others failed. These keys are deleted
+	// again rather than copied back to the replicas they were deleted
+	// from. If empty, they are only kept in memory.
+	Deleted string
+
+	// Written is the file recording the keys whose last value was written
+	// to some replicas only, with these replicas. These keys are only read
+	// from them, and copied to the others when read or scrubbed. If empty,
+	// they are only kept in memory.
+	Written string
+}
+
+// Datastore is a mirrored datastore.
+type Datastore struct {
+	replicas []ds.Batching
+	opts     Options
+
+	mu     sync.Mutex
+	failed []time.Time
+	// deleted holds the keys that were deleted from some replicas only.
+	deleted map[ds.Key]bool
+	// written holds the keys whose last value was written to some replicas
+	// only, with the indexes of these replicas.
+	written map[ds.Key][]int
+
+	// locks serialize the writes to the keys with the repairs of the
+	// written ones, each lock guarding the keys hashing to it.
+	locks [keyLocks]sync.Mutex
+}
+
+var _ ds.Batching = (*Datastore)(nil)
+var _ ds.PersistentDatastore = (*Datastore)(nil)
+
+// New returns a datastore mirroring its entries to all replicas.
+func New(replicas []ds.Batching, opts Options) (*Datastore, error) {
+	if len(replicas) == 0 {
+		return nil, errors.New("a mirror needs at least one replica")
+	}
+	d := &Datastore{
+		replicas: replicas,
+		opts:     opts,
+		failed:   make([]time.Time, len(replicas)),
+		deleted:  make(map[ds.Key]bool),
+		written:  make(map[ds.Key][]int),
+	}
+	if opts.Deleted != "" {
+		b, err := ioutil.ReadFile(opts.Deleted)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			var keys []string
+			if err := json.Unmarshal(b, &keys); err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", opts.Deleted, err)
+			}
+			for _, k := range keys {
+				d.deleted[ds.RawKey(k)] = true
+			}
+		}
+	}
+	if opts.Written != "" {
+		b, err := ioutil.ReadFile(opts.Written)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			var keys map[string][]int
+			if err := json.Unmarshal(b, &keys); err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", opts.Written, err)
+			}
+			for k, written := range keys {
+				for _, i := range written {
+					if i < 0 || i >= len(replicas) {
+						return nil, fmt.Errorf("invalid %s: no replica %d", opts.Written, i)
+					}
+				}
+				d.written[ds.RawKey(k)] = written
+			}
+		}
+	}
+	return d, nil
+}
+
+func (d *Datastore) lockIndex(key ds.Key) int {
+	h := fnv.New32a()
+	h.Write(key.Bytes())
+	return int(h.Sum32() % keyLocks)
+}
+
+func (d *Datastore) lock(key ds.Key) func() {
+	l := &d.locks[d.lockIndex(key)]
+	l.Lock()
+	return l.Unlock
+}
+
+func (d *Datastore) fail(i int, err error) {
+	log.Warningf("replica %d failed: %s", i, err)
+	d.mu.Lock()
+	d.failed[i] = time.Now()
+	d.mu.Unlock()
+}
+
+func (d *Datastore) succeed(i int) {
+	d.mu.Lock()
+	d.failed[i] = time.Time{}
+	d.mu.Unlock()
+}
+
+// order returns the indexes of the replicas, healthy ones first.
+func (d *Datastore) order() []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var healthy, failing []int
+	for i, t := range d.failed {
+		if t.IsZero() || time.Since(t) > RetryInterval {
+			healthy = append(healthy, i)
+		} else {
+			failing = append(failing, i)
+		}
+	}
+	return append(healthy, failing...)
+}
+
+// readOrder returns the indexes of the replicas to read a key from, healthy
+// ones first: only the ones in written, unless it's nil.
+func (d *Datastore) readOrder(written []int) []int {
+	order := d.order()
+	if written == nil {
+		return order
+	}
+	var indexes []int
+	for _, i := range order {
+		if contains(written, i) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+func contains(indexes []int, i int) bool {
+	for _, j := range indexes {
+		if i == j {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Datastore) isDeleted(key ds.Key) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.deleted[key]
+}
+
+// setDeleted records or forgets that the keys were deleted from some
+// replicas only.
+func (d *Datastore) setDeleted(keys []ds.Key, deleted bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	changed := false
+	for _, k := range keys {
+		if d.deleted[k] != deleted {
+			changed = true
+			if deleted {
+				d.deleted[k] = true
+			} else {
+				delete(d.deleted, k)
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	strs := make([]string, 0, len(d.deleted))
+	for k := range d.deleted {
+		strs = append(strs, k.String())
+	}
+	sort.Strings(strs)
+	return saveRecord(d.opts.Deleted, strs, len(strs) == 0)
+}
+
+// upToDate returns the replicas holding the last value of the key if it was
+// written to some replicas only, nil otherwise.
+func (d *Datastore) upToDate(key ds.Key) []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.written[key]
+}
+
+// setWritten records that the last values of the keys were written to the
+// given replicas only. If these are nil or all replicas, the keys are
+// forgotten.
+func (d *Datastore) setWritten(keys []ds.Key, replicas []int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	all := len(replicas) == 0 || len(replicas) == len(d.replicas)
+	changed := false
+	for _, k := range keys {
+		if all {
+			if _, ok := d.written[k]; ok {
+				delete(d.written, k)
+				changed = true
+			}
+		} else {
+			d.written[k] = replicas
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	record := make(map[string][]int, len(d.written))
+	for k, written := range d.written {
+		record[k.String()] = written
+	}
+	return saveRecord(d.opts.Written, record, len(record) == 0)
+}
+
+// saveRecord replaces the file at path with v, or removes it if empty is
+// set. Nothing is saved if path is empty.
+func saveRecord(path string, v interface{}, empty bool) error {
+	if path == "" {
+		return nil
+	}
+	if empty {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// deleteAll deletes the key from all replicas. It returns the first error and
+// whether the key is gone from any replica.
+func (d *Datastore) deleteAll(key ds.Key) (existed, gone bool, err error) {
+	for i, r := range d.replicas {
+		switch rerr := r.Delete(key); rerr {
+		case nil:
+			existed, gone = true, true
+		case ds.ErrNotFound:
+			gone = true
+		default:
+			d.fail(i, rerr)
+			if err == nil {
+				err = rerr
+			}
+		}
+	}
+	return existed, gone, err
+}
+
+// finishDelete deletes a key that was deleted from some replicas only from
+// the other ones.
+func (d *Datastore) finishDelete(key ds.Key) {
+	if _, _, err := d.deleteAll(key); err != nil {
+		return
+	}
+	if err := d.setDeleted([]ds.Key{key}, false); err != nil {
+		log.Warningf("failed to record the deletion of %s: %s", key, err)
+	}
+}
+
+func (d *Datastore) valid(key ds.Key, value []byte) bool {
+	if d.opts.Verify == nil {
+		return true
+	}
+	checked, valid := d.opts.Verify(key, value)
+	return !checked || valid
+}
+
+// repair writes the value to the replicas, and returns whether all of them
+// were written.
+func (d *Datastore) repair(key ds.Key, value []byte, replicas []int) bool {
+	ok := true
+	for _, i := range replicas {
+		if err := d.replicas[i].Put(key, value); err != nil {
+			d.fail(i, err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// Put writes the value to all replicas. It succeeds if at least one replica
+// was written and the replicas that were are recorded: the others only get
+// the value when it is read or scrubbed.
+func (d *Datastore) Put(key ds.Key, value []byte) error {
+	defer d.lock(key)()
+	if err := d.setDeleted([]ds.Key{key}, false); err != nil {
+		return err
+	}
+
+	var firstErr error
+	var written []int
+	for i, r := range d.replicas {
+		if err := r.Put(key, value); err != nil {
+			d.fail(i, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		d.succeed(i)
+		written = append(written, i)
+	}
+	if len(written) == 0 {
+		return firstErr
+	}
+	return d.setWritten([]ds.Key{key}, written)
+}
+
+// Get reads the value from the first healthy replica holding a valid value,
+// and repairs the replicas tried before it. A key written to some replicas
+// only is read from these, and copied to the others.
+func (d *Datastore) Get(key ds.Key) ([]byte, error) {
+	if d.isDeleted(key) {
+		d.finishDelete(key)
+		return nil, ds.ErrNotFound
+	}
+
+	written := d.upToDate(key)
+	if written != nil {
+		// Not to copy an older value over one being written.
+		defer d.lock(key)()
+		written = d.upToDate(key)
+	}
+
+	var bad []int
+	var lastErr error
+	for _, i := range d.readOrder(written) {
+		value, err := d.replicas[i].Get(key)
+		if err == ds.ErrNotFound {
+			bad = append(bad, i)
+			continue
+		} else if err != nil {
+			d.fail(i, err)
+			lastErr = err
+			continue
+		}
+		if !d.valid(key, value) {
+			log.Warningf("replica %d holds a corrupt value for %s", i, key)
+			bad = append(bad, i)
+			continue
+		}
+
+		d.repair(key, value, bad)
+		if written != nil {
+			var stale []int
+			for j := range d.replicas {
+				if !contains(written, j) {
+					stale = append(stale, j)
+				}
+			}
+			if d.repair(key, value, stale) {
+				if err := d.setWritten([]ds.Key{key}, nil); err != nil {
+					log.Warningf("failed to record the repair of %s: %s", key, err)
+				}
+			}
+		}
+		return value, nil
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, ds.ErrNotFound
+}
+
+// Has reports whether any replica holds the key, or any replica holding its
+// last value if it was written to some replicas only.
+func (d *Datastore) Has(key ds.Key) (bool, error) {
+	if d.isDeleted(key) {
+		d.finishDelete(key)
+		return false, nil
+	}
+
+	var lastErr error
+	for _, i := range d.readOrder(d.upToDate(key)) {
+		has, err := d.replicas[i].Has(key)
+		if err != nil {
+			d.fail(i, err)
+			lastErr = err
+			continue
+		}
+		if has {
+			return true, nil
+		}
+	}
+	return false, lastErr
+}
+
+// GetSize returns the size of the value in the first healthy replica holding
+// it, or holding its last value if it was written to some replicas only.
+func (d *Datastore) GetSize(key ds.Key) (int, error) {
+	if d.isDeleted(key) {
+		d.finishDelete(key)
+		return -1, ds.ErrNotFound
+	}
+
+	var lastErr error = ds.ErrNotFound
+	for _, i := range d.readOrder(d.upToDate(key)) {
+		size, err := d.replicas[i].GetSize(key)
+		if err == nil {
+			return size, nil
+		} else if err != ds.ErrNotFound {
+			d.fail(i, err)
+			lastErr = err
+		}
+	}
+	return -1, lastErr
+}
+
+// Delete removes the key from all replicas. If some replicas fail, it
+// succeeds if the others could be updated and the deletion was recorded: the
+// key is deleted from the failing replicas when it is accessed or scrubbed.
+func (d *Datastore) Delete(key ds.Key) error {
+	defer d.lock(key)()
+	existed, gone, err := d.deleteAll(key)
+	if gone {
+		if werr := d.setWritten([]ds.Key{key}, nil); werr != nil {
+			log.Warningf("failed to forget the write of %s: %s", key, werr)
+		}
+	}
+	if err == nil {
+		if !existed && !d.isDeleted(key) {
+			return ds.ErrNotFound
+		}
+		return d.setDeleted([]ds.Key{key}, false)
+	}
+	if !gone {
+		return err
+	}
+	if rerr := d.setDeleted([]ds.Key{key}, true); rerr != nil {
+		log.Errorf("failed to record the deletion of %s: %s", key, rerr)
+		return err
+	}
+	return nil
+}
+
+// Query returns the entries of all replicas, each key once. The values of
+// keys written to some replicas only are read like Get does.
+func (d *Datastore) Query(q query.Query) (query.Results, error) {
+	inner := query.Query{Prefix: q.Prefix, KeysOnly: q.KeysOnly}
+	order := d.order()
+	var cur query.Results
+	var replica int
+	seen := make(map[string]bool)
+
+	res := query.ResultsFromIterator(q, query.Iterator{
+		Next: func() (query.Result, bool) {
+			for {
+				if cur == nil {
+					if len(order) == 0 {
+						return query.Result{}, false
+					}
+					var err error
+					replica = order[0]
+					cur, err = d.replicas[replica].Query(inner)
+					order = order[1:]
+					if err != nil {
+						cur = nil
+						return query.Result{Error: err}, true
+					}
+				}
+				r, ok := cur.NextSync()
+				if !ok {
+					cur.Close()
+					cur = nil
+					continue
+				}
+				if r.Error != nil {
+					return r, true
+				}
+				if seen[r.Key] || d.isDeleted(ds.RawKey(r.Key)) {
+					continue
+				}
+				seen[r.Key] = true
+				if written := d.upToDate(ds.RawKey(r.Key)); !q.KeysOnly && written != nil && !contains(written, replica) {
+					value, err := d.Get(ds.RawKey(r.Key))
+					if err == ds.ErrNotFound {
+						continue
+					} else if err != nil {
+						return query.Result{Error: err}, true
+					}
+					r.Value = value
+				}
+				return r, true
+			}
+		},
+		Close: func() error {
+			if cur != nil {
+				return cur.Close()
+			}
+			return nil
+		},
+	})
+
+	return query.NaiveQueryApply(q, res), nil
+}
+
+// Batch returns a batch writing to all replicas.
+func (d *Datastore) Batch() (ds.Batch, error) {
+	b := &batch{d: d, locks: make(map[int]bool)}
+	for _, r := range d.replicas {
+		rb, err := r.Batch()
+		if err != nil {
+			return nil, err
+		}
+		b.batches = append(b.batches, rb)
+	}
+	return b, nil
+}
+
+type batch struct {
+	d       *Datastore
+	batches []ds.Batch
+	puts    []ds.Key
+	deletes []ds.Key
+	// locks of the keys written, taken while committing
+	locks map[int]bool
+}
+
+func (b *batch) Put(key ds.Key, value []byte) error {
+	b.puts = append(b.puts, key)
+	b.locks[b.d.lockIndex(key)] = true
+	for _, rb := range b.batches {
+		if err := rb.Put(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *batch) Delete(key ds.Key) error {
+	b.deletes = append(b.deletes, key)
+	b.locks[b.d.lockIndex(key)] = true
+	for _, rb := range b.batches {
+		if err := rb.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit commits the batch on all replicas. Like Put, it succeeds if at least
+// one replica committed it, recording the writes and deletions that the other
+// replicas missed.
+func (b *batch) Commit() error {
+	locks := make([]int, 0, len(b.locks))
+	for i := range b.locks {
+		locks = append(locks, i)
+	}
+	// in order, not to deadlock with other batches
+	sort.Ints(locks)
+	for _, i := range locks {
+		b.d.locks[i].Lock()
+		defer b.d.locks[i].Unlock()
+	}
+
+	if err := b.d.setDeleted(b.puts, false); err != nil {
+		return err
+	}
+
+	var firstErr error
+	var committed []int
+	for i, rb := range b.batches {
+		if err := rb.Commit(); err != nil {
+			b.d.fail(i, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		committed = append(committed, i)
+	}
+	if len(committed) == 0 {
+		return firstErr
+	}
+	if err := b.d.setWritten(b.puts, committed); err != nil {
+		return err
+	}
+	if err := b.d.setWritten(b.deletes, nil); err != nil {
+		return err
+	}
+	return b.d.setDeleted(b.deletes, len(committed) < len(b.batches))
+}
+
+// DiskUsage returns the disk usage of all replicas.
+func (d *Datastore) DiskUsage() (uint64, error) {
+	var total uint64
+	for _, r := range d.replicas {
+		du, err := ds.DiskUsage(r)
+		if err != nil {
+			return 0, err
+		}
+		total += du
+	}
+	return total, nil
+}
+
+// Close closes all replicas.
+func (d *Datastore) Close() error {
+	var firstErr error
+	for _, r := range d.replicas {
+		if err := r.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Kinds of problems found by Scrub.
+const (
+	Missing    = "missing"
+	Divergent  = "divergent"
+	Corrupt    = "corrupt"
+	Unreadable = "unreadable"
+	// Undeleted is a key left on a replica that failed to delete it.
+	Undeleted = "undeleted"
+)
+
+// Problem is a problem with an entry of a replica.
+type Problem struct {
+	Key string
+	// Replica is the index of the replica.
+	Replica int
+	// Kind is one of Missing, Divergent, Corrupt, Unreadable or Undeleted.
+	Kind  string
+	Error string `json:",omitempty"`
+	// Repaired is whether the entry of the replica was rewritten.
+	Repaired bool
+}
+
+// ScrubStat sums up a scrub.
+type ScrubStat struct {
+	Keys     int
+	Problems int
+	Repaired int
+}
+
+// Scrub compares the entries of all replicas, reporting problems as they are
+// found. Valid values are the ones passing Options.Verify or, when they can't
+// be verified, the value most replicas agree on, except for keys written to
+// some replicas only, whose valid value is the one of these replicas. If
+// repair is set, replicas missing the valid value are rewritten, and keys that
+// were deleted from some replicas only are deleted from the others.
+func (d *Datastore) Scrub(ctx context.Context, repair bool, report func(Problem)) (ScrubStat, error) {
+	var stat ScrubStat
+	for i, r := range d.replicas {
+		res, err := r.Query(query.Query{KeysOnly: true})
+		if err != nil {
+			return stat, err
+		}
+		for e := range res.Next() {
+			if err := ctx.Err(); err != nil {
+				res.Close()
+				return stat, err
+			}
+			if e.Error != nil {
+				res.Close()
+				return stat, e.Error
+			}
+			key := ds.RawKey(e.Key)
+
+			// Keys of earlier replicas were scrubbed already.
+			done := false
+			for _, prev := range d.replicas[:i] {
+				if has, _ := prev.Has(key); has {
+					done = true
+					break
+				}
+			}
+			if done {
+				continue
+			}
+
+			stat.Keys++
+			for _, p := range d.scrubKey(key, repair) {
+				stat.Problems++
+				if p.Repaired {
+					stat.Repaired++
+				}
+				report(p)
+			}
+		}
+		res.Close()
+	}
+	return stat, nil
+}
+
+func (d *Datastore) scrubKey(key ds.Key, repair bool) []Problem {
+	if d.isDeleted(key) {
+		return d.scrubDeleted(key, repair)
+	}
+
+	written := d.upToDate(key)
+	if written != nil {
+		defer d.lock(key)()
+		written = d.upToDate(key)
+	}
+
+	values := make([][]byte, len(d.replicas))
+	errs := make([]error, len(d.replicas))
+	missing := 0
+	for i, r := range d.replicas {
+		values[i], errs[i] = r.Get(key)
+		if errs[i] == ds.ErrNotFound {
+			missing++
+		}
+	}
+	if missing == len(d.replicas) {
+		// Deleted while scrubbing.
+		return nil
+	}
+
+	// Pick the valid value: the first verified one, or the most common one.
+	var valid []byte
+	found := false
+	votes := 0
+	for i, v := range values {
+		if errs[i] != nil {
+			continue
+		}
+		if written != nil {
+			// The last value is only on the replicas it was written to.
+			if !found && contains(written, i) && d.valid(key, v) {
+				valid, found = v, true
+			}
+			continue
+		}
+		if d.opts.Verify != nil {
+			if checked, ok := d.opts.Verify(key, v); checked {
+				if ok && !found {
+					valid, found = v, true
+					votes = len(values)
+				}
+				continue
+			}
+		}
+		n := 0
+		for j, w := range values {
+			if errs[j] == nil && bytes.Equal(v, w) {
+				n++
+			}
+		}
+		if n > votes {
+			valid, found, votes = v, true, n
+		}
+	}
+
+	var problems []Problem
+	complete := true
+	for i, v := range values {
+		p := Problem{Key: key.String(), Replica: i}
+		switch {
+		case errs[i] == ds.ErrNotFound:
+			p.Kind = Missing
+		case errs[i] != nil:
+			p.Kind = Unreadable
+			p.Error = errs[i].Error()
+		case found && bytes.Equal(v, valid):
+			continue
+		case !d.valid(key, v):
+			p.Kind = Corrupt
+		default:
+			p.Kind = Divergent
+		}
+
+		if repair && found && p.Kind != Unreadable {
+			if err := d.replicas[i].Put(key, valid); err != nil {
+				p.Error = err.Error()
+			} else {
+				p.Repaired = true
+			}
+		}
+		if !p.Repaired {
+			complete = false
+		}
+		problems = append(problems, p)
+	}
+
+	if written != nil && found && complete {
+		if err := d.setWritten([]ds.Key{key}, nil); err != nil {
+			log.Warningf("failed to record the repair of %s: %s", key, err)
+		}
+	}
+	return problems
+}
+
+// scrubDeleted reports the replicas still holding a key that was deleted from
+// the others, and deletes it from them if repair is set.
+func (d *Datastore) scrubDeleted(key ds.Key, repair bool) []Problem {
+	var problems []Problem
+	for i, r := range d.replicas {
+		has, err := r.Has(key)
+		if !has && err == nil {
+			continue
+		}
+		p := Problem{Key: key.String(), Replica: i, Kind: Undeleted}
+		if err != nil {
+			p.Kind = Unreadable
+			p.Error = err.Error()
+		}
+		if repair {
+			if err := r.Delete(key); err != nil && err != ds.ErrNotFound {
+				p.Error = err.Error()
+			} else {
+				p.Repaired = true
+			}
+		}
+		problems = append(problems, p)
+	}
+
+	if repair || len(problems) == 0 {
+		d.finishDelete(key)
+	}
+	return problems
+}
@@ -0,0 +1,305 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	failstore "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/failstore"
+	query "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/query"
+	dstest "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/test"
+)
+
+// verifyPrefix accepts values that start with the last namespace of their key,
+// and can't check keys under /unchecked.
+func verifyPrefix(key ds.Key, value []byte) (bool, bool) {
+	if strings.HasPrefix(key.String(), "/unchecked") {
+		return false, false
+	}
+	return true, strings.HasPrefix(string(value), key.BaseNamespace())
+}
+
+func newTestMirror(t *testing.T, n int) (*Datastore, []ds.Batching) {
+	var replicas []ds.Batching
+	for i := 0; i < n; i++ {
+		replicas = append(replicas, ds.NewMapDatastore())
+	}
+	d, err := New(replicas, Options{Verify: verifyPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, replicas
+}
+
+func TestSuite(t *testing.T) {
+	d, err := New([]ds.Batching{ds.NewMapDatastore(), ds.NewMapDatastore()}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstest.SubtestAll(t, d)
+}
+
+func TestReadRepair(t *testing.T) {
+	d, replicas := newTestMirror(t, 3)
+	key := ds.NewKey("/a")
+	if err := d.Put(key, []byte("a-value")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first replica lost the entry, the second one holds a corrupt value.
+	replicas[0].Delete(key)
+	replicas[1].Put(key, []byte("corrupt"))
+
+	v, err := d.Get(key)
+	if err != nil || string(v) != "a-value" {
+		t.Fatalf("expected the valid value, got %q, %v", v, err)
+	}
+	for i, r := range replicas {
+		if v, err := r.Get(key); err != nil || string(v) != "a-value" {
+			t.Errorf("expected replica %d to be repaired, got %q, %v", i, v, err)
+		}
+	}
+}
+
+func TestFailingReplica(t *testing.T) {
+	broken := failstore.NewFailstore(ds.NewMapDatastore(), func(string) error {
+		return errors.New("disk failure")
+	})
+	healthy := ds.NewMapDatastore()
+	d, err := New([]ds.Batching{broken, healthy}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := ds.NewKey("/a")
+	if err := d.Put(key, []byte("a")); err != nil {
+		t.Fatalf("expected writes to succeed with one healthy replica, got %v", err)
+	}
+	if v, err := d.Get(key); err != nil || string(v) != "a" {
+		t.Fatalf("expected to read from the healthy replica, got %q, %v", v, err)
+	}
+	if order := d.order(); order[0] != 1 {
+		t.Errorf("expected the failing replica to be tried last, got %v", order)
+	}
+}
+
+func TestScrub(t *testing.T) {
+	ctx := context.Background()
+	d, replicas := newTestMirror(t, 3)
+	for _, k := range []string{"/a", "/b", "/unchecked"} {
+		if err := d.Put(ds.NewKey(k), []byte(k[1:]+"-value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	replicas[0].Delete(ds.NewKey("/a"))
+	replicas[0].Put(ds.NewKey("/b"), []byte("corrupt"))
+	replicas[2].Put(ds.NewKey("/unchecked"), []byte("divergent"))
+
+	var problems []Problem
+	stat, err := d.Scrub(ctx, false, func(p Problem) { problems = append(problems, p) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Keys != 3 || stat.Problems != 3 || stat.Repaired != 0 {
+		t.Fatalf("unexpected stat %+v, problems %+v", stat, problems)
+	}
+	kinds := make(map[string]string)
+	for _, p := range problems {
+		kinds[p.Key] = p.Kind
+	}
+	expected := map[string]string{"/a": Missing, "/b": Corrupt, "/unchecked": Divergent}
+	for k, kind := range expected {
+		if kinds[k] != kind {
+			t.Errorf("expected %s to be %s, got %q", k, kind, kinds[k])
+		}
+	}
+
+	stat, err = d.Scrub(ctx, true, func(Problem) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Repaired != 3 {
+		t.Fatalf("expected 3 repairs, got %+v", stat)
+	}
+	stat, err = d.Scrub(ctx, false, func(Problem) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Problems != 0 {
+		t.Fatalf("expected the replicas to be repaired, got %+v", stat)
+	}
+	if v, _ := replicas[2].Get(ds.NewKey("/unchecked")); string(v) != "unchecked-value" {
+		t.Errorf("expected the majority value to win, got %q", v)
+	}
+}
+
+func TestFailedDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mirror-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opts := Options{Deleted: filepath.Join(dir, "deleted")}
+
+	failing := true
+	broken := failstore.NewFailstore(ds.NewMapDatastore(), func(op string) error {
+		if failing && op == "delete" {
+			return errors.New("disk failure")
+		}
+		return nil
+	})
+	healthy := ds.NewMapDatastore()
+	d, err := New([]ds.Batching{broken, healthy}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := ds.NewKey("/a")
+	if err := d.Put(key, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete(key); err != nil {
+		t.Fatalf("expected the delete to succeed with one healthy replica, got %v", err)
+	}
+
+	// The key isn't copied back to the healthy replica, even after a restart.
+	d, err = New([]ds.Batching{broken, healthy}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Get(key); err != ds.ErrNotFound {
+		t.Fatalf("expected the key to stay deleted, got %v", err)
+	}
+	if has, _ := healthy.Has(key); has {
+		t.Fatal("expected the key not to be copied back to the healthy replica")
+	}
+	res, err := d.Query(query.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := res.Rest(); len(entries) != 0 {
+		t.Fatalf("expected no entries, got %v", entries)
+	}
+
+	var problems []Problem
+	if _, err := d.Scrub(context.Background(), true, func(p Problem) { problems = append(problems, p) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Kind != Undeleted || problems[0].Repaired {
+		t.Fatalf("expected the undeleted key to be reported, got %+v", problems)
+	}
+
+	failing = false
+	stat, err := d.Scrub(context.Background(), true, func(Problem) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Repaired != 1 {
+		t.Fatalf("expected the key to be deleted, got %+v", stat)
+	}
+	if has, _ := broken.Has(key); has {
+		t.Error("expected the key to be deleted from the recovered replica")
+	}
+	if _, err := os.Stat(opts.Deleted); !os.IsNotExist(err) {
+		t.Error("expected the record of the deletion to be removed")
+	}
+}
+
+func TestPartialWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mirror-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opts := Options{Verify: verifyPrefix, Written: filepath.Join(dir, "written")}
+
+	failing := false
+	var replicas []ds.Batching
+	for i := 0; i < 2; i++ {
+		replicas = append(replicas, failstore.NewFailstore(ds.NewMapDatastore(), func(op string) error {
+			if failing && op == "put" {
+				return errors.New("disk failure")
+			}
+			return nil
+		}))
+	}
+	replicas = append(replicas, ds.NewMapDatastore())
+	d, err := New(replicas, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The values of these keys can't be checked, most replicas hold the old
+	// ones.
+	keys := []ds.Key{ds.NewKey("/unchecked/a"), ds.NewKey("/unchecked/b")}
+	for _, key := range keys {
+		if err := d.Put(key, []byte("old")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	failing = true
+	for _, key := range keys {
+		if err := d.Put(key, []byte("new")); err != nil {
+			t.Fatalf("expected the write to succeed with one healthy replica, got %v", err)
+		}
+	}
+	failing = false
+
+	// The new values are still read after a restart.
+	d, err = New(replicas, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := d.Query(query.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", entries)
+	}
+	for _, e := range entries {
+		if string(e.Value) != "new" {
+			t.Errorf("expected the new value of %s, got %q", e.Key, e.Value)
+		}
+	}
+	if v, err := d.Get(keys[0]); err != nil || string(v) != "new" {
+		t.Fatalf("expected the new value, got %q, %v", v, err)
+	}
+	for i, r := range replicas {
+		if v, err := r.Get(keys[0]); err != nil || string(v) != "new" {
+			t.Errorf("expected replica %d to be repaired, got %q, %v", i, v, err)
+		}
+	}
+
+	failing = true
+	if err := d.Put(keys[1], []byte("newer")); err != nil {
+		t.Fatal(err)
+	}
+	failing = false
+	var problems []Problem
+	stat, err := d.Scrub(context.Background(), true, func(p Problem) { problems = append(problems, p) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Problems != 2 || stat.Repaired != 2 {
+		t.Fatalf("expected 2 repairs, got %+v, %+v", stat, problems)
+	}
+	for i, r := range replicas {
+		if v, err := r.Get(keys[1]); err != nil || string(v) != "newer" {
+			t.Errorf("expected replica %d to get the newer value, got %q, %v", i, v, err)
+		}
+	}
+	if _, err := os.Stat(opts.Written); !os.IsNotExist(err) {
+		t.Error("expected the record of the writes to be removed")
+	}
+}
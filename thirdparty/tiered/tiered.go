@@ -0,0 +1,554 @@
+// Package tiered implements a datastore spreading its entries over a fast
+// "hot" and a slow "cold" datastore.
+//
+// Writes always land on the hot tier. Entries that haven't been read or
+// written for a while are moved to the cold tier in the background, and
+// entries read from the cold tier are moved back to the hot one.
+//
+// The access times of the entries of the hot tier are stored on the hot tier
+// itself, under keys prefixed with accessPrefix, so that they survive
+// restarts.
+package tiered
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	query "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/query"
+	logging "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("tiered")
+
+// accessPrefix prefixes the keys the access times are stored under on the hot
+// tier. It has no '/' so that it's a valid flatfs key.
+const accessPrefix = "/TIERED-ACCESS-"
+
+// keyLocks is the number of locks serializing the writes to the keys.
+const keyLocks = 256
+
+// Options configure a tiered datastore.
+type Options struct {
+	// ColdAfter is how long an entry must not have been accessed before it
+	// is moved to the cold tier.
+	ColdAfter time.Duration
+	// MigrateInterval is how often the hot tier is checked for entries to
+	// move to the cold tier. Zero disables background migration, Migrate
+	// has to be called instead.
+	MigrateInterval time.Duration
+}
+
+// Stat reports the usage of both tiers.
+type Stat struct {
+	// HotSize and ColdSize are the disk usage of the tiers, in bytes.
+	HotSize  uint64
+	ColdSize uint64
+	// HotReads and ColdReads count the entries read from each tier.
+	HotReads  uint64
+	ColdReads uint64
+	// Demoted counts the entries moved to the cold tier, Promoted the ones
+	// moved back to the hot tier.
+	Demoted  uint64
+	Promoted uint64
+}
+
+// Datastore is a tiered datastore.
+type Datastore struct {
+	hot, cold ds.Batching
+	opts      Options
+
+	// Access times of the entries of the hot tier since the last migration,
+	// which stores them on the hot tier.
+	mu       sync.Mutex
+	accessed map[ds.Key]time.Time
+
+	// locks serialize the moves of an entry between the tiers with the
+	// writes to it, each lock guarding the keys hashing to it.
+	locks [keyLocks]sync.Mutex
+	// migrating serializes the migrations.
+	migrating sync.Mutex
+
+	hotReads, coldReads uint64
+	demoted, promoted   uint64
+
+	closing chan struct{}
+	done    chan struct{}
+}
+
+var _ ds.Batching = (*Datastore)(nil)
+var _ ds.PersistentDatastore = (*Datastore)(nil)
+
+// New returns a datastore tiering entries between hot and cold, and starts
+// moving idle entries to the cold tier if opts.MigrateInterval is set.
+func New(hot, cold ds.Batching, opts Options) *Datastore {
+	d := &Datastore{
+		hot:      hot,
+		cold:     cold,
+		opts:     opts,
+		accessed: make(map[ds.Key]time.Time),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if opts.MigrateInterval > 0 {
+		go d.migrateLoop()
+	} else {
+		close(d.done)
+	}
+	return d
+}
+
+func (d *Datastore) touch(key ds.Key) {
+	d.mu.Lock()
+	d.accessed[key] = time.Now()
+	d.mu.Unlock()
+}
+
+func (d *Datastore) forget(key ds.Key) {
+	d.mu.Lock()
+	delete(d.accessed, key)
+	d.mu.Unlock()
+}
+
+func accessKey(key ds.Key) ds.Key {
+	return ds.RawKey(accessPrefix + strings.TrimPrefix(key.String(), "/"))
+}
+
+func isAccessKey(key string) bool {
+	return strings.HasPrefix(key, accessPrefix)
+}
+
+func encodeAccess(t time.Time) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(t.UnixNano()))
+	return buf
+}
+
+// storedAccess returns the access time of key stored on the hot tier, or a
+// zero time if there is none.
+func (d *Datastore) storedAccess(key ds.Key) (time.Time, error) {
+	buf, err := d.hot.Get(accessKey(key))
+	if err == ds.ErrNotFound || (err == nil && len(buf) != 8) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(buf))), nil
+}
+
+func (d *Datastore) lockIndex(key ds.Key) int {
+	h := fnv.New32a()
+	h.Write(key.Bytes())
+	return int(h.Sum32() % keyLocks)
+}
+
+func (d *Datastore) lock(key ds.Key) func() {
+	l := &d.locks[d.lockIndex(key)]
+	l.Lock()
+	return l.Unlock
+}
+
+// Put stores the value on the hot tier.
+func (d *Datastore) Put(key ds.Key, value []byte) error {
+	defer d.lock(key)()
+	if err := d.hot.Put(key, value); err != nil {
+		return err
+	}
+	d.touch(key)
+	return nil
+}
+
+// Get reads the value from the hot tier, falling back to the cold tier. Values
+// read from the cold tier are moved to the hot tier.
+func (d *Datastore) Get(key ds.Key) ([]byte, error) {
+	value, err := d.hot.Get(key)
+	if err == nil {
+		atomic.AddUint64(&d.hotReads, 1)
+		d.touch(key)
+		return value, nil
+	} else if err != ds.ErrNotFound {
+		return nil, err
+	}
+	return d.getCold(key)
+}
+
+// getCold reads the value from the cold tier and moves it to the hot tier.
+// The key is locked so that the entry isn't written or deleted in between.
+func (d *Datastore) getCold(key ds.Key) ([]byte, error) {
+	defer d.lock(key)()
+
+	// The entry may have been written or promoted since the hot tier was
+	// read.
+	value, err := d.hot.Get(key)
+	if err == nil {
+		atomic.AddUint64(&d.hotReads, 1)
+		d.touch(key)
+		return value, nil
+	} else if err != ds.ErrNotFound {
+		return nil, err
+	}
+
+	value, err = d.cold.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddUint64(&d.coldReads, 1)
+	if err := d.promote(key, value); err != nil {
+		log.Warningf("failed to move %s to the hot tier: %s", key, err)
+	}
+	return value, nil
+}
+
+// promote moves an entry read from the cold tier to the hot tier, the key
+// must be locked.
+func (d *Datastore) promote(key ds.Key, value []byte) error {
+	if err := d.hot.Put(key, value); err != nil {
+		return err
+	}
+	d.touch(key)
+	if err := d.cold.Delete(key); err != nil && err != ds.ErrNotFound {
+		return err
+	}
+	atomic.AddUint64(&d.promoted, 1)
+	return nil
+}
+
+// Has checks both tiers for the key. It doesn't count as an access.
+func (d *Datastore) Has(key ds.Key) (bool, error) {
+	has, err := d.hot.Has(key)
+	if err != nil || has {
+		return has, err
+	}
+	return d.cold.Has(key)
+}
+
+// GetSize returns the size of the value from whichever tier holds it. It
+// doesn't count as an access.
+func (d *Datastore) GetSize(key ds.Key) (int, error) {
+	size, err := d.hot.GetSize(key)
+	if err != ds.ErrNotFound {
+		return size, err
+	}
+	return d.cold.GetSize(key)
+}
+
+// Delete removes the key from both tiers.
+func (d *Datastore) Delete(key ds.Key) error {
+	defer d.lock(key)()
+	d.forget(key)
+	hotErr := d.hot.Delete(key)
+	if hotErr != nil && hotErr != ds.ErrNotFound {
+		return hotErr
+	}
+	if err := d.hot.Delete(accessKey(key)); err != nil && err != ds.ErrNotFound {
+		return err
+	}
+	coldErr := d.cold.Delete(key)
+	if coldErr != nil && coldErr != ds.ErrNotFound {
+		return coldErr
+	}
+	if hotErr == ds.ErrNotFound && coldErr == ds.ErrNotFound {
+		return ds.ErrNotFound
+	}
+	return nil
+}
+
+// Query returns the entries of both tiers. Keys present on both tiers while
+// they're being moved are only returned once, the stored access times aren't
+// returned.
+func (d *Datastore) Query(q query.Query) (query.Results, error) {
+	inner := query.Query{Prefix: q.Prefix, KeysOnly: q.KeysOnly}
+	hot, err := d.hot.Query(inner)
+	if err != nil {
+		return nil, err
+	}
+	cold, err := d.cold.Query(inner)
+	if err != nil {
+		hot.Close()
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	inHot := true
+	res := query.ResultsFromIterator(q, query.Iterator{
+		Next: func() (query.Result, bool) {
+			for inHot {
+				r, ok := hot.NextSync()
+				if !ok {
+					inHot = false
+					break
+				}
+				if r.Error == nil {
+					if isAccessKey(r.Key) {
+						continue
+					}
+					seen[r.Key] = true
+				}
+				return r, true
+			}
+			for {
+				r, ok := cold.NextSync()
+				if !ok || r.Error != nil || !seen[r.Key] {
+					return r, ok
+				}
+			}
+		},
+		Close: func() error {
+			err := hot.Close()
+			if cerr := cold.Close(); err == nil {
+				err = cerr
+			}
+			return err
+		},
+	})
+
+	return query.NaiveQueryApply(q, res), nil
+}
+
+// Batch returns a batch writing to the hot tier and deleting from both tiers.
+func (d *Datastore) Batch() (ds.Batch, error) {
+	hot, err := d.hot.Batch()
+	if err != nil {
+		return nil, err
+	}
+	cold, err := d.cold.Batch()
+	if err != nil {
+		return nil, err
+	}
+	return &batch{d: d, hot: hot, cold: cold, locks: make(map[int]bool)}, nil
+}
+
+type batch struct {
+	d         *Datastore
+	hot, cold ds.Batch
+	// locks of the keys written, taken while committing
+	locks map[int]bool
+}
+
+func (b *batch) Put(key ds.Key, value []byte) error {
+	b.locks[b.d.lockIndex(key)] = true
+	b.d.touch(key)
+	return b.hot.Put(key, value)
+}
+
+func (b *batch) Delete(key ds.Key) error {
+	b.locks[b.d.lockIndex(key)] = true
+	b.d.forget(key)
+	if err := b.hot.Delete(key); err != nil {
+		return err
+	}
+	if err := b.hot.Delete(accessKey(key)); err != nil {
+		return err
+	}
+	return b.cold.Delete(key)
+}
+
+func (b *batch) Commit() error {
+	locks := make([]int, 0, len(b.locks))
+	for i := range b.locks {
+		locks = append(locks, i)
+	}
+	// in order, not to deadlock with other batches
+	sort.Ints(locks)
+	for _, i := range locks {
+		b.d.locks[i].Lock()
+		defer b.d.locks[i].Unlock()
+	}
+
+	if err := b.hot.Commit(); err != nil {
+		return err
+	}
+	return b.cold.Commit()
+}
+
+// Migrate moves the entries of the hot tier that haven't been accessed for
+// ColdAfter to the cold tier and returns how many were moved. Entries without
+// a stored access time, e.g. written before an unclean shutdown, count as
+// accessed when first seen by Migrate.
+func (d *Datastore) Migrate() (int, error) {
+	d.migrating.Lock()
+	defer d.migrating.Unlock()
+
+	if err := d.storeAccessed(); err != nil {
+		return 0, err
+	}
+
+	res, err := d.hot.Query(query.Query{KeysOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	cutoff := now.Add(-d.opts.ColdAfter)
+	var idle []ds.Key
+	for r := range res.Next() {
+		if r.Error != nil {
+			res.Close()
+			return 0, r.Error
+		}
+		if isAccessKey(r.Key) {
+			continue
+		}
+		key := ds.RawKey(r.Key)
+		t, err := d.storedAccess(key)
+		if err != nil {
+			res.Close()
+			return 0, err
+		}
+		if t.IsZero() {
+			if err := d.hot.Put(accessKey(key), encodeAccess(now)); err != nil {
+				res.Close()
+				return 0, err
+			}
+			continue
+		}
+		if !t.After(cutoff) {
+			idle = append(idle, key)
+		}
+	}
+	res.Close()
+
+	moved := 0
+	for _, key := range idle {
+		select {
+		case <-d.closing:
+			return moved, nil
+		default:
+		}
+		if err := d.demote(key, cutoff); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// storeAccessed stores the access times recorded since the last migration on
+// the hot tier.
+func (d *Datastore) storeAccessed() error {
+	d.mu.Lock()
+	accessed := d.accessed
+	d.accessed = make(map[ds.Key]time.Time)
+	d.mu.Unlock()
+
+	b, err := d.hot.Batch()
+	if err == nil {
+		for key, t := range accessed {
+			if err = b.Put(accessKey(key), encodeAccess(t)); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = b.Commit()
+	}
+	if err != nil {
+		// keep the access times for the next migration
+		d.mu.Lock()
+		for key, t := range accessed {
+			if cur, ok := d.accessed[key]; !ok || t.After(cur) {
+				d.accessed[key] = t
+			}
+		}
+		d.mu.Unlock()
+	}
+	return err
+}
+
+func (d *Datastore) demote(key ds.Key, cutoff time.Time) error {
+	defer d.lock(key)()
+
+	value, err := d.hot.Get(key)
+	if err == ds.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := d.cold.Put(key, value); err != nil {
+		return err
+	}
+
+	// Reads of the hot tier aren't locked, the entry may have been read
+	// while it was copied.
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t, ok := d.accessed[key]; ok && t.After(cutoff) {
+		return nil
+	}
+	delete(d.accessed, key)
+	if err := d.hot.Delete(key); err != nil && err != ds.ErrNotFound {
+		return err
+	}
+	if err := d.hot.Delete(accessKey(key)); err != nil && err != ds.ErrNotFound {
+		return err
+	}
+	atomic.AddUint64(&d.demoted, 1)
+	return nil
+}
+
+func (d *Datastore) migrateLoop() {
+	defer close(d.done)
+	ticker := time.NewTicker(d.opts.MigrateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n, err := d.Migrate()
+			if err != nil {
+				log.Errorf("moving entries to the cold tier: %s", err)
+			} else if n > 0 {
+				log.Infof("moved %d entries to the cold tier", n)
+			}
+		case <-d.closing:
+			return
+		}
+	}
+}
+
+// Stat returns the usage of the tiers.
+func (d *Datastore) Stat() (Stat, error) {
+	hot, err := ds.DiskUsage(d.hot)
+	if err != nil {
+		return Stat{}, err
+	}
+	cold, err := ds.DiskUsage(d.cold)
+	if err != nil {
+		return Stat{}, err
+	}
+	return Stat{
+		HotSize:   hot,
+		ColdSize:  cold,
+		HotReads:  atomic.LoadUint64(&d.hotReads),
+		ColdReads: atomic.LoadUint64(&d.coldReads),
+		Demoted:   atomic.LoadUint64(&d.demoted),
+		Promoted:  atomic.LoadUint64(&d.promoted),
+	}, nil
+}
+
+// DiskUsage returns the disk usage of both tiers.
+func (d *Datastore) DiskUsage() (uint64, error) {
+	s, err := d.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return s.HotSize + s.ColdSize, nil
+}
+
+// Close stops moving entries to the cold tier and closes both tiers.
+func (d *Datastore) Close() error {
+	select {
+	case <-d.closing:
+	default:
+		close(d.closing)
+	}
+	<-d.done
+	err := d.hot.Close()
+	if cerr := d.cold.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
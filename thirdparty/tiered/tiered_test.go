@@ -0,0 +1,232 @@
+package tiered
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	query "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/sync"
+)
+
+func newTestDatastore(coldAfter time.Duration) (d *Datastore, hot, cold ds.Batching) {
+	hot = dssync.MutexWrap(ds.NewMapDatastore())
+	cold = dssync.MutexWrap(ds.NewMapDatastore())
+	return New(hot, cold, Options{ColdAfter: coldAfter}), hot, cold
+}
+
+func has(t *testing.T, d ds.Datastore, key ds.Key) bool {
+	t.Helper()
+	ok, err := d.Has(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
+
+func TestTiers(t *testing.T) {
+	d, hot, cold := newTestDatastore(time.Hour)
+	defer d.Close()
+
+	a, b := ds.NewKey("/a"), ds.NewKey("/b")
+	if err := d.Put(a, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Put(b, []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if !has(t, hot, a) || has(t, cold, a) {
+		t.Fatal("expected writes to land on the hot tier")
+	}
+
+	// Nothing is idle yet.
+	if n, err := d.Migrate(); err != nil || n != 0 {
+		t.Fatalf("expected no entries to be moved, got %d, %v", n, err)
+	}
+
+	d.opts.ColdAfter = 0
+	if n, err := d.Migrate(); err != nil || n != 2 {
+		t.Fatalf("expected 2 entries to be moved, got %d, %v", n, err)
+	}
+	if has(t, hot, a) || !has(t, cold, a) {
+		t.Fatal("expected idle entries to be moved to the cold tier")
+	}
+	if !has(t, d, a) {
+		t.Fatal("expected the tiered datastore to find entries on the cold tier")
+	}
+
+	v, err := d.Get(a)
+	if err != nil || string(v) != "a" {
+		t.Fatalf("expected to read %q, got %q, %v", "a", v, err)
+	}
+	if !has(t, hot, a) || has(t, cold, a) {
+		t.Fatal("expected entries read from the cold tier to move to the hot tier")
+	}
+
+	res, err := d.Query(query.Query{KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected the entries of both tiers, got %v", entries)
+	}
+
+	if err := d.Delete(b); err != nil {
+		t.Fatal(err)
+	}
+	if has(t, d, b) {
+		t.Fatal("expected the entry to be deleted")
+	}
+	if err := d.Delete(b); err != ds.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	s, err := d.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ColdReads != 1 || s.Demoted != 2 || s.Promoted != 1 {
+		t.Fatalf("unexpected stat %+v", s)
+	}
+}
+
+func TestQueryDuplicates(t *testing.T) {
+	d, hot, cold := newTestDatastore(time.Hour)
+	defer d.Close()
+
+	// An entry on both tiers, as while it's being moved.
+	key := ds.NewKey("/dup")
+	if err := hot.Put(key, []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cold.Put(key, []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cold.Put(ds.NewKey("/other"), []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := d.Query(query.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", entries)
+	}
+}
+
+func TestMigrateInterval(t *testing.T) {
+	hot := dssync.MutexWrap(ds.NewMapDatastore())
+	cold := dssync.MutexWrap(ds.NewMapDatastore())
+	d := New(hot, cold, Options{MigrateInterval: 10 * time.Millisecond})
+
+	key := ds.NewKey("/a")
+	if err := d.Put(key, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; has(t, hot, key); i++ {
+		if i == 100 {
+			t.Fatal("expected the entry to be moved in the background")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAccessTimesPersist(t *testing.T) {
+	d, hot, cold := newTestDatastore(50 * time.Millisecond)
+
+	key := ds.NewKey("/a")
+	if err := d.Put(key, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := d.Migrate(); err != nil || n != 0 {
+		t.Fatalf("expected no entries to be moved, got %d, %v", n, err)
+	}
+
+	res, err := d.Query(query.Query{KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Key != "/a" {
+		t.Fatalf("expected the stored access times not to be listed, got %v", entries)
+	}
+
+	// A restart doesn't count as an access.
+	time.Sleep(60 * time.Millisecond)
+	d = New(hot, cold, Options{ColdAfter: 50 * time.Millisecond})
+	if n, err := d.Migrate(); err != nil || n != 1 {
+		t.Fatalf("expected 1 entry to be moved, got %d, %v", n, err)
+	}
+	if has(t, hot, key) || has(t, hot, accessKey(key)) {
+		t.Fatal("expected the entry and its access time to leave the hot tier")
+	}
+}
+
+func TestUnknownAccessTime(t *testing.T) {
+	d, hot, _ := newTestDatastore(0)
+	defer d.Close()
+
+	// An entry whose access time was not stored counts as accessed when
+	// first seen.
+	key := ds.NewKey("/a")
+	if err := hot.Put(key, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := d.Migrate(); err != nil || n != 0 {
+		t.Fatalf("expected no entries to be moved, got %d, %v", n, err)
+	}
+	if n, err := d.Migrate(); err != nil || n != 1 {
+		t.Fatalf("expected 1 entry to be moved, got %d, %v", n, err)
+	}
+}
+
+func TestDeleteWhilePromoting(t *testing.T) {
+	d, _, cold := newTestDatastore(time.Hour)
+	defer d.Close()
+
+	var keys []ds.Key
+	for i := 0; i < 200; i++ {
+		key := ds.NewKey(fmt.Sprintf("/k%d", i))
+		if err := cold.Put(key, []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(2)
+		go func(key ds.Key) {
+			defer wg.Done()
+			d.Get(key)
+		}(key)
+		go func(key ds.Key) {
+			defer wg.Done()
+			d.Delete(key)
+		}(key)
+	}
+	wg.Wait()
+
+	for _, key := range keys {
+		if has(t, d, key) {
+			t.Fatalf("expected %s to stay deleted", key)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package valuetransform
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+)
+
+// Compression algorithms. There is no zstd: the pure Go implementations need a
+// newer Go than go-ipfs supports and the cgo bindings would require cgo, so
+// gzip stands in for a slower algorithm with a better ratio.
+const (
+	Snappy = "snappy"
+	Gzip   = "gzip"
+)
+
+// Headers of compressed values. Values that don't compress are stored as is,
+// behind their own header.
+const (
+	headerRaw byte = iota
+	headerCompressed
+)
+
+type compression struct {
+	compress   func([]byte) ([]byte, error)
+	decompress func([]byte) ([]byte, error)
+}
+
+// Compression returns a codec compressing values with the algorithm.
+func Compression(algorithm string) (Codec, error) {
+	switch algorithm {
+	case Snappy:
+		return &compression{
+			compress: func(b []byte) ([]byte, error) {
+				return snappy.Encode(nil, b), nil
+			},
+			decompress: func(b []byte) ([]byte, error) {
+				return snappy.Decode(nil, b)
+			},
+		}, nil
+	case Gzip:
+		return &compression{
+			compress: func(b []byte) ([]byte, error) {
+				var buf bytes.Buffer
+				w := gzip.NewWriter(&buf)
+				if _, err := w.Write(b); err != nil {
+					return nil, err
+				}
+				if err := w.Close(); err != nil {
+					return nil, err
+				}
+				return buf.Bytes(), nil
+			},
+			decompress: func(b []byte) ([]byte, error) {
+				r, err := gzip.NewReader(bytes.NewReader(b))
+				if err != nil {
+					return nil, err
+				}
+				return ioutil.ReadAll(r)
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm %q, expected %q or %q", algorithm, Snappy, Gzip)
+	}
+}
+
+func (c *compression) Encode(_ ds.Key, value []byte) ([]byte, error) {
+	compressed, err := c.compress(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(compressed) >= len(value) {
+		return append([]byte{headerRaw}, value...), nil
+	}
+	return append([]byte{headerCompressed}, compressed...), nil
+}
+
+func (c *compression) Decode(key ds.Key, stored []byte) ([]byte, error) {
+	if len(stored) == 0 {
+		return nil, fmt.Errorf("compressed value of %s is empty", key)
+	}
+	switch stored[0] {
+	case headerRaw:
+		return stored[1:], nil
+	case headerCompressed:
+		value, err := c.decompress(stored[1:])
+		if err != nil {
+			return nil, fmt.Errorf("decompressing value of %s: %s", key, err)
+		}
+		return value, nil
+	default:
+		return nil, fmt.Errorf("value of %s is not compressed", key)
+	}
+}
@@ -0,0 +1,54 @@
+package valuetransform
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+)
+
+// KeySize is the size of the keys used to encrypt values, selecting AES-256.
+const KeySize = 32
+
+type encryption struct {
+	aead cipher.AEAD
+}
+
+// Encryption returns a codec encrypting values with AES-GCM. Values are bound
+// to their datastore key, so they can't be moved to another key unnoticed.
+func Encryption(key []byte) (Codec, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("expected a %d bytes encryption key, got %d bytes", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &encryption{aead}, nil
+}
+
+func (e *encryption) Encode(key ds.Key, value []byte) ([]byte, error) {
+	nonce := make([]byte, e.aead.NonceSize(), e.aead.NonceSize()+len(value)+e.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return e.aead.Seal(nonce, nonce, value, key.Bytes()), nil
+}
+
+func (e *encryption) Decode(key ds.Key, stored []byte) ([]byte, error) {
+	n := e.aead.NonceSize()
+	if len(stored) < n {
+		return nil, fmt.Errorf("encrypted value of %s is too short", key)
+	}
+	value, err := e.aead.Open(nil, stored[:n], stored[n:], key.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("decrypting value of %s: %s", key, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,121 @@
+// Package valuetransform implements a datastore wrapper transforming the
+// values written to its child datastore, for example to compress or encrypt
+// them.
+package valuetransform
+
+import (
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	query "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/query"
+)
+
+// Codec transforms values on their way to and from the child datastore.
+type Codec interface {
+	// Encode returns the value to store for key.
+	Encode(key ds.Key, value []byte) ([]byte, error)
+	// Decode returns the value of key from what was stored.
+	Decode(key ds.Key, stored []byte) ([]byte, error)
+}
+
+// Datastore encodes the values written to its child datastore.
+type Datastore struct {
+	child ds.Batching
+	codec Codec
+}
+
+var _ ds.Batching = (*Datastore)(nil)
+var _ ds.PersistentDatastore = (*Datastore)(nil)
+
+// Wrap returns a datastore encoding the values written to child with codec.
+func Wrap(child ds.Batching, codec Codec) *Datastore {
+	return &Datastore{child: child, codec: codec}
+}
+
+func (d *Datastore) Put(key ds.Key, value []byte) error {
+	stored, err := d.codec.Encode(key, value)
+	if err != nil {
+		return err
+	}
+	return d.child.Put(key, stored)
+}
+
+func (d *Datastore) Get(key ds.Key) ([]byte, error) {
+	stored, err := d.child.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return d.codec.Decode(key, stored)
+}
+
+func (d *Datastore) Has(key ds.Key) (bool, error) {
+	return d.child.Has(key)
+}
+
+// GetSize returns the size of the decoded value, which requires reading it.
+func (d *Datastore) GetSize(key ds.Key) (int, error) {
+	value, err := d.Get(key)
+	if err != nil {
+		return -1, err
+	}
+	return len(value), nil
+}
+
+func (d *Datastore) Delete(key ds.Key) error {
+	return d.child.Delete(key)
+}
+
+// Query queries the child datastore and decodes the values. Filters and orders
+// are applied to the decoded entries.
+func (d *Datastore) Query(q query.Query) (query.Results, error) {
+	cres, err := d.child.Query(query.Query{Prefix: q.Prefix, KeysOnly: q.KeysOnly})
+	if err != nil {
+		return nil, err
+	}
+
+	res := query.ResultsFromIterator(q, query.Iterator{
+		Next: func() (query.Result, bool) {
+			r, ok := cres.NextSync()
+			if !ok || r.Error != nil || q.KeysOnly {
+				return r, ok
+			}
+			value, err := d.codec.Decode(ds.RawKey(r.Key), r.Value)
+			if err != nil {
+				return query.Result{Error: err}, true
+			}
+			r.Value = value
+			return r, true
+		},
+		Close: cres.Close,
+	})
+
+	return query.NaiveQueryApply(q, res), nil
+}
+
+func (d *Datastore) Batch() (ds.Batch, error) {
+	b, err := d.child.Batch()
+	if err != nil {
+		return nil, err
+	}
+	return &batch{Batch: b, codec: d.codec}, nil
+}
+
+// DiskUsage returns the disk usage of the child datastore.
+func (d *Datastore) DiskUsage() (uint64, error) {
+	return ds.DiskUsage(d.child)
+}
+
+func (d *Datastore) Close() error {
+	return d.child.Close()
+}
+
+type batch struct {
+	ds.Batch
+	codec Codec
+}
+
+func (b *batch) Put(key ds.Key, value []byte) error {
+	stored, err := b.codec.Encode(key, value)
+	if err != nil {
+		return err
+	}
+	return b.Batch.Put(key, stored)
+}
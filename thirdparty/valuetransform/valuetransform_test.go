@@ -0,0 +1,110 @@
+package valuetransform
+
+import (
+	"bytes"
+	"testing"
+
+	ds "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore"
+	dstest "github.com/ipsn/go-ipfs/gxlibs/github.com/ipfs/go-datastore/test"
+)
+
+func testKey() []byte {
+	return bytes.Repeat([]byte{7}, KeySize)
+}
+
+func TestSuite(t *testing.T) {
+	enc, err := Encryption(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	codecs := map[string]Codec{"encryption": enc}
+	for _, alg := range []string{Snappy, Gzip} {
+		c, err := Compression(alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		codecs[alg] = c
+	}
+
+	for name, c := range codecs {
+		t.Run(name, func(t *testing.T) {
+			dstest.SubtestAll(t, Wrap(ds.NewMapDatastore(), c))
+		})
+	}
+}
+
+func TestCompression(t *testing.T) {
+	child := ds.NewMapDatastore()
+	c, err := Compression(Snappy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := Wrap(child, c)
+
+	compressible := ds.NewKey("/compressible")
+	value := bytes.Repeat([]byte("ipfs"), 1024)
+	if err := d.Put(compressible, value); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := child.Get(compressible)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) >= len(value) {
+		t.Errorf("expected the value to be compressed, stored %d bytes", len(stored))
+	}
+
+	incompressible := ds.NewKey("/incompressible")
+	if err := d.Put(incompressible, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := d.Get(incompressible); err != nil || string(v) != "a" {
+		t.Errorf("expected %q, got %q, %v", "a", v, err)
+	}
+
+	if _, err := Compression("zip"); err == nil {
+		t.Error("expected an error for an unknown algorithm")
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	child := ds.NewMapDatastore()
+	c, err := Encryption(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := Wrap(child, c)
+
+	a, b := ds.NewKey("/a"), ds.NewKey("/b")
+	value := []byte("private data")
+	if err := d.Put(a, value); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := child.Get(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stored, value) {
+		t.Fatal("expected the value to be encrypted at rest")
+	}
+
+	// Values can't be moved to another key.
+	if err := child.Put(b, stored); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Get(b); err == nil {
+		t.Error("expected an error reading a value moved to another key")
+	}
+
+	other, err := Encryption(bytes.Repeat([]byte{8}, KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Wrap(child, other).Get(a); err == nil {
+		t.Error("expected an error decrypting with another key")
+	}
+
+	if _, err := Encryption([]byte("short")); err == nil {
+		t.Error("expected an error for a short key")
+	}
+}